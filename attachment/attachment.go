@@ -191,6 +191,51 @@ func ResolveAttachmentsWithRemotes(
 	return attachments, remotes, nil
 }
 
+// PreviewAttachments is ResolveAttachmentsWithRemotes without the uploads.
+//
+// Attachments that already exist remotely get their links, so that a document
+// referring to them compiles as it would when published. The names of those
+// that would be created or updated are returned alongside; they keep no link,
+// which leaves the document's reference to them as written.
+func PreviewAttachments(
+	attachments []Attachment,
+	remotes []confluence.AttachmentInfo,
+) ([]Attachment, []string, error) {
+	var pending []string
+	for i := range attachments {
+		if attachments[i].Checksum == "" {
+			checksum, err := GetChecksum(bytes.NewReader(attachments[i].FileBytes))
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to get checksum for attachment %q: %w", attachments[i].Name, err)
+			}
+			attachments[i].Checksum = checksum
+		}
+
+		found := false
+		for _, remote := range remotes {
+			if remote.Filename != attachments[i].Filename {
+				continue
+			}
+
+			found = true
+			attachments[i].ID = remote.ID
+			attachments[i].Link = path.Join(remote.Links.Context, remote.Links.Download)
+
+			if attachments[i].Checksum != strings.TrimPrefix(remote.Metadata.Comment, AttachmentChecksumPrefix) {
+				pending = append(pending, attachments[i].Filename)
+			}
+
+			break
+		}
+
+		if !found {
+			pending = append(pending, attachments[i].Filename)
+		}
+	}
+
+	return attachments, pending, nil
+}
+
 func ResolveLocalAttachments(opener vfs.Opener, base string, replacements []string) ([]Attachment, error) {
 	attachments, err := prepareAttachments(opener, base, replacements)
 	if err != nil {
@@ -254,6 +299,11 @@ func prepareAttachment(opener vfs.Opener, base, name string) (Attachment, error)
 			attachment.Width = strconv.Itoa(config.Width)
 			attachment.Height = strconv.Itoa(config.Height)
 		}
+	case ".svg":
+		if width, height, err := SVGSize(fileBytes); err == nil {
+			attachment.Width = strconv.Itoa(width)
+			attachment.Height = strconv.Itoa(height)
+		}
 	}
 
 	return attachment, nil
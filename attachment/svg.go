@@ -0,0 +1,76 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SVGSize returns the size an SVG image is drawn at: its root element's width
+// and height, or the size of its viewBox when they are not given in pixels --
+// Mermaid's are "100%", which says nothing about the drawing.
+func SVGSize(data []byte) (int, int, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return 0, 0, fmt.Errorf("there is no svg element")
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("unable to parse the SVG: %w", err)
+		}
+
+		root, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root.Name.Local != "svg" {
+			return 0, 0, fmt.Errorf("the image is a %s, not an svg", root.Name.Local)
+		}
+
+		var width, height, viewBox string
+		for _, attribute := range root.Attr {
+			switch attribute.Name.Local {
+			case "width":
+				width = attribute.Value
+			case "height":
+				height = attribute.Value
+			case "viewBox":
+				viewBox = attribute.Value
+			}
+		}
+
+		w, wOK := pixels(width)
+		h, hOK := pixels(height)
+		if wOK && hOK {
+			return w, h, nil
+		}
+
+		box := strings.FieldsFunc(viewBox, func(r rune) bool { return r == ',' || r == ' ' })
+		if len(box) == 4 {
+			w, errW := strconv.ParseFloat(box[2], 64)
+			h, errH := strconv.ParseFloat(box[3], 64)
+			if errW == nil && errH == nil && w > 0 && h > 0 {
+				return int(math.Ceil(w)), int(math.Ceil(h)), nil
+			}
+		}
+
+		return 0, 0, fmt.Errorf("the svg has neither a width and height in pixels nor a viewBox")
+	}
+}
+
+// pixels reads a length given in pixels, with or without the unit.
+func pixels(length string) (int, bool) {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(length), "px"), 64)
+	if err != nil || value <= 0 {
+		return 0, false
+	}
+
+	return int(math.Ceil(value)), true
+}
@@ -0,0 +1,29 @@
+package attachment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSVGSize(t *testing.T) {
+	for svg, want := range map[string][2]int{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="120" height="80"></svg>`:                                        {120, 80},
+		`<?xml version="1.0"?><!-- drawn --><svg width="120.5px" height="80px" viewBox="0 0 10 10"></svg>`:              {121, 80},
+		`<svg id="mermaid" width="100%" style="max-width: 523px;" viewBox="-8 -8 523.25 234" role="graphics-document">`: {524, 234},
+		`<svg viewBox="0,0,64,32"><svg width="1" height="1"></svg></svg>`:                                               {64, 32},
+	} {
+		width, height, err := SVGSize([]byte(svg))
+		assert.NoError(t, err, svg)
+		assert.Equal(t, want, [2]int{width, height}, svg)
+	}
+
+	for svg, message := range map[string]string{
+		`<html></html>`:      "the image is a html, not an svg",
+		`<svg width="100%">`: "the svg has neither a width and height in pixels nor a viewBox",
+		"not an image":       "there is no svg element",
+	} {
+		_, _, err := SVGSize([]byte(svg))
+		assert.ErrorContains(t, err, message, svg)
+	}
+}
@@ -31,6 +31,109 @@ func main() {
 		HideHelpCommand:       true,
 		Before:                util.CheckFlags,
 		Action:                util.RunMark,
+		Commands: []*cli.Command{
+			{
+				Name:   "diff",
+				Usage:  "show how publishing would change each page, and exit non-zero if it would.",
+				Action: util.RunDiff,
+			},
+			{
+				Name:   "plan",
+				Usage:  "work out what publishing would do and save it for apply.",
+				Flags:  util.PlanFlags,
+				Action: util.RunPlan,
+			},
+			{
+				Name:      "apply",
+				Usage:     "publish exactly what a saved plan describes, or refuse if it is out of date.",
+				ArgsUsage: "<plan-file>",
+				Action:    util.RunApply,
+			},
+			{
+				Name:   "preview",
+				Usage:  "serve the files as web pages showing how they would look once published.",
+				Flags:  util.PreviewFlags,
+				Action: util.RunPreview,
+			},
+			{
+				Name:   "validate",
+				Usage:  "check the files for everything a publish would fail on, without connecting to Confluence.",
+				Action: util.RunValidate,
+			},
+			{
+				Name:  "manifest",
+				Usage: "inspect and repair the --track-pages mapping, or move it between Confluence and --manifest-file.",
+				Commands: []*cli.Command{
+					{
+						Name:      "list",
+						Usage:     "list the files tracked in a space and the page each publishes to.",
+						ArgsUsage: "<space-key>",
+						Action:    util.RunManifestList,
+					},
+					{
+						Name:      "show",
+						Usage:     "show everything recorded about one file.",
+						ArgsUsage: "<space-key> <file>",
+						Action:    util.RunManifestShow,
+					},
+					{
+						Name:      "forget",
+						Usage:     "stop tracking a file, leaving its page alone.",
+						ArgsUsage: "<space-key> <file>",
+						Action:    util.RunManifestForget,
+					},
+					{
+						Name:      "set",
+						Usage:     "record that a file publishes to an existing page.",
+						ArgsUsage: "<space-key> <file> <page-id>",
+						Action:    util.RunManifestSet,
+					},
+					{
+						Name:      "fsck",
+						Usage:     "check that every tracked page still exists under the title it was published with, and is tracked once.",
+						ArgsUsage: "<space-key>",
+						Action:    util.RunManifestFsck,
+					},
+					{
+						Name:      "adopt",
+						Usage:     "track the pages that already exist for the files, found by title and parents.",
+						ArgsUsage: "[space-key...]",
+						Action:    util.RunManifestAdopt,
+					},
+					{
+						Name:      "export",
+						Usage:     "copy the mapping of each space from Confluence into --manifest-file.",
+						ArgsUsage: "<space-key>...",
+						Action:    util.RunManifestExport,
+					},
+					{
+						Name:      "import",
+						Usage:     "copy the mapping of each space from --manifest-file into Confluence.",
+						ArgsUsage: "<space-key>...",
+						Action:    util.RunManifestImport,
+					},
+				},
+			},
+			{
+				Name:  "cache",
+				Usage: "manage the diagrams kept in --cache-dir.",
+				Commands: []*cli.Command{
+					{
+						Name:   "prune",
+						Usage:  "remove the least recently used diagrams beyond --cache-max-size, and those older than --max-age.",
+						Flags:  util.CachePruneFlags,
+						Action: util.RunCachePrune,
+					},
+				},
+			},
+			{
+				Name:      "pull",
+				Usage:     "convert an existing Confluence page into a markdown file.",
+				ArgsUsage: "[page-id]",
+				Flags:     util.PullFlags,
+				Action:    util.RunPull,
+			},
+		},
 	}
 
 	if err := cmd.Run(context.TODO(), os.Args); err != nil {
@@ -0,0 +1,216 @@
+package mark
+
+import (
+	"bytes"
+	"io"
+	"iter"
+	"slices"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/metadata"
+	"github.com/kovetskiy/mark/v16/page"
+	"github.com/kovetskiy/mark/v16/report"
+)
+
+// published is what became of one document, held until every document before
+// it in the run has been accounted for.
+type published struct {
+	file       string
+	target     *confluence.PageInfo
+	placements []page.Ordered
+	err        error
+
+	// output and results are the document's own, written out and merged in
+	// the order of the run rather than as each document finishes.
+	output  bytes.Buffer
+	results *report.Report
+
+	// skipped is a document never started, because the run stopped first.
+	skipped bool
+}
+
+// publishFunc publishes one document, writing what it prints to output and
+// what became of it to results.
+type publishFunc func(file string, output io.Writer, results *report.Report) (*confluence.PageInfo, []page.Ordered, error)
+
+// publishInOrder publishes files on up to workers goroutines and yields what
+// became of each in the order of files, whatever order they finished in.
+//
+// Everything a run says about a document -- what it prints, its line in the
+// report, its place among the pages to order -- is decided by the loop over
+// the results, one document at a time and always in the same order. Only the
+// round trips to Confluence overlap, so a run with --concurrency reads exactly
+// like one without it.
+//
+// A document is not started until the documents it comes after have finished.
+// With stopOnError nothing new is started once a document fails; the
+// documents already in flight are finished, since abandoning one half way
+// would leave its page half written. Breaking out of the loop stops the run
+// the same way, and waits for those documents before returning.
+func publishInOrder(files []string, workers int, after [][]int, stopOnError bool, publish publishFunc) iter.Seq[*published] {
+	return func(yield func(*published) bool) {
+		results := make([]*published, len(files))
+		done := make([]chan struct{}, len(files))
+		for i, file := range files {
+			results[i] = &published{file: file, results: report.New()}
+			done[i] = make(chan struct{})
+		}
+
+		stop := make(chan struct{})
+		finished := make(chan struct{})
+
+		go func() {
+			defer close(finished)
+
+			started := schedule(len(files), workers, after, stopOnError, stop, func(i int) bool {
+				result := results[i]
+				result.target, result.placements, result.err = publish(result.file, &result.output, result.results)
+				close(done[i])
+
+				return result.err == nil
+			})
+
+			for i := range started {
+				if !started[i] {
+					results[i].skipped = true
+					close(done[i])
+				}
+			}
+		}()
+
+		defer func() {
+			close(stop)
+			<-finished
+		}()
+
+		for i := range files {
+			<-done[i]
+
+			if results[i].skipped {
+				continue
+			}
+
+			if !yield(results[i]) {
+				return
+			}
+		}
+	}
+}
+
+// schedule runs tasks 0 to n-1 on up to workers goroutines and returns which
+// of them were started.
+//
+// A task is started once every task it comes after has finished, and of the
+// tasks ready to start the lowest-numbered goes first, so with one worker the
+// tasks run in order exactly as a plain loop would run them. Tasks that come
+// after each other in a circle can never all be ready: when nothing is running
+// and nothing is ready, the lowest-numbered task still waiting is started
+// anyway, which is what publishing them one by one would have done.
+func schedule(n, workers int, after [][]int, stopOnError bool, stop <-chan struct{}, run func(i int) bool) []bool {
+	waiting := make([]int, n)
+	dependents := make([][]int, n)
+	for i, previous := range after {
+		for _, j := range previous {
+			waiting[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	type outcome struct {
+		task int
+		ok   bool
+	}
+
+	started := make([]bool, n)
+	finished := make(chan outcome)
+	running := 0
+	stopped := false
+
+	start := func(i int) {
+		started[i] = true
+		running++
+		go func() {
+			finished <- outcome{task: i, ok: run(i)}
+		}()
+	}
+
+	for {
+		if !stopped {
+			for i := 0; i < n && running < workers; i++ {
+				if !started[i] && waiting[i] <= 0 {
+					start(i)
+				}
+			}
+
+			if running == 0 {
+				if i := slices.Index(started, false); i >= 0 {
+					start(i)
+				}
+			}
+		}
+
+		if running == 0 {
+			return started
+		}
+
+		select {
+		case result := <-finished:
+			running--
+			if !result.ok && stopOnError {
+				stopped = true
+			}
+			for _, i := range dependents[result.task] {
+				waiting[i]--
+			}
+
+		case <-stop:
+			// Closed for good, so not waited on again.
+			stop = nil
+			stopped = true
+		}
+	}
+}
+
+// publishingDependencies works out which documents have to be published before
+// which: a document whose parent is another document in the run comes after
+// it, so that the parent is where its own headers put it, under the title they
+// give it, by the time the child looks for it. Otherwise the child could walk
+// its ancestry while the parent's document is still creating, moving or
+// retitling that page, and create a second, empty parent beside it.
+//
+// Documents that cannot be read are left for publishing to complain about.
+func publishingDependencies(files []string, config Config) [][]int {
+	type key struct {
+		space, title string
+	}
+
+	metas := make([]*metadata.Meta, len(files))
+	documents := map[key]int{}
+	for i, file := range files {
+		_, _, meta, err := readDocument(file, config)
+		if err != nil || meta == nil || config.PageID != "" {
+			continue
+		}
+
+		metas[i] = meta
+		if _, ok := documents[key{meta.Space, meta.Title}]; !ok {
+			documents[key{meta.Space, meta.Title}] = i
+		}
+	}
+
+	after := make([][]int, len(files))
+	for i, meta := range metas {
+		if meta == nil {
+			continue
+		}
+
+		for _, parent := range meta.Parents {
+			j, ok := documents[key{meta.Space, parent}]
+			if ok && j != i && !slices.Contains(after[i], j) {
+				after[i] = append(after[i], j)
+			}
+		}
+	}
+
+	return after
+}
@@ -6,8 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -175,6 +179,11 @@ type PageInfo struct {
 		} `json:"storage"`
 	} `json:"body"`
 
+	// Space is only filled in when "space" is expanded.
+	Space struct {
+		Key string `json:"key"`
+	} `json:"space"`
+
 	Links struct {
 		Full string `json:"webui"`
 		Base string `json:"-"` // Not from JSON; populated from response _links.base
@@ -614,13 +623,30 @@ func (api *API) UpdateAttachment(
 	return shortResponse, nil
 }
 
+// quoteEscaper escapes a file name in a Content-Disposition header, as
+// multipart.Writer.CreateFormFile does.
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
 func getAttachmentPayload(name, comment string, reader io.Reader) (*form, error) {
 	var (
 		payload = bytes.NewBuffer(nil)
 		writer  = multipart.NewWriter(payload)
 	)
 
-	content, err := writer.CreateFormFile("file", name)
+	// The type is said rather than left as application/octet-stream, which
+	// Confluence keeps an SVG as, and then does not show it as an image.
+	contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(
+		`form-data; name="file"; filename="%s"`, quoteEscaper.Replace(name),
+	))
+	header.Set("Content-Type", contentType)
+
+	content, err := writer.CreatePart(header)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create form file: %w", err)
 	}
@@ -703,6 +729,64 @@ func (api *API) GetAttachments(pageID string) ([]AttachmentInfo, error) {
 	return all, nil
 }
 
+// DownloadAttachment fetches the content of an attachment.
+//
+// The download link is not under the REST API, so it cannot go through
+// gopencils: it is resolved against the host, under the context path Confluence
+// reported with the attachment (/wiki on Cloud, often nothing on Server), and
+// fetched with the same client and credentials as every other call.
+func (api *API) DownloadAttachment(attachment AttachmentInfo) ([]byte, error) {
+	if attachment.Links.Download == "" {
+		return nil, fmt.Errorf("attachment %q has no download link", attachment.Filename)
+	}
+
+	base, err := url.Parse(api.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse base URL %q: %w", api.BaseURL, err)
+	}
+
+	ref, err := url.Parse(attachment.Links.Context + attachment.Links.Download)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"unable to parse download link of attachment %q: %w", attachment.Filename, err,
+		)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, base.ResolveReference(ref).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth := api.rest.Api.BasicAuth; auth != nil {
+		request.SetBasicAuth(auth.Username, auth.Password)
+	}
+	for key := range api.rest.Headers {
+		request.Header.Set(key, api.rest.Headers.Get(key))
+	}
+
+	response, err := api.rest.Api.Client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download attachment %q: %w", attachment.Filename, err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"unable to download attachment %q: unexpected status: %s",
+			attachment.Filename, response.Status,
+		)
+	}
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read attachment %q: %w", attachment.Filename, err)
+	}
+
+	return data, nil
+}
+
 func (api *API) GetPageByID(pageID string) (*PageInfo, error) {
 	return api.GetPageByIDExpanded(pageID, "ancestors,version")
 }
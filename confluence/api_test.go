@@ -1,8 +1,11 @@
 package confluence
 
 import (
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
 
@@ -205,3 +208,23 @@ func TestIsCloudHost(t *testing.T) {
 		assert.False(t, isCloudHost(host), "%q should not be recognised as Cloud", host)
 	}
 }
+
+func TestAttachmentPayloadSaysTheContentType(t *testing.T) {
+	for name, want := range map[string]string{
+		"diagram.svg":  "image/svg+xml",
+		"diagram.PNG":  "image/png",
+		`say "hi".bin`: "application/octet-stream",
+		"no-extension": "application/octet-stream",
+	} {
+		form, err := getAttachmentPayload(name, "comment", strings.NewReader("data"))
+		assert.NoError(t, err)
+
+		_, params, err := mime.ParseMediaType(form.writer.FormDataContentType())
+		assert.NoError(t, err)
+
+		part, err := multipart.NewReader(form.buffer, params["boundary"]).NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, want, part.Header.Get("Content-Type"), name)
+		assert.Equal(t, name, part.FileName(), name)
+	}
+}
@@ -47,6 +47,9 @@ type Attachment struct {
 	PageID   string
 	Filename string
 	Comment  string
+
+	// Data is what the download link serves.
+	Data []byte
 }
 
 // InlineComment is a comment returned by the child/comment endpoint.
@@ -322,6 +325,17 @@ func (s *Server) AddAttachment(pageID, filename, comment string) *Attachment {
 	return a
 }
 
+// SetAttachmentData sets the content served for an attachment's download link.
+func (s *Server) SetAttachmentData(id string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.attachments {
+		if a.ID == id {
+			a.Data = data
+		}
+	}
+}
+
 // AddComment adds an inline comment to a page.
 func (s *Server) AddComment(pageID string, c InlineComment) {
 	s.mu.Lock()
@@ -423,6 +437,7 @@ func (s *Server) pageJSON(p *Page) map[string]any {
 		"body": map[string]any{
 			"storage": map[string]any{"value": p.Body},
 		},
+		"space":  map[string]any{"key": p.SpaceKey},
 		"_links": map[string]any{"webui": "/display/" + p.SpaceKey + "/" + p.ID},
 	}
 }
@@ -490,6 +505,8 @@ func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
 		s.handleV1(w, r, strings.TrimPrefix(path, "/rest/api"))
 	case strings.HasPrefix(path, "/api/v2"):
 		s.handleV2(w, r, strings.TrimPrefix(path, "/api/v2"))
+	case strings.HasPrefix(path, "/wiki/download/attachments/"):
+		s.downloadAttachment(w, r, strings.TrimPrefix(path, "/wiki/download/attachments/"))
 	default:
 		http.NotFound(w, r)
 	}
@@ -1158,6 +1175,23 @@ func (s *Server) updateAttachment(w http.ResponseWriter, r *http.Request, pageID
 	})
 }
 
+// downloadAttachment serves the download link the attachment listing hands
+// out, which sits under the /wiki context rather than the REST API.
+func (s *Server) downloadAttachment(w http.ResponseWriter, r *http.Request, rest string) {
+	pageID, filename, _ := strings.Cut(rest, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.attachments {
+		if a.PageID == pageID && a.Filename == filename {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write(a.Data)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
 func parseMultipartAttachment(r *http.Request) (filename, comment string) {
 	// Test fixtures are small; a tight cap keeps a runaway test from buffering
 	// to disk. Uploads larger than this are not something the fake supports.
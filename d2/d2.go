@@ -16,13 +16,14 @@ import (
 
 	"github.com/kovetskiy/mark/v16/attachment"
 	"github.com/kovetskiy/mark/v16/chrome"
+	"github.com/kovetskiy/mark/v16/diagram"
 	"github.com/rs/zerolog/log"
 
 	"github.com/d2lang/d2/d2graph"
 	"github.com/d2lang/d2/d2layouts/d2dagrelayout"
+	"github.com/d2lang/d2/d2layouts/d2elklayout"
 	"github.com/d2lang/d2/d2lib"
 	"github.com/d2lang/d2/d2renderers/d2svg"
-	"github.com/d2lang/d2/d2themes/d2themescatalog"
 	d2log "github.com/d2lang/d2/lib/log"
 	"github.com/d2lang/d2/lib/textmeasure"
 	"github.com/d2lang/util-go/go2"
@@ -30,39 +31,27 @@ import (
 
 var renderTimeout = 120 * time.Second
 
-func ProcessD2(title string, d2Diagram []byte, scale float64) (attachment.Attachment, error) {
-	ctx, cancel := context.WithTimeout(context.TODO(), renderTimeout)
-	ctx = d2log.WithDefault(ctx)
-	defer cancel()
-
-	ruler, err := textmeasure.NewRuler()
+// ProcessD2 renders a D2 diagram as the PNG or SVG attachment it is published
+// as, drawn with the options given. D2 draws SVG itself, so only a PNG needs a
+// browser. A diagram the cache has is not rendered again, and no browser is
+// started for it.
+func ProcessD2(title string, d2Diagram []byte, scale float64, format string, options Options, cache *diagram.Cache) (attachment.Attachment, error) {
+	format, err := diagram.ParseFormat(format)
 	if err != nil {
 		return attachment.Attachment{}, err
 	}
-	layoutResolver := func(engine string) (d2graph.LayoutGraph, error) {
-		return d2dagrelayout.DefaultLayout, nil
-	}
-	renderOpts := &d2svg.RenderOpts{
-		Pad:     go2.Pointer(int64(5)),
-		ThemeID: &d2themescatalog.GrapeSoda.ID,
-	}
-	compileOpts := &d2lib.CompileOptions{
-		LayoutResolver: layoutResolver,
-		Ruler:          ruler,
-	}
 
-	diagram, _, err := d2lib.Compile(ctx, string(d2Diagram), compileOpts, renderOpts)
-	if err != nil {
-		return attachment.Attachment{}, err
-	}
-
-	out, err := d2svg.Render(diagram, renderOpts)
-	if err != nil {
-		return attachment.Attachment{}, err
-	}
-
-	log.Debug().Msgf("Rendering: %q", title)
-	pngBytes, boxModel, err := convertSVGtoPNG(ctx, out, scale)
+	key := diagram.CacheKey(
+		"d2",
+		diagram.ModuleVersion("github.com/d2lang/d2"),
+		strconv.FormatFloat(scale, 'g', -1, 64),
+		options.String(),
+		format,
+		string(d2Diagram),
+	)
+	image, err := cache.Render(key, func() (diagram.Image, error) {
+		return renderD2(title, d2Diagram, scale, format, options)
+	})
 	if err != nil {
 		return attachment.Attachment{}, err
 	}
@@ -73,6 +62,18 @@ func ProcessD2(title string, d2Diagram []byte, scale float64) (attachment.Attach
 
 	d2Bytes := append(d2Diagram, scaleAsBytes...)
 
+	// A PNG keeps the checksum it always had, so that the diagrams published
+	// before SVG could be are not uploaded again.
+	if format != diagram.FormatPNG {
+		d2Bytes = append(d2Bytes, format...)
+	}
+
+	// So do the diagrams drawn as they always were; one drawn another way is
+	// uploaded again when the way changes.
+	if options != DefaultOptions {
+		d2Bytes = append(d2Bytes, options.String()...)
+	}
+
 	checkSum, err := attachment.GetChecksum(bytes.NewReader(d2Bytes))
 
 	log.Debug().Msgf("Checksum: %q -> %s", title, checkSum)
@@ -84,20 +85,78 @@ func ProcessD2(title string, d2Diagram []byte, scale float64) (attachment.Attach
 		title = checkSum
 	}
 
-	fileName := title + ".png"
+	fileName := title + "." + format
 
 	return attachment.Attachment{
 		ID:        "",
 		Name:      title,
 		Filename:  fileName,
-		FileBytes: pngBytes,
+		FileBytes: image.Data,
 		Checksum:  checkSum,
 		Replace:   title,
-		Width:     strconv.FormatInt(boxModel.Width, 10),
-		Height:    strconv.FormatInt(boxModel.Height, 10),
+		Width:     strconv.FormatInt(image.Width, 10),
+		Height:    strconv.FormatInt(image.Height, 10),
 	}, nil
 }
 
+// renderD2 lays a diagram out and draws it as SVG and, for a PNG, has Chrome
+// turn that into one.
+func renderD2(title string, d2Diagram []byte, scale float64, format string, options Options) (diagram.Image, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), renderTimeout)
+	ctx = d2log.WithDefault(ctx)
+	defer cancel()
+
+	ruler, err := textmeasure.NewRuler()
+	if err != nil {
+		return diagram.Image{}, err
+	}
+	// The layout is the one the options name, whatever the diagram's own
+	// d2-config says, as the theme and padding always were.
+	layoutResolver := func(engine string) (d2graph.LayoutGraph, error) {
+		if options.Layout == "elk" {
+			return d2elklayout.DefaultLayout, nil
+		}
+		return d2dagrelayout.DefaultLayout, nil
+	}
+	renderOpts := &d2svg.RenderOpts{
+		Pad:     go2.Pointer(options.Pad),
+		Sketch:  go2.Pointer(options.Sketch),
+		ThemeID: go2.Pointer(options.Theme),
+	}
+	compileOpts := &d2lib.CompileOptions{
+		LayoutResolver: layoutResolver,
+		Layout:         go2.Pointer(options.Layout),
+		Ruler:          ruler,
+	}
+
+	compiled, _, err := d2lib.Compile(ctx, string(d2Diagram), compileOpts, renderOpts)
+	if err != nil {
+		return diagram.Image{}, err
+	}
+
+	out, err := d2svg.Render(compiled, renderOpts)
+	if err != nil {
+		return diagram.Image{}, err
+	}
+
+	if format == diagram.FormatSVG {
+		width, height, err := diagram.Size(out, format)
+		if err != nil {
+			return diagram.Image{}, err
+		}
+
+		return diagram.Image{Data: out, Width: width, Height: height}, nil
+	}
+
+	log.Debug().Msgf("Rendering: %q", title)
+	pngBytes, boxModel, err := convertSVGtoPNG(ctx, out, scale)
+	if err != nil {
+		return diagram.Image{}, err
+	}
+
+	return diagram.Image{Data: pngBytes, Width: boxModel.Width, Height: boxModel.Height}, nil
+}
+
 var (
 	chromeCtx       context.Context
 	chromeCtxCancel context.CancelFunc
@@ -6,10 +6,11 @@ import (
 	"testing"
 
 	"github.com/kovetskiy/mark/v16/attachment"
+	"github.com/kovetskiy/mark/v16/diagram"
 	"github.com/stretchr/testify/assert"
 )
 
-var diagram string = `d2
+var example string = `d2
 vars: {
   d2-config: {
     layout-engine: elk
@@ -70,7 +71,7 @@ func TestExtractD2Image(t *testing.T) {
 		want     attachment.Attachment
 		wantErr  assert.ErrorAssertionFunc
 	}{
-		{"example", []byte(diagram), 1.0, attachment.Attachment{
+		{"example", []byte(example), 1.0, attachment.Attachment{
 			// This is only the PNG Magic Header
 			FileBytes: []byte{0x89, 0x50, 0x4e, 0x47, 0xd, 0xa, 0x1a, 0xa},
 			Filename:  "example.png",
@@ -83,7 +84,7 @@ func TestExtractD2Image(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := ProcessD2(tt.name, tt.markdown, tt.scale)
+			got, err := ProcessD2(tt.name, tt.markdown, tt.scale, diagram.FormatPNG, DefaultOptions, nil)
 			if !tt.wantErr(t, err, fmt.Sprintf("processD2(%v, %v)", tt.name, string(tt.markdown))) {
 				return
 			}
@@ -104,3 +105,41 @@ func TestExtractD2Image(t *testing.T) {
 		})
 	}
 }
+
+// An SVG is D2's own drawing: no browser is started for it, and its size is
+// its own.
+func TestD2AsSVGStartsNoBrowser(t *testing.T) {
+	Cleanup()
+
+	got, err := ProcessD2("example", []byte(example), 1.0, diagram.FormatSVG, DefaultOptions, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "example.svg", got.Filename)
+	assert.Contains(t, string(got.FileBytes), "<svg")
+	assert.NotEqual(t, "40e75f93e09da9242d4b1ab8e2892665ec7d5bd1ac78a4b65210ee219cf62297", got.Checksum,
+		"an SVG is uploaded in place of the PNG")
+
+	width, err := strconv.ParseInt(got.Width, 10, 64)
+	assert.NoError(t, err)
+	assert.Greater(t, width, int64(0))
+
+	chromeMutex.Lock()
+	defer chromeMutex.Unlock()
+	assert.Nil(t, chromeCtx, "no browser was started")
+}
+
+// A diagram drawn in another theme is another image: it must be uploaded
+// again, while one drawn with the defaults keeps the checksum it always had.
+func TestD2OptionsChangeTheChecksum(t *testing.T) {
+	options, err := DefaultOptions.Apply([]string{"theme=dark-mauve", "sketch"})
+	assert.NoError(t, err)
+
+	got, err := ProcessD2("example", []byte(example), 1.0, diagram.FormatSVG, options, nil)
+	assert.NoError(t, err)
+
+	defaults, err := ProcessD2("example", []byte(example), 1.0, diagram.FormatSVG, DefaultOptions, nil)
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, defaults.Checksum, got.Checksum)
+	assert.NotEqual(t, defaults.FileBytes, got.FileBytes)
+}
@@ -0,0 +1,160 @@
+package d2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/d2lang/d2/d2themes"
+	"github.com/d2lang/d2/d2themes/d2themescatalog"
+)
+
+// Options are how a D2 diagram is drawn. A diagram's own options, written
+// after d2 in its code block's info string, are applied over the defaults
+// the flags set; see NewOptions:
+//
+//	```d2 theme=200 layout=elk sketch
+type Options struct {
+	// Theme is the ID of a theme in d2's catalog, light or dark.
+	Theme int64
+
+	// Layout is the layout engine: dagre or elk.
+	Layout string
+
+	// Sketch draws the diagram as if by hand.
+	Sketch bool
+
+	// Pad is the space around the diagram, in pixels.
+	Pad int64
+}
+
+// DefaultOptions are the options diagrams were drawn with before they could
+// be chosen.
+var DefaultOptions = Options{
+	Theme:  d2themescatalog.GrapeSoda.ID,
+	Layout: "dagre",
+	Pad:    5,
+}
+
+// NewOptions returns the options diagrams are drawn with unless their own say
+// otherwise, from a theme and a layout as ParseTheme and ParseLayout read
+// them. None given are DefaultOptions.
+func NewOptions(theme, layout string, sketch bool) (Options, error) {
+	themeID, err := ParseTheme(theme)
+	if err != nil {
+		return Options{}, err
+	}
+
+	engine, err := ParseLayout(layout)
+	if err != nil {
+		return Options{}, err
+	}
+
+	return Options{Theme: themeID, Layout: engine, Sketch: sketch, Pad: DefaultOptions.Pad}, nil
+}
+
+// String says what the options are, for a diagram's checksum and cache key.
+func (o Options) String() string {
+	return fmt.Sprintf("theme=%d layout=%s sketch=%t pad=%d", o.Theme, o.Layout, o.Sketch, o.Pad)
+}
+
+// IsOption reports whether an option in a code block's info string is one of
+// D2's.
+func IsOption(option string) bool {
+	if option == "sketch" || option == "nosketch" {
+		return true
+	}
+
+	name, _, ok := strings.Cut(option, "=")
+	return ok && (name == "theme" || name == "layout" || name == "pad")
+}
+
+// Apply returns the options with a code block's applied over them: theme=,
+// layout= and pad=, and sketch or nosketch.
+func (o Options) Apply(options []string) (Options, error) {
+	applied := o
+
+	for _, option := range options {
+		name, value, _ := strings.Cut(option, "=")
+
+		var err error
+		switch name {
+		case "sketch":
+			applied.Sketch = true
+		case "nosketch":
+			applied.Sketch = false
+		case "theme":
+			applied.Theme, err = ParseTheme(value)
+		case "layout":
+			applied.Layout, err = ParseLayout(value)
+		case "pad":
+			applied.Pad, err = ParsePad(value)
+		default:
+			err = fmt.Errorf("%q is not a d2 option: use theme=, layout=, pad=, sketch or nosketch", option)
+		}
+		if err != nil {
+			return Options{}, err
+		}
+	}
+
+	return applied, nil
+}
+
+// themes are the themes in d2's catalog, light and dark.
+func themes() []d2themes.Theme {
+	return append(append([]d2themes.Theme{}, d2themescatalog.LightCatalog...), d2themescatalog.DarkCatalog...)
+}
+
+// ParseTheme reads a theme of d2's catalog, by its ID or by its name in any
+// case, with dashes or underscores for spaces: 200, "Dark Mauve" and
+// dark-mauve are the same theme. No theme is Grape Soda, the one diagrams
+// were always drawn with.
+func ParseTheme(theme string) (int64, error) {
+	theme = strings.TrimSpace(theme)
+	if theme == "" {
+		return DefaultOptions.Theme, nil
+	}
+
+	if id, err := strconv.ParseInt(theme, 10, 64); err == nil {
+		if found := d2themescatalog.Find(id); found.Name != "" {
+			return found.ID, nil
+		}
+	}
+
+	normalize := strings.NewReplacer(" ", "", "-", "", "_", "")
+	for _, known := range themes() {
+		if strings.EqualFold(normalize.Replace(known.Name), normalize.Replace(theme)) {
+			return known.ID, nil
+		}
+	}
+
+	names := make([]string, 0, len(themes()))
+	for _, known := range themes() {
+		names = append(names, fmt.Sprintf("%d (%s)", known.ID, known.Name))
+	}
+
+	return 0, fmt.Errorf("%q is not a d2 theme: use one of %s", theme, strings.Join(names, ", "))
+}
+
+// ParseLayout reads a layout engine, dagre when none is given. TALA is not
+// one of them: it is not open source, and mark is not built with it.
+func ParseLayout(layout string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(layout)) {
+	case "", "dagre":
+		return "dagre", nil
+	case "elk":
+		return "elk", nil
+	default:
+		return "", fmt.Errorf("%q is not a d2 layout engine: use dagre or elk", layout)
+	}
+}
+
+// ParsePad reads the space around a diagram, in pixels.
+func ParsePad(pad string) (int64, error) {
+	value, err := strconv.ParseInt(strings.TrimSpace(pad), 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%q is not a d2 padding: use a number of pixels", pad)
+	}
+
+	return value, nil
+}
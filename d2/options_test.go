@@ -0,0 +1,92 @@
+package d2
+
+import (
+	"testing"
+
+	"github.com/d2lang/d2/d2themes/d2themescatalog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTheme(t *testing.T) {
+	for _, theme := range []string{"200", "Dark Mauve", "dark-mauve", "DARK_MAUVE", " darkmauve "} {
+		id, err := ParseTheme(theme)
+		require.NoError(t, err, theme)
+		assert.Equal(t, d2themescatalog.DarkMauve.ID, id, theme)
+	}
+
+	id, err := ParseTheme("")
+	require.NoError(t, err)
+	assert.Equal(t, d2themescatalog.GrapeSoda.ID, id, "diagrams are drawn as they always were")
+
+	id, err = ParseTheme("0")
+	require.NoError(t, err)
+	assert.Equal(t, d2themescatalog.NeutralDefault.ID, id)
+
+	_, err = ParseTheme("9999")
+	assert.ErrorContains(t, err, `"9999" is not a d2 theme: use one of `)
+	assert.ErrorContains(t, err, "200 (Dark Mauve)")
+
+	_, err = ParseTheme("solarized")
+	assert.ErrorContains(t, err, `"solarized" is not a d2 theme`)
+}
+
+func TestParseLayoutAndPad(t *testing.T) {
+	layout, err := ParseLayout("")
+	require.NoError(t, err)
+	assert.Equal(t, "dagre", layout)
+
+	layout, err = ParseLayout("ELK")
+	require.NoError(t, err)
+	assert.Equal(t, "elk", layout)
+
+	_, err = ParseLayout("tala")
+	assert.EqualError(t, err, `"tala" is not a d2 layout engine: use dagre or elk`)
+
+	pad, err := ParsePad("0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), pad)
+
+	_, err = ParsePad("-1")
+	assert.EqualError(t, err, `"-1" is not a d2 padding: use a number of pixels`)
+}
+
+func TestNewOptions(t *testing.T) {
+	options, err := NewOptions("", "", false)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultOptions, options, "none given are DefaultOptions")
+
+	options, err = NewOptions("dark-mauve", "elk", true)
+	require.NoError(t, err)
+	assert.Equal(t, Options{Theme: d2themescatalog.DarkMauve.ID, Layout: "elk", Sketch: true, Pad: 5}, options)
+
+	_, err = NewOptions("solarized", "", false)
+	assert.ErrorContains(t, err, `"solarized" is not a d2 theme`)
+
+	_, err = NewOptions("", "tala", false)
+	assert.EqualError(t, err, `"tala" is not a d2 layout engine: use dagre or elk`)
+}
+
+func TestOptionsApply(t *testing.T) {
+	applied, err := DefaultOptions.Apply(nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultOptions, applied)
+
+	defaults := Options{Theme: d2themescatalog.DarkMauve.ID, Layout: "elk", Sketch: true, Pad: 5}
+	applied, err = defaults.Apply([]string{"theme=grape-soda", "layout=dagre", "nosketch", "pad=20"})
+	require.NoError(t, err)
+	assert.Equal(t, Options{Theme: d2themescatalog.GrapeSoda.ID, Layout: "dagre", Pad: 20}, applied)
+	assert.True(t, defaults.Sketch, "the defaults are left as they were")
+
+	_, err = defaults.Apply([]string{"layout=circular"})
+	assert.EqualError(t, err, `"circular" is not a d2 layout engine: use dagre or elk`)
+}
+
+func TestIsOption(t *testing.T) {
+	for _, option := range []string{"theme=200", "layout=elk", "pad=0", "sketch", "nosketch"} {
+		assert.True(t, IsOption(option), option)
+	}
+	for _, option := range []string{"title", "format=svg", "sketchy", "theme"} {
+		assert.False(t, IsOption(option), option)
+	}
+}
@@ -0,0 +1,290 @@
+// Package datafile reads the data files a repository keeps beside its
+// documentation -- CSV, YAML and JSON -- for pages to show as tables and for
+// templates to loop over.
+package datafile
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ReadCSV reads a CSV file whose first record names its columns, as a row for
+// each record after it, by column.
+func ReadCSV(path string) ([]map[string]string, error) {
+	table, err := readCSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]string, len(table.Rows))
+	for i, row := range table.Rows {
+		rows[i] = map[string]string{}
+		for column, value := range row {
+			rows[i][column] = Format(value)
+		}
+	}
+
+	return rows, nil
+}
+
+// ReadYAML reads a YAML file as whatever it holds.
+func ReadYAML(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+
+	return value, nil
+}
+
+// ReadJSON reads a JSON file as whatever it holds.
+func ReadJSON(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+
+	return value, nil
+}
+
+// Table is a data file read as rows of named columns.
+type Table struct {
+	// Columns are the columns in the order the file has them: a CSV file's
+	// header, or the keys of the rows of a YAML or JSON one in the order
+	// they first appear.
+	Columns []string
+	Rows    []map[string]any
+}
+
+// Read reads a data file as a table, by its extension: a CSV file with a
+// header, or a YAML or JSON file holding a list of objects.
+func Read(path string) (*Table, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readCSV(path)
+	case ".yaml", ".yml", ".json":
+		return readList(path)
+	default:
+		return nil, fmt.Errorf("%s is not a data file: use a .csv, .yaml, .yml or .json file", path)
+	}
+}
+
+func readCSV(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return &Table{}, nil
+	}
+
+	table := &Table{Columns: records[0]}
+	for _, record := range records[1:] {
+		row := map[string]any{}
+		for i, column := range table.Columns {
+			row[column] = record[i]
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, nil
+}
+
+// readList reads a YAML file, or a JSON one, which YAML reads as well, as a
+// list of objects. It is read as YAML's nodes first for the order of the keys,
+// which decoding into a map forgets.
+func readList(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+
+	table := &Table{}
+	if len(document.Content) == 0 {
+		return table, nil
+	}
+
+	list := document.Content[0]
+	if list.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("%s does not hold a list of rows", path)
+	}
+
+	for i, item := range list.Content {
+		if item.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s: row %d is not an object", path, i+1)
+		}
+
+		row := map[string]any{}
+		if err := item.Decode(&row); err != nil {
+			return nil, fmt.Errorf("%s: row %d: %w", path, i+1, err)
+		}
+
+		for j := 0; j < len(item.Content); j += 2 {
+			if column := item.Content[j].Value; !slices.Contains(table.Columns, column) {
+				table.Columns = append(table.Columns, column)
+			}
+		}
+
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, nil
+}
+
+// Filter keeps the rows whose column holds one of the values given for it,
+// for every column given.
+func (t *Table) Filter(filter map[string][]string) error {
+	for column := range filter {
+		if !slices.Contains(t.Columns, column) {
+			return fmt.Errorf("there is no column %q to filter by", column)
+		}
+	}
+
+	t.Rows = slices.DeleteFunc(t.Rows, func(row map[string]any) bool {
+		for column, values := range filter {
+			if !slices.Contains(values, Format(row[column])) {
+				return true
+			}
+		}
+		return false
+	})
+
+	return nil
+}
+
+// Sort sorts the rows by the columns given, the first of them first. A column
+// prefixed with - is sorted from the highest value down. Values that are all
+// numbers are sorted as numbers, and the rows' order in the file is kept
+// between rows that are the same.
+func (t *Table) Sort(columns []string) error {
+	type key struct {
+		column     string
+		descending bool
+	}
+
+	var keys []key
+	for _, column := range columns {
+		name, descending := strings.CutPrefix(column, "-")
+		if !slices.Contains(t.Columns, name) {
+			return fmt.Errorf("there is no column %q to sort by", name)
+		}
+		keys = append(keys, key{name, descending})
+	}
+
+	slices.SortStableFunc(t.Rows, func(a, b map[string]any) int {
+		for _, key := range keys {
+			order := compare(Format(a[key.column]), Format(b[key.column]))
+			if key.descending {
+				order = -order
+			}
+			if order != 0 {
+				return order
+			}
+		}
+		return 0
+	})
+
+	return nil
+}
+
+// Select keeps the columns given, in the order given.
+func (t *Table) Select(columns []string) error {
+	for _, column := range columns {
+		if !slices.Contains(t.Columns, column) {
+			return fmt.Errorf("there is no column %q: the columns are %s", column, strings.Join(t.Columns, ", "))
+		}
+	}
+
+	t.Columns = columns
+
+	return nil
+}
+
+func compare(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+// Format is how a value is shown in a table: a list as its items, separated
+// by commas, nothing as nothing, and anything else as it is written.
+func Format(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []any:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = Format(item)
+		}
+		return strings.Join(items, ", ")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Funcs are the template functions that read data files: readCSV, readYAML
+// and readJSON, each taking a path relative to dir.
+func Funcs(dir string) template.FuncMap {
+	resolve := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, filepath.FromSlash(path))
+	}
+
+	return template.FuncMap{
+		"readCSV": func(path string) ([]map[string]string, error) {
+			return ReadCSV(resolve(path))
+		},
+		"readYAML": func(path string) (any, error) {
+			return ReadYAML(resolve(path))
+		},
+		"readJSON": func(path string) (any, error) {
+			return ReadJSON(resolve(path))
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package datafile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeDataFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	return path
+}
+
+func TestReadKeepsTheColumnsInOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	table, err := Read(writeDataFile(t, dir, "services.csv", "name,owner,tier\napi,core,1\nweb,\"front, end\",2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name", "owner", "tier"}, table.Columns)
+	assert.Equal(t, "front, end", table.Rows[1]["owner"])
+
+	table, err = Read(writeDataFile(t, dir, "services.yaml", "- name: api\n  tier: 1\n- name: web\n  owner: [ann, bob]\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name", "tier", "owner"}, table.Columns)
+	assert.Equal(t, "ann, bob", Format(table.Rows[1]["owner"]))
+	assert.Empty(t, Format(table.Rows[1]["tier"]))
+
+	table, err = Read(writeDataFile(t, dir, "services.json", `[{"zone": "eu", "name": "api"}]`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zone", "name"}, table.Columns, "in the file's order, not sorted")
+
+	_, err = Read(writeDataFile(t, dir, "map.yaml", "name: api\n"))
+	assert.ErrorContains(t, err, "does not hold a list of rows")
+
+	_, err = Read(writeDataFile(t, dir, "notes.txt", "name\n"))
+	assert.ErrorContains(t, err, "is not a data file")
+}
+
+func TestTableFilterSortSelect(t *testing.T) {
+	table, err := Read(writeDataFile(t, t.TempDir(), "services.csv",
+		"name,tier,zone\napi,10,eu\nweb,9,us\ndb,10,eu\ncache,2,eu\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, table.Filter(map[string][]string{"zone": {"eu"}}))
+	require.NoError(t, table.Sort([]string{"-tier", "name"}))
+	require.NoError(t, table.Select([]string{"name", "tier"}))
+
+	var names []string
+	for _, row := range table.Rows {
+		names = append(names, Format(row["name"]))
+	}
+	assert.Equal(t, []string{"api", "db", "cache"}, names, "tiers compared as numbers")
+	assert.Equal(t, []string{"name", "tier"}, table.Columns)
+
+	assert.ErrorContains(t, table.Sort([]string{"owner"}), `no column "owner"`)
+	assert.ErrorContains(t, table.Filter(map[string][]string{"owner": {"x"}}), `no column "owner"`)
+	assert.ErrorContains(t, table.Select([]string{"owner"}), "the columns are name, tier")
+}
+
+func TestFuncsReadFromTheDirectoryGiven(t *testing.T) {
+	dir := t.TempDir()
+	writeDataFile(t, dir, "rota.csv", "week,person\n1,ann\n2,bob\n")
+	writeDataFile(t, dir, "team.yaml", "lead: ann\n")
+	writeDataFile(t, dir, "team.json", `{"size": 2}`)
+
+	tmpl, err := template.New("").Funcs(Funcs(dir)).Parse(
+		`{{ range readCSV "rota.csv" }}{{ .week }}:{{ .person }} {{ end }}` +
+			`{{ (readYAML "team.yaml").lead }} {{ (readJSON "team.json").size }}`)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, tmpl.Execute(&out, nil))
+	assert.Equal(t, "1:ann 2:bob ann 2", out.String())
+}
@@ -0,0 +1,255 @@
+package diagram
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// cacheLayout is the version of how the cache keeps a diagram. It is part of
+// every key, so that changing the layout leaves the old entries to be pruned
+// rather than misread.
+const cacheLayout = "1"
+
+// cacheEntry is the name of a file the cache keeps. Pruning removes nothing
+// else, so that a cache directory pointed at the wrong place cannot lose
+// anybody's files.
+var cacheEntry = regexp.MustCompile(`^[0-9a-f]{64}\.diagram$`)
+
+// Cache keeps rendered diagrams on disk, so that a diagram rendered once is
+// not rendered again -- by a later run, on another machine the directory is
+// restored to, or by a run that has no browser to render it with.
+//
+// A diagram is kept by a key made of everything that decides how it is drawn:
+// its source, the scale and options it is drawn with, and what draws it, down
+// to the version of the library. The same source drawn differently is a
+// different entry, and a stale one is never returned. A nil Cache keeps
+// nothing.
+type Cache struct {
+	// Dir is where the diagrams are kept.
+	Dir string
+
+	// MaxSize is how many bytes the diagrams may take up. The least recently
+	// used are removed once a new one takes the cache over it. Zero is no
+	// limit.
+	MaxSize int64
+}
+
+// Image is a rendered diagram as the cache keeps it: the image, and the size
+// it is shown at, which is not always the size it was drawn at.
+type Image struct {
+	Data   []byte
+	Width  int64
+	Height int64
+}
+
+// CacheKey returns the key of a diagram drawn from the parts given, which are
+// everything that decides how it is drawn.
+func CacheKey(parts ...string) string {
+	hash := sha256.New()
+	hash.Write([]byte(cacheLayout))
+	for _, part := range parts {
+		hash.Write([]byte{0})
+		hash.Write([]byte(part))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ModuleVersion returns the version of a Go module mark is built with, for a
+// cache key to change when a library draws differently. It is "unknown" when
+// the binary does not say.
+func ModuleVersion(path string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	for _, module := range info.Deps {
+		if module.Path == path {
+			if module.Replace != nil {
+				module = module.Replace
+			}
+			return module.Version
+		}
+	}
+
+	return "unknown"
+}
+
+// Render returns the diagram kept under key or, when there is none, draws it
+// with draw and keeps it. Failing to keep a diagram is only warned about: the
+// cache saves time, and the diagram has been drawn.
+func (c *Cache) Render(key string, draw func() (Image, error)) (Image, error) {
+	if c == nil {
+		return draw()
+	}
+
+	if image, ok := c.get(key); ok {
+		log.Debug().Msgf("Diagram %s found in the cache", key)
+		return image, nil
+	}
+
+	image, err := draw()
+	if err != nil {
+		return Image{}, err
+	}
+
+	if err := c.put(key, image); err != nil {
+		log.Warn().Err(err).Msg("unable to cache a rendered diagram")
+	}
+
+	return image, nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key+".diagram")
+}
+
+// get reads the diagram kept under key. It is an entry's size, on the first
+// line, and then the image. Reading one marks it used, for pruning to keep it
+// over those that have not been.
+func (c *Cache) get(key string) (Image, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return Image{}, false
+	}
+
+	header, body, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return Image{}, false
+	}
+
+	var image Image
+	if _, err := fmt.Sscanf(string(header), "%d %d", &image.Width, &image.Height); err != nil {
+		return Image{}, false
+	}
+	image.Data = body
+
+	now := time.Now()
+	_ = os.Chtimes(c.path(key), now, now)
+
+	return image, true
+}
+
+// put keeps a diagram under key. It is written aside and renamed into place,
+// so that another run reading the cache never sees half of one.
+func (c *Cache) put(key string, image Image) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(c.Dir, ".diagram-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = fmt.Fprintf(file, "%d %d\n", image.Width, image.Height)
+	if err == nil {
+		_, err = file.Write(image.Data)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(file.Name(), c.path(key)); err != nil {
+		return err
+	}
+
+	if c.MaxSize > 0 {
+		if _, err := c.Prune(c.MaxSize, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PruneResult is what pruning the cache did.
+type PruneResult struct {
+	// Removed and Freed are how many diagrams were removed and the bytes they
+	// took up.
+	Removed int
+	Freed   int64
+
+	// Kept and Size are how many diagrams are left and the bytes they take up.
+	Kept int
+	Size int64
+}
+
+// Prune removes the diagrams not used for longer than maxAge, and then the
+// least recently used until the rest take up no more than maxSize bytes. Zero
+// is no limit for either.
+func (c *Cache) Prune(maxSize int64, maxAge time.Duration) (PruneResult, error) {
+	var result PruneResult
+
+	entries, err := os.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return result, fmt.Errorf("unable to read the cache: %w", err)
+	}
+
+	type kept struct {
+		name string
+		size int64
+		used time.Time
+	}
+
+	var diagrams []kept
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !cacheEntry.MatchString(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		diagrams = append(diagrams, kept{entry.Name(), info.Size(), info.ModTime()})
+		result.Size += info.Size()
+	}
+
+	slices.SortFunc(diagrams, func(a, b kept) int {
+		if order := a.used.Compare(b.used); order != 0 {
+			return order
+		}
+		return strings.Compare(a.name, b.name)
+	})
+
+	for _, diagram := range diagrams {
+		stale := maxAge > 0 && time.Since(diagram.used) > maxAge
+		over := maxSize > 0 && result.Size > maxSize
+		if !stale && !over {
+			result.Kept++
+			continue
+		}
+
+		err := os.Remove(filepath.Join(c.Dir, diagram.name))
+		if err != nil && !os.IsNotExist(err) {
+			return result, fmt.Errorf("unable to remove %s from the cache: %w", diagram.name, err)
+		}
+
+		result.Removed++
+		result.Freed += diagram.size
+		result.Size -= diagram.size
+	}
+
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package diagram
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheRendersADiagramOnce(t *testing.T) {
+	cache := &Cache{Dir: filepath.Join(t.TempDir(), "cache")}
+
+	draws := 0
+	draw := func() (Image, error) {
+		draws++
+		return Image{Data: []byte("png\nwith a newline"), Width: 120, Height: 80}, nil
+	}
+
+	first, err := cache.Render(CacheKey("mermaid", "v1", "graph TD; a-->b"), draw)
+	require.NoError(t, err)
+
+	second, err := cache.Render(CacheKey("mermaid", "v1", "graph TD; a-->b"), draw)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, draws)
+	assert.Equal(t, first, second)
+	assert.Equal(t, Image{Data: []byte("png\nwith a newline"), Width: 120, Height: 80}, second)
+
+	_, err = cache.Render(CacheKey("mermaid", "v2", "graph TD; a-->b"), draw)
+	require.NoError(t, err)
+	assert.Equal(t, 2, draws, "another version of the renderer draws it again")
+}
+
+func TestCacheKeepsNoFailure(t *testing.T) {
+	cache := &Cache{Dir: t.TempDir()}
+
+	_, err := cache.Render(CacheKey("d2"), func() (Image, error) {
+		return Image{}, errors.New("no browser")
+	})
+	assert.EqualError(t, err, "no browser")
+
+	entries, err := os.ReadDir(cache.Dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestNilCacheDrawsEveryTime(t *testing.T) {
+	var cache *Cache
+
+	draws := 0
+	for range 2 {
+		_, err := cache.Render(CacheKey("d2"), func() (Image, error) {
+			draws++
+			return Image{}, nil
+		})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, draws)
+}
+
+func TestCachePrunesTheLeastRecentlyUsed(t *testing.T) {
+	cache := &Cache{Dir: t.TempDir()}
+	writeFile := func(name string, size int, used time.Time) {
+		path := filepath.Join(cache.Dir, name)
+		require.NoError(t, os.WriteFile(path, make([]byte, size), 0o644))
+		require.NoError(t, os.Chtimes(path, used, used))
+	}
+
+	now := time.Now()
+	oldest, older, newest := CacheKey("a")+".diagram", CacheKey("b")+".diagram", CacheKey("c")+".diagram"
+	writeFile(oldest, 100, now.Add(-72*time.Hour))
+	writeFile(older, 100, now.Add(-2*time.Hour))
+	writeFile(newest, 100, now)
+	writeFile("notes.txt", 1000, now.Add(-1000*time.Hour))
+
+	result, err := cache.Prune(250, 0)
+	require.NoError(t, err)
+	assert.Equal(t, PruneResult{Removed: 1, Freed: 100, Kept: 2, Size: 200}, result)
+	assert.NoFileExists(t, filepath.Join(cache.Dir, oldest))
+
+	result, err = cache.Prune(0, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, PruneResult{Removed: 1, Freed: 100, Kept: 1, Size: 100}, result)
+	assert.FileExists(t, filepath.Join(cache.Dir, newest))
+	assert.FileExists(t, filepath.Join(cache.Dir, "notes.txt"), "only the cache's own files are removed")
+
+	result, err = (&Cache{Dir: filepath.Join(cache.Dir, "missing")}).Prune(0, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, PruneResult{}, result)
+}
+
+func TestCacheStaysWithinItsSize(t *testing.T) {
+	cache := &Cache{Dir: t.TempDir(), MaxSize: 150}
+
+	for _, source := range []string{"a", "b", "c"} {
+		_, err := cache.Render(CacheKey(source), func() (Image, error) {
+			return Image{Data: make([]byte, 60), Width: 1, Height: 1}, nil
+		})
+		require.NoError(t, err)
+	}
+
+	result, err := cache.Prune(0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Kept)
+	assert.LessOrEqual(t, result.Size, int64(150))
+}
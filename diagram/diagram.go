@@ -0,0 +1,265 @@
+// Package diagram renders the diagrams written in code blocks with a renderer
+// chosen for each language: a Kroki server, or a command.
+//
+// Mermaid and D2 are rendered in-process by default, through a headless
+// Chrome, which is heavy to carry around in a CI container and covers two
+// languages out of many. A renderer configured for a language takes over
+// rendering it -- Mermaid and D2 included -- so that Graphviz, BPMN, Vega,
+// WaveDrom or anything else a Kroki server or a command line tool draws can be
+// published too.
+package diagram
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/png" // For the size a PNG is shown at.
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kovetskiy/mark/v16/attachment"
+	"github.com/rs/zerolog/log"
+)
+
+// The formats a diagram is drawn in. PNG is what every Confluence shows well;
+// SVG is sharp at any size, but older Confluence Server versions show SVG
+// attachments poorly.
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// ParseFormat reads the format a diagram is drawn in, PNG when none is given.
+func ParseFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", FormatPNG:
+		return FormatPNG, nil
+	case FormatSVG:
+		return FormatSVG, nil
+	default:
+		return "", fmt.Errorf("%q is not a diagram format: use svg or png", format)
+	}
+}
+
+// Size returns the size an image in the format given is drawn at.
+func Size(data []byte, format string) (int64, int64, error) {
+	if format == FormatSVG {
+		width, height, err := attachment.SVGSize(data)
+		return int64(width), int64(height), err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int64(config.Width), int64(config.Height), nil
+}
+
+// renderTimeout bounds rendering one diagram, as it does for Mermaid and D2.
+var renderTimeout = 120 * time.Second
+
+// Renderer draws a diagram from its source.
+type Renderer interface {
+	// Render returns the diagram drawn as an image in the format given.
+	Render(ctx context.Context, source []byte, format string) ([]byte, error)
+
+	// String says what draws the diagram. It is part of a diagram's checksum,
+	// so that drawing it with something else uploads it again.
+	String() string
+}
+
+// Kroki renders diagrams with a Kroki server, or anything answering its API:
+// the source is POSTed to /<type>/<format> and the image is the response.
+//
+// https://docs.kroki.io/kroki/setup/http-clients/
+type Kroki struct {
+	// URL is where the server is.
+	URL string
+
+	// Type is Kroki's name for the diagram's language: graphviz, bpmn,
+	// vegalite, wavedrom and so on.
+	Type string
+
+	// Client is the client the requests are made with; http.DefaultClient
+	// when nil.
+	Client *http.Client
+}
+
+func (k Kroki) Render(ctx context.Context, source []byte, format string) ([]byte, error) {
+	endpoint, err := url.JoinPath(k.URL, k.Type, format)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build the Kroki URL: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "text/plain")
+
+	client := k.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach Kroki: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Kroki's response: %w", err)
+	}
+
+	// Kroki says what is wrong with a diagram in the body of the error.
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kroki answered %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
+
+func (k Kroki) String() string {
+	return "kroki:" + k.Type
+}
+
+// Command renders diagrams with a command, which reads the source on its
+// standard input and writes the image to its standard output. {format} in its
+// arguments is the format the image is wanted in.
+type Command struct {
+	Args []string
+}
+
+func (c Command) Render(ctx context.Context, source []byte, format string) ([]byte, error) {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = strings.ReplaceAll(arg, "{format}", format)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(source)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s: %w: %s", args[0], err, message)
+		}
+		return nil, fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func (c Command) String() string {
+	return "command:" + strings.Join(c.Args, " ")
+}
+
+// ParseRenderers reads the renderers configured for languages, each as
+// language=kroki, language=kroki:<type> or language=command:<command>. Kroki
+// is asked for a diagram by its language unless a type is given, so that a
+// block written as dot can be drawn as Kroki's graphviz.
+func ParseRenderers(specs []string, krokiURL string) (map[string]Renderer, error) {
+	renderers := map[string]Renderer{}
+
+	for _, spec := range specs {
+		language, backend, ok := strings.Cut(spec, "=")
+		language = strings.TrimSpace(language)
+		if !ok || language == "" {
+			return nil, fmt.Errorf("%q: use language=kroki, language=kroki:<type> or language=command:<command>", spec)
+		}
+
+		name, argument, _ := strings.Cut(strings.TrimSpace(backend), ":")
+		switch name {
+		case "kroki":
+			if krokiURL == "" {
+				return nil, fmt.Errorf("%s is rendered with Kroki, which needs --kroki-url", language)
+			}
+
+			kind := strings.TrimSpace(argument)
+			if kind == "" {
+				kind = language
+			}
+			renderers[language] = Kroki{URL: krokiURL, Type: kind}
+
+		case "command":
+			args := strings.Fields(argument)
+			if len(args) == 0 {
+				return nil, fmt.Errorf("%q names no command", spec)
+			}
+			renderers[language] = Command{Args: args}
+
+		default:
+			return nil, fmt.Errorf("%q: %q is not a renderer: use kroki or command", spec, name)
+		}
+	}
+
+	return renderers, nil
+}
+
+// Process renders a diagram as the image attachment it is published as, in
+// the format given, named by its title or, without one, by its checksum. A
+// diagram the cache has is not rendered again.
+func Process(renderer Renderer, title string, source []byte, format string, cache *Cache) (attachment.Attachment, error) {
+	format, err := ParseFormat(format)
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+
+	key := CacheKey("renderer", renderer.String(), format, string(source))
+	drawn, err := cache.Render(key, func() (Image, error) {
+		log.Debug().Msgf("Rendering with %s: %q", renderer, title)
+
+		ctx, cancel := context.WithTimeout(context.Background(), renderTimeout)
+		defer cancel()
+
+		data, err := renderer.Render(ctx, source, format)
+		if err != nil {
+			return Image{}, err
+		}
+
+		width, height, err := Size(data, format)
+		if err != nil {
+			return Image{}, fmt.Errorf("%s did not draw a %s image: %w", renderer, format, err)
+		}
+
+		return Image{Data: data, Width: width, Height: height}, nil
+	})
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+
+	checksum, err := attachment.GetChecksum(io.MultiReader(
+		bytes.NewReader(source),
+		strings.NewReader("\x00"+renderer.String()+"\x00"+format),
+	))
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+	log.Debug().Msgf("Checksum: %q -> %s", title, checksum)
+
+	if title == "" {
+		title = checksum
+	}
+
+	return attachment.Attachment{
+		Name:      title,
+		Filename:  title + "." + format,
+		FileBytes: drawn.Data,
+		Checksum:  checksum,
+		Replace:   title,
+		Width:     strconv.FormatInt(drawn.Width, 10),
+		Height:    strconv.FormatInt(drawn.Height, 10),
+	}, nil
+}
@@ -0,0 +1,146 @@
+package diagram
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drawing(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	require.NoError(t, png.Encode(&b, image.NewRGBA(image.Rect(0, 0, width, height))))
+
+	return b.Bytes()
+}
+
+func TestKrokiPostsTheSourceByTypeAndFormat(t *testing.T) {
+	drawn := drawing(t, 40, 30)
+
+	var path, source string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		path, source = r.URL.Path, string(body)
+		_, _ = w.Write(drawn)
+	}))
+	defer server.Close()
+
+	renderers, err := ParseRenderers([]string{"dot=kroki:graphviz"}, server.URL+"/kroki")
+	require.NoError(t, err)
+
+	attachment, err := Process(renderers["dot"], "", []byte("digraph { a -> b }"), FormatPNG, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/kroki/graphviz/png", path)
+	assert.Equal(t, "digraph { a -> b }", source)
+	assert.Equal(t, drawn, attachment.FileBytes)
+	assert.Equal(t, "40", attachment.Width)
+	assert.Equal(t, "30", attachment.Height)
+	assert.Equal(t, attachment.Checksum+".png", attachment.Filename, "without a title it is named by its checksum")
+}
+
+func TestKrokiErrorIsReported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Error 400: syntax error in line 1", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	_, err := Process(Kroki{URL: server.URL, Type: "graphviz"}, "graph", []byte("digraph {"), FormatPNG, nil)
+	assert.EqualError(t, err, "kroki answered 400 Bad Request: Error 400: syntax error in line 1")
+}
+
+func TestCommandReadsTheSourceAndWritesTheImage(t *testing.T) {
+	drawn := drawing(t, 12, 8)
+
+	attachment, err := Process(Command{Args: []string{"cat"}}, "drawn", drawn, FormatPNG, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "drawn.png", attachment.Filename)
+	assert.Equal(t, "12", attachment.Width)
+	assert.Equal(t, "8", attachment.Height)
+
+	image, err := Command{Args: []string{"sh", "-c", "echo {format}"}}.Render(t.Context(), nil, "svg")
+	require.NoError(t, err)
+	assert.Equal(t, "svg\n", string(image), "{format} is replaced in the arguments")
+
+	_, err = Command{Args: []string{"sh", "-c", "echo no such diagram >&2; exit 3"}}.Render(t.Context(), nil, "png")
+	assert.EqualError(t, err, "sh: exit status 3: no such diagram")
+
+	_, err = Process(Command{Args: []string{"echo", "not an image"}}, "", nil, FormatPNG, nil)
+	assert.ErrorContains(t, err, "command:echo not an image did not draw a png image")
+}
+
+func TestChecksumDependsOnTheRenderer(t *testing.T) {
+	drawn := drawing(t, 1, 1)
+
+	cat, err := Process(Command{Args: []string{"cat"}}, "", drawn, FormatPNG, nil)
+	require.NoError(t, err)
+
+	again, err := Process(Command{Args: []string{"cat"}}, "", drawn, FormatPNG, nil)
+	require.NoError(t, err)
+
+	other, err := Process(Command{Args: []string{"cat", "-"}}, "", drawn, FormatPNG, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, cat.Checksum, again.Checksum)
+	assert.NotEqual(t, cat.Checksum, other.Checksum, "drawn by something else, it is uploaded again")
+}
+
+func TestParseRenderers(t *testing.T) {
+	renderers, err := ParseRenderers([]string{
+		"bpmn=kroki",
+		" mermaid = command:mmdc -i - -o - -e {format} ",
+	}, "https://kroki.io")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]Renderer{
+		"bpmn":    Kroki{URL: "https://kroki.io", Type: "bpmn"},
+		"mermaid": Command{Args: []string{"mmdc", "-i", "-", "-o", "-", "-e", "{format}"}},
+	}, renderers)
+
+	for spec, message := range map[string]string{
+		"graphviz":       `"graphviz": use language=kroki, language=kroki:<type> or language=command:<command>`,
+		"=kroki":         `"=kroki": use language=kroki, language=kroki:<type> or language=command:<command>`,
+		"dot=command:":   `"dot=command:" names no command`,
+		"dot=graphviz":   `"dot=graphviz": "graphviz" is not a renderer: use kroki or command`,
+		"dot=kroki:dot ": "",
+	} {
+		_, err := ParseRenderers([]string{spec}, "https://kroki.io")
+		if message == "" {
+			assert.NoError(t, err, spec)
+		} else {
+			assert.EqualError(t, err, message, spec)
+		}
+	}
+
+	_, err = ParseRenderers([]string{"dot=kroki"}, "")
+	assert.EqualError(t, err, "dot is rendered with Kroki, which needs --kroki-url")
+}
+
+func TestKrokiDrawsSVG(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_, _ = w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 300 150"></svg>`))
+	}))
+	defer server.Close()
+
+	attachment, err := Process(Kroki{URL: server.URL, Type: "graphviz"}, "flow", []byte("digraph { a -> b }"), "SVG", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/graphviz/svg", path)
+	assert.Equal(t, "flow.svg", attachment.Filename)
+	assert.Equal(t, "300", attachment.Width)
+	assert.Equal(t, "150", attachment.Height)
+
+	_, err = Process(Kroki{URL: server.URL, Type: "graphviz"}, "flow", nil, "jpeg", nil)
+	assert.EqualError(t, err, `"jpeg" is not a diagram format: use svg or png`)
+}
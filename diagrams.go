@@ -0,0 +1,88 @@
+package mark
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kovetskiy/mark/v16/d2"
+	"github.com/kovetskiy/mark/v16/diagram"
+	"github.com/kovetskiy/mark/v16/mermaid"
+)
+
+// diagramRenderers returns the renderers configured for code block languages,
+// by language.
+func (c Config) diagramRenderers() (map[string]diagram.Renderer, error) {
+	return diagram.ParseRenderers(c.DiagramRenderers, c.KrokiURL)
+}
+
+// renderers is diagramRenderers for compiling a document. A run and a
+// validation refuse renderers that do not parse before reading any, so none
+// are rendered with here when they do not.
+func (c Config) renderers() map[string]diagram.Renderer {
+	renderers, _ := c.diagramRenderers()
+	return renderers
+}
+
+// checkDiagrams refuses diagram settings that do not parse, for a run, a
+// validation and a preview to fail on before reading any document rather
+// than at the first diagram.
+func (c Config) checkDiagrams() error {
+	if _, err := c.diagramRenderers(); err != nil {
+		return fmt.Errorf("--diagram-renderer: %w", err)
+	}
+
+	if _, err := diagram.ParseFormat(c.DiagramFormat); err != nil {
+		return fmt.Errorf("--diagram-format: %w", err)
+	}
+
+	if _, err := mermaid.ParseMode(c.MermaidMode); err != nil {
+		return fmt.Errorf("--mermaid-mode: %w", err)
+	}
+
+	if _, err := d2.ParseTheme(c.D2Theme); err != nil {
+		return fmt.Errorf("--d2-theme: %w", err)
+	}
+
+	if _, err := d2.ParseLayout(c.D2Layout); err != nil {
+		return fmt.Errorf("--d2-layout: %w", err)
+	}
+
+	return nil
+}
+
+// diagramCache returns the cache rendered diagrams are kept in, or nil when
+// there is none.
+func (c Config) diagramCache() *diagram.Cache {
+	if c.CacheDir == "" {
+		return nil
+	}
+
+	return &diagram.Cache{Dir: c.CacheDir, MaxSize: c.CacheMaxSize}
+}
+
+// PruneCache removes the diagrams not used for longer than maxAge from the
+// cache, and then the least recently used until the rest fit in CacheMaxSize,
+// and says what it removed.
+func PruneCache(config Config, maxAge time.Duration) error {
+	cache := config.diagramCache()
+	if cache == nil {
+		return fmt.Errorf("mark cache prune requires --cache-dir: there is no cache to prune without it")
+	}
+
+	result, err := cache.Prune(config.CacheMaxSize, maxAge)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(
+		config.output(),
+		"removed %d diagrams (%s), kept %d (%s)\n",
+		result.Removed, megabytes(result.Freed), result.Kept, megabytes(result.Size),
+	)
+
+	return err
+}
+
+func megabytes(size int64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+}
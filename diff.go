@@ -0,0 +1,354 @@
+package mark
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kovetskiy/mark/v16/attachment"
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/diff"
+	"github.com/kovetskiy/mark/v16/manifest"
+	markmd "github.com/kovetskiy/mark/v16/markdown"
+	"github.com/kovetskiy/mark/v16/metadata"
+	"github.com/kovetskiy/mark/v16/page"
+	"github.com/kovetskiy/mark/v16/report"
+	"github.com/kovetskiy/mark/v16/stdlib"
+	"github.com/kovetskiy/mark/v16/storage"
+	"github.com/kovetskiy/mark/v16/vfs"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrChanged is what Run returns in diff mode when any page differs from its
+// document, so that the exit status alone says whether publishing would do
+// anything.
+var ErrChanged = errors.New("one or more pages differ from their documents")
+
+// diffFile compiles a document exactly as publishing would and writes out how
+// its page would change, touching nothing.
+//
+// What is compared is the storage body after normalisation, not the HTML the
+// dry run prints: Confluence reformats what it is sent, and the comparison has
+// to see through that or every page would differ from itself. Attachments are
+// not uploaded, so a link to one not yet on the page is compared as written;
+// the attachment itself is listed among the changes.
+func diffFile(
+	doc document,
+	api *confluence.API,
+	config Config,
+	std *stdlib.Lib,
+	tracker *manifest.Store,
+	folders page.FolderTracker,
+	resolveLink func(target, text string) (string, error),
+	resolver *page.LinkResolver,
+	globalProperties map[string]any,
+	results *report.Report,
+) (*page.Ordered, error) {
+	file, key := doc.file, doc.key
+	markdown, sourceHash, meta := doc.markdown, doc.sourceHash, doc.meta
+
+	var target *confluence.PageInfo
+
+	if meta != nil {
+		_, pg, err := page.ResolvePage(true, api, meta, folders)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve page location: %w", err)
+		}
+
+		// The same fallbacks a real run takes, so that a rename is shown as the
+		// retitle it would be rather than as a new page.
+		if pg == nil {
+			if pg, err = resolveTrackedPage(tracker, api, meta, key); err != nil {
+				return nil, err
+			}
+		}
+		if pg == nil {
+			if pg, err = resolveRenamedFile(tracker, api, meta, key, sourceHash); err != nil {
+				return nil, err
+			}
+		}
+
+		target = pg
+	} else {
+		pg, err := api.GetPageByID(config.PageID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve page by id: %w", err)
+		}
+		target = pg
+	}
+
+	var remoteBody string
+	var remoteAttachments []confluence.AttachmentInfo
+	if target != nil {
+		pg, err := api.GetPageByIDExpanded(target.ID, "ancestors,version,body.storage")
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve page %s: %w", target.ID, err)
+		}
+		target = pg
+		remoteBody = pg.Body.Storage.Value
+
+		remoteAttachments, err = api.GetAttachments(target.ID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get attachments for page %s: %w", target.ID, err)
+		}
+	}
+
+	var declaredAttachments []string
+	if meta != nil {
+		declaredAttachments = meta.Attachments
+	}
+
+	localAttachments, err := attachment.ResolveLocalAttachments(
+		vfs.LocalOS,
+		filepath.Dir(file),
+		declaredAttachments,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to locate attachments: %w", err)
+	}
+
+	attaches, pending, err := attachment.PreviewAttachments(localAttachments, remoteAttachments)
+	if err != nil {
+		return nil, err
+	}
+
+	imageAlign, err := getImageAlign(config.ImageAlign, meta)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine image-align: %w", err)
+	}
+
+	cfg := config.markConfig(imageAlign, resolveLink, attachment.NewResolver(attaches).Resolve)
+
+	html, inlineAttachments, err := markmd.CompileMarkdown(markdown, std, file, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile markdown: %w", err)
+	}
+
+	if err := reportBrokenLinks(resolver.Broken(), key, config.CheckLinksWarnOnly); err != nil {
+		return nil, err
+	}
+
+	_, inlinePending, err := attachment.PreviewAttachments(inlineAttachments, remoteAttachments)
+	if err != nil {
+		return nil, err
+	}
+	pending = append(pending, inlinePending...)
+
+	var layout, sidebar string
+	if meta != nil {
+		layout = meta.Layout
+		sidebar = meta.Sidebar
+	}
+
+	var buffer bytes.Buffer
+	if err := std.Templates.ExecuteTemplate(
+		&buffer,
+		"ac:layout",
+		struct {
+			Layout  string
+			Sidebar string
+			Body    string
+		}{
+			Layout:  layout,
+			Sidebar: sidebar,
+			Body:    html,
+		},
+	); err != nil {
+		return nil, fmt.Errorf("unable to execute layout template: %w", err)
+	}
+
+	local, err := storage.Normalize(buffer.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to normalize compiled page: %w", err)
+	}
+
+	remote, err := storage.Normalize(remoteBody)
+	if err != nil {
+		return nil, fmt.Errorf("unable to normalize the published page: %w", err)
+	}
+
+	planned := PlannedPage{
+		File:        key,
+		Action:      ActionCreate,
+		Space:       spaceOf(meta),
+		Title:       titleOf(meta),
+		Source:      sourceHash,
+		BodyHash:    sha1Hash(local),
+		Attachments: pending,
+	}
+	if target != nil {
+		planned.Action = ActionUpdate
+		planned.PageID = target.ID
+		planned.Version = target.Version.Number
+		if planned.Title == "" {
+			planned.Title = target.Title
+		}
+	}
+
+	if err := metadataChanges(api, config, meta, target, globalProperties, &planned); err != nil {
+		return nil, err
+	}
+
+	fromName := "/dev/null"
+	if target != nil {
+		fromName = fmt.Sprintf("%s (page %s, version %d)", target.Title, target.ID, target.Version.Number)
+	}
+	planned.Diff = diff.Unified(fromName, key, remote, local)
+
+	// Where the page would sit among its siblings, for the run to order once
+	// every page is known. A page that does not exist yet has no position to
+	// compare, and is placed when it is published.
+	var placement *page.Ordered
+	if meta != nil && meta.Order != nil && target != nil {
+		placement = &page.Ordered{
+			PageID:   target.ID,
+			ParentID: page.ImmediateParentID(target),
+			Title:    target.Title,
+			Order:    *meta.Order,
+		}
+	}
+
+	entry := report.Page{File: key, Space: spaceOf(meta), Title: planned.Title}
+	if target != nil {
+		entry.PageID = target.ID
+		entry.URL = api.BaseURL + target.Links.Full
+	}
+
+	if planned.Diff == "" && !planned.metadataChanged() && target != nil {
+		log.Info().Msgf("page %q is up to date with %s", target.Title, key)
+		planned.Action = ActionUnchanged
+		config.plan.addPage(planned)
+
+		entry.Status = report.StatusUnchanged
+		results.AddPage(entry)
+
+		return placement, nil
+	}
+
+	config.plan.addPage(planned)
+
+	entry.Status = report.StatusChanged
+	results.AddPage(entry)
+
+	_, err = fmt.Fprint(config.output(), describeChanges(planned))
+
+	return placement, err
+}
+
+// metadataChanges works out everything besides the body that publishing would
+// change, reading what the page carries now.
+func metadataChanges(
+	api *confluence.API,
+	config Config,
+	meta *metadata.Meta,
+	target *confluence.PageInfo,
+	globalProperties map[string]any,
+	planned *PlannedPage,
+) error {
+	var documentProperties map[string]any
+	if meta != nil {
+		documentProperties = meta.Properties
+	}
+	properties := page.MergeProperties(globalProperties, documentProperties)
+
+	if target == nil {
+		if meta != nil {
+			planned.LabelsAdded = meta.Labels
+			if len(meta.Parents) > 0 {
+				planned.ParentTo = meta.Parents[len(meta.Parents)-1]
+			}
+		}
+		for key := range properties {
+			planned.Properties = append(planned.Properties, key)
+		}
+		slices.Sort(planned.Properties)
+
+		return nil
+	}
+
+	var err error
+	planned.Properties, err = page.PropertyChanges(api, target.ID, properties)
+	if err != nil {
+		return err
+	}
+
+	if meta == nil {
+		return nil
+	}
+
+	if target.Title != meta.Title {
+		planned.RetitleFrom = target.Title
+	}
+
+	// A page under folders is placed by the folder hierarchy, which a dry
+	// resolution does not create and so cannot compare against.
+	if len(meta.Parents) > 0 && len(meta.Folders) == 0 && meta.Type != "blogpost" &&
+		!page.UnderDeclaredParents(target, meta.Parents) {
+		if len(target.Ancestors) > 0 {
+			planned.ParentFrom = target.Ancestors[len(target.Ancestors)-1].Title
+		}
+		planned.ParentTo = meta.Parents[len(meta.Parents)-1]
+	}
+
+	labels, err := api.GetPageLabels(target, "global")
+	if err != nil {
+		return err
+	}
+
+	planned.LabelsAdded = determineLabelsToAdd(meta.Labels, labels)
+	if !config.AppendLabels {
+		planned.LabelsRemoved = determineLabelsToRemove(labels, meta.Labels)
+	}
+
+	return nil
+}
+
+// describeChanges writes a planned change the way a person reads it: a line
+// saying which page, one per change besides the body, then the body's diff.
+func describeChanges(planned PlannedPage) string {
+	var out strings.Builder
+
+	if planned.Action == ActionCreate {
+		fmt.Fprintf(&out, "%s: would create page %q\n", planned.File, planned.Title)
+	} else {
+		fmt.Fprintf(&out, "%s: would update page %s %q\n", planned.File, planned.PageID, planned.Title)
+	}
+
+	if planned.RetitleFrom != "" {
+		fmt.Fprintf(&out, "  title: %q -> %q\n", planned.RetitleFrom, planned.Title)
+	}
+
+	switch {
+	case planned.ParentTo == "":
+	case planned.ParentFrom == "":
+		fmt.Fprintf(&out, "  parent: %q\n", planned.ParentTo)
+	default:
+		fmt.Fprintf(&out, "  parent: %q -> %q\n", planned.ParentFrom, planned.ParentTo)
+	}
+
+	if len(planned.LabelsAdded) > 0 || len(planned.LabelsRemoved) > 0 {
+		var labels []string
+		for _, label := range planned.LabelsAdded {
+			labels = append(labels, "+"+label)
+		}
+		for _, label := range planned.LabelsRemoved {
+			labels = append(labels, "-"+label)
+		}
+		fmt.Fprintf(&out, "  labels: %s\n", strings.Join(labels, " "))
+	}
+
+	if len(planned.Properties) > 0 {
+		fmt.Fprintf(&out, "  properties: %s\n", strings.Join(planned.Properties, ", "))
+	}
+
+	if len(planned.Attachments) > 0 {
+		fmt.Fprintf(&out, "  attachments: %s\n", strings.Join(planned.Attachments, ", "))
+	}
+
+	out.WriteString(planned.Diff)
+
+	return out.String()
+}
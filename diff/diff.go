@@ -0,0 +1,274 @@
+// Package diff writes the difference between two texts as a unified diff, the
+// form code review tools and anyone reading a CI log already know how to read.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Context is the number of unchanged lines shown around each change.
+const Context = 3
+
+// maxEdits bounds the search for the shortest edit script. The search keeps a
+// row of state per edit, so two bodies with nothing in common would otherwise
+// cost memory quadratic in their length; past this point the remainder is
+// shown as removed and added wholesale, which is what it is anyway.
+const maxEdits = 2000
+
+type edit struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Unified returns the unified diff from one text to the other, with the names
+// given in the --- and +++ header lines, or "" when the texts are the same.
+func Unified(fromName, toName, from, to string) string {
+	a, b := lines(from), lines(to)
+
+	script := edits(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	changed := false
+	for _, h := range hunks(script) {
+		changed = true
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", span(h.fromStart, h.fromCount), span(h.toStart, h.toCount))
+		for _, e := range script[h.start:h.end] {
+			out.WriteByte(e.kind)
+			out.WriteString(e.line)
+			out.WriteByte('\n')
+		}
+	}
+
+	if !changed {
+		return ""
+	}
+
+	return out.String()
+}
+
+// lines splits a text into lines. A final newline ends the last line rather
+// than starting an empty one.
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// span formats a hunk range the way diff(1) does: a range of no lines is
+// numbered after the line it follows.
+func span(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// edits returns an edit script turning a into b. The common prefix and suffix
+// are set aside first: a page edit usually touches a few lines in the middle,
+// and they are the cheap part of the answer.
+func edits(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	script := make([]edit, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		script = append(script, edit{' ', line})
+	}
+
+	script = append(script, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+
+	for _, line := range a[len(a)-suffix:] {
+		script = append(script, edit{' ', line})
+	}
+
+	return script
+}
+
+// myers finds a shortest edit script with Myers' O(ND) algorithm.
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	if n+m == 0 {
+		return nil
+	}
+
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	// trace[d] holds the furthest x reached on each diagonal -d..d after d
+	// edits, which is what walking back from the end needs.
+	var trace [][]int
+
+	for d := 0; d <= n+m && d <= maxEdits; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+				return backtrack(a, b, trace)
+			}
+		}
+
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+
+	script := make([]edit, 0, n+m)
+	for _, line := range a {
+		script = append(script, edit{'-', line})
+	}
+	for _, line := range b {
+		script = append(script, edit{'+', line})
+	}
+
+	return script
+}
+
+func backtrack(a, b []string, trace [][]int) []edit {
+	x, y := len(a), len(b)
+
+	var reversed []edit
+	for d := len(trace) - 1; d > 0; d-- {
+		previous := trace[d-1]
+		at := func(k int) int { return previous[k+d-1] }
+
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, edit{' ', a[x-1]})
+			x--
+			y--
+		}
+
+		if x == prevX {
+			reversed = append(reversed, edit{'+', b[y-1]})
+			y--
+		} else {
+			reversed = append(reversed, edit{'-', a[x-1]})
+			x--
+		}
+	}
+
+	for x > 0 && y > 0 {
+		reversed = append(reversed, edit{' ', a[x-1]})
+		x--
+		y--
+	}
+
+	script := make([]edit, len(reversed))
+	for i, e := range reversed {
+		script[len(reversed)-1-i] = e
+	}
+
+	return script
+}
+
+type hunk struct {
+	start, end         int // indexes into the edit script
+	fromStart, toStart int // zero-based line numbers
+	fromCount, toCount int
+}
+
+// hunks groups changes with Context lines on either side, merging groups whose
+// context would overlap.
+func hunks(script []edit) []hunk {
+	var result []hunk
+
+	var fromLine, toLine int
+	for i := 0; i < len(script); {
+		if script[i].kind == ' ' {
+			fromLine++
+			toLine++
+			i++
+			continue
+		}
+
+		// The previous hunk stopped at least Context lines short of here, so
+		// everything this reaches back over is unchanged and not yet shown.
+		lead := min(Context, i)
+
+		h := hunk{
+			start:     i - lead,
+			fromStart: fromLine - lead,
+			toStart:   toLine - lead,
+			fromCount: lead,
+			toCount:   lead,
+		}
+
+		// Extend while the next change is close enough that the context around
+		// the two would touch.
+		end := i
+		for j := i; j < len(script); j++ {
+			if script[j].kind != ' ' {
+				end = j + 1
+				continue
+			}
+			if j-end >= 2*Context {
+				break
+			}
+		}
+
+		trail := 0
+		for j := end; j < len(script) && trail < Context && script[j].kind == ' '; j++ {
+			trail++
+		}
+		h.end = end + trail
+
+		for _, e := range script[i:h.end] {
+			switch e.kind {
+			case ' ':
+				fromLine++
+				toLine++
+				h.fromCount++
+				h.toCount++
+			case '-':
+				fromLine++
+				h.fromCount++
+			case '+':
+				toLine++
+				h.toCount++
+			}
+		}
+
+		result = append(result, h)
+		i = h.end
+	}
+
+	return result
+}
@@ -0,0 +1,92 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedSameTextIsEmpty(t *testing.T) {
+	assert.Equal(t, "", Unified("a", "b", "one\ntwo\n", "one\ntwo\n"))
+	assert.Equal(t, "", Unified("a", "b", "", ""))
+}
+
+func TestUnifiedChangedLine(t *testing.T) {
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	to := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n"
+
+	assert.Equal(t, `--- old
++++ new
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+`, Unified("old", "new", from, to))
+}
+
+func TestUnifiedSeparateHunks(t *testing.T) {
+	var from, to []string
+	for i := range 20 {
+		line := string(rune('a' + i))
+		from = append(from, line)
+		switch i {
+		case 1:
+			to = append(to, "B")
+		case 17:
+			// removed
+		default:
+			to = append(to, line)
+		}
+	}
+
+	got := Unified("old", "new", strings.Join(from, "\n")+"\n", strings.Join(to, "\n")+"\n")
+
+	assert.Equal(t, `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -15,6 +15,5 @@
+ o
+ p
+ q
+-r
+ s
+ t
+`, got)
+}
+
+func TestUnifiedFromNothing(t *testing.T) {
+	assert.Equal(t, `--- old
++++ new
+@@ -0,0 +1,2 @@
++hello
++world
+`, Unified("old", "new", "", "hello\nworld\n"))
+}
+
+// TestUnifiedBeyondMaxEdits checks that two texts with nothing in common still
+// produce a diff rather than exhausting memory looking for a clever one.
+func TestUnifiedBeyondMaxEdits(t *testing.T) {
+	var from, to strings.Builder
+	for i := range maxEdits {
+		from.WriteString("a" + strings.Repeat("x", i%7) + "\n")
+		to.WriteString("b" + strings.Repeat("y", i%5) + "\n")
+	}
+
+	got := Unified("old", "new", from.String(), to.String())
+
+	// Less the +++ header line.
+	assert.Equal(t, maxEdits, strings.Count(got, "\n-"))
+	assert.Equal(t, maxEdits, strings.Count(got, "\n+")-1)
+}
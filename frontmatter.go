@@ -0,0 +1,43 @@
+package mark
+
+import "github.com/kovetskiy/mark/v16/metadata"
+
+// frontMatterMapping returns the mapping front matter is read through, or nil
+// when there is none. As with the nav, a run reads it once and anything else
+// reading a document reads it again.
+func (c Config) frontMatterMapping() (metadata.FrontMatterMapping, error) {
+	switch {
+	case c.FrontMatterMapping == "":
+		return nil, nil
+	case c.loadedFrontMatter != nil:
+		return c.loadedFrontMatter, nil
+	default:
+		return metadata.LoadFrontMatterMapping(c.FrontMatterMapping)
+	}
+}
+
+// readMeta reads a document's metadata as a run would, for the link resolver
+// to title the documents links lead to the same way they are published. A link
+// to an anchor in a document split into pages arrives at the page of the
+// section holding it.
+func readMeta(config Config) func(file, anchor string) (*metadata.Meta, error) {
+	return func(file, anchor string) (*metadata.Meta, error) {
+		markdown, sourceHash, meta, err := readDocument(file, config)
+		if err != nil || anchor == "" {
+			return meta, err
+		}
+
+		documents, err := splitDocument(file, markdown, sourceHash, meta, config)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, doc := range documents[1:] {
+			if doc.owns(anchor) {
+				return doc.meta, nil
+			}
+		}
+
+		return meta, nil
+	}
+}
@@ -0,0 +1,431 @@
+package includes
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kovetskiy/mark/v16/metadata"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// embedDirective is a line holding nothing but an Embed directive,
+// <!-- Embed: ../shared/setup.md#installation -->, with whatever it is
+// indented by.
+var embedDirective = regexp.MustCompile(`(?m)^([ \t]*)<!--[ \t]*Embed:[ \t]*([^\n]*?)[ \t]*-->[ \t]*$`)
+
+// ProcessEmbeds replaces each Embed directive with the Markdown file it names,
+// or with the section of it under the heading its anchor names, and returns
+// the attachments those files declare.
+//
+// Include pulls in a Go template, which is the right tool for a snippet with
+// parameters and the wrong one for prose: a page of Markdown written to be
+// read on its own has to be escaped to survive being parsed as a template, and
+// stops reading well on its own the moment it is. Embed takes the Markdown as
+// it is.
+//
+// The embedded text is made to fit where it lands, so that it reads as if it
+// had been written there:
+//
+//   - its headings are shifted so that the highest of them is one level below
+//     the heading the directive sits under, and an h1 where there is none;
+//   - its relative links and images are rewritten to point from the embedding
+//     document's directory at what they pointed at from the embedded file's;
+//   - the attachments it declares are returned, by the same kind of path, for
+//     the caller to attach to the page -- all of them for a whole file, and
+//     those the section mentions for a section.
+//
+// The file's own headers say where it is published, which has nothing to do
+// with the page it is embedded in, and are left out. Files embedded by an
+// embedded file are embedded too; a file that ends up embedding itself is an
+// error rather than an endless page.
+func ProcessEmbeds(path string, contents []byte) ([]byte, []string, error) {
+	if !embedDirective.Match(contents) {
+		return contents, nil, nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return processEmbeds(abs, contents, []string{abs})
+}
+
+func processEmbeds(path string, contents []byte, stack []string) ([]byte, []string, error) {
+	matches := embedDirective.FindAllSubmatchIndex(contents, -1)
+	if len(matches) == 0 {
+		return contents, nil, nil
+	}
+
+	code := metadata.CodeRegions(contents)
+	headings := topHeadings(contents)
+
+	var (
+		res         bytes.Buffer
+		attachments []string
+		last        int
+	)
+	for _, match := range matches {
+		if metadata.InCode(code, match[0]) {
+			continue
+		}
+
+		indent := contents[match[2]:match[3]]
+		target := string(contents[match[4]:match[5]])
+
+		file, section, _ := strings.Cut(target, "#")
+		if strings.TrimSpace(file) == "" {
+			return nil, nil, fmt.Errorf("embed %q names no file", target)
+		}
+
+		embedded := filepath.Join(filepath.Dir(path), filepath.FromSlash(strings.TrimSpace(file)))
+
+		// A section is told apart from the rest of its file, so that one
+		// section of a file may embed another.
+		identity := embedded
+		if section != "" {
+			identity += "#" + HeadingKey(section)
+		}
+		if slices.Contains(stack, identity) {
+			return nil, nil, fmt.Errorf(
+				"embedding %q would embed a document in itself: %s",
+				target, strings.Join(slices.Concat(stack, []string{identity}), " -> "),
+			)
+		}
+
+		body, declared, err := readEmbedded(embedded, section)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to embed %q: %w", target, err)
+		}
+
+		body, nested, err := processEmbeds(embedded, body, slices.Concat(stack, []string{identity}))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", embedded, err)
+		}
+
+		from, to := filepath.Dir(embedded), filepath.Dir(path)
+		for _, name := range slices.Concat(declared, nested) {
+			if name = rebase(name, from, to); !slices.Contains(attachments, name) {
+				attachments = append(attachments, name)
+			}
+		}
+
+		body = rebaseLinks(body, from, to)
+		body = shiftHeadings(body, headingLevelAt(headings, match[0])+1)
+
+		res.Write(contents[last:match[0]])
+		res.WriteString("\n")
+		for _, line := range strings.Split(strings.TrimRight(string(body), "\n"), "\n") {
+			if line != "" {
+				res.Write(indent)
+			}
+			res.WriteString(line)
+			res.WriteString("\n")
+		}
+		last = match[1]
+	}
+	res.Write(contents[last:])
+
+	return res.Bytes(), attachments, nil
+}
+
+// EmbedFiles returns the files a document embeds with Embed, and the files
+// those embed in turn, for a caller that needs to know what a document is
+// built from without building it.
+func EmbedFiles(path string, contents []byte) []string {
+	var files []string
+
+	var walk func(path string, contents []byte)
+	walk = func(path string, contents []byte) {
+		code := metadata.CodeRegions(contents)
+		for _, match := range embedDirective.FindAllSubmatchIndex(contents, -1) {
+			if metadata.InCode(code, match[0]) {
+				continue
+			}
+
+			file, _, _ := strings.Cut(string(contents[match[4]:match[5]]), "#")
+			if strings.TrimSpace(file) == "" {
+				continue
+			}
+
+			embedded := filepath.Join(filepath.Dir(path), filepath.FromSlash(strings.TrimSpace(file)))
+			if slices.Contains(files, embedded) {
+				continue
+			}
+			files = append(files, embedded)
+
+			if body, err := os.ReadFile(embedded); err == nil {
+				walk(embedded, body)
+			}
+		}
+	}
+	walk(path, contents)
+
+	return files
+}
+
+// readEmbedded reads what an Embed directive shows of a file, without its
+// headers, and the attachments that goes with.
+func readEmbedded(file, section string) ([]byte, []string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	data, err = metadata.StripIgnoredBlocks(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Its snippets and tables are read from where it is, as its links are.
+	data, err = ProcessSnippets(file, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err = ProcessTables(file, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta, body, err := metadata.ExtractMeta(data, "", false, false, "", nil, false, "", true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var attachments []string
+	if meta != nil {
+		attachments = meta.Attachments
+	}
+
+	if section = strings.TrimSpace(section); section == "" {
+		return body, attachments, nil
+	}
+
+	body, err = Section(body, section)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var mentioned []string
+	for _, name := range attachments {
+		if bytes.Contains(body, []byte(name)) {
+			mentioned = append(mentioned, name)
+		}
+	}
+
+	return body, mentioned, nil
+}
+
+// heading is where a top-level heading is in a document, and its level.
+type heading struct {
+	start, stop int
+	level       int
+	atx         bool
+	text        string
+}
+
+// topHeadings returns the headings of a document that are not inside anything
+// else -- a list item's or a quotation's are part of that -- in order.
+func topHeadings(source []byte) []heading {
+	doc := goldmark.New().Parser().Parse(text.NewReader(source))
+
+	var headings []heading
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		h, ok := child.(*ast.Heading)
+		if !ok || h.Lines().Len() == 0 {
+			continue
+		}
+
+		lines := h.Lines()
+		first, last := lines.At(0), lines.At(lines.Len()-1)
+		start := lineStart(source, first.Start)
+		atx := strings.HasPrefix(strings.TrimLeft(string(source[start:]), " "), "#")
+
+		// The end of the heading's last line, or of a setext heading's
+		// underline. A setext heading's lines carry their newline.
+		stop := lineEnd(source, max(last.Stop-1, last.Start))
+		if !atx {
+			stop = lineEnd(source, min(stop+1, len(source)))
+		}
+
+		var words []string
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			words = append(words, strings.TrimSpace(string(segment.Value(source))))
+		}
+
+		headings = append(headings, heading{
+			start: start, stop: stop, level: h.Level, atx: atx,
+			text: strings.Join(words, " "),
+		})
+	}
+
+	return headings
+}
+
+// headingLevelAt returns the level of the last heading before offset, or 0
+// when there is none.
+func headingLevelAt(headings []heading, offset int) int {
+	level := 0
+	for _, h := range headings {
+		if h.start >= offset {
+			break
+		}
+		level = h.level
+	}
+
+	return level
+}
+
+// shiftHeadings moves a document's headings up or down so that the highest of
+// them is at level, keeping their levels relative to each other. Nothing goes
+// below h6, which is as far as Markdown goes.
+func shiftHeadings(source []byte, level int) []byte {
+	headings := topHeadings(source)
+	if len(headings) == 0 {
+		return source
+	}
+
+	highest := headings[0].level
+	for _, h := range headings {
+		highest = min(highest, h.level)
+	}
+
+	shift := level - highest
+	if shift == 0 {
+		return source
+	}
+
+	var res bytes.Buffer
+	last := 0
+	for _, h := range headings {
+		res.Write(source[last:h.start])
+
+		marks := strings.Repeat("#", min(max(h.level+shift, 1), 6))
+		if h.atx {
+			// Only the marks change; whatever follows them -- an {#id}, a
+			// closing run of #s -- is kept as written.
+			line := string(source[h.start:h.stop])
+			indent := len(line) - len(strings.TrimLeft(line, " "))
+			res.WriteString(line[:indent] + marks + strings.TrimLeft(line[indent:], "#"))
+		} else {
+			// A setext heading can only be h1 or h2, so it is written the
+			// other way.
+			res.WriteString(marks + " " + h.text)
+		}
+
+		last = h.stop
+	}
+	res.Write(source[last:])
+
+	return res.Bytes()
+}
+
+var (
+	// inlineDestination is the destination of an inline link or image,
+	// [text](destination) or ![alt](<destination>).
+	inlineDestination = regexp.MustCompile(`!?\[(?:[^\[\]\n]|\[[^\[\]\n]*\])*\]\([ \t]*(<[^>\n]*>|[^)\s]+)`)
+
+	// referenceDestination is the destination of a link reference
+	// definition, [name]: destination.
+	referenceDestination = regexp.MustCompile(`(?m)^ {0,3}\[[^\]\n]+\]:[ \t]*(<[^>\n]*>|\S+)`)
+
+	// htmlDestination is the address an HTML image or link is written with.
+	htmlDestination = regexp.MustCompile(`<(?:img|a)\b[^>]*?\b(?:src|href)="([^"]*)"`)
+)
+
+// rebaseLinks rewrites the relative links and images of a document read from
+// one directory so that they lead to the same files from another.
+func rebaseLinks(source []byte, from, to string) []byte {
+	if filepath.Clean(from) == filepath.Clean(to) {
+		return source
+	}
+
+	code := metadata.CodeRegions(source)
+
+	type edit struct {
+		start, stop int
+	}
+	var edits []edit
+	for _, pattern := range []*regexp.Regexp{inlineDestination, referenceDestination, htmlDestination} {
+		for _, match := range pattern.FindAllSubmatchIndex(source, -1) {
+			if !metadata.InCode(code, match[0]) {
+				edits = append(edits, edit{match[2], match[3]})
+			}
+		}
+	}
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+
+	var res bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		if e.start < last {
+			continue
+		}
+
+		destination := string(source[e.start:e.stop])
+		angled := strings.HasPrefix(destination, "<") && strings.HasSuffix(destination, ">")
+		if angled {
+			destination = destination[1 : len(destination)-1]
+		}
+
+		rebased := rebase(destination, from, to)
+		if angled {
+			rebased = "<" + rebased + ">"
+		}
+
+		res.Write(source[last:e.start])
+		res.WriteString(rebased)
+		last = e.stop
+	}
+	res.Write(source[last:])
+
+	return res.Bytes()
+}
+
+// rebase rewrites a relative path written from one directory to lead to the
+// same file from another. Anything that is not a relative path -- an address,
+// an anchor on the same page, a rooted path, an ac: link -- is returned as it
+// is.
+func rebase(destination, from, to string) string {
+	if destination == "" || strings.Contains(destination, "://") || strings.HasPrefix(destination, "/") {
+		return destination
+	}
+	for _, prefix := range []string{"#", "mailto:", "ac:", "data:"} {
+		if strings.HasPrefix(destination, prefix) {
+			return destination
+		}
+	}
+
+	name, suffix := destination, ""
+	if i := strings.IndexAny(destination, "#?"); i >= 0 {
+		name, suffix = destination[:i], destination[i:]
+	}
+
+	rel, err := filepath.Rel(to, filepath.Join(from, filepath.FromSlash(name)))
+	if err != nil {
+		return destination
+	}
+
+	return filepath.ToSlash(rel) + suffix
+}
+
+// lineEnd returns the offset of the end of the line offset is on, before its
+// newline.
+func lineEnd(source []byte, offset int) int {
+	if i := bytes.IndexByte(source[offset:], '\n'); i >= 0 {
+		return offset + i
+	}
+
+	return len(source)
+}
@@ -0,0 +1,78 @@
+package includes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeEmbedFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestProcessEmbedsFitsTheSectionWhereItLands(t *testing.T) {
+	dir := t.TempDir()
+	writeEmbedFile(t, dir, "shared/setup.md",
+		"<!-- Space: OPS -->\n<!-- Title: Setup -->\n<!-- Attachment: diagram.png -->\n<!-- Attachment: unused.pdf -->\n\n"+
+			"# Setup\n\n## Installation\n\nSee ![the diagram](diagram.png) and [the notes](notes.md#later).\n\n"+
+			"### Check\n\n[site](https://example.com), [here](#check).\n\n[ref]: ./images/ref.png\n\n"+
+			"```\n[not a link](code.md)\n```\n\n## Other\n\nNot embedded.\n")
+
+	host := filepath.Join(dir, "docs", "page.md")
+	contents := []byte("# Page\n\n## Getting Started\n\n<!-- Embed: ../shared/setup.md#installation -->\n\nAfter.\n")
+
+	out, attachments, err := ProcessEmbeds(host, contents)
+	require.NoError(t, err)
+
+	assert.Equal(t, "# Page\n\n## Getting Started\n\n\n"+
+		"### Installation\n\nSee ![the diagram](../shared/diagram.png) and [the notes](../shared/notes.md#later).\n\n"+
+		"#### Check\n\n[site](https://example.com), [here](#check).\n\n[ref]: ../shared/images/ref.png\n\n"+
+		"```\n[not a link](code.md)\n```\n\n\nAfter.\n", string(out))
+	assert.Equal(t, []string{"../shared/diagram.png"}, attachments, "only what the section mentions")
+}
+
+func TestProcessEmbedsWholeFileAndNesting(t *testing.T) {
+	dir := t.TempDir()
+	writeEmbedFile(t, dir, "a.md", "Title\n=====\n\nA.\n\n<!-- Embed: sub/b.md -->\n")
+	writeEmbedFile(t, dir, "c.md", "Title\n=====\n\nC.\n")
+	writeEmbedFile(t, dir, "sub/b.md", "<!-- Attachment: b.png -->\n\n# B\n\n![b](b.png)\n")
+
+	out, attachments, err := ProcessEmbeds(filepath.Join(dir, "page.md"), []byte("<!-- Embed: a.md -->\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "\nTitle\n=====\n\nA.\n\n\n\n## B\n\n![b](sub/b.png)\n\n", string(out))
+	assert.Equal(t, []string{"sub/b.png"}, attachments)
+
+	out, _, err = ProcessEmbeds(filepath.Join(dir, "page.md"), []byte("# Page\n\n<!-- Embed: c.md -->\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "# Page\n\n\n## Title\n\nC.\n\n", string(out), "a setext heading is rewritten to shift it")
+}
+
+func TestProcessEmbedsRefusesACycle(t *testing.T) {
+	dir := t.TempDir()
+	writeEmbedFile(t, dir, "a.md", "A.\n\n<!-- Embed: b.md -->\n")
+	writeEmbedFile(t, dir, "b.md", "B.\n\n<!-- Embed: a.md -->\n")
+
+	_, _, err := ProcessEmbeds(filepath.Join(dir, "a.md"), []byte("A.\n\n<!-- Embed: b.md -->\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "would embed a document in itself")
+}
+
+func TestEmbedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeEmbedFile(t, dir, "a.md", "<!-- Embed: b.md#x -->\n")
+	writeEmbedFile(t, dir, "b.md", "# X\n")
+
+	contents := []byte("<!-- Embed: a.md -->\n\n```\n<!-- Embed: example.md -->\n```\n")
+	assert.Equal(t,
+		[]string{filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md")},
+		EmbedFiles(filepath.Join(dir, "page.md"), contents),
+	)
+}
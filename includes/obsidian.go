@@ -0,0 +1,218 @@
+package includes
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/kovetskiy/mark/v16/metadata"
+	cparser "github.com/kovetskiy/mark/v16/parser"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// obsidianEmbed is a line holding nothing but an Obsidian embed, ![[Note]] or
+// ![[Note#Section]], with whatever it is indented by.
+var obsidianEmbed = regexp.MustCompile(`(?m)^([ \t]*)!\[\[([^\[\]|\n]+?)(?:\|[^\[\]\n]*)?\]\][ \t]*$`)
+
+// ProcessObsidianEmbeds replaces each line that is nothing but an embedded
+// note -- ![[Note]], or ![[Note#Section]] for one section of it -- with the
+// note, or the section, in the way Obsidian shows it in place.
+//
+// It is done on the text, before the document is parsed, for the same reason
+// includes are: the embedded Markdown is then parsed with the document, and is
+// everything Markdown written there would be -- code blocks, callouts, links to
+// other notes and all. Splicing parsed nodes in from another source leaves
+// anything that reads its text from the source, a code block first of all,
+// reading it from the wrong one.
+//
+// Notes are found relative to the document embedding them, as relative links
+// are. Embedded images, and embeds in the middle of a line, are left to the
+// parser. A note that ends up embedding itself is an error rather than an
+// endless page.
+func ProcessObsidianEmbeds(path string, contents []byte) ([]byte, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return processObsidianEmbeds(abs, contents, []string{abs})
+}
+
+func processObsidianEmbeds(path string, contents []byte, stack []string) ([]byte, error) {
+	matches := obsidianEmbed.FindAllSubmatchIndex(contents, -1)
+	if len(matches) == 0 {
+		return contents, nil
+	}
+
+	code := metadata.CodeRegions(contents)
+
+	var res bytes.Buffer
+	last := 0
+	for _, match := range matches {
+		if metadata.InCode(code, match[4]) {
+			continue
+		}
+
+		indent := contents[match[2]:match[3]]
+		target := strings.TrimSpace(string(contents[match[4]:match[5]]))
+		line := bytes.Count(contents[:match[0]], []byte("\n")) + 1
+
+		file, section, _ := strings.Cut(target, "#")
+		destination := cparser.WikiLinkDestination(file)
+		if file == "" || !strings.HasSuffix(destination, ".md") {
+			// An image, or something else Obsidian shows rather than
+			// transcludes.
+			continue
+		}
+
+		note := filepath.Join(filepath.Dir(path), filepath.FromSlash(destination))
+		if slices.Contains(stack, note) {
+			return nil, fmt.Errorf(
+				"line %d: embedding %q would embed a note in itself: %s",
+				line, target, strings.Join(slices.Concat(stack, []string{note}), " -> "),
+			)
+		}
+
+		embedded, err := readEmbeddedNote(note, section)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: unable to embed %q: %w", line, target, err)
+		}
+
+		embedded, err = processObsidianEmbeds(note, embedded, slices.Concat(stack, []string{note}))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", note, err)
+		}
+
+		res.Write(contents[last:match[0]])
+		res.WriteString("\n")
+		for _, embeddedLine := range strings.Split(strings.TrimRight(string(embedded), "\n"), "\n") {
+			if embeddedLine != "" {
+				res.Write(indent)
+			}
+			res.WriteString(embeddedLine)
+			res.WriteString("\n")
+		}
+		last = match[1]
+	}
+	res.Write(contents[last:])
+
+	return res.Bytes(), nil
+}
+
+// obsidianEmbedAnywhere is an Obsidian embed wherever it is on a line.
+var obsidianEmbedAnywhere = regexp.MustCompile(`!\[\[([^\[\]|\n]+?)(?:\|[^\[\]\n]*)?\]\]`)
+
+// ObsidianEmbedTargets reports the files a document embeds with ![[...]] --
+// notes, as the .md files they are, and images -- in the order they appear and
+// skipping any shown inside a code block.
+func ObsidianEmbedTargets(contents []byte) []string {
+	code := metadata.CodeRegions(contents)
+
+	var targets []string
+	for _, match := range obsidianEmbedAnywhere.FindAllSubmatchIndex(contents, -1) {
+		if metadata.InCode(code, match[2]) {
+			continue
+		}
+
+		file, _, _ := strings.Cut(strings.TrimSpace(string(contents[match[2]:match[3]])), "#")
+		if file != "" {
+			targets = append(targets, cparser.WikiLinkDestination(file))
+		}
+	}
+
+	return targets
+}
+
+// readEmbeddedNote reads the part of a note an embed shows: all of it but its
+// headers, or one section of it.
+func readEmbeddedNote(file, section string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	data, err = metadata.StripIgnoredBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The headers say where the note is published, which is nothing to do
+	// with the page it is embedded in.
+	_, body, err := metadata.ExtractMeta(data, "", false, false, "", nil, false, "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	section = strings.TrimSpace(section)
+	switch {
+	case section == "":
+		return body, nil
+	case strings.HasPrefix(section, "^"):
+		return nil, fmt.Errorf("embedding a block is not supported; embed the section it is in")
+	default:
+		return Section(body, section)
+	}
+}
+
+// Section returns the section of a document under the heading named, from the
+// heading up to the next heading of the same level or above.
+//
+// Headings are compared by their letters and digits alone, without case, so
+// that a section can be named by its title or by its anchor alike.
+func Section(source []byte, heading string) ([]byte, error) {
+	want := HeadingKey(heading)
+
+	doc := goldmark.New().Parser().Parse(text.NewReader(source))
+
+	start, stop, level := -1, len(source), 0
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		h, ok := child.(*ast.Heading)
+		if !ok || h.Lines().Len() == 0 {
+			continue
+		}
+
+		if start < 0 {
+			if HeadingKey(string(h.Lines().Value(source))) == want {
+				start, level = lineStart(source, h.Lines().At(0).Start), h.Level
+			}
+			continue
+		}
+
+		if h.Level <= level {
+			stop = lineStart(source, h.Lines().At(0).Start)
+			break
+		}
+	}
+
+	if start < 0 {
+		return nil, fmt.Errorf("there is no heading %q", heading)
+	}
+
+	return source[start:stop], nil
+}
+
+// HeadingKey is what two spellings of a heading agree on: its letters and
+// digits, in order, folded to lower case.
+func HeadingKey(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// lineStart returns the offset of the start of the line offset is on.
+func lineStart(source []byte, offset int) int {
+	return bytes.LastIndexByte(source[:offset], '\n') + 1
+}
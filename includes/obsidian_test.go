@@ -0,0 +1,25 @@
+package includes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSectionEndsAtTheNextHeadingOfItsLevel(t *testing.T) {
+	source := []byte("# Title\n\nIntro.\n\nSet Up\n------\n\nSteps.\n\n### Detail\n\nMore.\n\n## Next\n\nOther.\n")
+
+	section, err := Section(source, "set-up")
+	require.NoError(t, err)
+	assert.Equal(t, "Set Up\n------\n\nSteps.\n\n### Detail\n\nMore.\n\n", string(section))
+
+	_, err = Section(source, "Missing")
+	assert.EqualError(t, err, `there is no heading "Missing"`)
+}
+
+func TestObsidianEmbedTargets(t *testing.T) {
+	contents := []byte("![[Setup#Install]]\n\nA ![[chart.png|200]] inline.\n\n```\n![[Example]]\n```\n")
+
+	assert.Equal(t, []string{"Setup.md", "chart.png"}, ObsidianEmbedTargets(contents))
+}
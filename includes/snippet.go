@@ -0,0 +1,332 @@
+package includes
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kovetskiy/mark/v16/metadata"
+)
+
+// snippetDirective is a line holding nothing but a Snippet directive,
+// <!-- Snippet: ../cmd/main.go#L10-L42 collapse title The entry point -->, with
+// whatever it is indented by: the file and what of it to show, and then the
+// options a fenced code block takes after its language.
+var snippetDirective = regexp.MustCompile(`(?m)^([ \t]*)<!--[ \t]*Snippet:[ \t]*(\S+)[ \t]*([^\n]*?)[ \t]*-->[ \t]*$`)
+
+var (
+	// snippetLines selects lines by number: L10, L10-L42 or L10-42.
+	snippetLines = regexp.MustCompile(`^L(\d+)(?:-L?(\d+))?$`)
+
+	// The two ways of marking a region of source that editors and
+	// documentation tools already know, written in a comment in whatever
+	// syntax the language has for one: #region name ... #endregion, and
+	// [start:name] ... [end:name].
+	regionStart = regexp.MustCompile(`#region[ \t]+([^\s]+)|\[start:([^\]\s]+)\]`)
+	regionEnd   = regexp.MustCompile(`#endregion\b|\[end:([^\]\s]+)\]`)
+)
+
+// ProcessSnippets replaces each Snippet directive with a fenced code block
+// holding the code it names: a whole file, the lines of it a #L10-L42 anchor
+// names, or the region an anchor names by the markers around it.
+//
+// A sample copied into a page goes stale the first time the code it was copied
+// from changes; one taken from the code when the page is published cannot.
+// The block is an ordinary fenced one, so it is rendered like any other: in
+// the language the file's extension says, with the options written after the
+// file -- collapse, title and the rest -- as they would be after the
+// language. linenumbers numbers the lines as they are numbered in the file.
+//
+// Files are found relative to the document, as relative links are. A file, a
+// line or a region that is not there is an error, so that a snippet whose code
+// moved fails the publish rather than showing nothing.
+func ProcessSnippets(path string, contents []byte) ([]byte, error) {
+	matches := snippetDirective.FindAllSubmatchIndex(contents, -1)
+	if len(matches) == 0 {
+		return contents, nil
+	}
+
+	code := metadata.CodeRegions(contents)
+
+	var res bytes.Buffer
+	last := 0
+	for _, match := range matches {
+		if metadata.InCode(code, match[0]) {
+			continue
+		}
+
+		indent := contents[match[2]:match[3]]
+		target := string(contents[match[4]:match[5]])
+		options := strings.Fields(string(contents[match[6]:match[7]]))
+
+		file, selector, _ := strings.Cut(target, "#")
+		file = filepath.Join(filepath.Dir(path), filepath.FromSlash(file))
+
+		lines, first, err := readSnippet(file, selector)
+		if err != nil {
+			return nil, fmt.Errorf("snippet %q: %w", target, err)
+		}
+
+		for i, option := range options {
+			if option == "title" {
+				break
+			}
+			if option == "linenumbers" {
+				options[i] = strconv.Itoa(first)
+			}
+		}
+
+		fence := strings.Repeat("`", max(3, longestRun(lines, '`')+1))
+		info := strings.Join(append([]string{snippetLanguage(file)}, options...), " ")
+
+		res.Write(contents[last:match[0]])
+		for _, line := range slices.Concat([]string{fence + info}, lines, []string{fence}) {
+			if line != "" {
+				res.Write(indent)
+			}
+			res.WriteString(line)
+			res.WriteString("\n")
+		}
+		last = lineEnd(contents, match[1])
+		if last < len(contents) {
+			last++
+		}
+	}
+	res.Write(contents[last:])
+
+	return res.Bytes(), nil
+}
+
+// SnippetFiles returns the files a document takes snippets from.
+func SnippetFiles(path string, contents []byte) []string {
+	code := metadata.CodeRegions(contents)
+
+	var files []string
+	for _, match := range snippetDirective.FindAllSubmatchIndex(contents, -1) {
+		if metadata.InCode(code, match[0]) {
+			continue
+		}
+
+		file, _, _ := strings.Cut(string(contents[match[4]:match[5]]), "#")
+		files = append(files, filepath.Join(filepath.Dir(path), filepath.FromSlash(file)))
+	}
+
+	return files
+}
+
+// readSnippet returns the lines of a file a snippet shows, dedented, and the
+// number of the first of them in the file.
+func readSnippet(file, selector string) ([]string, int, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	var (
+		shown []string
+		first int
+	)
+	switch match := snippetLines.FindStringSubmatch(selector); {
+	case selector == "":
+		shown, first = lines, 1
+
+	case match != nil:
+		from, _ := strconv.Atoi(match[1])
+		to := from
+		if match[2] != "" {
+			to, _ = strconv.Atoi(match[2])
+		}
+
+		switch {
+		case from < 1 || to < from:
+			return nil, 0, fmt.Errorf("%s is not a range of lines: name them as L10-L42", selector)
+		case to > len(lines):
+			return nil, 0, fmt.Errorf("%s is past the end of %s, which has %d lines", selector, file, len(lines))
+		}
+
+		shown, first = lines[from-1:to], from
+
+	default:
+		shown, first, err = region(lines, selector)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	return dedent(shown), first, nil
+}
+
+// region returns the lines between the markers of the region named, without
+// the markers of any region inside it, and the number of the first of them.
+func region(lines []string, name string) ([]string, int, error) {
+	start := -1
+	vscode := false
+	for i, line := range lines {
+		if match := regionStart.FindStringSubmatch(line); match != nil && (match[1] == name || match[2] == name) {
+			start, vscode = i, match[1] == name
+			break
+		}
+	}
+	if start < 0 {
+		return nil, 0, fmt.Errorf("there is no region %q", name)
+	}
+
+	var shown []string
+	depth := 1
+	for _, line := range lines[start+1:] {
+		if match := regionEnd.FindStringSubmatch(line); match != nil {
+			// #endregion names nothing, and closes whichever #region was
+			// opened last.
+			if vscode && match[1] == "" {
+				depth--
+			}
+			if depth == 0 || (!vscode && match[1] == name) {
+				return shown, start + 2, nil
+			}
+			continue
+		}
+
+		if match := regionStart.FindStringSubmatch(line); match != nil {
+			if vscode && match[1] != "" {
+				depth++
+			}
+			continue
+		}
+
+		shown = append(shown, line)
+	}
+
+	return nil, 0, fmt.Errorf("region %q is not closed", name)
+}
+
+// dedent removes the indentation all of the lines share, so that a region cut
+// from the middle of a function starts at the margin.
+func dedent(lines []string) []string {
+	prefix := ""
+	set := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !set {
+			prefix, set = indent, true
+			continue
+		}
+
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = strings.TrimPrefix(line, prefix)
+		if strings.TrimSpace(out[i]) == "" {
+			out[i] = ""
+		}
+	}
+
+	return out
+}
+
+// longestRun returns the length of the longest run of c in any of lines, for
+// a fence the code cannot close early.
+func longestRun(lines []string, c byte) int {
+	longest := 0
+	for _, line := range lines {
+		run := 0
+		for i := 0; i < len(line); i++ {
+			if line[i] != c {
+				run = 0
+				continue
+			}
+			run++
+			longest = max(longest, run)
+		}
+	}
+
+	return longest
+}
+
+// snippetLanguages are the languages of code blocks, by the extension of the
+// file the code is in.
+var snippetLanguages = map[string]string{
+	".bash":   "bash",
+	".c":      "c",
+	".cc":     "cpp",
+	".cpp":    "cpp",
+	".cs":     "csharp",
+	".css":    "css",
+	".cxx":    "cpp",
+	".diff":   "diff",
+	".erl":    "erlang",
+	".ex":     "elixir",
+	".exs":    "elixir",
+	".go":     "go",
+	".gradle": "groovy",
+	".groovy": "groovy",
+	".h":      "c",
+	".hcl":    "hcl",
+	".hpp":    "cpp",
+	".html":   "html",
+	".java":   "java",
+	".js":     "javascript",
+	".json":   "json",
+	".jsx":    "javascript",
+	".kt":     "kotlin",
+	".kts":    "kotlin",
+	".lua":    "lua",
+	".mjs":    "javascript",
+	".patch":  "diff",
+	".php":    "php",
+	".pl":     "perl",
+	".proto":  "protobuf",
+	".ps1":    "powershell",
+	".py":     "python",
+	".r":      "r",
+	".rb":     "ruby",
+	".rs":     "rust",
+	".scala":  "scala",
+	".scss":   "sass",
+	".sh":     "bash",
+	".sql":    "sql",
+	".swift":  "swift",
+	".tf":     "hcl",
+	".toml":   "toml",
+	".ts":     "typescript",
+	".tsx":    "typescript",
+	".vb":     "vb",
+	".xml":    "xml",
+	".yaml":   "yaml",
+	".yml":    "yaml",
+	".zsh":    "bash",
+}
+
+// snippetLanguage returns the language of the code in a file, by its
+// extension, or by its name for the files that have none. Code in anything
+// else is shown as text: a block with no language would take the first option
+// for one.
+func snippetLanguage(file string) string {
+	if language, ok := snippetLanguages[strings.ToLower(filepath.Ext(file))]; ok {
+		return language
+	}
+
+	switch base := filepath.Base(file); {
+	case base == "Dockerfile" || strings.HasPrefix(base, "Dockerfile."):
+		return "dockerfile"
+	case base == "Makefile" || base == "GNUmakefile":
+		return "makefile"
+	}
+
+	return "text"
+}
@@ -0,0 +1,65 @@
+package includes
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const snippetSource = "package main\n\nfunc main() {\n" +
+	"\t// #region setup\n\tconfig := load()\n\t// [start:inner]\n\tcheck(config)\n\t// [end:inner]\n\t// #endregion\n" +
+	"\trun(config)\n}\n"
+
+func TestProcessSnippetsByLinesAndRegion(t *testing.T) {
+	dir := t.TempDir()
+	writeEmbedFile(t, dir, "cmd/main.go", snippetSource)
+
+	page := filepath.Join(dir, "docs", "page.md")
+
+	out, err := ProcessSnippets(page, []byte("Before.\n\n<!-- Snippet: ../cmd/main.go#L3-L3 -->\n\nAfter.\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Before.\n\n```go\nfunc main() {\n```\n\nAfter.\n", string(out))
+
+	out, err = ProcessSnippets(page, []byte("<!-- Snippet: ../cmd/main.go#setup linenumbers collapse title Setting up -->\n"))
+	require.NoError(t, err)
+	assert.Equal(t,
+		"```go 5 collapse title Setting up\nconfig := load()\ncheck(config)\n```\n", string(out),
+		"dedented, without the markers inside, and numbered as in the file")
+
+	out, err = ProcessSnippets(page, []byte("<!-- Snippet: ../cmd/main.go#inner -->\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "```go\ncheck(config)\n```\n", string(out))
+}
+
+func TestProcessSnippetsFenceAndLanguage(t *testing.T) {
+	dir := t.TempDir()
+	writeEmbedFile(t, dir, "README", "Use:\n\n```\nmark\n```\n")
+
+	out, err := ProcessSnippets(filepath.Join(dir, "page.md"), []byte("- Step:\n\n  <!-- Snippet: README -->\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "- Step:\n\n  ````text\n  Use:\n\n  ```\n  mark\n  ```\n  ````\n", string(out))
+}
+
+func TestProcessSnippetsMissing(t *testing.T) {
+	dir := t.TempDir()
+	writeEmbedFile(t, dir, "main.go", snippetSource)
+
+	page := filepath.Join(dir, "page.md")
+	for target, message := range map[string]string{
+		"gone.go":          "no such file",
+		"main.go#L10-L20":  "past the end",
+		"main.go#L5-L2":    "not a range of lines",
+		"main.go#teardown": `there is no region "teardown"`,
+	} {
+		_, err := ProcessSnippets(page, []byte("<!-- Snippet: "+target+" -->\n"))
+		require.Error(t, err, target)
+		assert.Contains(t, err.Error(), message, target)
+		assert.Contains(t, err.Error(), `snippet "`+target+`"`)
+	}
+
+	out, err := ProcessSnippets(page, []byte("```\n<!-- Snippet: gone.go -->\n```\n"))
+	require.NoError(t, err, "a directive shown in a code block is left alone")
+	assert.Equal(t, "```\n<!-- Snippet: gone.go -->\n```\n", string(out))
+}
@@ -0,0 +1,221 @@
+package includes
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kovetskiy/mark/v16/datafile"
+	"github.com/kovetskiy/mark/v16/metadata"
+	"go.yaml.in/yaml/v3"
+)
+
+// tableDirective is a Table directive on lines of its own: the data file on
+// the first line, and how to show it on the lines after, up to the end of the
+// comment.
+//
+//	<!-- Table: services.csv
+//	     Columns: [name, owner, tier]
+//	     Headers: {name: Service}
+//	     Sort: [tier, -name]
+//	     Filter: {tier: [1, 2]}
+//	-->
+var tableDirective = regexp.MustCompile(`(?m)^([ \t]*)<!--[ \t]*Table:[ \t]*(\S+?)(\s(?:[^-]|-[^-]|--[^>])*?)?-->[ \t]*$`)
+
+// tableConfig is how a Table directive says to show its data.
+type tableConfig struct {
+	// Columns are the columns shown, in order. All of them by default.
+	Columns []string `yaml:"Columns"`
+
+	// Headers are the headings columns are shown under, by column. A column
+	// not named here is headed by its own name.
+	Headers map[string]string `yaml:"Headers"`
+
+	// Sort is the columns rows are sorted by, a column prefixed with - from
+	// the highest value down.
+	Sort stringList `yaml:"Sort"`
+
+	// Filter is the values of a column a row is shown for, by column.
+	Filter map[string]stringList `yaml:"Filter"`
+}
+
+// stringList is a list of strings that may be written as a single one.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringList{node.Value}
+		return nil
+	}
+
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+
+	return nil
+}
+
+// ProcessTables replaces each Table directive with a table of the data file it
+// names: a CSV file with a header, or a YAML or JSON file holding a list of
+// objects, found relative to the document.
+//
+// An inventory kept as data and a table copied from it by hand drift apart;
+// one made from the data when the page is published cannot. The table is
+// written as a Markdown one, so a cell may hold a link or emphasis like any
+// other, and is published as any other table is.
+//
+// A file that is not there or has no rows, a column it does not have, or a
+// directive that does not parse is an error. A filter that leaves no rows
+// leaves no table: a table of headings alone is not one Confluence keeps.
+func ProcessTables(path string, contents []byte) ([]byte, error) {
+	matches := tableDirective.FindAllSubmatchIndex(contents, -1)
+	if len(matches) == 0 {
+		return contents, nil
+	}
+
+	code := metadata.CodeRegions(contents)
+
+	var res bytes.Buffer
+	last := 0
+	for _, match := range matches {
+		if metadata.InCode(code, match[0]) {
+			continue
+		}
+
+		indent := string(contents[match[2]:match[3]])
+		target := string(contents[match[4]:match[5]])
+
+		var configuration []byte
+		if match[6] >= 0 {
+			configuration = contents[match[6]:match[7]]
+		}
+
+		table, err := readTable(filepath.Join(filepath.Dir(path), filepath.FromSlash(target)), configuration)
+		if err != nil {
+			return nil, fmt.Errorf("table %q: %w", target, err)
+		}
+
+		res.Write(contents[last:match[0]])
+		for _, line := range strings.SplitAfter(strings.TrimSuffix(table, "\n"), "\n") {
+			res.WriteString(indent)
+			res.WriteString(line)
+		}
+		last = match[1]
+	}
+	res.Write(contents[last:])
+
+	return res.Bytes(), nil
+}
+
+// TableFiles returns the data files a document shows as tables.
+func TableFiles(path string, contents []byte) []string {
+	code := metadata.CodeRegions(contents)
+
+	var files []string
+	for _, match := range tableDirective.FindAllSubmatchIndex(contents, -1) {
+		if metadata.InCode(code, match[0]) {
+			continue
+		}
+
+		files = append(files, filepath.Join(filepath.Dir(path), filepath.FromSlash(string(contents[match[4]:match[5]]))))
+	}
+
+	return files
+}
+
+// readTable reads a data file and writes it as a Markdown table, as a Table
+// directive's configuration says to.
+func readTable(file string, configuration []byte) (string, error) {
+	var config tableConfig
+
+	decoder := yaml.NewDecoder(bytes.NewReader(configuration))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && strings.TrimSpace(string(configuration)) != "" {
+		return "", fmt.Errorf("unable to parse its configuration: %w", err)
+	}
+
+	table, err := datafile.Read(file)
+	if err != nil {
+		return "", err
+	}
+
+	if len(table.Rows) == 0 {
+		return "", fmt.Errorf("%s has no rows to show", file)
+	}
+
+	filter := map[string][]string{}
+	for column, values := range config.Filter {
+		filter[column] = values
+	}
+	if err := table.Filter(filter); err != nil {
+		return "", err
+	}
+
+	if err := table.Sort(config.Sort); err != nil {
+		return "", err
+	}
+
+	if len(config.Columns) > 0 {
+		if err := table.Select(config.Columns); err != nil {
+			return "", err
+		}
+	}
+
+	for column := range config.Headers {
+		if !slices.Contains(table.Columns, column) {
+			return "", fmt.Errorf("there is no column %q shown to rename", column)
+		}
+	}
+
+	if len(table.Rows) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	row := func(cells []string) {
+		b.WriteString("|")
+		for _, cell := range cells {
+			b.WriteString(" ")
+			b.WriteString(tableCell(cell))
+			b.WriteString(" |")
+		}
+		b.WriteString("\n")
+	}
+
+	headers := make([]string, len(table.Columns))
+	rule := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		headers[i] = column
+		if header, ok := config.Headers[column]; ok {
+			headers[i] = header
+		}
+		rule[i] = "---"
+	}
+
+	row(headers)
+	row(rule)
+	for _, values := range table.Rows {
+		cells := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			cells[i] = datafile.Format(values[column])
+		}
+		row(cells)
+	}
+
+	return b.String(), nil
+}
+
+// tableCell is a value as a Markdown table's cell has it: on one line, with a
+// pipe in it escaped so that it does not end the cell.
+func tableCell(value string) string {
+	value = strings.TrimSpace(value)
+	value = strings.ReplaceAll(value, "|", `\|`)
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+
+	return strings.ReplaceAll(value, "\n", "<br/>")
+}
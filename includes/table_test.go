@@ -0,0 +1,58 @@
+package includes
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessTables(t *testing.T) {
+	dir := t.TempDir()
+	writeEmbedFile(t, dir, "data/services.yaml",
+		"- name: api\n  owner: core\n  tier: 1\n  notes: \"a | b\"\n"+
+			"- name: web\n  owner: front\n  tier: 2\n"+
+			"- name: db\n  owner: core\n  tier: 1\n")
+
+	page := filepath.Join(dir, "docs", "page.md")
+	contents := []byte("Services:\n\n<!-- Table: ../data/services.yaml\n" +
+		"     Columns: [name, notes]\n     Headers: {name: Service}\n" +
+		"     Sort: -name\n     Filter: {owner: core}\n-->\n\nAfter.\n")
+
+	out, err := ProcessTables(page, contents)
+	require.NoError(t, err)
+	assert.Equal(t, "Services:\n\n| Service | notes |\n| --- | --- |\n| db |  |\n| api | a \\| b |\n\nAfter.\n", string(out))
+
+	out, err = ProcessTables(page, []byte("<!-- Table: ../data/services.yaml -->\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "| name | owner | tier | notes |\n| --- | --- | --- | --- |\n"+
+		"| api | core | 1 | a \\| b |\n| web | front | 2 |  |\n| db | core | 1 |  |\n", string(out))
+
+	assert.Equal(t, []string{filepath.Join(dir, "data", "services.yaml")}, TableFiles(page, contents))
+
+	out, err = ProcessTables(page, []byte("Before.\n\n<!-- Table: ../data/services.yaml\n  Filter: {owner: nobody}\n-->\n\nAfter.\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Before.\n\n\n\nAfter.\n", string(out), "no rows left is no table")
+}
+
+func TestProcessTablesErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeEmbedFile(t, dir, "services.csv", "name,tier\napi,1\n")
+	writeEmbedFile(t, dir, "empty.csv", "")
+	writeEmbedFile(t, dir, "header.csv", "name,tier\n")
+
+	page := filepath.Join(dir, "page.md")
+	for directive, message := range map[string]string{
+		"<!-- Table: gone.csv -->":                             "no such file",
+		"<!-- Table: services.csv\n  Columns: [owner]\n-->":    `no column "owner"`,
+		"<!-- Table: services.csv\n  Headers: {owner: x}\n-->": `no column "owner" shown to rename`,
+		"<!-- Table: services.csv\n  Sorted: name\n-->":        "field Sorted not found",
+		"<!-- Table: empty.csv -->":                            filepath.Join(dir, "empty.csv") + " has no rows to show",
+		"<!-- Table: header.csv -->":                           filepath.Join(dir, "header.csv") + " has no rows to show",
+	} {
+		_, err := ProcessTables(page, []byte(directive+"\n"))
+		require.Error(t, err, directive)
+		assert.Contains(t, err.Error(), message, directive)
+	}
+}
@@ -247,25 +247,19 @@ func findNextMacroStart(s string) int {
 	}
 }
 
-func ExtractMacros(
-	base string,
-	includePath string,
-	contents []byte,
-	templates *template.Template,
-) ([]Macro, []byte, error) {
-	var extracted []Macro
-	remaining := contents
-
-	searchOffset := 0
-	for searchOffset < len(remaining) {
-		relStart := bytes.Index(remaining[searchOffset:], []byte("<!--"))
+// findMacroDirective finds the first macro directive at or after searchOffset,
+// returning it with the offsets it starts and ends at, or nil when there is
+// none.
+func findMacroDirective(contents []byte, searchOffset int) (*MacroDirective, int, int, error) {
+	for searchOffset < len(contents) {
+		relStart := bytes.Index(contents[searchOffset:], []byte("<!--"))
 		if relStart == -1 {
 			break
 		}
 		startIdx := searchOffset + relStart
 
 		// Check if this comment block is a macro directive
-		s := string(remaining[startIdx:])
+		s := string(contents[startIdx:])
 		macroIdx := strings.Index(s, "Macro:")
 		firstEndIdx := strings.Index(s, "-->")
 		if macroIdx == -1 || firstEndIdx == -1 || macroIdx > firstEndIdx {
@@ -297,16 +291,72 @@ func ExtractMacros(
 		}
 		endIdx := startIdx + relEnd + 3
 
-		rawDirective := remaining[startIdx:endIdx]
+		rawDirective := contents[startIdx:endIdx]
 		dir, err := ParseMacroDirective(rawDirective)
 		if err != nil {
-			return nil, contents, err
+			return nil, 0, 0, err
 		}
 		if dir == nil {
 			searchOffset = startIdx + 4
 			continue
 		}
 
+		return dir, startIdx, endIdx, nil
+	}
+
+	return nil, 0, 0, nil
+}
+
+// Directives reports the macro directives a document declares, in order,
+// without loading their templates or compiling their patterns.
+func Directives(contents []byte) []MacroDirective {
+	var directives []MacroDirective
+
+	searchOffset := 0
+	for {
+		dir, _, endIdx, err := findMacroDirective(contents, searchOffset)
+		if err != nil || dir == nil {
+			return directives
+		}
+
+		directives = append(directives, *dir)
+		searchOffset = endIdx
+	}
+}
+
+// TemplateFiles reports the files a document's macros take their templates
+// from, in the order the macros are declared. A macro whose template is
+// written inline in its config has no file.
+func TemplateFiles(contents []byte) []string {
+	var files []string
+	for _, dir := range Directives(contents) {
+		if !strings.HasPrefix(dir.Template, "#") {
+			files = append(files, dir.Template)
+		}
+	}
+
+	return files
+}
+
+func ExtractMacros(
+	base string,
+	includePath string,
+	contents []byte,
+	templates *template.Template,
+) ([]Macro, []byte, error) {
+	var extracted []Macro
+	remaining := contents
+
+	searchOffset := 0
+	for {
+		dir, startIdx, endIdx, err := findMacroDirective(remaining, searchOffset)
+		if err != nil {
+			return nil, contents, err
+		}
+		if dir == nil {
+			break
+		}
+
 		var m Macro
 		if strings.HasPrefix(dir.Template, "#") {
 			m.Name = dir.Template[1:]
@@ -114,3 +114,12 @@ func TestExtractMacros_InlineTemplateUsesDefaultDelims(t *testing.T) {
 	assert.Equal(t, "Hello world", out.String(),
 		"an inline macro must use {{ }} regardless of any Delims: an include declared")
 }
+
+func TestTemplateFiles(t *testing.T) {
+	contents := []byte("<!-- Macro: :box:\n     Template: box.tpl\n     Title: Box -->\n" +
+		"<!-- Macro: :inline:\n     Template: #body\n     body: <b>x</b> -->\n" +
+		"<!-- Not a macro -->\n" +
+		"<!-- Macro: :note:\n     Template: notes/note.tpl -->\n\nText.\n")
+
+	assert.Equal(t, []string{"box.tpl", "notes/note.tpl"}, TemplateFiles(contents))
+}
@@ -0,0 +1,370 @@
+package mark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/manifest"
+	"github.com/rs/zerolog/log"
+)
+
+// openManifest returns the page manifest the configuration points at: the
+// manifest file if there is one, Confluence otherwise.
+func openManifest(config Config) (*manifest.Store, *confluence.API) {
+	api := confluence.NewAPI(config.BaseURL, config.Username, config.Password, config.InsecureSkipTLSVerify)
+
+	if config.ManifestFile != "" {
+		return manifest.NewFileStore(config.ManifestFile), api
+	}
+
+	return manifest.NewStore(api), api
+}
+
+// ListManifest writes every file recorded in a space's manifest, with the
+// page it publishes to and the title it was last published under.
+func ListManifest(config Config, space string) error {
+	store, _ := openManifest(config)
+
+	entries, err := store.Entries(space)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	w := tabwriter.NewWriter(config.output(), 0, 4, 2, ' ', 0)
+	for _, path := range paths {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", path, entries[path].PageID, entries[path].Title)
+	}
+
+	return w.Flush()
+}
+
+// ShowManifest writes everything a space's manifest records about one file.
+func ShowManifest(config Config, space, file string) error {
+	store, _ := openManifest(config)
+
+	entries, err := store.Entries(space)
+	if err != nil {
+		return err
+	}
+
+	entry, ok := entries[manifest.Key(file)]
+	if !ok {
+		return fmt.Errorf("%s is not recorded in the manifest of space %q", manifest.Key(file), space)
+	}
+
+	data, err := json.MarshalIndent(struct {
+		Space string `json:"space"`
+		Path  string `json:"path"`
+		manifest.Entry
+	}{space, manifest.Key(file), entry}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(config.output(), "%s\n", data)
+
+	return err
+}
+
+// ForgetManifest drops a file from a space's manifest. Its page is left alone;
+// the next publish of the file finds a page by title again, as if tracking had
+// only just been turned on.
+func ForgetManifest(config Config, space, file string) error {
+	store, _ := openManifest(config)
+
+	entries, err := store.Entries(space)
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[manifest.Key(file)]; !ok {
+		return fmt.Errorf("%s is not recorded in the manifest of space %q", manifest.Key(file), space)
+	}
+
+	if err := store.Forget(space, file); err != nil {
+		return err
+	}
+
+	return store.Save()
+}
+
+// SetManifest records that a file publishes to a page, replacing whatever was
+// recorded for it before. The page has to exist; its title is recorded as the
+// one the file was last published under.
+//
+// The fingerprint of the file is recorded too when the file can be read, so
+// that renaming it is followed like any other. The version is not: mark has
+// not written the page, and a version it did not write would tell
+// --no-overwrite something that is not true.
+func SetManifest(config Config, space, file, pageID string) error {
+	store, api := openManifest(config)
+	if config.Files != "" {
+		store.SetRunFiles(config.Files, nil)
+	}
+
+	pg, err := api.GetPageByID(pageID)
+	if err != nil {
+		return fmt.Errorf("unable to find page %s: %w", pageID, err)
+	}
+
+	var hash string
+	if _, sourceHash, _, err := readDocument(file, config); err == nil {
+		hash = sourceHash
+	}
+
+	if err := store.Record(space, file, pg.ID, pg.Title, hash); err != nil {
+		return err
+	}
+
+	return store.Save()
+}
+
+// FsckManifest checks a space's manifest against Confluence: that every page
+// it records still exists, that each still has the title it was published
+// under, and that no page is claimed by more than one file. Each problem is
+// written as the file it concerns and what is wrong with it.
+//
+// A title that differs is not necessarily wrong -- a publish renames the page
+// back -- but it does mean somebody renamed it by hand, which is worth knowing
+// before the publish that undoes it.
+func FsckManifest(config Config, space string) error {
+	store, api := openManifest(config)
+
+	entries, err := store.Entries(space)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(entries))
+	claims := map[string][]string{}
+	for path, entry := range entries {
+		paths = append(paths, path)
+		claims[entry.PageID] = append(claims[entry.PageID], path)
+	}
+	sort.Strings(paths)
+
+	problems := 0
+	problem := func(path, format string, args ...any) {
+		problems++
+		_, _ = fmt.Fprintf(config.output(), "%s: %s\n", path, fmt.Sprintf(format, args...))
+	}
+
+	for _, path := range paths {
+		entry := entries[path]
+
+		if owners := claims[entry.PageID]; len(owners) > 1 {
+			sort.Strings(owners)
+			others := slices.DeleteFunc(slices.Clone(owners), func(owner string) bool { return owner == path })
+			problem(path, "page %s is also claimed by %s", entry.PageID, strings.Join(others, ", "))
+		}
+
+		pg, err := api.GetPageByID(entry.PageID)
+		switch {
+		case errors.Is(err, confluence.ErrNotFound):
+			problem(path, "page %s no longer exists", entry.PageID)
+			continue
+		case err != nil:
+			return fmt.Errorf("unable to check page %s of %s: %w", entry.PageID, path, err)
+		}
+
+		if entry.Title != "" && pg.Title != entry.Title {
+			problem(path, "page %s is titled %q, not %q as it was published", entry.PageID, pg.Title, entry.Title)
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) in the manifest of space %q", problems, space)
+	}
+
+	log.Info().Msgf("space %q: %d tracked page(s) checked, no problems", space, len(paths))
+
+	return nil
+}
+
+// AdoptManifest records the pages that already exist for the files matching
+// --files, for a space that was published without --track-pages.
+//
+// Turning tracking on is otherwise safe only if nothing is renamed before the
+// first tracked publish, since that is when the mapping is first written. This
+// writes it up front instead, matching each file to its page the way a publish
+// would find it: by title, and under the parents its headers declare. A file
+// whose page cannot be found, or is found somewhere else, is left out and said
+// so -- a wrong mapping is worse than none. So is a file already tracked, and a
+// page another file already claims.
+//
+// Only the spaces named are adopted, or every space the files publish to if
+// none is.
+func AdoptManifest(config Config, spaces []string) error {
+	store, api := openManifest(config)
+
+	files, err := doublestar.FilepathGlob(config.Files)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no files matched")
+	}
+	store.SetRunFiles(config.Files, files)
+
+	adopted, skipped := 0, 0
+	skip := func(file, format string, args ...any) {
+		skipped++
+		log.Warn().Msgf("%s: not adopted: %s", file, fmt.Sprintf(format, args...))
+	}
+
+	claimed := map[string]map[string]string{}
+
+	for _, file := range files {
+		_, hash, meta, err := readDocument(file, config)
+		if err != nil {
+			skip(file, "%s", err)
+			continue
+		}
+		if meta == nil || meta.Space == "" || meta.Title == "" {
+			skip(file, "it has no space and title to find a page by")
+			continue
+		}
+		if len(spaces) > 0 && !slices.Contains(spaces, meta.Space) {
+			continue
+		}
+
+		if _, ok := claimed[meta.Space]; !ok {
+			entries, err := store.Entries(meta.Space)
+			if err != nil {
+				return err
+			}
+			claimed[meta.Space] = map[string]string{}
+			for path, entry := range entries {
+				claimed[meta.Space][entry.PageID] = path
+			}
+		}
+
+		if _, ok, err := store.Lookup(meta.Space, file); err != nil {
+			return err
+		} else if ok {
+			skip(file, "it is already tracked")
+			continue
+		}
+
+		pg, err := api.FindPage(meta.Space, meta.Title, meta.Type)
+		if err != nil {
+			return fmt.Errorf("unable to find page %q: %w", meta.Title, err)
+		}
+		if pg == nil {
+			skip(file, "there is no page titled %q in space %q; publishing will create it", meta.Title, meta.Space)
+			continue
+		}
+
+		if !underParents(pg, meta.Parents) {
+			skip(file, "page %q is not under %s", meta.Title, strings.Join(meta.Parents, " > "))
+			continue
+		}
+
+		if owner, ok := claimed[meta.Space][pg.ID]; ok {
+			skip(file, "page %q is already tracked as %s", meta.Title, owner)
+			continue
+		}
+
+		if err := store.Record(meta.Space, file, pg.ID, pg.Title, hash); err != nil {
+			return err
+		}
+		claimed[meta.Space][pg.ID] = manifest.Key(file)
+		adopted++
+
+		log.Info().Msgf("%s: adopted page %s %q", file, pg.ID, pg.Title)
+	}
+
+	if err := store.Save(); err != nil {
+		return fmt.Errorf("unable to save the manifest: %w", err)
+	}
+
+	log.Info().Msgf("%d page(s) adopted, %d file(s) left out", adopted, skipped)
+
+	return nil
+}
+
+// underParents reports whether a page sits directly under the parents a
+// document declares, the nearest of them last. A document declaring none can
+// be anywhere: it is placed by what the run is given, not by its headers.
+func underParents(pg *confluence.PageInfo, parents []string) bool {
+	if len(parents) > len(pg.Ancestors) {
+		return false
+	}
+
+	nearest := pg.Ancestors[len(pg.Ancestors)-len(parents):]
+	for i, parent := range parents {
+		if nearest[i].Title != parent {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ExportManifest copies the page manifest of each of the spaces from
+// Confluence into the manifest file, for a repository moving to
+// --manifest-file.
+func ExportManifest(config Config, spaces []string) error {
+	return migrateManifest(config, spaces, true)
+}
+
+// ImportManifest copies the page manifest of each of the spaces from the
+// manifest file into Confluence, for a repository moving back from
+// --manifest-file.
+func ImportManifest(config Config, spaces []string) error {
+	return migrateManifest(config, spaces, false)
+}
+
+// migrateManifest copies the manifests of the spaces from one place they can
+// be kept to the other. Whatever the destination already holds is kept unless
+// the source has a mapping for the same file; see manifest.Store.CopyFrom.
+//
+// The source is left as it was. Both copies agree until the next publish, and
+// removing the old one is left to a person once the new one has been used.
+func migrateManifest(config Config, spaces []string, toFile bool) error {
+	if config.ManifestFile == "" {
+		return errors.New("--manifest-file is required: it is the file the manifest is copied to or from")
+	}
+	if len(spaces) == 0 {
+		return errors.New("no space given: name the key of each space whose manifest is to be copied")
+	}
+
+	api := confluence.NewAPI(config.BaseURL, config.Username, config.Password, config.InsecureSkipTLSVerify)
+
+	remote := manifest.NewStore(api)
+	file := manifest.NewFileStore(config.ManifestFile)
+
+	from, to := remote, file
+	fromName, toName := "Confluence", config.ManifestFile
+	if !toFile {
+		from, to = file, remote
+		fromName, toName = toName, fromName
+	}
+
+	for _, space := range spaces {
+		copied, err := to.CopyFrom(from, space)
+		if err != nil {
+			return fmt.Errorf("unable to copy the manifest of space %q: %w", space, err)
+		}
+
+		log.Info().Msgf("space %q: %d page mapping(s) copied from %s to %s", space, copied, fromName, toName)
+	}
+
+	if err := to.Save(); err != nil {
+		return fmt.Errorf("unable to save the manifest to %s: %w", toName, err)
+	}
+
+	return nil
+}
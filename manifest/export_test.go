@@ -0,0 +1,11 @@
+package manifest
+
+import "time"
+
+// SetLockLease shortens the lease of the locks taken from here on, for a test
+// to see them renewed, and returns what puts it back.
+func SetLockLease(lease time.Duration) func() {
+	was := lockLease
+	lockLease = lease
+	return func() { lockLease = was }
+}
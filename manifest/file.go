@@ -0,0 +1,257 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fileDocument is the manifest file as stored: every space's mapping in one
+// document, pages and folders side by side.
+//
+// Unlike the properties, the file is not split into shards. The bound that
+// made splitting necessary is Confluence's, and a file in a repository has
+// none; one readable document that diffs cleanly in review is worth more than
+// an arrangement nobody would recognise there.
+type fileDocument struct {
+	Version int                  `json:"version"`
+	Spaces  map[string]fileSpace `json:"spaces"`
+}
+
+// fileSpace is one space's mapping in the manifest file.
+type fileSpace struct {
+	Pages   map[string]Entry  `json:"pages,omitempty"`
+	Folders map[string]string `json:"folders,omitempty"`
+}
+
+// NewFileStore returns a Store that keeps the mapping in a JSON file rather
+// than in Confluence.
+//
+// Some Data Center instances do not let ordinary accounts write content
+// properties, and a mapping held in Confluence cannot be reviewed alongside
+// the documents it describes. The file holds exactly what the properties
+// would, and everything the Store does -- lookups, renames, folders, orphans
+// -- behaves the same over it. It is meant to be committed: the next run, on
+// whatever machine, needs to read what this one wrote.
+//
+// A file that does not exist yet is an empty manifest, the same as a space
+// with no properties.
+func NewFileStore(path string) *Store {
+	store := NewStore(nil)
+	store.file = path
+	return store
+}
+
+// NewReadOnlyFileStore is NewReadOnlyStore over a manifest file.
+func NewReadOnlyFileStore(path string) *Store {
+	store := NewFileStore(path)
+	store.readOnly = true
+	return store
+}
+
+// readFile reads the manifest file, once.
+//
+// A file that cannot be read or parsed fails the run, where an unreadable
+// property is only warned about. A property is rewritten one shard at a time
+// and a bad one loses only its own paths; the file is rewritten whole, so
+// carrying on would replace it with a manifest that has lost every entry. In
+// a repository the likeliest cause is a merge conflict left in it, which is
+// for a person to resolve.
+func (s *Store) readFile() (*fileDocument, error) {
+	if s.stored != nil {
+		return s.stored, nil
+	}
+
+	doc := &fileDocument{Version: formatVersion, Spaces: map[string]fileSpace{}}
+
+	data, err := os.ReadFile(s.file)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("unable to read manifest file: %w", err)
+	default:
+		if err := json.Unmarshal(data, doc); err != nil {
+			return nil, fmt.Errorf("unable to parse manifest file %s: %w", s.file, err)
+		}
+		if doc.Version > formatVersion {
+			return nil, fmt.Errorf(
+				"manifest file %s was written by a newer mark (format %d); refusing to overwrite it",
+				s.file, doc.Version,
+			)
+		}
+		if doc.Spaces == nil {
+			doc.Spaces = map[string]fileSpace{}
+		}
+	}
+
+	s.stored = doc
+	return doc, nil
+}
+
+// loadFile reads a space's manifest from the manifest file.
+func (s *Store) loadFile(spaceKey string, state *spaceState) error {
+	doc, err := s.readFile()
+	if err != nil {
+		return err
+	}
+
+	space := doc.Spaces[spaceKey]
+	for path, entry := range space.Pages {
+		state.shards[shardFor(path)].pages[path] = entry
+	}
+	for folderPath, folderID := range space.Folders {
+		state.folders[folderPath] = folderID
+	}
+
+	return nil
+}
+
+// saveFile writes the manifest file back, if anything in it changed.
+//
+// The whole file is written, to a temporary file beside it that is then
+// renamed over it, so a run that dies halfway leaves the old manifest rather
+// than half of a new one.
+func (s *Store) saveFile() error {
+	dirty := false
+	for _, state := range s.spaces {
+		if state.foldersDirty {
+			dirty = true
+		}
+		for i := range state.shards {
+			if state.shards[i].dirty {
+				dirty = true
+			}
+		}
+	}
+	if !dirty {
+		return nil
+	}
+
+	doc, err := s.readFile()
+	if err != nil {
+		return err
+	}
+
+	spaces := make(map[string]fileSpace, len(doc.Spaces))
+	for spaceKey, space := range doc.Spaces {
+		spaces[spaceKey] = space
+	}
+
+	for spaceKey, state := range s.spaces {
+		space := fileSpace{Pages: map[string]Entry{}, Folders: state.folders}
+		for i := range state.shards {
+			for path, entry := range state.shards[i].pages {
+				space.Pages[path] = entry
+			}
+		}
+
+		if len(space.Pages) == 0 && len(space.Folders) == 0 {
+			delete(spaces, spaceKey)
+			continue
+		}
+		spaces[spaceKey] = space
+	}
+
+	updated := &fileDocument{Version: formatVersion, Spaces: spaces}
+
+	// Indented, and with map keys in order -- which encoding/json already
+	// guarantees -- so that a change to one mapping is a change to one line
+	// in review.
+	data, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode manifest file: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err := writeFileAtomically(s.file, data); err != nil {
+		return fmt.Errorf("unable to write manifest file: %w", err)
+	}
+
+	s.stored = updated
+	for _, state := range s.spaces {
+		state.foldersDirty = false
+		for i := range state.shards {
+			state.shards[i].dirty = false
+		}
+	}
+
+	return nil
+}
+
+// writeFileAtomically replaces path with data, or leaves it as it was.
+func writeFileAtomically(path string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(temp.Name()) }()
+
+	if _, err := temp.Write(data); err != nil {
+		_ = temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	// CreateTemp makes the file readable by its owner only, which is right for
+	// a secret and wrong for a file meant to be committed and shared.
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(temp.Name(), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
+
+// CopyFrom merges what another store holds for a space into this one, and
+// reports how many page mappings it added or changed. Saving this store then
+// writes them wherever it keeps its manifest.
+//
+// This is how a mapping moves between Confluence and a manifest file, in
+// either direction. It merges rather than replaces: a mapping only this store
+// has is kept, since dropping it would be the one outcome that cannot be
+// undone, and where both have one for the same path the other store's wins.
+func (s *Store) CopyFrom(other *Store, spaceKey string) (int, error) {
+	other.mu.Lock()
+	source, err := other.load(spaceKey)
+	other.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	target, err := s.load(spaceKey)
+	if err != nil {
+		return 0, err
+	}
+
+	copied := 0
+	for i := range source.shards {
+		for path, entry := range source.shards[i].pages {
+			sh := &target.shards[shardFor(path)]
+			if existing, ok := sh.pages[path]; ok && existing == entry {
+				continue
+			}
+			sh.pages[path] = entry
+			sh.dirty = true
+			copied++
+		}
+	}
+
+	for folderPath, folderID := range source.folders {
+		if existing, ok := target.folders[folderPath]; !ok || existing != folderID {
+			target.folders[folderPath] = folderID
+			target.foldersDirty = true
+		}
+	}
+
+	return copied, nil
+}
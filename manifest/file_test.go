@@ -0,0 +1,169 @@
+package manifest_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFileStore(t *testing.T, path string) *manifest.Store {
+	t.Helper()
+	store := manifest.NewFileStore(path)
+	store.SetRunFiles("*.md", nil)
+	return store
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+
+	store := newFileStore(t, path)
+	require.NoError(t, store.Record("DOCS", "docs/intro.md", "1234", "Intro", "abc"))
+	require.NoError(t, store.RecordFolder("DOCS", "Guides", "99"))
+	require.NoError(t, store.Save())
+
+	var doc struct {
+		Version int `json:"version"`
+		Spaces  map[string]struct {
+			Pages   map[string]manifest.Entry `json:"pages"`
+			Folders map[string]string         `json:"folders"`
+		} `json:"spaces"`
+	}
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, "1234", doc.Spaces["DOCS"].Pages["docs/intro.md"].PageID)
+	assert.Equal(t, "99", doc.Spaces["DOCS"].Folders["Guides"])
+
+	again := newFileStore(t, path)
+	entry, ok, err := again.Lookup("DOCS", "docs/intro.md")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "Intro", entry.Title)
+
+	folder, ok, err := again.LookupFolder("DOCS", "Guides")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "99", folder)
+}
+
+func TestFileStoreMissingFileIsEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+
+	store := newFileStore(t, path)
+	_, ok, err := store.Lookup("DOCS", "docs/intro.md")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Nothing changed, so nothing is written.
+	require.NoError(t, store.Save())
+	assert.NoFileExists(t, path)
+}
+
+func TestFileStoreKeepsSpacesItDidNotTouch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+
+	first := newFileStore(t, path)
+	require.NoError(t, first.Record("OPS", "ops/runbook.md", "1", "Runbook", ""))
+	require.NoError(t, first.Save())
+
+	second := newFileStore(t, path)
+	require.NoError(t, second.Record("DOCS", "docs/intro.md", "2", "Intro", ""))
+	require.NoError(t, second.Save())
+
+	third := newFileStore(t, path)
+	entry, ok, err := third.Lookup("OPS", "ops/runbook.md")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "1", entry.PageID)
+}
+
+func TestFileStoreFindsRenamesAndOrphans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+
+	first := newFileStore(t, path)
+	require.NoError(t, first.Record("DOCS", "old.md", "1", "Old", "same-content"))
+	require.NoError(t, first.Record("DOCS", "gone.md", "2", "Gone", "other-content"))
+	require.NoError(t, first.Save())
+
+	second := manifest.NewFileStore(path)
+	second.SetRunFiles("*.md", []string{"new.md"})
+
+	previous, entry, ok, err := second.ResolveRenamed("DOCS", "same-content")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "old.md", previous)
+	assert.Equal(t, "1", entry.PageID)
+
+	require.NoError(t, second.Forget("DOCS", previous))
+	require.NoError(t, second.Record("DOCS", "new.md", "1", "Old", "same-content"))
+	assert.Equal(t, []string{"gone.md"}, second.Orphans("DOCS"))
+}
+
+func TestFileStoreRefusesAnUnreadableFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, os.WriteFile(path, []byte("<<<<<<< HEAD\n{}\n"), 0o600))
+
+	store := newFileStore(t, path)
+	_, _, err := store.Lookup("DOCS", "docs/intro.md")
+	require.Error(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "<<<<<<< HEAD\n{}\n", string(data), "left for a person to resolve")
+}
+
+func TestReadOnlyFileStoreWritesNothing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+
+	store := manifest.NewReadOnlyFileStore(path)
+	require.NoError(t, store.Record("DOCS", "docs/intro.md", "1", "Intro", ""))
+	require.NoError(t, store.Save())
+	assert.NoFileExists(t, path)
+}
+
+func TestCopyFromMovesAMappingBothWays(t *testing.T) {
+	remote, server := newStore(t)
+	server.AddSpace("DOCS")
+	require.NoError(t, remote.Record("DOCS", "docs/intro.md", "1", "Intro", ""))
+	require.NoError(t, remote.RecordFolder("DOCS", "Guides", "99"))
+	require.NoError(t, remote.Save())
+
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	file := newFileStore(t, path)
+	require.NoError(t, file.Record("DOCS", "docs/local.md", "2", "Local", ""))
+
+	copied, err := file.CopyFrom(newStoreOn(t, server), "DOCS")
+	require.NoError(t, err)
+	assert.Equal(t, 1, copied)
+	require.NoError(t, file.Save())
+
+	exported := newFileStore(t, path)
+	for path, id := range map[string]string{"docs/intro.md": "1", "docs/local.md": "2"} {
+		entry, ok, err := exported.Lookup("DOCS", path)
+		require.NoError(t, err)
+		require.True(t, ok, path)
+		assert.Equal(t, id, entry.PageID)
+	}
+	folder, _, err := exported.LookupFolder("DOCS", "Guides")
+	require.NoError(t, err)
+	assert.Equal(t, "99", folder)
+
+	// And back, into a space whose mapping is empty.
+	server.AddSpace("OPS")
+	require.NoError(t, exported.Record("OPS", "ops/runbook.md", "3", "Runbook", ""))
+	require.NoError(t, exported.Save())
+
+	target := newStoreOn(t, server)
+	copied, err = target.CopyFrom(newFileStore(t, path), "OPS")
+	require.NoError(t, err)
+	assert.Equal(t, 1, copied)
+	require.NoError(t, target.Save())
+
+	assert.Equal(t, map[string]string{"ops/runbook.md": "3"},
+		manifestPages(t, server, spaceID(t, server, "OPS")))
+}
@@ -0,0 +1,299 @@
+package manifest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/rs/zerolog/log"
+)
+
+// LockPropertyKey holds the advisory lock on a space's manifest; see
+// Store.SetLock.
+//
+// It sits beside the shards under the same prefix, where whoever looks for the
+// manifest will see it, and is not mistaken for one: its suffix is not a shard
+// number.
+const LockPropertyKey = PropertyKeyPrefix + ".lock"
+
+// lockLease is how long a lock is good for once taken or renewed.
+//
+// A run that dies holding the lock -- a cancelled pipeline, a killed runner --
+// never releases it, and without an expiry every run after it would wait for
+// nothing. A lock found past its expiry is taken over as if it were free. A run
+// that is still going renews its locks well before then, however long it
+// takes; see renewLocks.
+var lockLease = time.Hour
+
+// lockPoll is the longest a waiting run sleeps between looks at the lock.
+const lockPoll = 5 * time.Second
+
+// lockDocument is the lock as stored. An empty owner is a released lock.
+type lockDocument struct {
+	Version int       `json:"version"`
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// SetLock makes Lock take the advisory lock on each space's manifest, waiting
+// up to wait for another run to release it first. A wait of zero takes no lock
+// at all, which is the default.
+//
+// Concurrent runs do not need it to keep their mappings: a write that lost a
+// race is merged with the one that won; see saveShardAfterConflict. What the
+// merge cannot do is decide between two runs that published the same file to
+// different pages, and a team that would rather such runs never overlap takes
+// the lock and has them queue instead.
+//
+// Only the manifest kept in Confluence can be locked. A manifest file is
+// serialised by whatever serialises commits to the repository holding it.
+func (s *Store) SetLock(wait time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lockWait = wait
+	if s.lockOwner == "" {
+		s.lockOwner = lockOwner()
+	}
+}
+
+// Lock takes the lock on the manifest of every space given before reading it,
+// and holds them all until Unlock, renewing them for as long as the run takes.
+//
+// The spaces are all of a run's, locked at its start and in sorted order. A
+// lock taken as each space is first met would be waited for in the middle of
+// publishing, and two runs meeting two spaces in opposite orders would each
+// hold the lock the other waits for, until one lease ran out.
+func (s *Store) Lock(spaceKeys []string) error {
+	if s.lockWait <= 0 || s.readOnly || s.file != "" {
+		return nil
+	}
+
+	keys := slices.Clone(spaceKeys)
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, spaceKey := range keys {
+		if spaceKey == "" {
+			continue
+		}
+		if _, err := s.open(spaceKey, true); err != nil {
+			return err
+		}
+	}
+
+	s.lockedUpFront = true
+	if s.stopRenewing == nil {
+		s.stopRenewing = make(chan struct{})
+		go s.renewLocks(s.stopRenewing)
+	}
+
+	return nil
+}
+
+// lockOwner names this run in a lock it holds, for whoever finds it waiting:
+// the host and process are what a person needs to go looking for it, and the
+// random suffix keeps two stores in one process from mistaking each other's
+// lock for their own.
+func lockOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// acquireLock takes the lock on a space's manifest, waiting for the run
+// holding it for as long as SetLock allows.
+//
+// The lock is an ordinary property, so taking it is a versioned write like any
+// other: two runs finding it free both try, one write lands and the other is
+// refused as a conflict, and the loser reads it again and finds it held.
+func (s *Store) acquireLock(spaceKey string, state *spaceState) error {
+	deadline := time.Now().Add(s.lockWait)
+	waiting := false
+
+	for {
+		property, err := state.fetch(s.api, LockPropertyKey)
+		if err != nil {
+			return fmt.Errorf("unable to read the manifest lock of space %q: %w", spaceKey, err)
+		}
+
+		var held lockDocument
+		if property != nil {
+			// An unreadable lock protects nothing and is taken over.
+			_ = json.Unmarshal(property.Value, &held)
+		}
+
+		now := time.Now()
+		if held.Owner != "" && held.Owner != s.lockOwner && now.Before(held.Expires) {
+			if !now.Before(deadline) {
+				return fmt.Errorf(
+					"manifest of space %q is locked by %s until %s",
+					spaceKey, held.Owner, held.Expires.Format(time.RFC3339),
+				)
+			}
+			if !waiting {
+				log.Info().Msgf("waiting for the manifest lock of space %q, held by %s", spaceKey, held.Owner)
+				waiting = true
+			}
+
+			time.Sleep(min(lockPoll, s.lockWait/10, deadline.Sub(now)))
+			continue
+		}
+
+		err = s.writeLock(spaceKey, state, property)
+		if errors.Is(err, confluence.ErrPropertyConflict) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to take the manifest lock of space %q: %w", spaceKey, err)
+		}
+
+		state.locked = true
+		log.Debug().Msgf("took the manifest lock of space %q as %s", spaceKey, s.lockOwner)
+
+		return nil
+	}
+}
+
+// writeLock writes a space's lock as this run's, for another lease.
+func (s *Store) writeLock(spaceKey string, state *spaceState, existing *confluence.Property) error {
+	value, err := json.Marshal(lockDocument{
+		Version: formatVersion,
+		Owner:   s.lockOwner,
+		Expires: time.Now().Add(lockLease).UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to encode the manifest lock of space %q: %w", spaceKey, err)
+	}
+
+	return state.writeProperty(s.api, LockPropertyKey, value, existing)
+}
+
+// renewLocks extends the lease of every lock this store holds a few times
+// over each lease, until stop is closed. A run that outlives the lease would
+// otherwise have its locks taken over while it is still publishing.
+func (s *Store) renewLocks(stop <-chan struct{}) {
+	ticker := time.NewTicker(lockLease / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		for _, spaceKey := range s.sortedSpaces() {
+			state := s.spaces[spaceKey]
+			if !state.locked {
+				continue
+			}
+
+			if err := s.renewLock(spaceKey, state); err != nil {
+				log.Warn().Err(err).Msgf("unable to renew the manifest lock of space %q; trying again later", spaceKey)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// renewLock extends a space's lock, if it is still this run's.
+func (s *Store) renewLock(spaceKey string, state *spaceState) error {
+	property, err := state.fetch(s.api, LockPropertyKey)
+	if err != nil {
+		return fmt.Errorf("unable to read the manifest lock of space %q: %w", spaceKey, err)
+	}
+
+	var held lockDocument
+	if property != nil {
+		_ = json.Unmarshal(property.Value, &held)
+	}
+	if held.Owner != s.lockOwner {
+		log.Warn().Msgf(
+			"the manifest lock of space %q expired during this run and was taken by %s",
+			spaceKey, held.Owner,
+		)
+		state.locked = false
+		return nil
+	}
+
+	return s.writeLock(spaceKey, state, property)
+}
+
+// Unlock releases every manifest lock this store holds. A lock that has since
+// been taken over -- this run outlived its lease -- is left to its new owner.
+func (s *Store) Unlock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopRenewing != nil {
+		close(s.stopRenewing)
+		s.stopRenewing = nil
+	}
+
+	var errs []error
+	for _, spaceKey := range s.sortedSpaces() {
+		state := s.spaces[spaceKey]
+		if !state.locked {
+			continue
+		}
+
+		if err := s.releaseLock(spaceKey, state); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		state.locked = false
+	}
+
+	return errors.Join(errs...)
+}
+
+// releaseLock writes a space's lock back as free, if it is still this run's.
+func (s *Store) releaseLock(spaceKey string, state *spaceState) error {
+	property, err := state.fetch(s.api, LockPropertyKey)
+	if err != nil {
+		return fmt.Errorf("unable to read the manifest lock of space %q: %w", spaceKey, err)
+	}
+
+	var held lockDocument
+	if property != nil {
+		_ = json.Unmarshal(property.Value, &held)
+	}
+	if held.Owner == "" {
+		return nil
+	}
+	if held.Owner != s.lockOwner {
+		log.Warn().Msgf(
+			"the manifest lock of space %q expired during this run and was taken by %s",
+			spaceKey, held.Owner,
+		)
+		return nil
+	}
+
+	value, err := json.Marshal(lockDocument{Version: formatVersion})
+	if err != nil {
+		return fmt.Errorf("unable to encode the manifest lock of space %q: %w", spaceKey, err)
+	}
+
+	if err := state.writeProperty(s.api, LockPropertyKey, value, property); err != nil {
+		return fmt.Errorf("unable to release the manifest lock of space %q: %w", spaceKey, err)
+	}
+
+	return nil
+}
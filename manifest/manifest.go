@@ -9,7 +9,8 @@
 // time", which needs somewhere to remember the answer.
 //
 // The mapping lives in Confluence rather than in the repository, keyed on the
-// source path. Nothing is written back to the working tree.
+// source path. Nothing is written back to the working tree -- unless it is
+// asked to be, with a manifest file; see NewFileStore.
 //
 // # Where it is kept
 //
@@ -58,12 +59,14 @@ import (
 	"errors"
 	"fmt"
 	"hash/fnv"
+	"maps"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/kovetskiy/mark/v16/confluence"
 	"github.com/rs/zerolog/log"
@@ -225,6 +228,14 @@ type document struct {
 type Store struct {
 	api *confluence.API
 
+	// file is the manifest file when the mapping is kept in the repository
+	// rather than in Confluence; see NewFileStore. Empty means Confluence.
+	file string
+
+	// stored is what the manifest file held when it was read, nil until then.
+	// Spaces this run never touches are written back from it as they were.
+	stored *fileDocument
+
 	// mu guards everything below. Run publishes one file at a time today, so
 	// nothing contends -- but Store is reachable from exported entry points and
 	// an unsynchronised map is a hard throw rather than a wrong answer, which
@@ -243,6 +254,14 @@ type Store struct {
 	// dry run write to Confluence.
 	readOnly bool
 
+	// lockWait and lockOwner are the advisory lock this run takes on each
+	// space's manifest, if any; see SetLock. lockedUpFront is set once Lock
+	// has taken them, and stopRenewing stops their renewal.
+	lockWait      time.Duration
+	lockOwner     string
+	lockedUpFront bool
+	stopRenewing  chan struct{}
+
 	// runFiles is every path this run will publish, known up front because the
 	// whole file set is globbed before any of it is processed. A recorded path
 	// missing from it is either a deleted file or a renamed one, and telling
@@ -275,6 +294,11 @@ type spaceState struct {
 	folders        map[string]string
 	folderProperty *confluence.Property
 	foldersDirty   bool
+	folderBase     map[string]string
+
+	// locked is set while this run holds the advisory lock on the space's
+	// manifest; see Store.SetLock.
+	locked bool
 
 	// titles maps the title each path was published under *as read*, and is
 	// deliberately never updated during a run. Resolving a stale reference asks
@@ -301,6 +325,11 @@ type shard struct {
 	property *confluence.Property
 	pages    map[string]Entry
 	dirty    bool
+
+	// base is pages as they were read, before this run changed anything. What
+	// differs between the two is what this run did, which is what is carried
+	// over when another run has written the shard in the meantime.
+	base map[string]Entry
 }
 
 // NewStore returns a Store that reads and writes through api.
@@ -416,14 +445,32 @@ func (state *spaceState) writeProperty(
 	return api.SetContentProperty(state.contentID, key, value, existing)
 }
 
-// load returns the state for a space, reading it from Confluence on first use.
+// load returns the state for a space, reading it from wherever the manifest is
+// kept on first use.
 func (s *Store) load(spaceKey string) (*spaceState, error) {
+	return s.open(spaceKey, false)
+}
+
+// open is load, taking the space's lock before its manifest is read when lock
+// is set; see Lock.
+func (s *Store) open(spaceKey string, lock bool) (*spaceState, error) {
 	if state, ok := s.spaces[spaceKey]; ok {
+		if lock && !state.locked && s.file == "" {
+			if err := s.acquireLock(spaceKey, state); err != nil {
+				return nil, err
+			}
+		}
 		return state, nil
 	}
 
+	if !lock && s.lockWait > 0 && s.lockedUpFront && !s.readOnly && s.file == "" {
+		log.Warn().Msgf(
+			"the manifest of space %q is not locked: it was not among the spaces this run was locked for",
+			spaceKey,
+		)
+	}
+
 	state := &spaceState{
-		cloud:   s.api.IsCloud(),
 		byPage:  map[string]string{},
 		titles:  map[string]string{},
 		folders: map[string]string{},
@@ -434,23 +481,58 @@ func (s *Store) load(spaceKey string) (*spaceState, error) {
 		state.shards[i].pages = map[string]Entry{}
 	}
 
+	var err error
+	if s.file != "" {
+		err = s.loadFile(spaceKey, state)
+	} else {
+		err = s.loadRemote(spaceKey, state, lock)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range state.shards {
+		state.shards[i].base = maps.Clone(state.shards[i].pages)
+	}
+	state.folderBase = maps.Clone(state.folders)
+
+	state.normaliseKeys()
+	state.buildIndexes()
+
+	s.spaces[spaceKey] = state
+	return state, nil
+}
+
+// loadRemote reads a space's manifest from the properties Confluence holds it
+// in, taking its lock first when lock is set.
+func (s *Store) loadRemote(spaceKey string, state *spaceState, lock bool) error {
+	state.cloud = s.api.IsCloud()
+
 	var err error
 	if state.cloud {
 		state.spaceID, err = s.api.GetSpaceID(spaceKey)
 		if err != nil {
-			return nil, fmt.Errorf("unable to resolve space %q: %w", spaceKey, err)
+			return fmt.Errorf("unable to resolve space %q: %w", spaceKey, err)
 		}
 	} else {
 		homepage, err := s.api.FindHomePage(spaceKey)
 		if err != nil {
-			return nil, fmt.Errorf("unable to resolve home page of space %q: %w", spaceKey, err)
+			return fmt.Errorf("unable to resolve home page of space %q: %w", spaceKey, err)
 		}
 		state.contentID = homepage.ID
 	}
 
+	// The lock has to be held before the manifest is read, or what this run
+	// read could be changed by the run it was waiting for.
+	if lock {
+		if err := s.acquireLock(spaceKey, state); err != nil {
+			return err
+		}
+	}
+
 	properties, err := state.list(s.api)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	for i := range properties {
@@ -499,11 +581,7 @@ func (s *Store) load(spaceKey string) (*spaceState, error) {
 		}
 	}
 
-	state.normaliseKeys()
-	state.buildIndexes()
-
-	s.spaces[spaceKey] = state
-	return state, nil
+	return nil
 }
 
 // Lookup returns the entry recorded for a source path, and whether one exists.
@@ -526,6 +604,29 @@ func (s *Store) Lookup(spaceKey, path string) (Entry, bool, error) {
 	return entry, ok, nil
 }
 
+// Entries returns every path recorded for a space, with what it published to.
+//
+// A copy, for a caller inspecting the mapping rather than publishing. Unlike
+// Lookup it marks nothing as seen.
+func (s *Store) Entries(spaceKey string) (map[string]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.load(spaceKey)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string]Entry{}
+	for i := range state.shards {
+		for path, entry := range state.shards[i].pages {
+			entries[path] = entry
+		}
+	}
+
+	return entries, nil
+}
+
 // Record notes which page a source path published to, under which title and
 // with what source fingerprint.
 func (s *Store) Record(spaceKey, path, pageID, title, hash string) error {
@@ -909,6 +1010,10 @@ func (s *Store) Save() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.file != "" {
+		return s.saveFile()
+	}
+
 	for _, spaceKey := range s.sortedSpaces() {
 		state := s.spaces[spaceKey]
 
@@ -922,18 +1027,13 @@ func (s *Store) Save() error {
 			}
 
 			err = state.writeProperty(s.api, FolderPropertyKey, value, state.folderProperty)
+			if errors.Is(err, confluence.ErrPropertyConflict) {
+				err = s.saveFoldersAfterConflict(spaceKey, state)
+			}
 			if err != nil {
-				if errors.Is(err, confluence.ErrPropertyConflict) {
-					log.Warn().Msgf(
-						"folder mapping for space %q was updated by a concurrent run; it was not saved",
-						spaceKey,
-					)
-				} else {
-					return err
-				}
-			} else {
-				state.foldersDirty = false
+				return err
 			}
+			state.foldersDirty = false
 		}
 
 		for i := range state.shards {
@@ -960,19 +1060,14 @@ func (s *Store) Save() error {
 				)
 			}
 
-			if err := state.write(s.api, i, value); err != nil {
-				if errors.Is(err, confluence.ErrPropertyConflict) {
-					// Another run wrote between this run's read and its write.
-					// The two are not mergeable from here without re-reading,
-					// and losing the mapping is not worth failing a publish that
-					// has already succeeded -- the pages are live either way.
-					log.Warn().Msgf(
-						"manifest shard %s of space %q was updated by a concurrent run; "+
-							"those mappings were not saved",
-						PropertyKey(i), spaceKey,
-					)
-					continue
-				}
+			err = state.write(s.api, i, value)
+			if errors.Is(err, confluence.ErrPropertyConflict) {
+				// Another run wrote between this run's read and its write.
+				// What each of them changed is merged; see
+				// saveShardAfterConflict.
+				err = s.saveShardAfterConflict(spaceKey, state, i)
+			}
+			if err != nil {
 				return err
 			}
 
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/kovetskiy/mark/v16/confluence"
 	"github.com/kovetskiy/mark/v16/confluence/confluencetest"
@@ -260,9 +261,10 @@ func TestNewerFormatIsIgnored(t *testing.T) {
 	assert.False(t, ok, "entries from an unknown format must not be trusted")
 }
 
-// TestConcurrentWriteIsReportedNotFatal: two runs racing on the same manifest.
-// The loser keeps its published pages -- they are live either way -- and only
-// loses its mapping, so a failed manifest write must not fail the run.
+// TestConcurrentWriteIsReportedNotFatal: two runs racing on the same manifest
+// and recording the same path differently. The loser keeps its published pages
+// -- they are live either way -- and the mapping written first, so a conflict
+// in the manifest must not fail the run.
 func TestConcurrentWriteIsReportedNotFatal(t *testing.T) {
 	first, server := newStore(t)
 	server.AddSpace("DOCS")
@@ -286,6 +288,158 @@ func TestConcurrentWriteIsReportedNotFatal(t *testing.T) {
 	assert.Equal(t, 2, property.Version, "exactly one of the two writes landed")
 }
 
+// samePathsShard returns two paths that hash to the same shard, which is what
+// it takes for two runs to contend over different files.
+func samePathsShard(t *testing.T) (string, string) {
+	t.Helper()
+	first := "a.md"
+	for i := range 1000 {
+		other := fmt.Sprintf("doc-%d.md", i)
+		if manifest.ShardFor(other) == manifest.ShardFor(first) {
+			return first, other
+		}
+	}
+	t.Fatal("no two paths share a shard")
+	return "", ""
+}
+
+// TestConcurrentWritesToDifferentPathsAreMerged: the loser of the race reads
+// the shard again and carries its own mapping over onto it, so neither run
+// loses what it recorded.
+func TestConcurrentWritesToDifferentPathsAreMerged(t *testing.T) {
+	server := confluencetest.New(t)
+	server.AddSpace("DOCS")
+	a, b := samePathsShard(t)
+
+	seed := newStoreOn(t, server)
+	require.NoError(t, seed.Record("DOCS", "kept.md", "9", "Kept", ""))
+	require.NoError(t, seed.Save())
+
+	left := newStoreOn(t, server)
+	right := newStoreOn(t, server)
+	require.NoError(t, left.Record("DOCS", a, "1", "A", ""))
+	require.NoError(t, right.Record("DOCS", b, "2", "B", ""))
+	require.NoError(t, right.Forget("DOCS", "kept.md"))
+
+	require.NoError(t, left.Save())
+	require.NoError(t, right.Save())
+
+	pages := manifestPages(t, server, spaceID(t, server, "DOCS"))
+	assert.Equal(t, map[string]string{a: "1", b: "2"}, pages)
+}
+
+func TestManifestLockIsWaitedFor(t *testing.T) {
+	server := confluencetest.New(t)
+	server.AddSpace("DOCS")
+
+	holder := newStoreOn(t, server)
+	holder.SetLock(time.Second)
+	require.NoError(t, holder.Lock([]string{"DOCS"}))
+
+	waiter := newStoreOn(t, server)
+	waiter.SetLock(50 * time.Millisecond)
+	err := waiter.Lock([]string{"DOCS"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `manifest of space "DOCS" is locked by`)
+
+	// Released part-way through the wait, it is taken as soon as it is free.
+	waiter = newStoreOn(t, server)
+	waiter.SetLock(5 * time.Second)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		assert.NoError(t, holder.Unlock())
+	}()
+	require.NoError(t, waiter.Lock([]string{"DOCS"}))
+	require.NoError(t, waiter.Unlock())
+
+	var lock struct {
+		Owner string `json:"owner"`
+	}
+	require.NoError(t, json.Unmarshal(server.SpaceProperty(spaceID(t, server, "DOCS"), manifest.LockPropertyKey).Value, &lock))
+	assert.Empty(t, lock.Owner, "released")
+}
+
+func TestExpiredManifestLockIsTakenOver(t *testing.T) {
+	server := confluencetest.New(t)
+	server.AddSpace("DOCS")
+	server.SetSpaceProperty(
+		spaceID(t, server, "DOCS"), manifest.LockPropertyKey,
+		[]byte(`{"version":1,"owner":"gone/1/0","expires":"2001-01-01T00:00:00Z"}`),
+	)
+
+	store := newStoreOn(t, server)
+	store.SetLock(time.Millisecond)
+	require.NoError(t, store.Lock([]string{"DOCS"}))
+	require.NoError(t, store.Unlock())
+}
+
+// TestManifestLocksAreTakenInOrder: whatever order a run names its spaces in,
+// they are locked in one order, so that two runs never each hold a lock the
+// other is waiting for. A run that cannot have them all takes none past the
+// one it waited on.
+func TestManifestLocksAreTakenInOrder(t *testing.T) {
+	server := confluencetest.New(t)
+	server.AddSpace("DOCS")
+	server.AddSpace("OPS")
+
+	holder := newStoreOn(t, server)
+	holder.SetLock(time.Second)
+	require.NoError(t, holder.Lock([]string{"DOCS"}))
+
+	waiter := newStoreOn(t, server)
+	waiter.SetLock(50 * time.Millisecond)
+	err := waiter.Lock([]string{"OPS", "DOCS"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `manifest of space "DOCS" is locked by`)
+	assert.Nil(t, server.SpaceProperty(spaceID(t, server, "OPS"), manifest.LockPropertyKey),
+		"OPS comes after DOCS and was not taken")
+
+	require.NoError(t, holder.Unlock())
+}
+
+// TestManifestLockIsRenewed: a run taking longer than the lease keeps its
+// locks, rather than having them taken over while it is still publishing.
+func TestManifestLockIsRenewed(t *testing.T) {
+	defer manifest.SetLockLease(200 * time.Millisecond)()
+
+	server := confluencetest.New(t)
+	server.AddSpace("DOCS")
+
+	holder := newStoreOn(t, server)
+	holder.SetLock(time.Second)
+	require.NoError(t, holder.Lock([]string{"DOCS"}))
+	time.Sleep(500 * time.Millisecond)
+
+	waiter := newStoreOn(t, server)
+	waiter.SetLock(time.Millisecond)
+	err := waiter.Lock([]string{"DOCS"})
+	require.Error(t, err, "the lease was renewed past its first expiry")
+	assert.Contains(t, err.Error(), `manifest of space "DOCS" is locked by`)
+
+	require.NoError(t, holder.Unlock())
+}
+
+// TestManifestSaveThatNeverLandsFails: a shard written by another run on every
+// attempt is not given up on quietly, which would lose this run's mappings.
+func TestManifestSaveThatNeverLandsFails(t *testing.T) {
+	server := confluencetest.New(t)
+	server.AddSpace("DOCS")
+
+	store := newStoreOn(t, server)
+	require.NoError(t, store.Record("DOCS", "a.md", "1", "A", ""))
+
+	server.SetFail(func(r *http.Request) (int, string, bool) {
+		if r.Method != http.MethodGet && strings.Contains(r.URL.Path, "/properties") {
+			return http.StatusConflict, `{"message":"version conflict"}`, true
+		}
+		return 0, "", false
+	})
+
+	err := store.Save()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "kept changing under this run after 5 attempts; its mappings were not saved")
+}
+
 // serverInstance makes the fake behave like Confluence Server/Data Center:
 // there is no v2 API at all, so the Cloud probe fails and every v2 route 404s.
 func serverInstance(t *testing.T) (*manifest.Store, *confluencetest.Server, *confluence.API) {
@@ -0,0 +1,204 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/rs/zerolog/log"
+)
+
+// saveAttempts bounds how many times a contended write is merged and tried
+// again. Each attempt re-reads what the other run wrote, so losing the race
+// this often means the property is being written continuously, and one more
+// try is no likelier to land than the last.
+const saveAttempts = 5
+
+// merge applies what this run changed -- the difference between base, what it
+// read, and ours, what it has now -- to theirs, what another run has written
+// since.
+//
+// A key only one of the two runs changed takes that run's value, and a key
+// both changed to the same thing is no disagreement at all. A key both changed
+// differently is a real conflict: the other run's value is kept, because it is
+// the one already stored, and the key is returned so that it can be said.
+func merge[V comparable](base, ours, theirs map[string]V) (map[string]V, []string) {
+	merged := maps.Clone(theirs)
+	if merged == nil {
+		merged = map[string]V{}
+	}
+
+	keys := map[string]bool{}
+	for key := range base {
+		keys[key] = true
+	}
+	for key := range ours {
+		keys[key] = true
+	}
+
+	var conflicts []string
+	for key := range keys {
+		was, inBase := base[key]
+		now, inOurs := ours[key]
+		if inBase == inOurs && was == now {
+			continue
+		}
+
+		theirValue, inTheirs := theirs[key]
+		switch {
+		case inTheirs == inBase && theirValue == was:
+			if inOurs {
+				merged[key] = now
+			} else {
+				delete(merged, key)
+			}
+		case inTheirs == inOurs && theirValue == now:
+		default:
+			conflicts = append(conflicts, key)
+		}
+	}
+
+	sort.Strings(conflicts)
+
+	return merged, conflicts
+}
+
+// describeEntry says what a path is recorded as, for a conflict message.
+func describeEntry(entries map[string]Entry, path string) string {
+	entry, ok := entries[path]
+	if !ok {
+		return "forgotten"
+	}
+
+	return fmt.Sprintf("page %s %q", entry.PageID, entry.Title)
+}
+
+// saveShardAfterConflict writes a shard another run has written since it was
+// read: it is read again, what this run changed is merged into it, and the
+// result written in its place.
+//
+// Two runs publishing different files into one space touch different paths,
+// and both keep their mappings. Where both recorded the same path differently
+// the other run's mapping stays, and each such path is reported rather than
+// dropped without a word. Failing the run is not the answer to a conflict: the
+// pages are published either way, and only the mapping is in question.
+//
+// A write that never lands is another matter. This run's mappings would be
+// lost, and the next run would take its pages for ones it has never seen, so
+// giving up is an error the run ends with.
+func (s *Store) saveShardAfterConflict(spaceKey string, state *spaceState, index int) error {
+	sh := &state.shards[index]
+	key := PropertyKey(index)
+
+	for range saveAttempts {
+		property, err := state.fetch(s.api, key)
+		if err != nil {
+			return err
+		}
+
+		theirs := map[string]Entry{}
+		if property != nil {
+			var doc document
+			if err := json.Unmarshal(property.Value, &doc); err == nil && doc.Version <= formatVersion && doc.Pages != nil {
+				theirs = doc.Pages
+			}
+		}
+
+		merged, conflicts := merge(sh.base, sh.pages, theirs)
+		for _, path := range conflicts {
+			log.Warn().Msgf(
+				"%s in space %q was recorded as %s by a concurrent run and as %s by this one; "+
+					"keeping the concurrent run's",
+				path, spaceKey, describeEntry(theirs, path), describeEntry(sh.pages, path),
+			)
+		}
+
+		sh.property, sh.pages, sh.base = property, merged, maps.Clone(theirs)
+		if maps.Equal(merged, theirs) {
+			return nil
+		}
+
+		value, err := json.Marshal(document{Version: formatVersion, Pages: merged})
+		if err != nil {
+			return fmt.Errorf("unable to encode manifest for space %q: %w", spaceKey, err)
+		}
+
+		err = state.write(s.api, index, value)
+		if !errors.Is(err, confluence.ErrPropertyConflict) {
+			return err
+		}
+	}
+
+	return fmt.Errorf(
+		"manifest shard %s of space %q kept changing under this run after %d attempts; "+
+			"its mappings were not saved",
+		key, spaceKey, saveAttempts,
+	)
+}
+
+// saveFoldersAfterConflict is saveShardAfterConflict for the folder mapping.
+func (s *Store) saveFoldersAfterConflict(spaceKey string, state *spaceState) error {
+	for range saveAttempts {
+		property, err := state.fetch(s.api, FolderPropertyKey)
+		if err != nil {
+			return err
+		}
+
+		theirs := map[string]string{}
+		if property != nil {
+			var doc folderDocument
+			if err := json.Unmarshal(property.Value, &doc); err == nil && doc.Version <= formatVersion && doc.Folders != nil {
+				theirs = doc.Folders
+			}
+		}
+
+		merged, conflicts := merge(state.folderBase, state.folders, theirs)
+		for _, folderPath := range conflicts {
+			log.Warn().Msgf(
+				"folder %q in space %q was recorded as %q by a concurrent run and as %q by this one; "+
+					"keeping the concurrent run's",
+				folderPath, spaceKey, theirs[folderPath], state.folders[folderPath],
+			)
+		}
+
+		state.folderProperty, state.folders, state.folderBase = property, merged, maps.Clone(theirs)
+		if maps.Equal(merged, theirs) {
+			return nil
+		}
+
+		value, err := json.Marshal(folderDocument{Version: formatVersion, Folders: merged})
+		if err != nil {
+			return fmt.Errorf("unable to encode folder mapping for space %q: %w", spaceKey, err)
+		}
+
+		err = state.writeProperty(s.api, FolderPropertyKey, value, property)
+		if !errors.Is(err, confluence.ErrPropertyConflict) {
+			return err
+		}
+	}
+
+	return fmt.Errorf(
+		"folder mapping of space %q kept changing under this run after %d attempts; it was not saved",
+		spaceKey, saveAttempts,
+	)
+}
+
+// fetch reads one property of the space's manifest as it is now, or nil if
+// there is no such property.
+func (state *spaceState) fetch(api *confluence.API, key string) (*confluence.Property, error) {
+	properties, err := state.list(api)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range properties {
+		if properties[i].Key == key {
+			return &properties[i], nil
+		}
+	}
+
+	return nil, nil
+}
@@ -17,6 +17,7 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
@@ -29,6 +30,7 @@ import (
 	markmd "github.com/kovetskiy/mark/v16/markdown"
 	"github.com/kovetskiy/mark/v16/mermaid"
 	"github.com/kovetskiy/mark/v16/metadata"
+	"github.com/kovetskiy/mark/v16/nav"
 	"github.com/kovetskiy/mark/v16/page"
 	"github.com/kovetskiy/mark/v16/report"
 	"github.com/kovetskiy/mark/v16/stdlib"
@@ -44,7 +46,7 @@ type Config struct {
 	// Connection settings
 	BaseURL               string
 	Username              string
-	Password              string
+	Password              string `json:"-"`
 	PageID                string
 	InsecureSkipTLSVerify bool
 
@@ -54,17 +56,33 @@ type Config struct {
 	// Behaviour
 	CompileOnly     bool
 	DryRun          bool
+	Diff            bool
 	ContinueOnError bool
 	CI              bool
 
+	// Concurrency is how many documents are published at once. Zero and one
+	// both mean one at a time.
+	Concurrency int
+
+	// Since is a git ref. When set, only the documents changed since it, or
+	// built from a file changed since it, are published.
+	Since string
+
 	// Page content
 	Space                    string
 	Parents                  []string
+	ParentsFromPath          string
+	PathAsFolders            bool
+	Nav                      string
 	TitleFromH1              bool
 	TitleFromFilename        bool
 	TitleAppendGeneratedHash bool
 	ContentAppearance        string
 
+	// SplitOn is the heading level, h1 to h6, every document is split into
+	// pages at unless it says otherwise with a Split-On header.
+	SplitOn string
+
 	// Page updates
 	MinorEdit          bool
 	VersionMessage     string
@@ -72,6 +90,8 @@ type Config struct {
 	ChangesOnly        bool
 	PreserveComments   bool
 	TrackPages         bool
+	ManifestFile       string
+	ManifestLock       time.Duration
 	NoOverwrite        bool
 	CheckLinks         []string
 	CheckLinksWarnOnly bool
@@ -86,14 +106,67 @@ type Config struct {
 	StripLinebreaks bool
 	MermaidScale    float64
 	D2Scale         float64
-	Features        []string
-	ImageAlign      string
-	IncludePath     string
+
+	// D2Theme, D2Layout and D2Sketch are how D2 diagrams are drawn unless a
+	// diagram's own options say otherwise: a theme of d2's catalog by ID or
+	// name, the dagre or elk layout engine, and whether as if by hand.
+	D2Theme  string
+	D2Layout string
+	D2Sketch bool
+
+	Features []string
+
+	// DiagramRenderers are the renderers configured for code block languages,
+	// each as language=kroki, language=kroki:<type> or
+	// language=command:<command>. KrokiURL is the Kroki server they use.
+	DiagramRenderers []string
+	KrokiURL         string
+
+	// DiagramFormat is the format diagrams are drawn in: png, the default, or
+	// svg.
+	DiagramFormat string
+
+	// MermaidMode is how Mermaid diagrams are published: image, the default,
+	// or macro. MermaidMacroTemplate names the template a macro is written
+	// by, a standard library one or a file.
+	MermaidMode          string
+	MermaidMacroTemplate string
+
+	// CacheDir is where rendered diagrams are kept between runs, and
+	// CacheMaxSize how many bytes they may take up there. No diagrams are kept
+	// without a directory.
+	CacheDir     string
+	CacheMaxSize int64
+
+	// FrontMatterMapping names a preset or a YAML file saying which front
+	// matter keys of another tool stand for which of mark's.
+	FrontMatterMapping string
+
+	ImageAlign  string
+	IncludePath string
+
+	// HTMLDir is where a compile or dry run writes each document's HTML, to a
+	// file named after the document, instead of printing it.
+	HTMLDir string
 
 	// Output is the writer used for result output (e.g. published page URLs,
 	// compiled HTML). If nil, output is discarded; the CLI sets this to
 	// os.Stdout.
-	Output io.Writer
+	Output io.Writer `json:"-"`
+
+	// plan collects what a diff finds, when the run is making a plan.
+	plan *Plan
+
+	// applying is the plan the run is carrying out. Nothing it does not
+	// describe as things are now is published; see checkPlanned.
+	applying *Plan
+
+	// loadedNav is Nav once a run has read it, so that it is read once rather
+	// than once per document.
+	loadedNav *nav.Nav
+
+	// loadedFrontMatter is FrontMatterMapping once a run has read it.
+	loadedFrontMatter metadata.FrontMatterMapping
 }
 
 // output returns the configured writer, falling back to io.Discard so that
@@ -107,6 +180,15 @@ func (c Config) output() io.Writer {
 
 // Run processes all files matching Config.Files and publishes them to Confluence.
 func Run(config Config) error {
+	return run(config, nil, nil)
+}
+
+// run is Run with a standard library that has already been built, when std is
+// not nil, and publishing only those of the matched files named in only, when
+// that is not nil. A watch publishes like this on every change: building the
+// library again each time would be wasted, and so would everything not
+// affected by the change. Orphans are not looked for in such a run.
+func run(config Config, std *stdlib.Lib, only []string) error {
 	// Settings are checked before anything else happens. A value that cannot be
 	// acted on should be said so plainly, not after a glob has been resolved
 	// and a connection opened -- and least of all part way through publishing.
@@ -150,6 +232,83 @@ func Run(config Config) error {
 			"the version mark last published is remembered in the page manifest")
 	}
 
+	if config.ManifestFile != "" && !config.TrackPages {
+		return fmt.Errorf("--manifest-file requires --track-pages: " +
+			"without it there is no page manifest to keep in the file")
+	}
+
+	if config.FrontMatterMapping != "" && !slices.Contains(config.Features, "frontmatter") {
+		return fmt.Errorf("--front-matter-mapping requires the frontmatter feature: " +
+			"without it front matter is not read, and there is nothing to map")
+	}
+
+	if _, err := metadata.SplitLevel(config.SplitOn); err != nil {
+		return fmt.Errorf("--split-on: %w", err)
+	}
+
+	if err := config.checkDiagrams(); err != nil {
+		return err
+	}
+
+	if config.Nav != "" && config.ParentsFromPath != "" {
+		return fmt.Errorf("--nav cannot be used with --parents-from-path: " +
+			"both place every document, and only one of them can be followed")
+	}
+
+	if config.PathAsFolders && config.ParentsFromPath == "" {
+		return fmt.Errorf("--path-as-folders requires --parents-from-path: " +
+			"without it there are no directories to turn into folders")
+	}
+
+	if config.PathAsFolders && (len(config.Parents) == 0 || config.Parents[0] == "") {
+		return fmt.Errorf("--path-as-folders requires --parents: " +
+			"the folders are created under the page it names")
+	}
+
+	if config.ParentsFromPath != "" {
+		if info, err := os.Stat(config.ParentsFromPath); err != nil || !info.IsDir() {
+			return fmt.Errorf("--parents-from-path %q is not a directory", config.ParentsFromPath)
+		}
+	}
+
+	if config.ManifestLock != 0 {
+		switch {
+		case config.ManifestLock < 0:
+			return fmt.Errorf("--manifest-lock must be a positive duration, not %s", config.ManifestLock)
+		case !config.TrackPages:
+			return fmt.Errorf("--manifest-lock requires --track-pages: " +
+				"the lock serialises runs writing the page manifest, and there is none without it")
+		case config.ManifestFile != "":
+			return fmt.Errorf("--manifest-lock cannot be used with --manifest-file: " +
+				"the lock is held in Confluence, and a manifest file is serialised by its repository")
+		}
+	}
+
+	if config.HTMLDir != "" && !config.CompileOnly && !config.DryRun {
+		log.Warn().Msg("--html-dir has no effect without --compile-only or --dry-run: only those produce HTML")
+	}
+
+	if config.Concurrency < 0 {
+		return fmt.Errorf("--concurrency must be at least 1, not %d", config.Concurrency)
+	}
+
+	if config.CacheMaxSize < 0 {
+		return fmt.Errorf("--cache-max-size must not be negative")
+	}
+
+	if config.Diff && config.CompileOnly {
+		return fmt.Errorf("--compile-only cannot be used with diff: " +
+			"there is nothing to compare against without Confluence")
+	}
+
+	// A diff writes nothing, and everything that keeps a dry run from writing
+	// -- a manifest that is never saved, orphans reported rather than removed,
+	// no second pass for links waiting on new pages -- applies to it as is.
+	// processFile looks at Diff first, so the page is compared, not printed.
+	if config.Diff {
+		config.DryRun = true
+	}
+
 	linkChecks, err := page.ParseLinkChecks(config.CheckLinks)
 	if err != nil {
 		return err
@@ -176,13 +335,26 @@ func Run(config Config) error {
 		}
 	}
 
+	if config.FrontMatterMapping != "" {
+		if config.loadedFrontMatter, err = metadata.LoadFrontMatterMapping(config.FrontMatterMapping); err != nil {
+			return err
+		}
+	}
+
+	if config.Nav != "" {
+		if config.loadedNav, err = loadNav(config, files); err != nil {
+			return err
+		}
+	}
+
 	// The standard library is a fixed set of templates that does not depend on
 	// the file being processed, so it is built once for the whole run rather
 	// than once per file. Building it cannot reach the network -- the "user"
 	// template func captures the API but is only invoked during rendering.
-	std, err := stdlib.New(api)
-	if err != nil {
-		return fmt.Errorf("unable to retrieve standard library: %w", err)
+	if std == nil {
+		if std, err = stdlib.New(api); err != nil {
+			return fmt.Errorf("unable to retrieve standard library: %w", err)
+		}
 	}
 
 	// Read once and before anything is published: a file that cannot be parsed
@@ -202,9 +374,14 @@ func Run(config Config) error {
 		// A dry run resolves exactly as a real one does -- otherwise its preview
 		// is fiction -- and resolving records what it finds. The store it gets
 		// cannot write, which is a guard that holds however it is used.
-		if config.DryRun {
+		switch {
+		case config.ManifestFile != "" && config.DryRun:
+			tracker = manifest.NewReadOnlyFileStore(config.ManifestFile)
+		case config.ManifestFile != "":
+			tracker = manifest.NewFileStore(config.ManifestFile)
+		case config.DryRun:
 			tracker = manifest.NewReadOnlyStore(api)
-		} else {
+		default:
 			tracker = manifest.NewStore(api)
 		}
 		if config.PageID != "" {
@@ -219,6 +396,22 @@ func Run(config Config) error {
 		}
 	}
 
+	if tracker != nil && config.ManifestLock > 0 {
+		// Taken for every space the run publishes to before anything is, and
+		// given back however the run ends: a lock left behind holds up every
+		// run after this one until it expires.
+		tracker.SetLock(config.ManifestLock)
+		defer func() {
+			if err := tracker.Unlock(); err != nil {
+				log.Warn().Err(err).Msg("unable to release the manifest lock; it is released when it expires")
+			}
+		}()
+
+		if err := tracker.Lock(documentSpaces(files, config)); err != nil {
+			return err
+		}
+	}
+
 	// A nil *manifest.Store put into a non-nil interface is still a non-nil
 	// interface, so page would see tracking as enabled and call through a nil
 	// receiver. Build the interface value only when there is a store behind it.
@@ -228,7 +421,62 @@ func Run(config Config) error {
 		// The whole file set is known before any of it is processed, which is
 		// what lets a recorded path missing from the run be read as a rename
 		// rather than a guess made one document at a time.
-		tracker.SetRunFiles(config.Files, files)
+		tracker.SetRunFiles(config.Files, documentKeys(files, config))
+	}
+
+	// A run narrowed by its caller has not looked at the rest of the files,
+	// and cannot tell which of the pages it did not publish have lost their
+	// documents.
+	partial := only != nil
+
+	// --since narrows the run too, but it is a full run in every other respect:
+	// the files it leaves out are known to be there, and unchanged. They are
+	// counted as seen, without being compiled or looked up in Confluence, so
+	// that orphan handling does not take their pages for ones whose documents
+	// are gone.
+	if config.Since != "" && only == nil {
+		if only, err = changedDocuments(files, config, std); err != nil {
+			return err
+		}
+
+		log.Info().Msgf("%d of %d document(s) changed since %s", len(only), len(files), config.Since)
+
+		if tracker != nil {
+			for _, file := range files {
+				if slices.Contains(only, file) {
+					continue
+				}
+
+				markdown, sourceHash, meta, err := readDocument(file, config)
+				if err != nil || meta == nil || meta.Space == "" {
+					continue
+				}
+
+				// A split document is known by each of its sections too, as
+				// documentKeys tells the manifest, and their pages are as
+				// present as the document's own.
+				keys := []string{file}
+				if documents, err := splitDocument(file, markdown, sourceHash, meta, config); err == nil {
+					for _, doc := range documents[1:] {
+						keys = append(keys, doc.key)
+					}
+				}
+
+				for _, key := range keys {
+					if _, _, err := tracker.Lookup(meta.Space, key); err != nil {
+						return fmt.Errorf("unable to look up page mapping for %q: %w", key, err)
+					}
+				}
+			}
+		}
+	}
+
+	// Narrowed after the manifest has been told about every file, so that the
+	// files left out are known to still exist rather than taken for renamed.
+	if only != nil {
+		files = slices.DeleteFunc(files, func(file string) bool {
+			return !slices.Contains(only, file)
+		})
 	}
 
 	// A link is resolved by finding the page it points at, so a document linking
@@ -250,14 +498,57 @@ func Run(config Config) error {
 	// anything alongside the others.
 	var ordered []page.Ordered
 
+	// One lock for the whole run: see processFile.
+	placing := &sync.Mutex{}
+
+	workers := max(config.Concurrency, 1)
+
+	// Each document compiled alongside others gets a library of its own to add
+	// its includes to; one at a time, they share one as they always have.
+	library := func() (*stdlib.Lib, error) {
+		if workers == 1 {
+			return std, nil
+		}
+		return std.Clone()
+	}
+
+	publish := func(deferrals *page.Deferrals, again bool) publishFunc {
+		return func(file string, output io.Writer, results *report.Report) (*confluence.PageInfo, []page.Ordered, error) {
+			if again {
+				log.Info().Msgf("processing %s again", file)
+			} else {
+				log.Info().Msgf("processing %s", file)
+			}
+
+			lib, err := library()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			fileConfig := config
+			fileConfig.Output = output
+
+			return processFile(
+				file, api, fileConfig, lib, tracker, folders, placing, checker, globalProperties, deferrals, results,
+			)
+		}
+	}
+
+	var dependencies [][]int
+	if workers > 1 {
+		dependencies = publishingDependencies(files, config)
+	}
+
 	var hasErrors bool
-	for _, file := range files {
-		log.Info().Msgf("processing %s", file)
+	for result := range publishInOrder(files, workers, dependencies, !config.ContinueOnError, publish(deferrals, false)) {
+		file, target, err := result.file, result.target, result.err
 
-		target, placement, err := processFile(file, api, config, std, tracker, folders, checker, globalProperties, deferrals, results)
-		if placement != nil {
-			ordered = append(ordered, *placement)
+		results.Merge(result.results)
+		if _, writeErr := config.output().Write(result.output.Bytes()); writeErr != nil {
+			return writeErr
 		}
+
+		ordered = append(ordered, result.placements...)
 		if err != nil {
 			results.AddPage(report.Page{
 				File: file, Status: report.StatusFailed, Reason: err.Error(),
@@ -297,16 +588,18 @@ func Run(config Config) error {
 			len(waiting),
 		)
 
-		for _, file := range waiting {
-			log.Info().Msgf("processing %s again", file)
+		// Nil deferrals: this is the last look, so a link that still does not
+		// resolve is reported rather than waited on again. Nothing is created
+		// the second time round, so nothing has to wait for anything either.
+		for result := range publishInOrder(waiting, workers, nil, !config.ContinueOnError, publish(nil, true)) {
+			results.Merge(result.results)
+			if _, err := config.output().Write(result.output.Bytes()); err != nil {
+				return err
+			}
 
-			// Nil deferrals: this is the last look, so a link that still does
-			// not resolve is reported rather than waited on again.
-			if _, _, err := processFile(
-				file, api, config, std, tracker, folders, checker, globalProperties, nil, results,
-			); err != nil {
+			if err := result.err; err != nil {
 				if config.ContinueOnError {
-					log.Error().Err(err).Msgf("processing %s", file)
+					log.Error().Err(err).Msgf("processing %s", result.file)
 					hasErrors = true
 
 					continue
@@ -337,15 +630,19 @@ func Run(config Config) error {
 		// Not attempted when a file failed: the pages that did not publish are
 		// missing from the sequence, and ordering the rest against each other
 		// would arrange them as though the absent ones were gone for good.
-		if err := page.OrderChildren(api, config.DryRun, ordered); err != nil {
+		moves, err := page.OrderChildren(api, config.DryRun, ordered)
+		if err != nil {
 			return fmt.Errorf("unable to order pages: %w", err)
 		}
+		config.plan.addMoves(moves)
 	}
 
 	var saveErr error
 	if tracker != nil {
-		if err := handleOrphans(tracker, api, config, onOrphan, hasErrors, results); err != nil {
-			return err
+		if !partial {
+			if err := handleOrphans(tracker, api, config, onOrphan, hasErrors, results); err != nil {
+				return err
+			}
 		}
 		if saveErr = tracker.Save(); saveErr != nil {
 			saveErr = fmt.Errorf("unable to save page manifest: %w", saveErr)
@@ -375,6 +672,10 @@ func Run(config Config) error {
 		return fmt.Errorf("one or more files failed to process")
 	}
 
+	if saveErr == nil && config.Diff && results.Count(report.StatusChanged) > 0 {
+		return ErrChanged
+	}
+
 	return saveErr
 }
 
@@ -401,7 +702,7 @@ func ProcessFile(file string, api *confluence.API, config Config) (*confluence.P
 
 	checker := page.NewLinkChecker(linkChecks)
 
-	target, _, err := processFile(file, api, config, std, nil, nil, checker, globalProperties, nil, nil)
+	target, _, err := processFile(file, api, config, std, nil, nil, &sync.Mutex{}, checker, globalProperties, nil, nil)
 	if err != nil {
 		return target, err
 	}
@@ -420,10 +721,65 @@ func ProcessFile(file string, api *confluence.API, config Config) (*confluence.P
 	return target, nil
 }
 
-func processFile(file string, api *confluence.API, config Config, std *stdlib.Lib, tracker *manifest.Store, folders page.FolderTracker, checker *page.LinkChecker, globalProperties map[string]any, deferrals *page.Deferrals, results *report.Report) (*confluence.PageInfo, *page.Ordered, error) {
+// readDocument reads a document and its headers. The fingerprint is of the
+// file as it is on disk.
+func readDocument(file string, config Config) ([]byte, string, *metadata.Meta, error) {
+	navigation, err := config.navigation()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var entry nav.Entry
+	listed := false
+	headersConfig := config
+	if navigation != nil {
+		// A document in the nav is titled the way MkDocs would title it when
+		// the nav does not: by its leading heading, or failing that its name.
+		if entry, listed = navigation.Lookup(file); listed {
+			headersConfig.TitleFromH1, headersConfig.TitleFromFilename = true, true
+		}
+	}
+
+	markdown, sourceHash, meta, err := readHeaders(file, titleSource(file, config), headersConfig)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	switch {
+	case meta == nil:
+	case listed:
+		applyNav(config, meta, entry)
+	case config.ParentsFromPath != "":
+		applyPathParents(file, config, meta)
+	}
+
+	return markdown, sourceHash, meta, nil
+}
+
+// documentSpaces returns the spaces a run's documents publish to. A document
+// that cannot be read is left to fail when it is published.
+func documentSpaces(files []string, config Config) []string {
+	var spaces []string
+	for _, file := range files {
+		_, _, meta, err := readDocument(file, config)
+		if err != nil || meta == nil || meta.Space == "" {
+			continue
+		}
+
+		if !slices.Contains(spaces, meta.Space) {
+			spaces = append(spaces, meta.Space)
+		}
+	}
+
+	return spaces
+}
+
+// readHeaders is readDocument without the parents --parents-from-path adds,
+// titling the document after titleFile when its title comes from a filename.
+func readHeaders(file, titleFile string, config Config) ([]byte, string, *metadata.Meta, error) {
 	markdown, err := os.ReadFile(file)
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to read file %q: %w", file, err)
+		return nil, "", nil, fmt.Errorf("unable to read file %q: %w", file, err)
 	}
 
 	markdown = bytes.ReplaceAll(markdown, []byte("\r\n"), []byte("\n"))
@@ -434,8 +790,6 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 	// moves with the remote would not survive the round trip it exists for.
 	sourceHash := sha1Hash(string(markdown))
 
-	frontMatterEnabled := slices.Contains(config.Features, "frontmatter")
-
 	// Before the headers are read, so that the line numbers in any complaint
 	// are the ones in the file the author is looking at rather than offsets
 	// into what is left after the header block is taken off. It also means an
@@ -443,22 +797,63 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 	// markers say on the tin.
 	markdown, err = metadata.StripIgnoredBlocks(markdown)
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to process %q: %w", file, err)
+		return nil, "", nil, fmt.Errorf("unable to process %q: %w", file, err)
 	}
 
-	meta, markdown, err := metadata.ExtractMeta(
+	mapping, err := config.frontMatterMapping()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	meta, markdown, err := metadata.ExtractMetaWithMapping(
 		markdown,
 		config.Space,
 		config.TitleFromH1,
 		config.TitleFromFilename,
-		file,
+		titleFile,
 		config.Parents,
 		config.TitleAppendGeneratedHash,
 		config.ContentAppearance,
-		frontMatterEnabled,
+		slices.Contains(config.Features, "frontmatter"),
+		mapping,
 	)
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to extract metadata from file %q: %w", file, err)
+		return nil, "", nil, fmt.Errorf("unable to extract metadata from file %q: %w", file, err)
+	}
+
+	// Snippets, tables and embeds are brought in here rather than while compiling, so
+	// that everything reading a document sees the one it publishes: its
+	// sections, its headings to link to, and the attachments the embedded
+	// files bring with them.
+	markdown, err = includes.ProcessSnippets(file, markdown)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unable to read snippets for %q: %w", file, err)
+	}
+
+	markdown, err = includes.ProcessTables(file, markdown)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unable to read tables for %q: %w", file, err)
+	}
+
+	markdown, embedded, err := includes.ProcessEmbeds(file, markdown)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unable to embed into %q: %w", file, err)
+	}
+	if meta != nil {
+		for _, name := range embedded {
+			if !slices.Contains(meta.Attachments, name) {
+				meta.Attachments = append(meta.Attachments, name)
+			}
+		}
+	}
+
+	return markdown, sourceHash, meta, nil
+}
+
+func processFile(file string, api *confluence.API, config Config, std *stdlib.Lib, tracker *manifest.Store, folders page.FolderTracker, placing *sync.Mutex, checker *page.LinkChecker, globalProperties map[string]any, deferrals *page.Deferrals, results *report.Report) (*confluence.PageInfo, []page.Ordered, error) {
+	markdown, sourceHash, meta, err := readDocument(file, config)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	if config.PageID != "" && meta != nil {
@@ -485,9 +880,21 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 		// account for the file would read it as gone: the page is reported as
 		// having no source file and its mapping is dropped, so synchronising it
 		// again later would no longer know which page was already its own.
+		// A split document's sections are its pages as much as the file's own
+		// page is.
 		if tracker != nil && meta != nil && meta.Space != "" {
-			if _, _, err := tracker.Lookup(meta.Space, file); err != nil {
-				return nil, nil, fmt.Errorf("unable to look up page mapping for %q: %w", file, err)
+			keys := []string{file}
+			if documents, err := splitDocument(file, markdown, sourceHash, meta, config); err == nil {
+				keys = keys[:0]
+				for _, doc := range documents {
+					keys = append(keys, doc.key)
+				}
+			}
+
+			for _, key := range keys {
+				if _, _, err := tracker.Lookup(meta.Space, key); err != nil {
+					return nil, nil, fmt.Errorf("unable to look up page mapping for %q: %w", key, err)
+				}
 			}
 		}
 
@@ -515,6 +922,43 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 		}
 	}
 
+	documents, err := splitDocument(file, markdown, sourceHash, meta, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The file's own page first: a section's page is created under it, and
+	// has to find it there.
+	var target *confluence.PageInfo
+	var placements []page.Ordered
+	for i, doc := range documents {
+		published, placement, err := publishDocument(
+			doc, documents, api, config, std, tracker, folders, placing, checker, globalProperties, deferrals, results,
+		)
+		if err != nil {
+			return target, placements, err
+		}
+
+		if i == 0 {
+			target = published
+		}
+		if placement != nil {
+			placements = append(placements, *placement)
+		}
+	}
+
+	return target, placements, nil
+}
+
+// publishDocument publishes one page of a document: the whole of it, or one of
+// the pages it is split into. documents are all of them, for links from one to
+// another.
+func publishDocument(doc document, documents []document, api *confluence.API, config Config, std *stdlib.Lib, tracker *manifest.Store, folders page.FolderTracker, placing *sync.Mutex, checker *page.LinkChecker, globalProperties map[string]any, deferrals *page.Deferrals, results *report.Report) (*confluence.PageInfo, *page.Ordered, error) {
+	file, key := doc.file, doc.key
+	markdown, sourceHash, meta := doc.markdown, doc.sourceHash, doc.meta
+
+	frontMatterEnabled := slices.Contains(config.Features, "frontmatter")
+
 	// Links are rewritten while the document is being rendered, by walking the
 	// parsed tree. Doing it here, over the text, meant a fenced block showing
 	// Markdown syntax had its example links turned into Confluence URLs.
@@ -536,10 +980,18 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 		checker,
 		searchDirs,
 	)
+	resolver.ReadMeta = readMeta(config)
 	resolver.SourceFile = file
 	resolver.Deferrals = deferrals
 
-	resolveLink := resolver.Resolve
+	resolveLink := sectionLinks(doc, documents, resolver.Resolve)
+
+	if config.Diff {
+		placement, err := diffFile(
+			doc, api, config, std, tracker, folders, resolveLink, resolver, globalProperties, results,
+		)
+		return nil, placement, err
+	}
 
 	if config.DryRun {
 		if meta != nil {
@@ -550,7 +1002,7 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 				// the manifest. Saying so is the whole point of a dry run:
 				// otherwise it reports a new page for every rename and retitle
 				// the run would actually have handled in place.
-				previewTrackedResolution(tracker, api, meta, file, sourceHash)
+				previewTrackedResolution(tracker, api, meta, key, sourceHash)
 			}
 		} else if config.PageID != "" {
 			if _, err := api.GetPageByID(config.PageID); err != nil {
@@ -569,106 +1021,54 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 			return nil, nil, fmt.Errorf("unable to determine image-align: %w", err)
 		}
 
-		cfg := types.MarkConfig{
-			MermaidScale:  config.MermaidScale,
-			D2Scale:       config.D2Scale,
-			DropFirstH1:   config.DropH1,
-			StripNewlines: config.StripLinebreaks,
-			Features:      config.Features,
-			ImageAlign:    imageAlign,
-			IncludePath:   config.IncludePath,
-			ResolveLink:   resolveLink,
-		}
+		cfg := config.markConfig(imageAlign, resolveLink, nil)
 		html, _, err := markmd.CompileMarkdown(markdown, std, file, cfg)
 		if err != nil {
 			return nil, nil, fmt.Errorf("unable to compile markdown: %w", err)
 		}
+		if config.HTMLDir != "" {
+			return nil, nil, writeHTML(config, doc.htmlFile(), html)
+		}
 		if _, err := fmt.Fprintln(config.output(), html); err != nil {
 			return nil, nil, err
 		}
 		return nil, nil, nil
 	}
 
+	var planned PlannedPage
+	if config.applying != nil {
+		var err error
+		if planned, err = checkPlanned(api, config.applying, key, sourceHash); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	var target *confluence.PageInfo
 	var pageCreated bool
 	// A page whose title changed has to be written even when its content did
 	// not, or --changes-only would leave it under the old title forever.
 	var titleChanged bool
+	var err error
 
 	if meta != nil {
-		// Parents are named by title, so a parent that has itself been renamed
-		// leaves this document pointing at a name nothing carries any more.
-		// Do this before resolution, so ancestry is walked against titles that
-		// exist rather than creating an empty page under the old one.
-		if err := refreshStaleParents(tracker, api, meta); err != nil {
-			return nil, nil, err
-		}
-
-		parent, pg, err := page.ResolvePage(false, api, meta, folders)
+		// Finding the page and creating whatever is missing above it is done
+		// one document at a time, even when documents are published in
+		// parallel: two documents under the same missing parent would
+		// otherwise each create it, and Confluence would end up with a
+		// duplicate -- or, since titles are unique in a space, refuse one.
+		placing.Lock()
+		target, pageCreated, titleChanged, err = placePage(key, api, tracker, folders, meta, sourceHash)
+		placing.Unlock()
 		if err != nil {
-			return nil, nil, fmt.Errorf("error resolving page %q: %w", meta.Title, err)
-		}
-
-		// The title lookup found nothing, which is how both "this page is new"
-		// and "this page was renamed" look. Ask the manifest which of the two
-		// this is before creating a second page beside the first.
-		if pg == nil {
-			pg, err = resolveTrackedPage(tracker, api, meta, file)
-			if err != nil {
-				return nil, nil, err
-			}
-			if pg == nil {
-				// Not published under this path before. It may have been
-				// published under another: a renamed file is a new key holding
-				// an old document.
-				pg, err = resolveRenamedFile(tracker, api, meta, file, sourceHash)
-				if err != nil {
-					return nil, nil, err
-				}
-			}
-			if pg != nil && pg.Title != meta.Title {
-				pg.Title = meta.Title
-				titleChanged = true
-			}
+			return nil, nil, err
 		}
 
-		if pg == nil {
-			if parent != nil && parent.Type == "folder-parent" {
-				pg, err = api.CreatePageWithFolderParent(meta.Space, meta.Type, parent.ID, meta.Title, ``)
-			} else {
-				pg, err = api.CreatePage(meta.Space, meta.Type, parent, meta.Title, ``)
-			}
-			if err != nil {
-				return nil, nil, fmt.Errorf("can't create %s %q: %w", meta.Type, meta.Title, err)
-			}
+		if pageCreated {
 			// A delay between the create and update call helps mitigate a 409
 			// conflict that can occur when attempting to update a page just
 			// after it was created. See issues/139.
 			time.Sleep(1 * time.Second)
-			pageCreated = true
-		} else if parent != nil && parent.Type == "folder-parent" {
-			if err := page.EnsurePageUnderFolderParent(api, pg, parent.ID); err != nil {
-				return nil, nil, fmt.Errorf("error relocating page %q: %w", meta.Title, err)
-			}
-		} else if parent != nil && !page.UnderDeclaredParents(pg, meta.Parents) {
-			// A page resolved through the manifest rather than by title never
-			// passed the ancestry check, because that check starts from a title
-			// lookup that just missed. So an edit changing the title and the
-			// parent together would retitle the page and leave it where it was.
-			if err := page.EnsurePageUnderParent(api, pg, parent.ID); err != nil {
-				return nil, nil, fmt.Errorf("error relocating page %q: %w", meta.Title, err)
-			}
 		}
-
-		// Relocating refreshes the page from Confluence, which still carries the
-		// old title -- the retitle above is staged and not published until the
-		// update below. Without this it is overwritten by the move and the page
-		// keeps its old name, silently and only when both changed at once.
-		if titleChanged && pg != nil {
-			pg.Title = meta.Title
-		}
-
-		target = pg
 	} else {
 		pg, err := api.GetPageByID(config.PageID)
 		if err != nil {
@@ -680,6 +1080,24 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 		target = pg
 	}
 
+	// Found rather than created where the plan would create it, or found
+	// elsewhere than where it would update it: a page has appeared or been
+	// moved since the plan was checked.
+	if config.applying != nil && target != nil {
+		switch {
+		case planned.PageID == "" && !pageCreated:
+			return nil, nil, fmt.Errorf(
+				"page %q (%s) was created since the plan was made; make the plan again",
+				target.Title, target.ID,
+			)
+		case planned.PageID != "" && target.ID != planned.PageID:
+			return nil, nil, fmt.Errorf(
+				"%s now publishes to page %s, not to page %s as planned; make the plan again",
+				key, target.ID, planned.PageID,
+			)
+		}
+	}
+
 	if target != nil && target.Type == "" {
 		if meta != nil && meta.Type != "" {
 			target.Type = meta.Type
@@ -692,7 +1110,7 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 	// lines below, and there is no point sending them for a page that is about
 	// to be left alone.
 	if config.NoOverwrite && !pageCreated && tracker != nil && meta != nil && target != nil {
-		drifted, recorded, err := hasDrifted(tracker, meta.Space, file, target)
+		drifted, recorded, err := hasDrifted(tracker, meta.Space, key, target)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -705,7 +1123,7 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 			)
 
 			results.AddPage(report.Page{
-				File: file, Status: report.StatusSkipped,
+				File: key, Status: report.StatusSkipped,
 				Reason: fmt.Sprintf(
 					"edited in Confluence since mark published it (version %d, mark wrote %d)",
 					target.Version.Number, recorded,
@@ -718,8 +1136,8 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 			// for an orphan and deleted. The version is deliberately not
 			// updated: until somebody resolves the difference, every run should
 			// say so again.
-			if err := tracker.Record(meta.Space, file, target.ID, target.Title, sourceHash); err != nil {
-				return nil, nil, fmt.Errorf("unable to record page mapping for %q: %w", file, err)
+			if err := tracker.Record(meta.Space, key, target.ID, target.Title, sourceHash); err != nil {
+				return nil, nil, fmt.Errorf("unable to record page mapping for %q: %w", key, err)
 			}
 
 			return target, nil, nil
@@ -768,25 +1186,14 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 		return nil, nil, fmt.Errorf("unable to determine image-align: %w", err)
 	}
 
-	cfg := types.MarkConfig{
-		MermaidScale:  config.MermaidScale,
-		D2Scale:       config.D2Scale,
-		DropFirstH1:   config.DropH1,
-		StripNewlines: config.StripLinebreaks,
-		Features:      config.Features,
-		ImageAlign:    imageAlign,
-		IncludePath:   config.IncludePath,
-		ResolveLink:   resolveLink,
-
-		ResolveAttachment: attachmentLinks.Resolve,
-	}
+	cfg := config.markConfig(imageAlign, resolveLink, attachmentLinks.Resolve)
 
 	html, inlineAttachments, err := markmd.CompileMarkdown(markdown, std, file, cfg)
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to compile markdown: %w", err)
 	}
 
-	if err := reportBrokenLinks(resolver.Broken(), file, config.CheckLinksWarnOnly); err != nil {
+	if err := reportBrokenLinks(resolver.Broken(), key, config.CheckLinksWarnOnly); err != nil {
 		return nil, nil, err
 	}
 
@@ -880,8 +1287,8 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 	}
 
 	if tracker != nil && meta != nil {
-		if err := tracker.Record(meta.Space, file, target.ID, meta.Title, sourceHash); err != nil {
-			return nil, nil, fmt.Errorf("unable to record page mapping for %q: %w", file, err)
+		if err := tracker.Record(meta.Space, key, target.ID, meta.Title, sourceHash); err != nil {
+			return nil, nil, fmt.Errorf("unable to record page mapping for %q: %w", key, err)
 		}
 	}
 
@@ -890,7 +1297,7 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 		status = report.StatusUnchanged
 	}
 	results.AddPage(report.Page{
-		File: file, Status: status,
+		File: key, Status: status,
 		Space: spaceOf(meta), Title: target.Title,
 		PageID: target.ID, URL: api.BaseURL + target.Links.Full,
 	})
@@ -914,8 +1321,8 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 	// wrote nothing still records what it found, so that a page nobody touches
 	// gets a version on the first run rather than staying unguarded forever.
 	if tracker != nil && meta != nil {
-		if err := tracker.RecordVersion(meta.Space, file, target.Version.Number); err != nil {
-			return nil, nil, fmt.Errorf("unable to record page version for %q: %w", file, err)
+		if err := tracker.RecordVersion(meta.Space, key, target.Version.Number); err != nil {
+			return nil, nil, fmt.Errorf("unable to record page version for %q: %w", key, err)
 		}
 	}
 
@@ -965,6 +1372,117 @@ func processFile(file string, api *confluence.API, config Config, std *stdlib.Li
 	return target, placement, nil
 }
 
+// placePage finds the page a document publishes to, creating it -- and any
+// missing ancestor -- when there is none, and moving it under the parent its
+// headers name. It reports whether the page was created and whether it is
+// being retitled.
+func placePage(
+	file string,
+	api *confluence.API,
+	tracker *manifest.Store,
+	folders page.FolderTracker,
+	meta *metadata.Meta,
+	sourceHash string,
+) (*confluence.PageInfo, bool, bool, error) {
+	var pageCreated, titleChanged bool
+
+	// Parents are named by title, so a parent that has itself been renamed
+	// leaves this document pointing at a name nothing carries any more.
+	// Do this before resolution, so ancestry is walked against titles that
+	// exist rather than creating an empty page under the old one.
+	if err := refreshStaleParents(tracker, api, meta); err != nil {
+		return nil, false, false, err
+	}
+
+	parent, pg, err := page.ResolvePage(false, api, meta, folders)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("error resolving page %q: %w", meta.Title, err)
+	}
+
+	// The title lookup found nothing, which is how both "this page is new"
+	// and "this page was renamed" look. Ask the manifest which of the two
+	// this is before creating a second page beside the first.
+	if pg == nil {
+		pg, err = resolveTrackedPage(tracker, api, meta, file)
+		if err != nil {
+			return nil, false, false, err
+		}
+		if pg == nil {
+			// Not published under this path before. It may have been
+			// published under another: a renamed file is a new key holding
+			// an old document.
+			pg, err = resolveRenamedFile(tracker, api, meta, file, sourceHash)
+			if err != nil {
+				return nil, false, false, err
+			}
+		}
+		if pg != nil && pg.Title != meta.Title {
+			pg.Title = meta.Title
+			titleChanged = true
+		}
+	}
+
+	if pg == nil {
+		if parent != nil && parent.Type == "folder-parent" {
+			pg, err = api.CreatePageWithFolderParent(meta.Space, meta.Type, parent.ID, meta.Title, ``)
+		} else {
+			pg, err = api.CreatePage(meta.Space, meta.Type, parent, meta.Title, ``)
+		}
+		if err != nil {
+			return nil, false, false, fmt.Errorf("can't create %s %q: %w", meta.Type, meta.Title, err)
+		}
+		pageCreated = true
+	} else if parent != nil && parent.Type == "folder-parent" {
+		if err := page.EnsurePageUnderFolderParent(api, pg, parent.ID); err != nil {
+			return nil, false, false, fmt.Errorf("error relocating page %q: %w", meta.Title, err)
+		}
+	} else if parent != nil && !page.UnderDeclaredParents(pg, meta.Parents) {
+		// A page resolved through the manifest rather than by title never
+		// passed the ancestry check, because that check starts from a title
+		// lookup that just missed. So an edit changing the title and the
+		// parent together would retitle the page and leave it where it was.
+		if err := page.EnsurePageUnderParent(api, pg, parent.ID); err != nil {
+			return nil, false, false, fmt.Errorf("error relocating page %q: %w", meta.Title, err)
+		}
+	}
+
+	// Relocating refreshes the page from Confluence, which still carries the
+	// old title -- the retitle above is staged and not published until the
+	// page is updated. Without this it is overwritten by the move and the page
+	// keeps its old name, silently and only when both changed at once.
+	if titleChanged && pg != nil {
+		pg.Title = meta.Title
+	}
+
+	return pg, pageCreated, titleChanged, nil
+}
+
+// writeHTML writes a document's compiled HTML into the HTML directory, at the
+// document's path below the directory the files were matched in, with an .html
+// extension: docs/guide/setup.md matched by "docs/**/*.md" is written to
+// guide/setup.html.
+func writeHTML(config Config, file, html string) error {
+	base, _ := doublestar.SplitPattern(filepath.ToSlash(config.Files))
+
+	rel, err := filepath.Rel(filepath.FromSlash(base), file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(file)
+	}
+
+	path := filepath.Join(config.HTMLDir, strings.TrimSuffix(rel, filepath.Ext(rel))+".html")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("unable to create directory for %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, []byte(html+"\n"), 0o644); err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+
+	log.Info().Msgf("wrote %s", path)
+
+	return nil
+}
+
 // previewTrackedResolution says what a real run would have done with a document
 // the title lookup could not place.
 //
@@ -1234,6 +1752,37 @@ func determineLabelsToAdd(metaLabels []string, labelInfo *confluence.LabelInfo)
 	return labels
 }
 
+// markConfig returns what a document is compiled with: the settings of the
+// run, and what only the document decides -- where its images are aligned,
+// and where its links and attachments lead. Publishing, a dry run, a diff, a
+// validation and a preview all compile with it, so that none of them renders
+// a document differently from the others.
+func (c Config) markConfig(
+	imageAlign string,
+	resolveLink func(target, text string) (string, error),
+	resolveAttachment func(target string) string,
+) types.MarkConfig {
+	return types.MarkConfig{
+		MermaidScale:         c.MermaidScale,
+		D2Scale:              c.D2Scale,
+		D2Theme:              c.D2Theme,
+		D2Layout:             c.D2Layout,
+		D2Sketch:             c.D2Sketch,
+		DiagramRenderers:     c.renderers(),
+		DiagramCache:         c.diagramCache(),
+		DiagramFormat:        c.DiagramFormat,
+		MermaidMode:          c.MermaidMode,
+		MermaidMacroTemplate: c.MermaidMacroTemplate,
+		DropFirstH1:          c.DropH1,
+		StripNewlines:        c.StripLinebreaks,
+		Features:             c.Features,
+		ImageAlign:           imageAlign,
+		IncludePath:          c.IncludePath,
+		ResolveLink:          resolveLink,
+		ResolveAttachment:    resolveAttachment,
+	}
+}
+
 func getImageAlign(align string, meta *metadata.Meta) (string, error) {
 	if meta != nil && meta.ImageAlign != "" {
 		align = meta.ImageAlign
@@ -1852,6 +2401,17 @@ func handleOrphans(
 		}
 
 		if config.DryRun {
+			if action != page.OnOrphanReport {
+				for _, candidate := range candidates {
+					if slices.Contains(handled, candidate.Path) {
+						config.plan.addOrphan(PlannedOrphan{
+							File: candidate.Path, PageID: candidate.PageID,
+							Title: candidate.Title, Action: action,
+						})
+					}
+				}
+			}
+
 			continue
 		}
 
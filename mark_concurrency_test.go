@@ -0,0 +1,168 @@
+package mark
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScheduleStartsATaskOnlyAfterItsDependencies runs a task that others wait
+// on last in file order, and checks none of them starts before it is done.
+func TestScheduleStartsATaskOnlyAfterItsDependencies(t *testing.T) {
+	const n = 8
+
+	// Every task but the last comes after the last.
+	after := make([][]int, n)
+	for i := range n - 1 {
+		after[i] = []int{n - 1}
+	}
+
+	var mu sync.Mutex
+	var order []int
+	started := schedule(n, 4, after, false, nil, func(i int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, i)
+		return true
+	})
+
+	assert.Equal(t, n-1, order[0])
+	assert.Len(t, order, n)
+	assert.NotContains(t, started, false)
+}
+
+func TestScheduleWithOneWorkerRunsInOrder(t *testing.T) {
+	var order []int
+	schedule(5, 1, nil, false, nil, func(i int) bool {
+		order = append(order, i)
+		return true
+	})
+
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+}
+
+// TestScheduleBreaksACycle: two documents each naming the other as a parent
+// would otherwise wait for each other forever.
+func TestScheduleBreaksACycle(t *testing.T) {
+	var order []int
+	schedule(2, 2, [][]int{{1}, {0}}, false, nil, func(i int) bool {
+		order = append(order, i)
+		return true
+	})
+
+	assert.Equal(t, []int{0, 1}, order)
+}
+
+func TestScheduleStopsStartingAfterAFailure(t *testing.T) {
+	var order []int
+	started := schedule(5, 1, nil, true, nil, func(i int) bool {
+		order = append(order, i)
+		return i != 1
+	})
+
+	assert.Equal(t, []int{0, 1}, order)
+	assert.Equal(t, []bool{true, true, false, false, false}, started)
+}
+
+func TestPublishingDependencies(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a-child.md", outHeader+"<!-- Parent: Section -->\n<!-- Title: Child -->\n\nChild.\n")
+	writeFile(t, dir, "b-other.md", outHeader+"<!-- Title: Other -->\n\nOther.\n")
+	writeFile(t, dir, "c-elsewhere.md", "<!-- Space: OTHER -->\n<!-- Parent: Section -->\n<!-- Title: Elsewhere -->\n\nElsewhere.\n")
+	writeFile(t, dir, "z-section.md", outHeader+"<!-- Title: Section -->\n\nSection.\n")
+
+	files := []string{
+		filepath.Join(dir, "a-child.md"),
+		filepath.Join(dir, "b-other.md"),
+		filepath.Join(dir, "c-elsewhere.md"),
+		filepath.Join(dir, "z-section.md"),
+	}
+
+	// Only the child in the same space waits for the section.
+	assert.Equal(t, [][]int{{3}, nil, nil, nil}, publishingDependencies(files, Config{}))
+}
+
+// TestConcurrentRunPublishesParentsFirst publishes a parent and the documents
+// under it together, with the parent sorted last so that a run taking files in
+// order would reach every child first.
+func TestConcurrentRunPublishesParentsFirst(t *testing.T) {
+	server := outputServer(t)
+	dir := t.TempDir()
+
+	const children = 4
+	for i := range children {
+		writeFile(t, dir, fmt.Sprintf("a-child-%d.md", i),
+			outHeader+"<!-- Parent: Section -->\n"+
+				fmt.Sprintf("<!-- Title: Child %d -->\n\nChild %d.\n", i, i))
+	}
+	writeFile(t, dir, "z-section.md", outHeader+"<!-- Title: Section -->\n\nSection body.\n")
+
+	var out strings.Builder
+	require.NoError(t, Run(Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files:        filepath.Join(dir, "*.md"),
+		Concurrency:  4,
+		OutputFormat: "json",
+		Output:       &out,
+	}))
+
+	api := confluence.NewAPI(server.URL, "user", "token", false)
+	section, err := api.FindPage("DOCS", "Section", "page")
+	require.NoError(t, err)
+	require.NotNil(t, section)
+	assert.Contains(t, server.Page(section.ID).Body, "Section body.")
+
+	// One page per document, and no empty Section made on a child's behalf.
+	assert.Equal(t, children+1, server.CountRequests("POST", "/content"))
+
+	for i := range children {
+		child, err := api.FindPage("DOCS", fmt.Sprintf("Child %d", i), "page")
+		require.NoError(t, err)
+		require.NotNil(t, child)
+		assert.Equal(t, section.ID, server.Page(child.ID).ParentID)
+	}
+
+	// The report is in the order of the files, not of when they finished.
+	var got struct {
+		Pages []struct{ File string } `json:"pages"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &got))
+	require.Len(t, got.Pages, children+1)
+	for i := range children {
+		assert.Equal(t, fmt.Sprintf("a-child-%d.md", i), filepath.Base(got.Pages[i].File))
+	}
+	assert.Equal(t, "z-section.md", filepath.Base(got.Pages[children].File))
+}
+
+// TestConcurrentRunSharesANewAncestor names a parent no document provides, so
+// every document needs it created, and expects it to be created once.
+func TestConcurrentRunSharesANewAncestor(t *testing.T) {
+	server := outputServer(t)
+	dir := t.TempDir()
+
+	for i := range 4 {
+		writeFile(t, dir, fmt.Sprintf("doc-%d.md", i),
+			outHeader+"<!-- Parent: Shared -->\n"+
+				fmt.Sprintf("<!-- Title: Doc %d -->\n\nDoc %d.\n", i, i))
+	}
+
+	require.NoError(t, Run(Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files:       filepath.Join(dir, "*.md"),
+		Concurrency: 4,
+	}))
+
+	api := confluence.NewAPI(server.URL, "user", "token", false)
+	shared, err := api.FindPage("DOCS", "Shared", "page")
+	require.NoError(t, err)
+	require.NotNil(t, shared)
+
+	assert.Equal(t, 4+1, server.CountRequests("POST", "/content"))
+}
@@ -0,0 +1,137 @@
+package mark
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagramRendererAttachesTheDiagram(t *testing.T) {
+	var drawn bytes.Buffer
+	require.NoError(t, png.Encode(&drawn, image.NewRGBA(image.Rect(0, 0, 64, 48))))
+
+	var requests []string
+	kroki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		_, _ = w.Write(drawn.Bytes())
+	}))
+	defer kroki.Close()
+
+	server := synchronizedServer(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "page.md",
+		"<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Page -->\n\n"+
+			"```dot title flow\ndigraph { a -> b }\n```\n")
+
+	require.NoError(t, Run(Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "*.md"), Output: io.Discard,
+		DiagramRenderers: []string{"dot=kroki:graphviz"}, KrokiURL: kroki.URL,
+	}))
+
+	assert.Equal(t, []string{"/graphviz/png"}, requests)
+
+	page := findPage(t, server, "Page")
+	attachments := server.Attachments(page.ID)
+	require.Len(t, attachments, 1)
+	assert.Equal(t, "flow.png", attachments[0].Filename)
+	assert.Contains(t, page.Body, `<ri:attachment ri:filename="flow.png"/>`)
+}
+
+func TestDiagramSettingsAreCheckedFirst(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "page.md", "<!-- Space: DOCS -->\n<!-- Title: Page -->\n\nText.\n")
+
+	err := Run(Config{
+		Files: filepath.Join(dir, "*.md"), CompileOnly: true, Output: io.Discard,
+		DiagramRenderers: []string{"dot=kroki"},
+	})
+	assert.EqualError(t, err, "--diagram-renderer: dot is rendered with Kroki, which needs --kroki-url")
+
+	err = Validate(Config{Files: filepath.Join(dir, "*.md"), DiagramRenderers: []string{"dot"}})
+	assert.ErrorContains(t, err, "--diagram-renderer:")
+
+	err = Run(Config{Files: filepath.Join(dir, "*.md"), CompileOnly: true, MermaidMode: "plugin"})
+	assert.EqualError(t, err, `--mermaid-mode: "plugin" is not a mermaid mode: use image or macro`)
+
+	err = Validate(Config{Files: filepath.Join(dir, "*.md"), DiagramFormat: "jpeg"})
+	assert.EqualError(t, err, `--diagram-format: "jpeg" is not a diagram format: use svg or png`)
+
+	err = Run(Config{Files: filepath.Join(dir, "*.md"), CompileOnly: true, D2Layout: "tala"})
+	assert.EqualError(t, err, `--d2-layout: "tala" is not a d2 layout engine: use dagre or elk`)
+
+	err = Validate(Config{Files: filepath.Join(dir, "*.md"), D2Theme: "solarized"})
+	assert.ErrorContains(t, err, `--d2-theme: "solarized" is not a d2 theme`)
+
+	_, err = NewPreviewHandler(Config{Files: filepath.Join(dir, "*.md"), MermaidMode: "plugin"})
+	assert.EqualError(t, err, `--mermaid-mode: "plugin" is not a mermaid mode: use image or macro`)
+}
+
+// TestEveryCompileHasTheDiagramSettings: publishing, a diff, a validation and
+// a preview compile with one configuration, so a diagram setting given to the
+// run reaches all of them.
+func TestEveryCompileHasTheDiagramSettings(t *testing.T) {
+	config := Config{
+		MermaidScale: 2, D2Scale: 3, D2Theme: "dark-mauve", D2Sketch: true,
+		DiagramRenderers: []string{"dot=command:dot -T{format}"},
+		DiagramFormat:    "svg", MermaidMode: "macro", MermaidMacroTemplate: "mermaid.tmpl",
+		CacheDir: t.TempDir(), CacheMaxSize: 1,
+	}
+
+	cfg := config.markConfig("center", nil, nil)
+	assert.Equal(t, 2.0, cfg.MermaidScale)
+	assert.Equal(t, 3.0, cfg.D2Scale)
+	assert.Contains(t, cfg.DiagramRenderers, "dot")
+	assert.Equal(t, config.CacheDir, cfg.DiagramCache.Dir)
+	assert.Equal(t, "svg", cfg.DiagramFormat)
+	assert.Equal(t, "macro", cfg.MermaidMode)
+	assert.Equal(t, "mermaid.tmpl", cfg.MermaidMacroTemplate)
+	assert.Equal(t, "center", cfg.ImageAlign)
+	assert.Equal(t, "dark-mauve", cfg.D2Theme)
+	assert.True(t, cfg.D2Sketch)
+}
+
+func TestDiagramCacheSkipsRenderingAgain(t *testing.T) {
+	var drawn bytes.Buffer
+	require.NoError(t, png.Encode(&drawn, image.NewRGBA(image.Rect(0, 0, 8, 8))))
+
+	requests := 0
+	kroki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write(drawn.Bytes())
+	}))
+	defer kroki.Close()
+
+	dir := t.TempDir()
+	writeFile(t, dir, "page.md", "<!-- Space: DOCS -->\n<!-- Title: Page -->\n\n```dot\ndigraph { a -> b }\n```\n")
+
+	config := Config{
+		Files: filepath.Join(dir, "*.md"), CompileOnly: true, Output: io.Discard,
+		DiagramRenderers: []string{"dot=kroki:graphviz"}, KrokiURL: kroki.URL,
+		CacheDir: filepath.Join(dir, "cache"),
+	}
+	require.NoError(t, Run(config))
+	require.NoError(t, Run(config))
+	assert.Equal(t, 1, requests)
+
+	var out bytes.Buffer
+	config.Output = &out
+	require.NoError(t, PruneCache(config, time.Nanosecond))
+	assert.Equal(t, "removed 1 diagrams (0.0 MB), kept 0 (0.0 MB)\n", out.String())
+
+	require.NoError(t, Run(config))
+	assert.Equal(t, 2, requests, "a pruned diagram is rendered again")
+
+	config.CacheDir = ""
+	assert.ErrorContains(t, PruneCache(config, 0), "mark cache prune requires --cache-dir")
+}
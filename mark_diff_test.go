@@ -0,0 +1,119 @@
+package mark
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/confluence/confluencetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// diffFixture publishes a document and returns the server, the page id and a
+// config that diffs the same file.
+func diffFixture(t *testing.T) (*confluencetest.Server, string, Config) {
+	t.Helper()
+
+	server := confluencetest.New(t)
+	home := server.AddPage("DOCS", "Home", "page", "")
+	server.SetHomepage("DOCS", home.ID)
+	server.AddPage("DOCS", "Parent", "page", home.ID)
+	server.AddPage("DOCS", "Elsewhere", "page", home.ID)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "doc.md", "<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Doc -->\n"+
+		"<!-- Label: kept -->\n\n# Heading\n\nFirst paragraph.\n\nSecond paragraph.\n")
+
+	config := Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files:  filepath.Join(dir, "doc.md"),
+		Output: io.Discard,
+	}
+	require.NoError(t, Run(config))
+
+	api := confluence.NewAPI(server.URL, "user", "token", false)
+	doc, err := api.FindPage("DOCS", "Doc", "page")
+	require.NoError(t, err)
+	require.NotNil(t, doc)
+
+	config.Diff = true
+
+	return server, doc.ID, config
+}
+
+func TestDiffOfAPublishedPageIsEmpty(t *testing.T) {
+	_, _, config := diffFixture(t)
+
+	var out bytes.Buffer
+	config.Output = &out
+
+	require.NoError(t, Run(config))
+	assert.Empty(t, out.String())
+}
+
+// TestDiffSeesThroughConfluenceReformatting stores the page the way Confluence
+// hands it back -- reformatted, with an inline comment on it -- and expects no
+// difference.
+func TestDiffSeesThroughConfluenceReformatting(t *testing.T) {
+	server, id, config := diffFixture(t)
+
+	server.EditPage(id, "<h1 id=\"Heading\">Heading</h1>\n<p>First <ac:inline-comment-marker ac:ref=\"x\">paragraph</ac:inline-comment-marker>.</p>\n"+
+		"<p>Second paragraph.</p>\n")
+
+	var out bytes.Buffer
+	config.Output = &out
+
+	require.NoError(t, Run(config))
+	assert.Empty(t, out.String())
+}
+
+func TestDiffShowsBodyAndMetadataChanges(t *testing.T) {
+	server, id, config := diffFixture(t)
+	server.AddLabel(id, "stale")
+
+	writeFile(t, filepath.Dir(config.Files), "doc.md",
+		"<!-- Space: DOCS -->\n<!-- Parent: Elsewhere -->\n<!-- Title: Doc -->\n"+
+			"<!-- Label: kept -->\n<!-- Label: fresh -->\n<!-- Property: owner=docs-team -->\n\n"+
+			"# Heading\n\nFirst paragraph.\n\nChanged paragraph.\n")
+
+	var out bytes.Buffer
+	config.Output = &out
+
+	err := Run(config)
+	require.ErrorIs(t, err, ErrChanged)
+
+	assert.Contains(t, out.String(), config.Files+`: would update page `+id+` "Doc"`)
+	assert.Contains(t, out.String(), `  parent: "Parent" -> "Elsewhere"`)
+	assert.Contains(t, out.String(), "  labels: +fresh -stale")
+	assert.Contains(t, out.String(), "  properties: owner")
+	assert.Contains(t, out.String(), "+++ "+config.Files+"\n")
+	assert.Contains(t, out.String(), "-<p>Second paragraph.</p>\n+<p>Changed paragraph.</p>\n")
+
+	// Nothing was written.
+	assert.Contains(t, server.Page(id).Body, "Second paragraph.")
+	assert.ElementsMatch(t, []string{"kept", "stale"}, server.Page(id).Labels)
+}
+
+func TestDiffOfANewPage(t *testing.T) {
+	_, _, config := diffFixture(t)
+
+	writeFile(t, filepath.Dir(config.Files), "new.md",
+		"<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Brand New -->\n\nHello.\n")
+	config.Files = filepath.Join(filepath.Dir(config.Files), "new.md")
+
+	var out bytes.Buffer
+	config.Output = &out
+
+	require.ErrorIs(t, Run(config), ErrChanged)
+	assert.Contains(t, out.String(), `would create page "Brand New"`)
+	assert.Contains(t, out.String(), "--- /dev/null\n")
+	assert.Contains(t, out.String(), "+<p>Hello.</p>\n")
+
+	api := confluence.NewAPI(config.BaseURL, "user", "token", false)
+	pg, err := api.FindPage("DOCS", "Brand New", "page")
+	require.NoError(t, err)
+	assert.Nil(t, pg, "a diff must not create the page it describes")
+}
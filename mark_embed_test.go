@@ -0,0 +1,40 @@
+package mark
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedPublishesTheSectionWithItsAttachments(t *testing.T) {
+	server := synchronizedServer(t)
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "shared"), 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "docs"), 0o755))
+	writeFile(t, dir, "shared/setup.md",
+		"<!-- Space: OPS -->\n<!-- Title: Setup -->\n<!-- Attachment: diagram.png -->\n\n"+
+			"# Setup\n\n## Installation\n\nRun it. ![the diagram](diagram.png)\n\n## Other\n\nNot embedded.\n")
+	writeFile(t, dir, "shared/diagram.png", "png")
+	writeFile(t, dir, "docs/page.md",
+		"<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Page -->\n\n"+
+			"## Getting Started\n\n<!-- Embed: ../shared/setup.md#installation -->\n")
+
+	require.NoError(t, Run(Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "docs", "*.md"), Output: io.Discard,
+	}))
+
+	page := findPage(t, server, "Page")
+	assert.Contains(t, page.Body, "<h3")
+	assert.Contains(t, page.Body, "Run it.")
+	assert.NotContains(t, page.Body, "Not embedded.")
+
+	attachments := server.Attachments(page.ID)
+	require.Len(t, attachments, 1, "the embedded section's image is attached to the page")
+	assert.Contains(t, page.Body, attachments[0].Filename)
+}
@@ -0,0 +1,49 @@
+package mark
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFrontMatterMappingPublishesADocusaurusSite is a Docusaurus docs
+// directory as it is, linking between its own documents.
+func TestFrontMatterMappingPublishesADocusaurusSite(t *testing.T) {
+	server := synchronizedServer(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "install.md", `---
+sidebar_label: Install
+tags: [setup]
+---
+See [usage](usage.md).
+`)
+	writeFile(t, dir, "usage.md", "---\nsidebar_label: Usage\n---\nUsing it.\n")
+	writeFile(t, dir, "upcoming.md", "---\nsidebar_label: Upcoming\ndraft: true\n---\nNot yet.\n")
+
+	config := Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "*.md"), Features: []string{"frontmatter"},
+		FrontMatterMapping: "docusaurus", Space: "DOCS", Parents: []string{"Parent"},
+		Output: io.Discard,
+	}
+	// Twice, so the link's target exists by the time it is resolved.
+	require.NoError(t, Run(config))
+	require.NoError(t, Run(config))
+
+	install := findPage(t, server, "Install")
+	assert.Contains(t, install.Labels, "setup")
+	assert.Contains(t, install.Body, "/x/", "the link is resolved by the mapped title")
+	findPage(t, server, "Usage")
+
+	assert.Zero(t, server.CountRequests("GET", "Upcoming"), "a draft is never looked up")
+}
+
+func TestFrontMatterMappingNeedsTheFeature(t *testing.T) {
+	err := Run(Config{Files: "*.md", CompileOnly: true, FrontMatterMapping: "hugo"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--front-matter-mapping requires the frontmatter feature")
+}
@@ -0,0 +1,194 @@
+package mark
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/confluence/confluencetest"
+	"github.com/kovetskiy/mark/v16/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manifestFixture is a space with a Parent page and a manifest file, and a
+// configuration reaching both. It returns the id of Parent last.
+func manifestFixture(t *testing.T) (*confluencetest.Server, Config, string, string) {
+	t.Helper()
+
+	server := confluencetest.New(t)
+	home := server.AddPage("DOCS", "Home", "page", "")
+	server.SetHomepage("DOCS", home.ID)
+	parent := server.AddPage("DOCS", "Parent", "page", home.ID)
+
+	dir := t.TempDir()
+	config := Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files:        filepath.Join(dir, "*.md"),
+		ManifestFile: filepath.Join(dir, "manifest.json"),
+		Output:       io.Discard,
+	}
+
+	return server, config, dir, parent.ID
+}
+
+func TestManifestListShowAndForget(t *testing.T) {
+	_, config, dir, _ := manifestFixture(t)
+
+	store := manifest.NewFileStore(config.ManifestFile)
+	require.NoError(t, store.Record("DOCS", filepath.Join(dir, "b.md"), "2", "Beta", ""))
+	require.NoError(t, store.Record("DOCS", filepath.Join(dir, "a.md"), "1", "Alpha", ""))
+	require.NoError(t, store.Save())
+
+	var out bytes.Buffer
+	config.Output = &out
+
+	require.NoError(t, ListManifest(config, "DOCS"))
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	assert.Contains(t, string(lines[0]), "Alpha")
+	assert.Contains(t, string(lines[1]), "Beta")
+
+	out.Reset()
+	require.NoError(t, ShowManifest(config, "DOCS", filepath.Join(dir, "a.md")))
+	var shown map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &shown))
+	assert.Equal(t, "1", shown["pageId"])
+	assert.Equal(t, "DOCS", shown["space"])
+
+	require.NoError(t, ForgetManifest(config, "DOCS", filepath.Join(dir, "a.md")))
+	err := ShowManifest(config, "DOCS", filepath.Join(dir, "a.md"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not recorded")
+
+	assert.Error(t, ForgetManifest(config, "DOCS", filepath.Join(dir, "a.md")))
+}
+
+func TestManifestSetRecordsAnExistingPage(t *testing.T) {
+	server, config, dir, _ := manifestFixture(t)
+	pg := server.AddPage("DOCS", "Existing", "page", "")
+
+	writeFile(t, dir, "a.md", outHeader+"<!-- Title: Existing -->\n\nText.\n")
+	require.NoError(t, SetManifest(config, "DOCS", filepath.Join(dir, "a.md"), pg.ID))
+
+	entry, ok, err := manifest.NewFileStore(config.ManifestFile).Lookup("DOCS", filepath.Join(dir, "a.md"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, pg.ID, entry.PageID)
+	assert.Equal(t, "Existing", entry.Title)
+	assert.NotEmpty(t, entry.Hash)
+
+	assert.Error(t, SetManifest(config, "DOCS", filepath.Join(dir, "a.md"), "999999"))
+}
+
+func TestManifestFsckFindsWhatIsWrong(t *testing.T) {
+	server, config, dir, _ := manifestFixture(t)
+	renamed := server.AddPage("DOCS", "Now", "page", "")
+	gone := server.AddPage("DOCS", "Gone", "page", "")
+	fine := server.AddPage("DOCS", "Fine", "page", "")
+
+	store := manifest.NewFileStore(config.ManifestFile)
+	require.NoError(t, store.Record("DOCS", filepath.Join(dir, "renamed.md"), renamed.ID, "Then", ""))
+	require.NoError(t, store.Record("DOCS", filepath.Join(dir, "gone.md"), gone.ID, "Gone", ""))
+	require.NoError(t, store.Record("DOCS", filepath.Join(dir, "fine.md"), fine.ID, "Fine", ""))
+	require.NoError(t, store.Record("DOCS", filepath.Join(dir, "twin.md"), fine.ID, "Fine", ""))
+	require.NoError(t, store.Save())
+	server.DeletePage(gone.ID)
+
+	var out bytes.Buffer
+	config.Output = &out
+
+	err := FsckManifest(config, "DOCS")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "4 problem(s)")
+
+	report := out.String()
+	assert.Contains(t, report, `renamed.md: page `+renamed.ID+` is titled "Now", not "Then"`)
+	assert.Contains(t, report, "gone.md: page "+gone.ID+" no longer exists")
+	assert.Contains(t, report, "fine.md: page "+fine.ID+" is also claimed by")
+	assert.Contains(t, report, "twin.md: page "+fine.ID+" is also claimed by")
+}
+
+func TestManifestAdoptMatchesByTitleAndParents(t *testing.T) {
+	server, config, dir, parent := manifestFixture(t)
+
+	under := server.AddPage("DOCS", "Under", "page", parent)
+	server.AddPage("DOCS", "Elsewhere", "page", "")
+
+	writeFile(t, dir, "under.md", outHeader+"<!-- Title: Under -->\n\nText.\n")
+	writeFile(t, dir, "elsewhere.md", outHeader+"<!-- Title: Elsewhere -->\n\nText.\n")
+	writeFile(t, dir, "new.md", outHeader+"<!-- Title: New -->\n\nText.\n")
+
+	require.NoError(t, AdoptManifest(config, nil))
+
+	entries, err := manifest.NewFileStore(config.ManifestFile).Entries("DOCS")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, under.ID, entries[manifest.Key(filepath.Join(dir, "under.md"))].PageID)
+
+	// Publishing with tracking on now updates the adopted page after a
+	// retitle, rather than creating another.
+	writeFile(t, dir, "under.md", outHeader+"<!-- Title: Renamed -->\n\nText.\n")
+	config.TrackPages = true
+	config.Files = filepath.Join(dir, "under.md")
+	require.NoError(t, Run(config))
+	assert.Equal(t, "Renamed", server.Page(under.ID).Title)
+}
+
+func TestManifestLockNeedsTheManifestInConfluence(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.md", outHeader+"<!-- Title: A -->\n\nText.\n")
+	config := Config{Files: filepath.Join(dir, "*.md"), CompileOnly: true, ManifestLock: time.Minute}
+
+	err := Run(config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--manifest-lock requires --track-pages")
+
+	config.TrackPages, config.ManifestFile = true, filepath.Join(dir, "m.json")
+	err = Run(config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be used with --manifest-file")
+}
+
+// TestManifestLockIsReleasedAfterARun: the lock is taken for the run and given
+// back at its end, so the next run does not wait.
+func TestManifestLockIsReleasedAfterARun(t *testing.T) {
+	server, config, dir, _ := manifestFixture(t)
+	writeFile(t, dir, "a.md", outHeader+"<!-- Title: A -->\n\nText.\n")
+
+	config.ManifestFile = ""
+	config.TrackPages, config.ManifestLock = true, time.Minute
+	require.NoError(t, Run(config))
+
+	spaceID, err := confluence.NewAPI(server.URL, "user", "token", false).GetSpaceID("DOCS")
+	require.NoError(t, err)
+	lock := server.SpaceProperty(spaceID, manifest.LockPropertyKey)
+	require.NotNil(t, lock, "the run took the lock")
+	assert.Contains(t, string(lock.Value), `"owner":""`)
+
+	require.NoError(t, Run(config))
+}
+
+// TestManifestLockIsTakenBeforePublishing: a run that cannot have the lock of
+// a space it publishes to fails at its start, not halfway through.
+func TestManifestLockIsTakenBeforePublishing(t *testing.T) {
+	server, config, dir, _ := manifestFixture(t)
+	writeFile(t, dir, "a.md", outHeader+"<!-- Title: A -->\n\nText.\n")
+
+	holder := manifest.NewStore(confluence.NewAPI(server.URL, "user", "token", false))
+	holder.SetLock(time.Minute)
+	require.NoError(t, holder.Lock([]string{"DOCS"}))
+	defer func() { assert.NoError(t, holder.Unlock()) }()
+
+	config.ManifestFile = ""
+	config.TrackPages, config.ManifestLock = true, 50*time.Millisecond
+	err := Run(config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `manifest of space "DOCS" is locked by`)
+	assert.Zero(t, server.CountRequests(http.MethodPost, "/content"), "nothing was published")
+}
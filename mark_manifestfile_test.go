@@ -0,0 +1,115 @@
+package mark
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/confluence/confluencetest"
+	"github.com/kovetskiy/mark/v16/manifest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func manifestFileFixture(t *testing.T) (*confluencetest.Server, string) {
+	t.Helper()
+
+	server := confluencetest.New(t)
+	home := server.AddPage("DOCS", "Home", "page", "")
+	server.SetHomepage("DOCS", home.ID)
+	server.AddPage("DOCS", "Parent", "page", home.ID)
+
+	return server, t.TempDir()
+}
+
+// TestManifestFileFollowsARetitle is --track-pages doing its job with the
+// mapping kept in a file: the retitled document updates its page rather than
+// publishing a second one, and Confluence holds no manifest at all.
+func TestManifestFileFollowsARetitle(t *testing.T) {
+	server, dir := manifestFileFixture(t)
+	manifestFile := filepath.Join(dir, "manifest.json")
+
+	writeFile(t, dir, "a.md", outHeader+"<!-- Title: Before -->\n\nText.\n")
+
+	config := Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files:      filepath.Join(dir, "*.md"),
+		TrackPages: true, ManifestFile: manifestFile,
+		Output: io.Discard,
+	}
+	require.NoError(t, Run(config))
+	assert.FileExists(t, manifestFile)
+
+	api := confluence.NewAPI(server.URL, "user", "token", false)
+	before, err := api.FindPage("DOCS", "Before", "page")
+	require.NoError(t, err)
+	require.NotNil(t, before)
+
+	writeFile(t, dir, "a.md", outHeader+"<!-- Title: After -->\n\nText.\n")
+	require.NoError(t, Run(config))
+
+	assert.Equal(t, "After", server.Page(before.ID).Title)
+	assert.Zero(t, server.CountRequests(http.MethodPost, "propert"))
+	assert.Zero(t, server.CountRequests(http.MethodPut, "propert"))
+}
+
+func TestManifestFileRequiresTrackPages(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.md", outHeader+"<!-- Title: A -->\n\nText.\n")
+
+	err := Run(Config{Files: filepath.Join(dir, "*.md"), CompileOnly: true, ManifestFile: filepath.Join(dir, "m.json")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--manifest-file requires --track-pages")
+}
+
+func TestManifestExportAndImport(t *testing.T) {
+	server, dir := manifestFileFixture(t)
+	manifestFile := filepath.Join(dir, "manifest.json")
+
+	writeFile(t, dir, "a.md", outHeader+"<!-- Title: A -->\n\nText.\n")
+
+	config := Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "*.md"), TrackPages: true,
+		Output: io.Discard,
+	}
+	require.NoError(t, Run(config))
+
+	config.ManifestFile = manifestFile
+	require.NoError(t, ExportManifest(config, []string{"DOCS"}))
+
+	exported, ok, err := manifest.NewFileStore(manifestFile).Lookup("DOCS", filepath.Join(dir, "a.md"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// A second space, known only to the file, goes the other way.
+	server.AddSpace("OPS")
+	store := manifest.NewFileStore(manifestFile)
+	require.NoError(t, store.Record("OPS", "ops.md", "123", "Ops", ""))
+	require.NoError(t, store.Save())
+
+	require.NoError(t, ImportManifest(config, []string{"OPS", "DOCS"}))
+
+	api := confluence.NewAPI(server.URL, "user", "token", false)
+	imported, ok, err := manifest.NewStore(api).Lookup("OPS", "ops.md")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "123", imported.PageID)
+
+	remote, ok, err := manifest.NewStore(api).Lookup("DOCS", filepath.Join(dir, "a.md"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, exported, remote)
+}
+
+func TestManifestMigrationNeedsAFileAndASpace(t *testing.T) {
+	err := ExportManifest(Config{}, []string{"DOCS"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--manifest-file is required")
+
+	err = ImportManifest(Config{ManifestFile: "manifest.json"}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no space given")
+}
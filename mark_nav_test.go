@@ -0,0 +1,60 @@
+package mark
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNavPublishesASiteWithoutHeaders is an MkDocs site as it is: not one of
+// its documents says where it goes, and the nav says it for all of them.
+func TestNavPublishesASiteWithoutHeaders(t *testing.T) {
+	server := synchronizedServer(t)
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "docs", "guides"), 0o755))
+	writeFile(t, dir, "mkdocs.yml", `site_name: Docs
+nav:
+  - Welcome: index.md
+  - Guides:
+      - guides/index.md
+      - guides/usage.md
+      - Install: guides/install.md
+`)
+	writeFile(t, dir, "docs/index.md", "Hello.\n")
+	writeFile(t, dir, "docs/guides/index.md", "# Ignored\n\nAll the guides.\n")
+	writeFile(t, dir, "docs/guides/usage.md", "# Usage Guide\n\nUsing it.\n")
+	writeFile(t, dir, "docs/guides/install.md", "Installing.\n")
+	writeFile(t, dir, "docs/stray.md", outHeader+"<!-- Title: Stray -->\n\nNot in the nav.\n")
+
+	require.NoError(t, Run(Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "docs", "**", "*.md"), Nav: filepath.Join(dir, "mkdocs.yml"),
+		Space: "DOCS", Parents: []string{"Parent"}, Output: io.Discard,
+	}))
+
+	parent := findPage(t, server, "Parent")
+	assert.Equal(t, parent.ID, findPage(t, server, "Welcome").ParentID)
+
+	guides := findPage(t, server, "Guides")
+	assert.Equal(t, parent.ID, guides.ParentID)
+	assert.Contains(t, guides.Body, "All the guides.", "the section's index is the section's page")
+
+	usage := findPage(t, server, "Usage Guide")
+	install := findPage(t, server, "Install")
+	assert.Equal(t, guides.ID, usage.ParentID)
+	assert.Equal(t, guides.ID, install.ParentID)
+	assert.Equal(t, []string{usage.ID, install.ID}, server.ChildOrder(guides.ID), "in the order of the nav")
+
+	assert.Equal(t, parent.ID, findPage(t, server, "Stray").ParentID, "a file outside the nav keeps its headers")
+}
+
+func TestNavCannotBeUsedWithParentsFromPath(t *testing.T) {
+	err := Run(Config{Files: "*.md", CompileOnly: true, Nav: "mkdocs.yml", ParentsFromPath: "."})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--nav cannot be used with --parents-from-path")
+}
@@ -0,0 +1,89 @@
+package mark
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/confluence/confluencetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pathTree is a documentation tree placed by its directories: guides has an
+// index, getting-started does not, and pinned.md says where it goes itself.
+func pathTree(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, sub := range []string{"guides", "getting-started"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, sub), 0o755))
+	}
+
+	writeFile(t, dir, "guides/index.md", "<!-- Space: DOCS -->\n<!-- Title: User Guides -->\n\nAll the guides.\n")
+	writeFile(t, dir, "guides/install.md", "<!-- Space: DOCS -->\n<!-- Title: Install -->\n\nInstalling.\n")
+	writeFile(t, dir, "guides/pinned.md", outHeader+"<!-- Title: Pinned -->\n\nPinned.\n")
+	writeFile(t, dir, "getting-started/intro.md", "<!-- Space: DOCS -->\n<!-- Title: Intro -->\n\nHello.\n")
+
+	return dir
+}
+
+func findPage(t *testing.T, server *confluencetest.Server, title string) *confluencetest.Page {
+	t.Helper()
+
+	api := confluence.NewAPI(server.URL, "user", "token", false)
+	pg, err := api.FindPage("DOCS", title, "page")
+	require.NoError(t, err)
+	require.NotNil(t, pg, "page %q", title)
+
+	return server.Page(pg.ID)
+}
+
+func TestParentsFromPathBuildsTheHierarchy(t *testing.T) {
+	server := synchronizedServer(t)
+	dir := pathTree(t)
+
+	require.NoError(t, Run(Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "**/*.md"), ParentsFromPath: dir,
+		Output: io.Discard,
+	}))
+
+	guides := findPage(t, server, "User Guides")
+	assert.Contains(t, guides.Body, "All the guides.", "the index is the directory's page")
+	assert.Equal(t, guides.ID, findPage(t, server, "Install").ParentID)
+
+	started := findPage(t, server, "Getting Started")
+	assert.Equal(t, started.ID, findPage(t, server, "Intro").ParentID)
+
+	assert.Equal(t, findPage(t, server, "Parent").ID, findPage(t, server, "Pinned").ParentID,
+		"a Parent header overrides the directory")
+}
+
+func TestParentsFromPathAsFolders(t *testing.T) {
+	server := synchronizedServer(t)
+	dir := pathTree(t)
+
+	require.NoError(t, Run(Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "getting-started/*.md"), ParentsFromPath: dir, PathAsFolders: true,
+		Parents: []string{"Parent"}, Output: io.Discard,
+	}))
+
+	folders := server.Folders()
+	require.Len(t, folders, 1)
+	assert.Equal(t, "Getting Started", folders[0].Title)
+	assert.Equal(t, folders[0].ID, findPage(t, server, "Intro").ParentID)
+}
+
+func TestPathAsFoldersNeedsARootAndAnAnchor(t *testing.T) {
+	err := Run(Config{Files: "*.md", CompileOnly: true, PathAsFolders: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--path-as-folders requires --parents-from-path")
+
+	err = Run(Config{Files: "*.md", CompileOnly: true, PathAsFolders: true, ParentsFromPath: t.TempDir()})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--path-as-folders requires --parents:")
+}
@@ -0,0 +1,164 @@
+package mark
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/confluence/confluencetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// planFixture publishes one document, edits it locally, and returns a plan for
+// publishing the edit, read back from its file as apply would.
+func planFixture(t *testing.T) (*confluencetest.Server, string, *Plan, Config) {
+	t.Helper()
+
+	server, id, config := diffFixture(t)
+	config.Diff = false
+
+	writeFile(t, filepath.Dir(config.Files), "doc.md",
+		"<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Doc -->\n"+
+			"<!-- Label: kept -->\n\n# Heading\n\nFirst paragraph.\n\nReviewed paragraph.\n")
+
+	plan, err := MakePlan(config)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, plan.Save(path))
+
+	loaded, err := LoadPlan(path)
+	require.NoError(t, err)
+
+	// Credentials are not saved in the plan.
+	assert.Empty(t, loaded.Config.Password)
+
+	apply := loaded.Config
+	apply.Password = "token"
+	apply.Output = io.Discard
+
+	return server, id, loaded, apply
+}
+
+func TestPlanDescribesTheRunAndWritesNothing(t *testing.T) {
+	server, id, plan, _ := planFixture(t)
+
+	require.Len(t, plan.Pages, 1)
+	planned := plan.Pages[0]
+
+	assert.Equal(t, ActionUpdate, planned.Action)
+	assert.Equal(t, id, planned.PageID)
+	assert.Equal(t, server.Page(id).Version, planned.Version)
+	assert.Contains(t, planned.Diff, "+<p>Reviewed paragraph.</p>")
+
+	assert.Contains(t, server.Page(id).Body, "Second paragraph.")
+}
+
+func TestApplyPublishesThePlan(t *testing.T) {
+	server, id, plan, config := planFixture(t)
+
+	require.NoError(t, Apply(config, plan))
+
+	assert.Contains(t, server.Page(id).Body, "Reviewed paragraph.")
+}
+
+// TestApplyRefusesAPageEditedSinceThePlan is the guarantee the plan exists for:
+// what somebody approved is not quietly published over a newer edit.
+func TestApplyRefusesAPageEditedSinceThePlan(t *testing.T) {
+	server, id, plan, config := planFixture(t)
+
+	server.EditPage(id, "<p>Edited in Confluence after review.</p>")
+	version := server.Page(id).Version
+
+	err := Apply(config, plan)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the plan was made against version")
+
+	assert.Equal(t, version, server.Page(id).Version, "nothing may be written")
+	assert.Contains(t, server.Page(id).Body, "Edited in Confluence after review.")
+}
+
+func TestApplyRefusesADocumentEditedSinceThePlan(t *testing.T) {
+	server, id, plan, config := planFixture(t)
+
+	writeFile(t, filepath.Dir(config.Files), "doc.md",
+		"<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Doc -->\n"+
+			"<!-- Label: kept -->\n\n# Heading\n\nFirst paragraph.\n\nUnreviewed paragraph.\n")
+
+	err := Apply(config, plan)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "doc.md has been edited")
+
+	assert.Contains(t, server.Page(id).Body, "Second paragraph.")
+}
+
+func TestPlanAndApplyANewPage(t *testing.T) {
+	_, _, config := diffFixture(t)
+	config.Diff = false
+
+	writeFile(t, filepath.Dir(config.Files), "new.md",
+		"<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Brand New -->\n\nHello.\n")
+	config.Files = filepath.Join(filepath.Dir(config.Files), "new.md")
+
+	plan, err := MakePlan(config)
+	require.NoError(t, err)
+	require.Len(t, plan.Pages, 1)
+	assert.Equal(t, ActionCreate, plan.Pages[0].Action)
+	assert.Equal(t, "Parent", plan.Pages[0].ParentTo)
+
+	require.NoError(t, Apply(config, plan))
+
+	api := confluence.NewAPI(config.BaseURL, "user", "token", false)
+	pg, err := api.FindPage("DOCS", "Brand New", "page")
+	require.NoError(t, err)
+	assert.NotNil(t, pg)
+}
+
+// TestApplyingRunRefusesWhatChangedAfterTheCheck: a page or a document can
+// change after Apply has compared the plan and before the run reaches it. The
+// run is given the plan, and checks each one again as it publishes it.
+func TestApplyingRunRefusesWhatChangedAfterTheCheck(t *testing.T) {
+	server, id, plan, config := planFixture(t)
+	config.applying = plan
+
+	server.EditPage(id, "<p>Edited in Confluence after the check.</p>")
+	version := server.Page(id).Version
+
+	err := Run(config)
+	require.Error(t, err)
+	assert.Equal(t, version, server.Page(id).Version, "nothing may be written")
+	assert.Contains(t, server.Page(id).Body, "Edited in Confluence after the check.")
+
+	server, id, plan, config = planFixture(t)
+	config.applying = plan
+
+	writeFile(t, filepath.Dir(config.Files), "doc.md",
+		"<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Doc -->\n"+
+			"<!-- Label: kept -->\n\n# Heading\n\nFirst paragraph.\n\nUnreviewed paragraph.\n")
+
+	require.Error(t, Run(config))
+	assert.NotContains(t, server.Page(id).Body, "Unreviewed paragraph.")
+}
+
+func TestCheckPlannedSaysWhatChanged(t *testing.T) {
+	server, id, plan, config := planFixture(t)
+	api := confluence.NewAPI(config.BaseURL, "user", "token", false)
+	planned := plan.Pages[0]
+
+	got, err := checkPlanned(api, plan, planned.File, planned.Source)
+	require.NoError(t, err)
+	assert.Equal(t, id, got.PageID)
+
+	_, err = checkPlanned(api, plan, "other.md", planned.Source)
+	assert.EqualError(t, err, "other.md is not in the plan; make the plan again")
+
+	_, err = checkPlanned(api, plan, planned.File, "edited")
+	assert.EqualError(t, err, planned.File+" has been edited since the plan was made; make the plan again")
+
+	server.EditPage(id, "<p>Edited.</p>")
+	_, err = checkPlanned(api, plan, planned.File, planned.Source)
+	assert.ErrorContains(t, err, "the plan was made against version")
+	assert.ErrorContains(t, err, "since the plan was checked")
+}
@@ -0,0 +1,116 @@
+package mark
+
+import (
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// previewFixture serves a preview of two documents that link to each other,
+// one of them showing an image and including a fragment.
+func previewFixture(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "parts"), 0o700))
+
+	writeFile(t, dir, "a.md", "<!-- Space: DOCS -->\n<!-- Title: Alpha -->\n\n"+
+		"See [the beta page](b.md) and [a section of it](b.md#setup).\n\n"+
+		"![Logo](logo.png)\n\n<!-- Include: parts/part.md -->\n")
+	writeFile(t, dir, "b.md", "<!-- Space: DOCS -->\n<!-- Title: Beta -->\n\n## Setup\n\nBeta.\n")
+	writeFile(t, dir, "parts/part.md", "Included text.\n")
+	writeFile(t, dir, "logo.png", "not really a png")
+
+	handler, err := NewPreviewHandler(Config{Files: filepath.Join(dir, "*.md")})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return server, dir
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+
+	response, err := http.Get(url) //nolint:gosec,noctx // a test server
+	require.NoError(t, err)
+	defer func() { _ = response.Body.Close() }()
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	return response.StatusCode, string(body)
+}
+
+func TestPreviewListsTheDocuments(t *testing.T) {
+	server, dir := previewFixture(t)
+
+	status, body := get(t, server.URL+"/")
+	require.Equal(t, http.StatusOK, status)
+
+	assert.Contains(t, body, `>Alpha</a>`)
+	assert.Contains(t, body, `>Beta</a>`)
+	assert.Contains(t, body, html.EscapeString(previewPageURL(filepath.Join(dir, "b.md"))))
+	assert.NotContains(t, body, "part.md")
+}
+
+func TestPreviewRendersAPageWithoutConfluence(t *testing.T) {
+	server, dir := previewFixture(t)
+
+	status, body := get(t, server.URL+previewPageURL(filepath.Join(dir, "a.md")))
+	require.Equal(t, http.StatusOK, status)
+
+	assert.Contains(t, body, "<title>Alpha</title>")
+	assert.Contains(t, body, "Included text.")
+
+	// The relative link leads to the other document's preview.
+	beta := previewPageURL(filepath.Join(dir, "b.md"))
+	assert.Contains(t, body, `href="`+html.EscapeString(beta)+`"`)
+	assert.Contains(t, body, `href="`+html.EscapeString(beta+"#setup")+`"`)
+
+	// The image is served from the file beside the document.
+	src := regexp.MustCompile(`<img src="([^"]+)"`).FindStringSubmatch(body)
+	require.NotNil(t, src, body)
+
+	status, image := get(t, server.URL+html.UnescapeString(src[1]))
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "not really a png", image)
+}
+
+func TestPreviewRefusesFilesOutsideTheGlob(t *testing.T) {
+	server, dir := previewFixture(t)
+
+	status, _ := get(t, server.URL+previewPageURL(filepath.Join(dir, "parts", "part.md")))
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+// TestPreviewVersionFollowsIncludes is what live reload rests on: an open page
+// polls its version, and a change to a fragment it includes has to change it.
+func TestPreviewVersionFollowsIncludes(t *testing.T) {
+	server, dir := previewFixture(t)
+
+	versionURL := server.URL + "/version?file=" + filepath.Join(dir, "a.md")
+
+	_, before := get(t, versionURL)
+	_, other := get(t, server.URL+"/version?file="+filepath.Join(dir, "b.md"))
+
+	writeFile(t, dir, "parts/part.md", "Included text, edited.\n")
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "parts/part.md"), later, later))
+
+	_, after := get(t, versionURL)
+	assert.NotEqual(t, before, after)
+
+	_, unchanged := get(t, server.URL+"/version?file="+filepath.Join(dir, "b.md"))
+	assert.Equal(t, other, unchanged)
+}
@@ -0,0 +1,194 @@
+package mark
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/confluence/confluencetest"
+	"github.com/kovetskiy/mark/v16/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pullFixture is a small tree written by hand in Confluence: Guide under
+// Handbook, with a child page and an attached image.
+func pullFixture(t *testing.T) (*confluencetest.Server, *confluencetest.Page) {
+	t.Helper()
+
+	server := confluencetest.New(t)
+	home := server.AddPage("DOCS", "Home", "page", "")
+	server.SetHomepage("DOCS", home.ID)
+	handbook := server.AddPage("DOCS", "Handbook", "page", home.ID)
+
+	guide := server.AddPage("DOCS", "Getting Started", "page", handbook.ID)
+	server.EditPage(guide.ID, `<h1>Welcome</h1>`+
+		`<p>See <ac:link><ri:page ri:content-title="Handbook"/><ac:plain-text-link-body><![CDATA[the handbook]]></ac:plain-text-link-body></ac:link>.</p>`+
+		`<p><ac:image ac:alt="overview"><ri:attachment ri:filename="overview.png"/></ac:image></p>`)
+	server.AddLabel(guide.ID, "onboarding")
+	image := server.AddAttachment(guide.ID, "overview.png", "")
+	server.SetAttachmentData(image.ID, []byte("png bytes"))
+
+	child := server.AddPage("DOCS", "First Steps", "page", guide.ID)
+	server.EditPage(child.ID, `<p>Step one.</p>`)
+
+	return server, guide
+}
+
+func TestPullWritesMarkdownWithHeaders(t *testing.T) {
+	server, guide := pullFixture(t)
+	dir := t.TempDir()
+
+	require.NoError(t, Pull(PullConfig{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		PageID:    guide.ID,
+		OutputDir: dir,
+	}))
+
+	content, err := os.ReadFile(filepath.Join(dir, "getting-started", "getting-started.md"))
+	require.NoError(t, err)
+
+	assert.Equal(t, `<!-- Space: DOCS -->
+<!-- Parent: Handbook -->
+<!-- Title: Getting Started -->
+<!-- Label: onboarding -->
+<!-- Attachment: overview.png -->
+
+# Welcome
+
+See [the handbook](ac:Handbook).
+
+![overview](overview.png)
+`, string(content))
+
+	image, err := os.ReadFile(filepath.Join(dir, "getting-started", "overview.png"))
+	require.NoError(t, err)
+	assert.Equal(t, "png bytes", string(image))
+
+	// Without --recursive the child stays where it is.
+	assert.NoDirExists(t, filepath.Join(dir, "getting-started", "first-steps"))
+}
+
+// TestPullHeadersPublishBackToTheSamePlace reads the pulled headers the way a
+// publish would, which is the point of writing them.
+func TestPullHeadersPublishBackToTheSamePlace(t *testing.T) {
+	server, guide := pullFixture(t)
+	dir := t.TempDir()
+
+	require.NoError(t, Pull(PullConfig{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		PageID:    guide.ID,
+		OutputDir: dir,
+		Recursive: true,
+	}))
+
+	content, err := os.ReadFile(filepath.Join(dir, "getting-started", "first-steps", "first-steps.md"))
+	require.NoError(t, err)
+
+	meta, _, err := metadata.ExtractMeta(content, "", false, false, "", nil, false, "", false)
+	require.NoError(t, err)
+	require.NotNil(t, meta)
+
+	assert.Equal(t, "DOCS", meta.Space)
+	assert.Equal(t, "First Steps", meta.Title)
+	assert.Equal(t, []string{"Handbook", "Getting Started"}, meta.Parents)
+}
+
+func TestPullRefusesToOverwrite(t *testing.T) {
+	server, guide := pullFixture(t)
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "getting-started"), 0o755))
+	writeFile(t, dir, "getting-started/getting-started.md", "local edits\n")
+
+	config := PullConfig{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		PageID:    guide.ID,
+		OutputDir: dir,
+	}
+
+	err := Pull(config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--overwrite")
+
+	content, err := os.ReadFile(filepath.Join(dir, "getting-started", "getting-started.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "local edits\n", string(content))
+
+	config.Overwrite = true
+	require.NoError(t, Pull(config))
+}
+
+// An attachment is a file in the repository like the page is, and is not
+// replaced without --overwrite either -- nor is anything else of the page.
+func TestPullRefusesToOverwriteAnAttachment(t *testing.T) {
+	server, guide := pullFixture(t)
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "getting-started"), 0o755))
+	writeFile(t, dir, "getting-started/overview.png", "my own image")
+
+	err := Pull(PullConfig{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		PageID:    guide.ID,
+		OutputDir: dir,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "overview.png already exists; pass --overwrite")
+
+	image, err := os.ReadFile(filepath.Join(dir, "getting-started", "overview.png"))
+	require.NoError(t, err)
+	assert.Equal(t, "my own image", string(image))
+	assert.NoFileExists(t, filepath.Join(dir, "getting-started", "getting-started.md"))
+}
+
+// Sibling pages with attachments of the same name each keep their own, in
+// their own directories.
+func TestPullKeepsSiblingsAttachmentsApart(t *testing.T) {
+	server, guide := pullFixture(t)
+	for _, title := range []string{"Install", "Upgrade"} {
+		page := server.AddPage("DOCS", title, "page", guide.ID)
+		server.EditPage(page.ID, `<p><ac:image><ri:attachment ri:filename="screen.png"/></ac:image></p>`)
+		image := server.AddAttachment(page.ID, "screen.png", "")
+		server.SetAttachmentData(image.ID, []byte(title+" screen"))
+	}
+	dir := t.TempDir()
+
+	require.NoError(t, Pull(PullConfig{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		PageID:    guide.ID,
+		OutputDir: dir,
+		Recursive: true,
+	}))
+
+	for _, page := range []string{"install", "upgrade"} {
+		image, err := os.ReadFile(filepath.Join(dir, "getting-started", page, "screen.png"))
+		require.NoError(t, err)
+		assert.Equal(t, strings.ToUpper(page[:1])+page[1:]+" screen", string(image))
+
+		content, err := os.ReadFile(filepath.Join(dir, "getting-started", page, page+".md"))
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "<!-- Attachment: screen.png -->")
+	}
+}
+
+// A space whose pages sit beside its homepage, rather than under it, has
+// their first ancestor a real parent, which publishing back needs.
+func TestPullKeepsAParentThatIsNotTheHomepage(t *testing.T) {
+	server := confluencetest.New(t)
+	home := server.AddPage("DOCS", "Home", "page", "")
+	server.SetHomepage("DOCS", home.ID)
+	handbook := server.AddPage("DOCS", "Handbook", "page", "")
+	guide := server.AddPage("DOCS", "Getting Started", "page", handbook.ID)
+	server.EditPage(guide.ID, `<p>Welcome.</p>`)
+	dir := t.TempDir()
+
+	require.NoError(t, Pull(PullConfig{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		PageID:    guide.ID,
+		OutputDir: dir,
+	}))
+
+	content, err := os.ReadFile(filepath.Join(dir, "getting-started", "getting-started.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "<!-- Space: DOCS -->\n<!-- Parent: Handbook -->\n<!-- Title: Getting Started -->\n")
+}
@@ -0,0 +1,154 @@
+package mark
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/confluence/confluencetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commitAll makes a git repository of dir, if it is not one yet, and commits
+// everything in it.
+func commitAll(t *testing.T, dir string) {
+	t.Helper()
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "--all"},
+		{"-c", "user.name=mark", "-c", "user.email=mark@example.com", "commit", "--quiet", "--allow-empty", "-m", "docs"},
+	} {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+}
+
+func TestSinceCompilesWhatAChangeAffects(t *testing.T) {
+	dir := t.TempDir()
+	out := t.TempDir()
+
+	writeFile(t, dir, "a.md", "<!-- Space: DOCS -->\n<!-- Title: A -->\n\n<!-- Include: part.tpl -->\n")
+	writeFile(t, dir, "b.md", "<!-- Space: DOCS -->\n<!-- Title: B -->\n\nB.\n")
+	writeFile(t, dir, "c.md", "<!-- Space: DOCS -->\n<!-- Title: C -->\n<!-- Attachment: notes.txt -->\n\nC.\n")
+	writeFile(t, dir, "part.tpl", "First version.")
+	writeFile(t, dir, "notes.txt", "Notes.")
+	commitAll(t, dir)
+
+	config := Config{
+		Files: filepath.Join(dir, "*.md"), CompileOnly: true, HTMLDir: out,
+		Since: "HEAD",
+	}
+
+	// Nothing changed, so nothing is compiled.
+	require.NoError(t, Run(config))
+	entries, err := os.ReadDir(out)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	writeFile(t, dir, "part.tpl", "Second version.")
+	writeFile(t, dir, "notes.txt", "More notes.")
+	writeFile(t, dir, "d.md", "<!-- Space: DOCS -->\n<!-- Title: D -->\n\nD.\n")
+
+	require.NoError(t, Run(config))
+
+	data, err := os.ReadFile(filepath.Join(out, "a.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Second version.")
+
+	assert.NoFileExists(t, filepath.Join(out, "b.html"))
+	assert.FileExists(t, filepath.Join(out, "c.html"))
+	assert.FileExists(t, filepath.Join(out, "d.html"), "an untracked document counts as changed")
+}
+
+func TestSinceRefusesAnUnknownRef(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.md", "<!-- Space: DOCS -->\n<!-- Title: A -->\n\nA.\n")
+	commitAll(t, dir)
+
+	err := Run(Config{Files: filepath.Join(dir, "*.md"), CompileOnly: true, Since: "no-such-ref"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `--since "no-such-ref"`)
+}
+
+// TestSinceStillHandlesOrphans publishes three documents, then deletes one and
+// edits another. The untouched document is not published again, and must not
+// be taken for deleted along with the one that was.
+func TestSinceStillHandlesOrphans(t *testing.T) {
+	server := confluencetest.New(t)
+	home := server.AddPage("DOCS", "Home", "page", "")
+	server.SetHomepage("DOCS", home.ID)
+	server.AddPage("DOCS", "Parent", "page", home.ID)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "edited.md", outHeader+"<!-- Title: Edited -->\n\nFirst.\n")
+	writeFile(t, dir, "untouched.md", outHeader+"<!-- Title: Untouched -->\n\nSame.\n")
+	writeFile(t, dir, "gone.md", outHeader+"<!-- Title: Gone -->\n\nGone.\n")
+
+	config := Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files:      filepath.Join(dir, "*.md"),
+		TrackPages: true, OnOrphan: "delete",
+		Output: io.Discard,
+	}
+	require.NoError(t, Run(config))
+	commitAll(t, dir)
+
+	api := confluence.NewAPI(server.URL, "user", "token", false)
+	ids := map[string]string{}
+	for _, title := range []string{"Edited", "Untouched", "Gone"} {
+		pg, err := api.FindPage("DOCS", title, "page")
+		require.NoError(t, err)
+		require.NotNil(t, pg)
+		ids[title] = pg.ID
+	}
+	untouchedVersion := server.Page(ids["Untouched"]).Version
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "gone.md")))
+	writeFile(t, dir, "edited.md", outHeader+"<!-- Title: Edited -->\n\nSecond.\n")
+
+	config.Since = "HEAD"
+	require.NoError(t, Run(config))
+
+	assert.Contains(t, server.Page(ids["Edited"]).Body, "Second.")
+	assert.Equal(t, untouchedVersion, server.Page(ids["Untouched"]).Version, "not published again")
+	assert.False(t, server.Page(ids["Untouched"]).Trashed)
+	assert.True(t, server.Page(ids["Gone"]).Trashed)
+}
+
+// TestSinceKeepsTheSectionsOfAnUntouchedSplitDocument: the pages a split
+// document's sections publish to are as present as the document's own when
+// --since leaves it out, and are not taken for orphans.
+func TestSinceKeepsTheSectionsOfAnUntouchedSplitDocument(t *testing.T) {
+	server := synchronizedServer(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "runbook.md", runbook)
+	writeFile(t, dir, "edited.md", outHeader+"<!-- Title: Edited -->\n\nFirst.\n")
+
+	config := Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files:      filepath.Join(dir, "*.md"),
+		TrackPages: true, OnOrphan: "delete",
+		Output: io.Discard,
+	}
+	require.NoError(t, Run(config))
+	commitAll(t, dir)
+
+	install := findPage(t, server, "Install")
+	rollback := findPage(t, server, "Rolling Back")
+
+	writeFile(t, dir, "edited.md", outHeader+"<!-- Title: Edited -->\n\nSecond.\n")
+
+	config.Since = "HEAD"
+	require.NoError(t, Run(config))
+
+	assert.Contains(t, findPage(t, server, "Edited").Body, "Second.")
+	assert.False(t, server.Page(install.ID).Trashed)
+	assert.False(t, server.Page(rollback.ID).Trashed)
+	assert.False(t, findPage(t, server, "Runbook").Trashed)
+}
@@ -0,0 +1,48 @@
+package mark
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnippetPublishesTheCodeAsACodeBlock(t *testing.T) {
+	server := synchronizedServer(t)
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "docs"), 0o755))
+	writeFile(t, dir, "main.go", "package main\n\n// #region run\nfunc run() {}\n// #endregion\n")
+	writeFile(t, dir, "docs/page.md", "<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Page -->\n\n"+
+		"<!-- Snippet: ../main.go#run collapse title Running -->\n")
+
+	require.NoError(t, Run(Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "docs", "*.md"), Output: io.Discard,
+	}))
+
+	body := findPage(t, server, "Page").Body
+	assert.Contains(t, body, `<ac:parameter ac:name="language">go</ac:parameter>`)
+	assert.Contains(t, body, `<ac:parameter ac:name="collapse">true</ac:parameter>`)
+	assert.Contains(t, body, `<ac:parameter ac:name="title">Running</ac:parameter>`)
+	assert.Contains(t, body, "<![CDATA[func run() {}]]>")
+}
+
+func TestValidateReportsAMissingSnippet(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "main.go", "package main\n")
+	writeFile(t, dir, "a.md", "<!-- Space: DOCS -->\n<!-- Title: A -->\n\nText.\n\n<!-- Snippet: main.go#run -->\n")
+
+	results, err := validate(t, dir)
+	require.ErrorIs(t, err, ErrInvalid)
+
+	require.Len(t, results.Problems, 1)
+	assert.Equal(t, report.Problem{
+		File: filepath.Join(dir, "a.md"), Line: 6,
+		Message: `snippet "main.go#run": ` + filepath.Join(dir, "main.go") + `: there is no region "run"`,
+	}, results.Problems[0])
+}
@@ -0,0 +1,105 @@
+package mark
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const runbook = "<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Runbook -->\n<!-- Split-On: h2 -->\n\n" +
+	"What to do when the service is down.\n\n" +
+	"## Install\n\nInstalling. If it goes wrong, see [rolling back](#rolling-back).\n\n### Check\n\nChecking.\n\n" +
+	"## Rolling Back\n\nRolling back. Then [install](#install) again.\n"
+
+func TestSplitOnPublishesSectionsAsChildPages(t *testing.T) {
+	server := synchronizedServer(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "runbook.md", runbook)
+
+	require.NoError(t, Run(Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "*.md"), Output: io.Discard,
+	}))
+
+	parent := findPage(t, server, "Runbook")
+	assert.Contains(t, parent.Body, "What to do when the service is down.")
+	assert.NotContains(t, parent.Body, "Installing.", "a section is on its own page")
+
+	install := findPage(t, server, "Install")
+	rollback := findPage(t, server, "Rolling Back")
+	assert.Equal(t, parent.ID, install.ParentID)
+	assert.Equal(t, parent.ID, rollback.ParentID)
+	assert.Equal(t, []string{install.ID, rollback.ID}, server.ChildOrder(parent.ID))
+
+	assert.Contains(t, install.Body, "Checking.", "a subsection stays with its section")
+	assert.NotContains(t, install.Body, "<h2", "the heading is the page's title")
+
+	assert.Regexp(t, `href="[^"]+/x/[^"]+#rolling-back"`, install.Body, "a link to another section goes to its page")
+	assert.Regexp(t, `href="[^"]+/x/[^"]+#install"`, rollback.Body)
+}
+
+func TestSplitOnRemovedSectionIsAnOrphan(t *testing.T) {
+	server := synchronizedServer(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "runbook.md", runbook)
+
+	config := Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "*.md"), TrackPages: true, OnOrphan: "delete",
+		Output: io.Discard,
+	}
+	require.NoError(t, Run(config))
+
+	rollback := findPage(t, server, "Rolling Back")
+
+	writeFile(t, dir, "runbook.md",
+		"<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Runbook -->\n<!-- Split-On: h2 -->\n\n"+
+			"Intro.\n\n## Install\n\nInstalling.\n")
+	require.NoError(t, Run(config))
+
+	assert.True(t, server.Page(rollback.ID).Trashed, "the section's page went with the section")
+	assert.False(t, findPage(t, server, "Install").Trashed)
+	assert.False(t, findPage(t, server, "Runbook").Trashed)
+}
+
+func TestSplitOnRefusesDuplicateSectionTitles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "runbook.md",
+		"<!-- Space: DOCS -->\n<!-- Title: Runbook -->\n\n## Notes\n\nOne.\n\n## Notes\n\nTwo.\n")
+
+	err := Run(Config{
+		Files: filepath.Join(dir, "*.md"), CompileOnly: true, SplitOn: "h2", Output: io.Discard,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `two pages titled "Notes"`)
+
+	err = Run(Config{Files: filepath.Join(dir, "*.md"), CompileOnly: true, SplitOn: "h7"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--split-on")
+}
+
+func TestSplitOnRewordedHeadingRetitlesThePage(t *testing.T) {
+	server := synchronizedServer(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "runbook.md", runbook)
+
+	config := Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "*.md"), TrackPages: true, Output: io.Discard,
+	}
+	require.NoError(t, Run(config))
+
+	install := findPage(t, server, "Install")
+
+	writeFile(t, dir, "runbook.md", strings.Replace(runbook, "## Install", "## Installing", 1))
+	require.NoError(t, Run(config))
+
+	assert.Equal(t, install.ID, findPage(t, server, "Installing").ID)
+}
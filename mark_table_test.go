@@ -0,0 +1,31 @@
+package mark
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableAndDataFunctionsPublishTheData(t *testing.T) {
+	server := synchronizedServer(t)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "rota.csv", "week,person\n1,Ann\n2,Bob\n")
+	writeFile(t, dir, "rota.tmpl", "{{ range readCSV \"rota.csv\" }}* Week {{ .week }}: {{ .person }}\n{{ end }}")
+	writeFile(t, dir, "page.md", "<!-- Space: DOCS -->\n<!-- Parent: Parent -->\n<!-- Title: Rota -->\n\n"+
+		"<!-- Table: rota.csv\n     Headers: {person: On call}\n     Sort: -week\n-->\n\n"+
+		"<!-- Include: rota.tmpl -->\n")
+
+	require.NoError(t, Run(Config{
+		BaseURL: server.URL, Username: "user", Password: "token",
+		Files: filepath.Join(dir, "*.md"), Output: io.Discard,
+	}))
+
+	body := findPage(t, server, "Rota").Body
+	assert.Contains(t, body, "<th>On call</th>")
+	assert.Regexp(t, `(?s)<td>2</td>.*<td>1</td>`, body, "sorted from the highest week down")
+	assert.Contains(t, body, "<li>Week 1: Ann</li>")
+}
@@ -0,0 +1,89 @@
+package mark
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validate runs Validate over the markdown files in dir and returns the report
+// it wrote.
+func validate(t *testing.T, dir string) (*report.Report, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	err := Validate(Config{Files: filepath.Join(dir, "*.md"), OutputFormat: "json", Output: &out})
+
+	var results report.Report
+	require.NoError(t, json.Unmarshal(out.Bytes(), &results), out.String())
+
+	return &results, err
+}
+
+func TestValidatePassesAGoodDocument(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.md", "<!-- Space: DOCS -->\n<!-- Title: A -->\n<!-- Attachment: notes.txt -->\n\n"+
+		"See [B](b.md).\n\n<!-- Include: parts/part.md -->\n")
+	writeFile(t, dir, "b.md", "<!-- Space: DOCS -->\n<!-- Title: B -->\n\nB.\n")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "parts"), 0o700))
+	writeFile(t, dir, "parts/part.md", "Included.\n")
+	writeFile(t, dir, "notes.txt", "Notes.")
+
+	results, err := validate(t, dir)
+	require.NoError(t, err)
+
+	assert.Empty(t, results.Problems)
+	require.Len(t, results.Pages, 2)
+	assert.Equal(t, report.StatusValid, results.Pages[0].Status)
+}
+
+func TestValidateReportsEveryProblemByLine(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "attachments.md", "<!-- Space: DOCS -->\n<!-- Title: Attachments -->\n"+
+		"<!-- Attachment: missing.png -->\n\n<!-- Include: missing.md -->\n")
+	writeFile(t, dir, "ignore.md", "<!-- Space: DOCS -->\n<!-- Title: Ignore -->\n\nText.\n\n<!-- ac:ignore -->\n")
+	writeFile(t, dir, "links.md", "<!-- Space: DOCS -->\n<!-- Title: Links -->\n\n"+
+		"Text.\n\nSee [the guide](guide.md).\n")
+	writeFile(t, dir, "macro.md", "<!-- Space: DOCS -->\n<!-- Title: Macro -->\n"+
+		"<!-- Macro: ([a-z\n     Template: #\n     Config: {} -->\n\nText.\n")
+	writeFile(t, dir, "same.md", "<!-- Space: DOCS -->\n<!-- Label: copy -->\n<!-- Title: Links -->\n\nText.\n")
+
+	results, err := validate(t, dir)
+	require.ErrorIs(t, err, ErrInvalid)
+
+	lines := map[string][]int{}
+	for _, problem := range results.Problems {
+		lines[filepath.Base(problem.File)] = append(lines[filepath.Base(problem.File)], problem.Line)
+	}
+
+	assert.Equal(t, map[string][]int{
+		"attachments.md": {3, 5},
+		"ignore.md":      {6},
+		"links.md":       {6},
+		"macro.md":       {3},
+		"same.md":        {3},
+	}, lines, results.Problems)
+
+	for _, page := range results.Pages {
+		assert.Equal(t, report.StatusInvalid, page.Status, page.File)
+	}
+}
+
+func TestValidateWritesProblemsAsAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.md", "<!-- Space: DOCS -->\n<!-- Title: A -->\n\n<!-- Include: missing.md -->\n")
+
+	var out bytes.Buffer
+	err := Validate(Config{Files: filepath.Join(dir, "*.md"), OutputFormat: "github", Output: &out})
+	require.Error(t, err)
+
+	assert.Equal(t,
+		"::error file="+filepath.Join(dir, "a.md")+",line=4::include \"missing.md\" does not exist\n",
+		out.String())
+}
@@ -0,0 +1,91 @@
+package mark
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kovetskiy/mark/v16/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDependenciesFollowIncludesMacrosAndAttachments(t *testing.T) {
+	dir := t.TempDir()
+	shared := t.TempDir()
+
+	writeFile(t, dir, "doc.md", "<!-- Space: DOCS -->\n<!-- Title: Doc -->\n<!-- Attachment: report.pdf -->\n\n"+
+		"<!-- Macro: :box:\n     Template: box.tpl\n     Title: Box -->\n"+
+		"<!-- Macro: :done:\n     Template: ac:status\n     Title: DONE -->\n\n"+
+		"<!-- Include: intro.md -->\n\n![Diagram](img/diagram.png)\n\n![Logo](https://example.com/logo.png)\n")
+	writeFile(t, dir, "intro.md", "Intro.\n\n<!-- Include: footer.md -->\n")
+	writeFile(t, shared, "footer.md", "Footer.\n")
+	writeFile(t, dir, "box.tpl", "<b>{{ .Title }}</b>")
+
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	deps := dependencies(filepath.Join(dir, "doc.md"), Config{IncludePath: shared}, std)
+
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "doc.md"),
+		filepath.Join(dir, "report.pdf"),
+		filepath.Join(dir, "img/diagram.png"),
+		filepath.Join(dir, "intro.md"),
+		filepath.Join(shared, "footer.md"),
+		filepath.Join(dir, "box.tpl"),
+	}, deps)
+}
+
+// TestWatchCompilesAgainWhatAChangeAffects compiles two documents, changes a
+// fragment only one of them includes, and expects that one alone to be
+// written again -- with the fragment as it now is, not as the first compile
+// cached it.
+func TestWatchCompilesAgainWhatAChangeAffects(t *testing.T) {
+	previous := watchInterval
+	watchInterval = 10 * time.Millisecond
+	t.Cleanup(func() { watchInterval = previous })
+
+	dir := t.TempDir()
+	out := t.TempDir()
+
+	writeFile(t, dir, "a.md", "<!-- Space: DOCS -->\n<!-- Title: A -->\n\n<!-- Include: part.md -->\n")
+	writeFile(t, dir, "b.md", "<!-- Space: DOCS -->\n<!-- Title: B -->\n\nB.\n")
+	writeFile(t, dir, "part.md", "First version.\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(ctx, Config{
+			Files: filepath.Join(dir, "*.md"), CompileOnly: true, HTMLDir: out,
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	a := filepath.Join(out, "a.html")
+	b := filepath.Join(out, "b.html")
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(a)
+		_, bErr := os.Stat(b)
+		return err == nil && bErr == nil && strings.Contains(string(data), "First version.")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.Remove(b))
+
+	writeFile(t, dir, "part.md", "Second version, which is longer.\n")
+
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(a)
+		return err == nil && strings.Contains(string(data), "Second version")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// b.md does not include the fragment, so it is not compiled again.
+	time.Sleep(10 * watchInterval)
+	assert.NoFileExists(t, b)
+}
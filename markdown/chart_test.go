@@ -0,0 +1,71 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/stdlib"
+	"github.com/kovetskiy/mark/v16/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compileChart(t *testing.T, markdown string) (string, error) {
+	t.Helper()
+
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	out, _, err := CompileMarkdown([]byte(markdown), std, "test.md", types.MarkConfig{Features: []string{"chart"}})
+
+	return out, err
+}
+
+func TestChartBlockCompilesToTheChartMacro(t *testing.T) {
+	want := `<ac:structured-macro ac:name="chart">` +
+		`<ac:parameter ac:name="type">bar</ac:parameter>` +
+		`<ac:parameter ac:name="title">Sales &amp; returns</ac:parameter>` +
+		`<ac:parameter ac:name="xLabel">Quarter</ac:parameter>` +
+		"<ac:rich-text-body>\n\n" +
+		`<table><tbody><tr><th>Quarter</th><th>Sales</th></tr><tr><td>Q1</td><td>10</td></tr><tr><td>Q2</td><td>12</td></tr></tbody></table>` +
+		"\n\n</ac:rich-text-body></ac:structured-macro>"
+
+	out, err := compileChart(t, "```chart type=bar title=\"Sales & returns\" xlabel=Quarter\n"+
+		"| Quarter | Sales |\n|---|--:|\n| Q1 | 10 |\n| Q2 | 12 |\n```\n")
+	require.NoError(t, err)
+	assert.Equal(t, want, out)
+
+	out, err = compileChart(t, "```chart type=bar title=\"Sales & returns\" xLabel=Quarter\nQuarter, Sales\nQ1, 10\nQ2, 12\n```\n")
+	require.NoError(t, err)
+	assert.Equal(t, want, out, "CSV is read the same as a Markdown table")
+}
+
+func TestChartBlockErrors(t *testing.T) {
+	_, err := compileChart(t, "```chart kind=bar\na,b\n1,2\n```\n")
+	assert.ErrorContains(t, err, `no parameter "kind"`)
+
+	_, err = compileChart(t, "```chart type=bar\na,b\n```\n")
+	assert.ErrorContains(t, err, "at least one row of data")
+
+	_, err = compileChart(t, "```chart title Sales\na,b\n1,2\n```\n")
+	assert.ErrorContains(t, err, "key=value pairs")
+}
+
+func TestChartBlockWithoutTheFeatureIsCode(t *testing.T) {
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	out, _, err := CompileMarkdown([]byte("```chart type=bar\na,b\n1,2\n```\n"), std, "test.md", types.MarkConfig{})
+	require.NoError(t, err)
+	assert.Contains(t, out, `<ac:structured-macro ac:name="code">`)
+}
+
+func TestChartTemplateTakesAMarkdownTable(t *testing.T) {
+	out, err := compileChart(t, "<!-- Include: ac:chart\n     Type: pie\n     Width: 400\n"+
+		"     Body: |\n       | Team | Size |\n       |---|---|\n       | A | 3 |\n -->\n")
+	require.NoError(t, err)
+
+	assert.Contains(t, out, `<ac:parameter ac:name="type">pie</ac:parameter>`)
+	assert.Contains(t, out, `<ac:parameter ac:name="width">400</ac:parameter>`)
+	assert.Contains(t, out, "<th>Team</th>")
+	assert.Contains(t, out, "<td>3</td>")
+}
@@ -0,0 +1,31 @@
+package mark
+
+import (
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/stdlib"
+	"github.com/kovetskiy/mark/v16/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A diagram's options are checked before it is drawn, and a wrong one is
+// reported where it was written.
+func TestD2OptionsAreCheckedFirst(t *testing.T) {
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	_, _, err = CompileMarkdown(
+		[]byte("text\n\n```d2 theme=200 layout=circular\na -> b\n```\n"),
+		std, "test.md",
+		types.MarkConfig{Features: []string{"d2"}},
+	)
+	assert.EqualError(t, err, `line 3, col 1: "circular" is not a d2 layout engine: use dagre or elk`)
+
+	_, _, err = CompileMarkdown(
+		[]byte("```d2 sketch theme=solarized\na -> b\n```\n"),
+		std, "test.md",
+		types.MarkConfig{Features: []string{"d2"}},
+	)
+	assert.ErrorContains(t, err, `line 1, col 1: "solarized" is not a d2 theme`)
+}
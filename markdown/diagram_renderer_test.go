@@ -0,0 +1,124 @@
+package mark
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/diagram"
+	"github.com/kovetskiy/mark/v16/stdlib"
+	"github.com/kovetskiy/mark/v16/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagramRendererDrawsItsLanguageAsAnImage(t *testing.T) {
+	var drawn bytes.Buffer
+	require.NoError(t, png.Encode(&drawn, image.NewRGBA(image.Rect(0, 0, 200, 100))))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(drawn.Bytes())
+	}))
+	defer server.Close()
+
+	renderers, err := diagram.ParseRenderers([]string{"dot=kroki:graphviz", "mermaid=kroki"}, server.URL)
+	require.NoError(t, err)
+
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	out, attachments, err := CompileMarkdown(
+		[]byte("```dot title flow\ndigraph { a -> b }\n```\n\n```mermaid\ngraph TD; a-->b\n```\n\n```go\nfunc main() {}\n```\n"),
+		std, "test.md",
+		types.MarkConfig{Features: []string{"mermaid"}, DiagramRenderers: renderers},
+	)
+	require.NoError(t, err)
+
+	require.Len(t, attachments, 2, "mermaid is drawn by the renderer configured for it, not the built-in one")
+	assert.Equal(t, "flow.png", attachments[0].Filename)
+	assert.Equal(t, "200", attachments[0].Width)
+
+	assert.Contains(t, out, `<ri:attachment ri:filename="flow.png"/>`)
+	assert.Contains(t, out, `<ri:attachment ri:filename="`+attachments[1].Filename+`"/>`)
+	assert.Contains(t, out, `<ac:parameter ac:name="language">go</ac:parameter>`, "other languages are still code")
+}
+
+func TestDiagramRendererWinsOverMermaidMode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = png.Encode(w, image.NewRGBA(image.Rect(0, 0, 40, 20)))
+	}))
+	defer server.Close()
+
+	renderers, err := diagram.ParseRenderers([]string{"mermaid=kroki"}, server.URL)
+	require.NoError(t, err)
+
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	out, attachments, err := CompileMarkdown(
+		[]byte("```mermaid\ngraph TD; a-->b\n```\n\n```mermaid mode=live\ngraph TD; b-->c\n```\n"),
+		std, "test.md",
+		types.MarkConfig{Features: []string{"mermaid"}, MermaidMode: "macro", DiagramRenderers: renderers},
+	)
+	require.NoError(t, err, "the mode is not used, so it is not checked")
+
+	assert.Len(t, attachments, 2)
+	assert.NotContains(t, out, `<ac:structured-macro ac:name="mermaid">`)
+}
+
+func TestDiagramFormatIsChosenGloballyOrPerBlock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/svg") {
+			_, _ = w.Write([]byte(`<svg width="40" height="20"></svg>`))
+			return
+		}
+
+		_ = png.Encode(w, image.NewRGBA(image.Rect(0, 0, 40, 20)))
+	}))
+	defer server.Close()
+
+	renderers, err := diagram.ParseRenderers([]string{"dot=kroki"}, server.URL)
+	require.NoError(t, err)
+
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	_, attachments, err := CompileMarkdown(
+		[]byte("```dot title one\ndigraph {}\n```\n\n```dot format=png title two\ndigraph {}\n```\n"),
+		std, "test.md",
+		types.MarkConfig{DiagramRenderers: renderers, DiagramFormat: "svg"},
+	)
+	require.NoError(t, err)
+
+	require.Len(t, attachments, 2)
+	assert.Equal(t, "one.svg", attachments[0].Filename)
+	assert.Equal(t, "two.png", attachments[1].Filename)
+
+	_, _, err = CompileMarkdown([]byte("```dot format=gif\ndigraph {}\n```\n"), std, "test.md",
+		types.MarkConfig{DiagramRenderers: renderers})
+	assert.ErrorContains(t, err, `line 1, col 1: dot rendering failed: "gif" is not a diagram format: use svg or png`)
+}
+
+// Only a diagram has a format. Any other code block keeps the option as it
+// always did, where the code macro takes it for a theme.
+func TestFormatIsAnOptionOfDiagramsOnly(t *testing.T) {
+	renderers, err := diagram.ParseRenderers([]string{"dot=kroki"}, "http://kroki.invalid")
+	require.NoError(t, err)
+
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	out, attachments, err := CompileMarkdown(
+		[]byte("```go format=gif\nfunc main() {}\n```\n"),
+		std, "test.md",
+		types.MarkConfig{DiagramRenderers: renderers, DiagramFormat: "svg"},
+	)
+	require.NoError(t, err)
+
+	assert.Empty(t, attachments)
+	assert.Contains(t, out, `<ac:parameter ac:name="theme">format=gif</ac:parameter>`)
+}
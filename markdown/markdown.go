@@ -9,6 +9,7 @@ import (
 
 	katex "github.com/FurqanSoftware/goldmark-katex"
 	"github.com/kovetskiy/mark/v16/attachment"
+	"github.com/kovetskiy/mark/v16/datafile"
 	"github.com/kovetskiy/mark/v16/includes"
 	"github.com/kovetskiy/mark/v16/macro"
 	cparser "github.com/kovetskiy/mark/v16/parser"
@@ -58,7 +59,7 @@ func (c *ConfluenceLegacyExtension) Extend(m goldmark.Markdown) {
 		util.Prioritized(crenderer.NewConfluenceTextLegacyRenderer(c.MarkConfig.StripNewlines), 100),
 		util.Prioritized(crenderer.NewConfluenceBlockQuoteRenderer(), 100),
 		util.Prioritized(crenderer.NewConfluenceCodeBlockRenderer(c.Stdlib, c.Path), 100),
-		util.Prioritized(crenderer.NewConfluenceFencedCodeBlockRenderer(c.Stdlib, c, c.MarkConfig), 100),
+		util.Prioritized(crenderer.NewConfluenceFencedCodeBlockRenderer(c.Stdlib, c, c.Path, c.MarkConfig), 100),
 		util.Prioritized(crenderer.NewConfluenceHTMLBlockRenderer(c.Stdlib, c, c.Path, c.MarkConfig.ImageAlign), 100),
 		util.Prioritized(crenderer.NewConfluenceHeadingRenderer(c.MarkConfig.DropFirstH1), 100),
 		util.Prioritized(crenderer.NewConfluenceImageRenderer(c.Stdlib, c, c.Path, c.MarkConfig.ImageAlign), 100),
@@ -180,6 +181,10 @@ func CompileMarkdown(markdown []byte, stdlib *stdlib.Lib, path string, cfg types
 		tmpl = template.New("stdlib")
 	}
 
+	// A template reads data files from beside the document it is compiled
+	// for, as the document's own links and includes are found.
+	tmpl = tmpl.Funcs(datafile.Funcs(filepath.Dir(path)))
+
 	var err error
 	var recurse bool
 	for {
@@ -209,6 +214,15 @@ func CompileMarkdown(markdown []byte, stdlib *stdlib.Lib, path string, cfg types
 		}
 	}
 
+	// After includes and macros, so that an embed a template writes is
+	// embedded too.
+	if slices.Contains(cfg.Features, "obsidian") {
+		markdown, err = includes.ProcessObsidianEmbeds(path, markdown)
+		if err != nil {
+			return "", nil, fmt.Errorf("unable to embed notes: %w", err)
+		}
+	}
+
 	ghAlertsExtension := NewConfluenceExtension(stdlib, path, cfg)
 	htmlOutput, err := compileMarkdownWithExtension(markdown, ghAlertsExtension, "rendering markdown with GitHub Alerts support:\n%s")
 	// A transformer cannot return an error from Transform, so each one that can
@@ -235,6 +249,10 @@ func CompileMarkdownLegacy(markdown []byte, stdlib *stdlib.Lib, path string, cfg
 		tmpl = template.New("stdlib")
 	}
 
+	// A template reads data files from beside the document it is compiled
+	// for, as the document's own links and includes are found.
+	tmpl = tmpl.Funcs(datafile.Funcs(filepath.Dir(path)))
+
 	var err error
 	var recurse bool
 	for {
@@ -320,10 +338,13 @@ func (c *ConfluenceExtension) Attach(a attachment.Attachment) {
 // 2. GitHub Alerts specific renderers (blockquote and text) with higher priority
 // 3. GitHub Alerts AST transformer for preprocessing
 func (c *ConfluenceExtension) Extend(m goldmark.Markdown) {
+	alerts := ctransformer.NewGHAlertsTransformer()
+	alerts.Callouts = slices.Contains(c.MarkConfig.Features, "obsidian")
+
 	// Register core renderers (excluding blockquote and text which we'll replace)
 	m.Renderer().AddOptions(renderer.WithNodeRenderers(
 		util.Prioritized(crenderer.NewConfluenceCodeBlockRenderer(c.Stdlib, c.Path), 100),
-		util.Prioritized(crenderer.NewConfluenceFencedCodeBlockRenderer(c.Stdlib, c, c.MarkConfig), 100),
+		util.Prioritized(crenderer.NewConfluenceFencedCodeBlockRenderer(c.Stdlib, c, c.Path, c.MarkConfig), 100),
 		util.Prioritized(crenderer.NewConfluenceHTMLBlockRenderer(c.Stdlib, c, c.Path, c.MarkConfig.ImageAlign), 100),
 		util.Prioritized(crenderer.NewConfluenceHeadingRenderer(c.MarkConfig.DropFirstH1), 100),
 		util.Prioritized(crenderer.NewConfluenceImageRenderer(c.Stdlib, c, c.Path, c.MarkConfig.ImageAlign), 100),
@@ -343,7 +364,7 @@ func (c *ConfluenceExtension) Extend(m goldmark.Markdown) {
 	m.Parser().AddOptions(parser.WithASTTransformers(
 		util.Prioritized(c.Pipeline, 10),
 		util.Prioritized(ctransformer.NewLayoutTransformer(), 100),
-		util.Prioritized(ctransformer.NewGHAlertsTransformer(), 100),
+		util.Prioritized(alerts, 100),
 		// Last, so that it sees the headings includes and macros brought in as
 		// well as the ones written in the file, and so that heading ids have
 		// already been assigned.
@@ -423,6 +444,14 @@ func (c *ConfluenceExtension) Extend(m goldmark.Markdown) {
 			util.Prioritized(ctransformer.NewAutoLinkTransformer(), 110),
 		))
 	}
+	// Add Obsidian's [[links]] if requested. Ahead of goldmark's own link
+	// parser, which would otherwise take [[Note]] for a bracketed [Note].
+	if slices.Contains(c.MarkConfig.Features, "obsidian") {
+		m.Parser().AddOptions(parser.WithInlineParsers(
+			util.Prioritized(cparser.NewWikiLinkParser(), 198),
+		))
+	}
+
 	// Add confluence tag parser for <ac:*/> tags
 	m.Parser().AddOptions(parser.WithInlineParsers(
 		util.Prioritized(cparser.NewConfluenceTagParser(), 199),
@@ -0,0 +1,108 @@
+package mark
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/stdlib"
+	"github.com/kovetskiy/mark/v16/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMermaidMacroModeKeepsTheSource(t *testing.T) {
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	out, attachments, err := CompileMarkdown(
+		[]byte("```mermaid title Login & logout\ngraph TD;\n  A-->B;\n```\n"),
+		std, "test.md",
+		types.MarkConfig{Features: []string{"mermaid"}, MermaidMode: "macro"},
+	)
+	require.NoError(t, err)
+
+	assert.Empty(t, attachments, "nothing is rendered")
+	assert.Equal(t,
+		`<ac:structured-macro ac:name="mermaid">`+
+			`<ac:parameter ac:name="title">Login &amp; logout</ac:parameter>`+
+			"<ac:plain-text-body><![CDATA[graph TD;\n  A-->B;]]></ac:plain-text-body>"+
+			`</ac:structured-macro>`,
+		out,
+	)
+}
+
+func TestMermaidModeOfABlockWins(t *testing.T) {
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	out, _, err := CompileMarkdown(
+		[]byte("```mermaid mode=macro\ngraph TD; A-->B;\n```\n"),
+		std, "test.md",
+		types.MarkConfig{Features: []string{"mermaid"}},
+	)
+	require.NoError(t, err)
+	assert.Contains(t, out, `<ac:structured-macro ac:name="mermaid">`)
+
+	_, _, err = CompileMarkdown(
+		[]byte("text\n\n```mermaid mode=live\ngraph TD; A-->B;\n```\n"),
+		std, "test.md",
+		types.MarkConfig{Features: []string{"mermaid"}, MermaidMode: "macro"},
+	)
+	assert.EqualError(t, err, `line 3, col 1: "live" is not a mermaid mode: use image or macro`)
+}
+
+func TestMermaidMacroTemplateIsAFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mermaid-cloud.tmpl"), []byte(
+		`<ac:structured-macro ac:name="mermaid-cloud">`+
+			`<ac:parameter ac:name="source">{{ .Text | xmlesc }}</ac:parameter>`+
+			`</ac:structured-macro>`,
+	), 0o644))
+
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	out, _, err := CompileMarkdown(
+		[]byte("```mermaid\ngraph TD; A-->B;\n```\n"),
+		std, "test.md",
+		types.MarkConfig{
+			Features:             []string{"mermaid"},
+			MermaidMode:          "macro",
+			MermaidMacroTemplate: "mermaid-cloud.tmpl",
+			IncludePath:          dir,
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`<ac:structured-macro ac:name="mermaid-cloud">`+
+			`<ac:parameter ac:name="source">graph TD; A--&gt;B;</ac:parameter>`+
+			`</ac:structured-macro>`,
+		out,
+	)
+}
+
+// The template is found next to the document, as its Includes are, wherever
+// mark is run from.
+func TestMermaidMacroTemplateIsFoundNextToTheDocument(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "docs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "mermaid-cloud.tmpl"), []byte(
+		`<ac:structured-macro ac:name="mermaid-cloud">{{ .Text }}</ac:structured-macro>`,
+	), 0o644))
+
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	out, _, err := CompileMarkdown(
+		[]byte("```mermaid\ngraph TD; A;\n```\n"),
+		std, filepath.Join(dir, "docs", "page.md"),
+		types.MarkConfig{
+			Features:             []string{"mermaid"},
+			MermaidMode:          "macro",
+			MermaidMacroTemplate: "mermaid-cloud.tmpl",
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, `<ac:structured-macro ac:name="mermaid-cloud">graph TD; A;</ac:structured-macro>`, out)
+}
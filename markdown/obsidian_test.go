@@ -0,0 +1,139 @@
+package mark
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/stdlib"
+	"github.com/kovetskiy/mark/v16/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compileObsidian(t *testing.T, dir, markdown string, resolved map[string]string) (string, []string) {
+	t.Helper()
+
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	cfg := types.MarkConfig{
+		Features: []string{"obsidian"},
+		ResolveLink: func(target, text string) (string, error) {
+			return resolved[target], nil
+		},
+	}
+
+	html, attachments, err := CompileMarkdown([]byte(markdown), std, filepath.Join(dir, "note.md"), cfg)
+	require.NoError(t, err)
+
+	var names []string
+	for _, a := range attachments {
+		names = append(names, a.Filename)
+	}
+
+	return html, names
+}
+
+func TestObsidianWikiLinksResolveLikeRelativeLinks(t *testing.T) {
+	html, _ := compileObsidian(t, t.TempDir(),
+		"See [[Other Note]], [[Other Note#Set Up|setting up]] and [[#Intro]].\n",
+		map[string]string{
+			"Other Note.md":        "https://example.com/other",
+			"Other Note.md#Set-Up": "https://example.com/other#Set-Up",
+		},
+	)
+
+	assert.Contains(t, html, `<a href="https://example.com/other">Other Note</a>`)
+	assert.Contains(t, html, `<a href="https://example.com/other#Set-Up">setting up</a>`)
+	assert.Contains(t, html, `<a href="#Intro">#Intro</a>`)
+}
+
+func TestObsidianWikiLinksNeedTheFeature(t *testing.T) {
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	html, _, err := CompileMarkdown([]byte("See [[Other Note]].\n"), std, "note.md", types.MarkConfig{})
+	require.NoError(t, err)
+
+	assert.Contains(t, html, "[[Other Note]]")
+}
+
+func TestObsidianImageEmbedIsAnAttachmentWithAWidth(t *testing.T) {
+	dir := t.TempDir()
+	image, err := os.ReadFile("../testdata/test.png")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "diagram.png"), image, 0o644))
+
+	html, attachments := compileObsidian(t, dir, "![[diagram.png|300]]\n", nil)
+
+	assert.Equal(t, []string{"diagram.png"}, attachments)
+	assert.Contains(t, html, `ac:width="300"`)
+	assert.Contains(t, html, `<ri:attachment ri:filename="diagram.png"/>`)
+}
+
+func TestObsidianNoteEmbedTranscludesASection(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Setup.md"), []byte(`---
+title: Setup
+---
+# Setup
+
+## Install
+
+Run the installer.
+
+`+"```sh\nmake install\n```"+`
+
+### Check
+
+It works.
+
+## Uninstall
+
+Remove it.
+`), 0o644))
+
+	html, _ := compileObsidian(t, dir, "Before.\n\n![[Setup#Install]]\n\nAfter.\n", nil)
+
+	assert.Contains(t, html, "Run the installer.")
+	assert.Contains(t, html, "make install", "code blocks come from the embedded note")
+	assert.Contains(t, html, "It works.", "subsections come along")
+	assert.NotContains(t, html, "Remove it.")
+	assert.NotContains(t, html, "title: Setup")
+	assert.Contains(t, html, "<p>After.</p>")
+}
+
+func TestObsidianNoteEmbeddingItselfIsAnError(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.md"), []byte("![[b]]\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.md"), []byte("![[a]]\n"), 0o644))
+
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	_, _, err = CompileMarkdown([]byte("![[a]]\n"), std, filepath.Join(dir, "note.md"), types.MarkConfig{Features: []string{"obsidian"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "would embed a note in itself")
+}
+
+func TestObsidianFoldedCalloutIsAnExpandedPanel(t *testing.T) {
+	html, _ := compileObsidian(t, t.TempDir(), "> [!faq]- Why *this*?\n> Because.\n", nil)
+
+	assert.Equal(t, `<ac:structured-macro ac:name="expand"><ac:parameter ac:name="title">Why *this*?</ac:parameter><ac:rich-text-body>
+<ac:structured-macro ac:name="note"><ac:parameter ac:name="icon">true</ac:parameter><ac:rich-text-body>
+<p>Because.</p>
+</ac:rich-text-body></ac:structured-macro>
+</ac:rich-text-body></ac:structured-macro>
+`, html)
+}
+
+func TestObsidianCalloutKeepsItsTitle(t *testing.T) {
+	html, _ := compileObsidian(t, t.TempDir(), "> [!danger]+ Do not\n> Ever.\n\n> [!NOTE]\n> Plain.\n", nil)
+
+	assert.Contains(t, html, `<ac:structured-macro ac:name="warning"><ac:parameter ac:name="icon">true</ac:parameter><ac:rich-text-body>
+<p>Do not</p>
+<p>Ever.</p>`)
+	assert.Contains(t, html, "<p>Note</p>\n<p>Plain.</p>", "GitHub's alerts are unchanged")
+	assert.NotContains(t, html, `ac:name="expand"`)
+}
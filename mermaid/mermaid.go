@@ -8,12 +8,14 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	mermaid "github.com/dreampuf/mermaid.go"
 	"github.com/kovetskiy/mark/v16/attachment"
 	"github.com/kovetskiy/mark/v16/chrome"
+	"github.com/kovetskiy/mark/v16/diagram"
 	"github.com/rs/zerolog/log"
 )
 
@@ -35,6 +37,27 @@ var renderTimeout = 120 * time.Second
 // second attempt runs on a new one: see the crash case in renderPNG.
 const renderAttempts = 2
 
+// The modes a Mermaid diagram is published in: rendered here as an image, or
+// left to a Mermaid macro app installed in Confluence to draw, which keeps the
+// source editable on the page and needs no browser here.
+const (
+	ModeImage = "image"
+	ModeMacro = "macro"
+)
+
+// ParseMode reads the mode a Mermaid diagram is published in, an image when
+// none is given.
+func ParseMode(mode string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", ModeImage:
+		return ModeImage, nil
+	case ModeMacro:
+		return ModeMacro, nil
+	default:
+		return "", fmt.Errorf("%q is not a mermaid mode: use image or macro", mode)
+	}
+}
+
 func getMermaidEngine() (*mermaid.RenderEngine, error) {
 	mermaidMutex.Lock()
 	defer mermaidMutex.Unlock()
@@ -87,26 +110,56 @@ func discardEngine(engine *mermaid.RenderEngine) {
 	engine.Cancel()
 }
 
-// renderPNG renders one diagram, deciding from mermaid.go's sentinel errors
-// whether the engine survived the failure and whether another attempt is worth
-// making.
+// renderPNG renders one diagram as a PNG, and the size it is shown at.
 func renderPNG(title, diagram string, scale float64) ([]byte, *mermaid.BoxModel, error) {
+	var (
+		pngBytes []byte
+		boxModel *mermaid.BoxModel
+	)
+
+	err := render(title, func(ctx context.Context, engine *mermaid.RenderEngine) error {
+		var err error
+		pngBytes, boxModel, err = engine.RenderAsScaledPngContext(ctx, diagram, scale)
+		return err
+	})
+
+	return pngBytes, boxModel, err
+}
+
+// renderSVG renders one diagram as an SVG. The engine bounds the render with
+// its own timeout, as it takes no context for one.
+func renderSVG(title, diagram string) ([]byte, error) {
+	var svg string
+
+	err := render(title, func(ctx context.Context, engine *mermaid.RenderEngine) error {
+		var err error
+		svg, err = engine.Render(diagram)
+		return err
+	})
+
+	return []byte(svg), err
+}
+
+// render renders one diagram with draw, deciding from mermaid.go's sentinel
+// errors whether the engine survived the failure and whether another attempt
+// is worth making.
+func render(title string, draw func(ctx context.Context, engine *mermaid.RenderEngine) error) error {
 	for attempt := 1; ; attempt++ {
 		engine, err := getMermaidEngine()
 		if err != nil {
-			return nil, nil, err
+			return err
 		}
 
 		// The context bounds the wait for a turn on the engine's page as well as
 		// the render, which the engine's own timeout does not: that clock only
 		// starts once the render begins.
 		ctx, cancel := context.WithTimeout(context.Background(), renderTimeout)
-		pngBytes, boxModel, err := engine.RenderAsScaledPngContext(ctx, diagram, scale)
+		err = draw(ctx, engine)
 		cancel()
 
 		switch {
 		case err == nil:
-			return pngBytes, boxModel, nil
+			return nil
 
 		case errors.Is(err, mermaid.ErrTargetCrashed), errors.Is(err, mermaid.ErrEngineClosed):
 			// Every later render on this engine fails the same way, so it is
@@ -117,36 +170,78 @@ func renderPNG(title, diagram string, scale float64) ([]byte, *mermaid.BoxModel,
 				log.Warn().Err(err).Msgf("Mermaid render engine died on %q, retrying with a new browser", title)
 				continue
 			}
-			return nil, nil, err
+			return err
 
 		case errors.Is(err, mermaid.ErrRenderException):
 			// The diagram is what failed, so the engine is still good and a
 			// retry would fail identically. mermaid.go keeps chrome's
 			// *runtime.ExceptionDetails in the chain, so the message already
 			// names the mermaid parse error.
-			return nil, nil, fmt.Errorf("invalid mermaid diagram: %w", err)
+			return fmt.Errorf("invalid mermaid diagram: %w", err)
 
 		case errors.Is(err, context.DeadlineExceeded):
 			// Cancelling a render only aborts its in-flight commands, so the
 			// engine stays usable and is kept for the next diagram. Retrying is
 			// not worth another renderTimeout on a diagram that has already
 			// shown it does not settle.
-			return nil, nil, fmt.Errorf("mermaid rendering timed out after %v: %w", renderTimeout, err)
+			return fmt.Errorf("mermaid rendering timed out after %v: %w", renderTimeout, err)
 
 		default:
 			// An unclassified failure says nothing about whether the browser
 			// survived it, so it is discarded: starting the next diagram over is
 			// cheap next to producing a page with a diagram missing from it.
 			discardEngine(engine)
-			return nil, nil, err
+			return err
 		}
 	}
 }
 
-func ProcessMermaidLocally(title string, mermaidDiagram []byte, scale float64) (attachment.Attachment, error) {
-	log.Debug().Msgf("Rendering: %q", title)
+// cacheKey returns the key a diagram is cached under: anything that changes
+// the image drawn, down to the version of the renderer, is part of it.
+func cacheKey(source []byte, scale float64, format string) string {
+	return diagram.CacheKey(
+		"mermaid",
+		diagram.ModuleVersion("github.com/dreampuf/mermaid.go"),
+		strconv.FormatFloat(scale, 'g', -1, 64),
+		format,
+		string(source),
+	)
+}
 
-	pngBytes, boxModel, err := renderPNG(title, string(mermaidDiagram), scale)
+// ProcessMermaidLocally renders a Mermaid diagram as the PNG or SVG attachment
+// it is published as. A diagram the cache has is not rendered again, and no browser
+// is started for it.
+func ProcessMermaidLocally(title string, mermaidDiagram []byte, scale float64, format string, cache *diagram.Cache) (attachment.Attachment, error) {
+	format, err := diagram.ParseFormat(format)
+	if err != nil {
+		return attachment.Attachment{}, err
+	}
+
+	key := cacheKey(mermaidDiagram, scale, format)
+	image, err := cache.Render(key, func() (diagram.Image, error) {
+		log.Debug().Msgf("Rendering: %q", title)
+
+		if format == diagram.FormatSVG {
+			svg, err := renderSVG(title, string(mermaidDiagram))
+			if err != nil {
+				return diagram.Image{}, err
+			}
+
+			width, height, err := diagram.Size(svg, format)
+			if err != nil {
+				return diagram.Image{}, fmt.Errorf("mermaid did not draw an svg image: %w", err)
+			}
+
+			return diagram.Image{Data: svg, Width: width, Height: height}, nil
+		}
+
+		pngBytes, boxModel, err := renderPNG(title, string(mermaidDiagram), scale)
+		if err != nil {
+			return diagram.Image{}, err
+		}
+
+		return diagram.Image{Data: pngBytes, Width: boxModel.Width, Height: boxModel.Height}, nil
+	})
 	if err != nil {
 		return attachment.Attachment{}, err
 	}
@@ -157,6 +252,12 @@ func ProcessMermaidLocally(title string, mermaidDiagram []byte, scale float64) (
 
 	mermaidBytes := append(mermaidDiagram, scaleAsBytes...)
 
+	// A PNG keeps the checksum it always had, so that the diagrams published
+	// before SVG could be are not uploaded again.
+	if format != diagram.FormatPNG {
+		mermaidBytes = append(mermaidBytes, format...)
+	}
+
 	checkSum, err := attachment.GetChecksum(bytes.NewReader(mermaidBytes))
 	log.Debug().Msgf("Checksum: %q -> %s", title, checkSum)
 
@@ -167,17 +268,17 @@ func ProcessMermaidLocally(title string, mermaidDiagram []byte, scale float64) (
 		title = checkSum
 	}
 
-	fileName := title + ".png"
+	fileName := title + "." + format
 
 	return attachment.Attachment{
 		ID:        "",
 		Name:      title,
 		Filename:  fileName,
-		FileBytes: pngBytes,
+		FileBytes: image.Data,
 		Checksum:  checkSum,
 		Replace:   title,
-		Width:     strconv.FormatInt(boxModel.Width, 10),
-		Height:    strconv.FormatInt(boxModel.Height, 10),
+		Width:     strconv.FormatInt(image.Width, 10),
+		Height:    strconv.FormatInt(image.Height, 10),
 	}, nil
 }
 
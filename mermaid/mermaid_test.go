@@ -9,6 +9,7 @@ import (
 
 	mermaid "github.com/dreampuf/mermaid.go"
 	"github.com/kovetskiy/mark/v16/attachment"
+	"github.com/kovetskiy/mark/v16/diagram"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,7 +35,7 @@ func TestExtractMermaidImage(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := ProcessMermaidLocally(tt.name, tt.markdown, tt.scale)
+			got, err := ProcessMermaidLocally(tt.name, tt.markdown, tt.scale, diagram.FormatPNG, nil)
 			if !tt.wantErr(t, err, fmt.Sprintf("processMermaidLocally(%v, %v)", tt.name, string(tt.markdown))) {
 				return
 			}
@@ -64,7 +65,7 @@ func TestInvalidDiagramKeepsEngine(t *testing.T) {
 	before, err := getMermaidEngine()
 	require.NoError(t, err)
 
-	_, err = ProcessMermaidLocally("invalid", []byte("this is not a mermaid diagram"), 1.0)
+	_, err = ProcessMermaidLocally("invalid", []byte("this is not a mermaid diagram"), 1.0, diagram.FormatPNG, nil)
 	require.Error(t, err)
 	assert.ErrorIs(t, err, mermaid.ErrRenderException)
 
@@ -89,7 +90,7 @@ func TestRenderTimeoutKeepsEngine(t *testing.T) {
 	renderTimeout = time.Nanosecond
 	before.SetRenderTimeout(time.Nanosecond)
 
-	_, err = ProcessMermaidLocally("timeout", []byte("graph TD;\n A-->B;"), 1.0)
+	_, err = ProcessMermaidLocally("timeout", []byte("graph TD;\n A-->B;"), 1.0, diagram.FormatPNG, nil)
 	require.Error(t, err)
 	assert.ErrorIs(t, err, context.DeadlineExceeded)
 
@@ -100,7 +101,31 @@ func TestRenderTimeoutKeepsEngine(t *testing.T) {
 	require.NoError(t, err)
 	assert.Same(t, before, after)
 
-	got, err := ProcessMermaidLocally("after-timeout", []byte("graph TD;\n A-->B;"), 1.0)
+	got, err := ProcessMermaidLocally("after-timeout", []byte("graph TD;\n A-->B;"), 1.0, diagram.FormatPNG, nil)
 	require.NoError(t, err)
 	assert.NotEmpty(t, got.FileBytes)
 }
+
+// A diagram the cache has is returned without starting a browser.
+func TestCachedDiagramStartsNoBrowser(t *testing.T) {
+	cache := &diagram.Cache{Dir: t.TempDir()}
+	source := []byte("graph TD;\n A-->B;")
+
+	_, err := cache.Render(cacheKey(source, 2, diagram.FormatPNG), func() (diagram.Image, error) {
+		return diagram.Image{Data: []byte("cached"), Width: 30, Height: 20}, nil
+	})
+	require.NoError(t, err)
+
+	Cleanup()
+
+	got, err := ProcessMermaidLocally("cached", source, 2, diagram.FormatPNG, cache)
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("cached"), got.FileBytes)
+	assert.Equal(t, "30", got.Width)
+	assert.Equal(t, "20", got.Height)
+
+	mermaidMutex.Lock()
+	defer mermaidMutex.Unlock()
+	assert.Nil(t, mermaidEngine, "no browser was started")
+}
@@ -0,0 +1,227 @@
+package metadata
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"go.yaml.in/yaml/v3"
+)
+
+// FrontMatterMapping says which front matter keys of another tool stand for
+// which of mark's, so that documents written for a static site generator can
+// be published as they are.
+//
+// Keys are matched the way mark's own front matter keys are: case, dashes and
+// underscores do not matter. Each maps to one of the targets below. A mapped
+// key only fills in what the document did not say in mark's own terms, so a
+// document carrying both a sidebar_label and a title keeps its title.
+//
+//   - title, order and labels are the page title, its Order and its labels
+//   - synchronized publishes the document when true and skips it when false,
+//     and draft is the opposite
+//   - property:NAME sets the content property NAME to the value
+type FrontMatterMapping map[string]string
+
+// frontMatterPresets are the mappings for the generators common enough to be
+// worth naming. slug has no counterpart in any of them: a Confluence page's
+// address is derived from its id and title, not chosen.
+var frontMatterPresets = map[string]FrontMatterMapping{
+	"docusaurus": {
+		"sidebar_label":    "title",
+		"sidebar_position": "order",
+		"tags":             "labels",
+		"keywords":         "labels",
+		"draft":            "draft",
+		"description":      "property:description",
+	},
+	"hugo": {
+		"linkTitle":   "title",
+		"weight":      "order",
+		"tags":        "labels",
+		"draft":       "draft",
+		"description": "property:description",
+	},
+	"jekyll": {
+		"nav_order":   "order",
+		"tags":        "labels",
+		"published":   "synchronized",
+		"description": "property:description",
+	},
+}
+
+// FrontMatterPresets returns the names of the built-in mappings.
+func FrontMatterPresets() []string {
+	names := make([]string, 0, len(frontMatterPresets))
+	for name := range frontMatterPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// LoadFrontMatterMapping returns the mapping a --front-matter-mapping value
+// names: a built-in preset, or a YAML file mapping keys to targets.
+func LoadFrontMatterMapping(value string) (FrontMatterMapping, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if preset, ok := frontMatterPresets[strings.ToLower(value)]; ok {
+		return normaliseMapping(preset)
+	}
+
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"front matter mapping %q is neither a preset (%s) nor a readable file: %w",
+			value, strings.Join(FrontMatterPresets(), ", "), err,
+		)
+	}
+
+	var mapping FrontMatterMapping
+	if err := yaml.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("unable to parse front matter mapping %s: %w", value, err)
+	}
+
+	normalised, err := normaliseMapping(mapping)
+	if err != nil {
+		return nil, fmt.Errorf("front matter mapping %s: %w", value, err)
+	}
+
+	return normalised, nil
+}
+
+// normaliseMapping keys a mapping the way front matter keys are looked up,
+// and refuses a target mark does not have.
+func normaliseMapping(mapping FrontMatterMapping) (FrontMatterMapping, error) {
+	normalised := make(FrontMatterMapping, len(mapping))
+	for key, target := range mapping {
+		target = strings.TrimSpace(target)
+
+		switch name, isProperty := strings.CutPrefix(target, "property:"); {
+		case isProperty && name == "":
+			return nil, fmt.Errorf("%s: property: needs the name of the property", key)
+		case isProperty:
+		case target == "title", target == "order", target == "labels",
+			target == "synchronized", target == "draft":
+		default:
+			return nil, fmt.Errorf(
+				"%s: unknown target %q; use title, order, labels, synchronized, draft or property:NAME",
+				key, target,
+			)
+		}
+
+		normalised[normaliseKey(key)] = target
+	}
+
+	return normalised, nil
+}
+
+// normaliseKey is how a front matter key is compared: without case, dashes or
+// underscores.
+func normaliseKey(key string) string {
+	key = strings.ToLower(key)
+	key = strings.ReplaceAll(key, "-", "")
+	return strings.ReplaceAll(key, "_", "")
+}
+
+// apply fills in from mapped keys whatever the front matter left unset in
+// mark's own terms.
+func (m FrontMatterMapping) apply(parsed map[string]any, meta *Meta) error {
+	// Sorted, so that two keys mapped to the same target settle it the same
+	// way on every run rather than by map order.
+	keys := make([]string, 0, len(parsed))
+	for key := range parsed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		target, ok := m[normaliseKey(key)]
+		if !ok {
+			continue
+		}
+		value := parsed[key]
+
+		switch target {
+		case "title":
+			if meta.Title == "" {
+				meta.Title = toString(value)
+			}
+
+		case "order":
+			if meta.Order != nil {
+				continue
+			}
+			order, ok := toInt(value)
+			if !ok {
+				// Some generators allow positions between whole numbers, which
+				// Confluence has no way to express. Better placed by the rest
+				// than not published at all.
+				log.Warn().Msgf("front matter %s: %v is not a whole number; the page is not ordered", key, value)
+				continue
+			}
+			meta.Order = &order
+
+		case "labels":
+			labels := toStringSlice(value)
+			if label := toString(value); label != "" {
+				labels = []string{label}
+			}
+			for _, label := range labels {
+				if !slices.Contains(meta.Labels, label) {
+					meta.Labels = append(meta.Labels, label)
+				}
+			}
+
+		case "synchronized", "draft":
+			if meta.Synchronized != nil {
+				continue
+			}
+			flag, ok := toBool(value)
+			if !ok {
+				return fmt.Errorf("front matter %s must be true or false, got %v", key, value)
+			}
+			synchronized := flag == (target == "synchronized")
+			meta.Synchronized = &synchronized
+
+		default:
+			name := strings.TrimPrefix(target, "property:")
+			if _, ok := meta.Properties[name]; ok {
+				continue
+			}
+			if meta.Properties == nil {
+				meta.Properties = map[string]any{}
+			}
+			meta.Properties[name] = value
+		}
+	}
+
+	return nil
+}
+
+// toInt reads a whole number from front matter, which YAML may have decoded
+// as an integer or, written as 2.0, a float.
+func toInt(val any) (int, bool) {
+	switch v := val.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false
+		}
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,110 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func extractMapped(t *testing.T, markdown, mapping string) *Meta {
+	t.Helper()
+
+	loaded, err := LoadFrontMatterMapping(mapping)
+	require.NoError(t, err)
+
+	meta, _, err := ExtractMetaWithMapping([]byte(markdown), "DOCS", false, false, "", nil, false, "", true, loaded)
+	require.NoError(t, err)
+	require.NotNil(t, meta)
+
+	return meta
+}
+
+func TestFrontMatterMappingDocusaurus(t *testing.T) {
+	meta := extractMapped(t, `---
+sidebar_label: Install
+sidebar_position: 3
+slug: /install
+tags: [setup, linux]
+keywords: [setup, packages]
+description: How to install it.
+---
+# Installing
+`, "docusaurus")
+
+	assert.Equal(t, "Install", meta.Title)
+	require.NotNil(t, meta.Order)
+	assert.Equal(t, 3, *meta.Order)
+	assert.ElementsMatch(t, []string{"setup", "linux", "packages"}, meta.Labels)
+	assert.Equal(t, "How to install it.", meta.Properties["description"])
+	assert.Nil(t, meta.Synchronized)
+}
+
+func TestFrontMatterMappingHugoDraftIsNotPublished(t *testing.T) {
+	meta := extractMapped(t, "---\nlinkTitle: Notes\nweight: 20\ndraft: true\n---\n", "hugo")
+
+	assert.Equal(t, "Notes", meta.Title)
+	require.NotNil(t, meta.Synchronized)
+	assert.False(t, *meta.Synchronized)
+}
+
+func TestFrontMatterMappingJekyllPublished(t *testing.T) {
+	meta := extractMapped(t, "---\ntitle: Notes\nnav_order: 2.0\npublished: false\n---\n", "jekyll")
+
+	require.NotNil(t, meta.Order)
+	assert.Equal(t, 2, *meta.Order, "a whole number written as a float is still whole")
+	require.NotNil(t, meta.Synchronized)
+	assert.False(t, *meta.Synchronized)
+}
+
+func TestFrontMatterMappingKeepsMarksOwnKeys(t *testing.T) {
+	meta := extractMapped(t, `---
+title: Installing Mark
+sidebar_label: Install
+order: 1
+sidebar_position: 3
+draft: true
+---
+<!-- Synchronized: true -->
+`, "docusaurus")
+
+	assert.Equal(t, "Installing Mark", meta.Title)
+	require.NotNil(t, meta.Order)
+	assert.Equal(t, 1, *meta.Order)
+	require.NotNil(t, meta.Synchronized)
+	assert.True(t, *meta.Synchronized, "a header wins over draft")
+}
+
+func TestFrontMatterMappingLeavesFractionalOrderUnset(t *testing.T) {
+	meta := extractMapped(t, "---\ntitle: Between\nsidebar_position: 2.5\n---\n", "docusaurus")
+
+	assert.Nil(t, meta.Order)
+}
+
+func TestFrontMatterMappingFromFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "mapping.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("menu-title: title\nCategories: labels\nhidden: draft\nsummary: property:summary\n"), 0o644))
+
+	meta := extractMapped(t, "---\nmenu_title: Menu\ncategories: [a]\nhidden: false\nsummary: Short.\n---\n", file)
+
+	assert.Equal(t, "Menu", meta.Title)
+	assert.Equal(t, []string{"a"}, meta.Labels)
+	require.NotNil(t, meta.Synchronized)
+	assert.True(t, *meta.Synchronized)
+	assert.Equal(t, "Short.", meta.Properties["summary"])
+}
+
+func TestLoadFrontMatterMappingRefusesUnknownTargets(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "mapping.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("slug: url\n"), 0o644))
+
+	_, err := LoadFrontMatterMapping(file)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown target "url"`)
+
+	_, err = LoadFrontMatterMapping("gatsby")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "neither a preset (docusaurus, hugo, jekyll) nor a readable file")
+}
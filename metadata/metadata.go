@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -35,6 +36,10 @@ const (
 	HeaderImageAlign   = `Image-Align`
 	HeaderProperty     = `Property`
 	HeaderSynchronized = `Synchronized`
+	HeaderSplitOn      = `Split-On`
+	HeaderEmbed        = `Embed`
+	HeaderSnippet      = `Snippet`
+	HeaderTable        = `Table`
 )
 
 type Meta struct {
@@ -71,6 +76,11 @@ type Meta struct {
 	// sorting them to the front.
 	Order      *int
 	ImageAlign string
+
+	// SplitOn is the heading level the document is published in sections at,
+	// h1 to h6, or "none" to publish it whole whatever the run says. Empty
+	// means the document said nothing, and the run decides.
+	SplitOn string
 }
 
 const (
@@ -153,6 +163,21 @@ func setContentAppearance(meta *Meta, value string) {
 	}
 }
 
+// SplitLevel reads a Split-On value: the level of heading a document is split
+// at, or 0 for "none" and for nothing at all.
+func SplitLevel(value string) (int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	switch {
+	case value == "" || value == "none":
+		return 0, nil
+	case len(value) == 2 && value[0] == 'h' && value[1] >= '1' && value[1] <= '6':
+		return int(value[1] - '0'), nil
+	default:
+		return 0, fmt.Errorf("split on %q: use a heading level from h1 to h6, or none", value)
+	}
+}
+
 func stripFrontMatter(data []byte) ([]byte, error) {
 	delimiter, rest, ok := bytes.Cut(data, []byte("\n"))
 	if !ok {
@@ -173,6 +198,12 @@ func stripFrontMatter(data []byte) ([]byte, error) {
 }
 
 func ExtractMeta(data []byte, spaceFromCli string, titleFromH1 bool, titleFromFilename bool, filename string, parents []string, titleAppendGeneratedHash bool, defaultContentAppearance string, frontMatterEnabled bool) (*Meta, []byte, error) {
+	return ExtractMetaWithMapping(data, spaceFromCli, titleFromH1, titleFromFilename, filename, parents, titleAppendGeneratedHash, defaultContentAppearance, frontMatterEnabled, nil)
+}
+
+// ExtractMetaWithMapping is ExtractMeta reading the front matter keys of
+// another tool as well as mark's own; see FrontMatterMapping.
+func ExtractMetaWithMapping(data []byte, spaceFromCli string, titleFromH1 bool, titleFromFilename bool, filename string, parents []string, titleAppendGeneratedHash bool, defaultContentAppearance string, frontMatterEnabled bool, mapping FrontMatterMapping) (*Meta, []byte, error) {
 	var meta *Meta
 	body := data
 
@@ -195,11 +226,7 @@ func ExtractMeta(data []byte, spaceFromCli string, titleFromH1 bool, titleFromFi
 		meta.Type = "page" // Default type
 
 		for k, v := range parsed {
-			normKey := strings.ToLower(k)
-			normKey = strings.ReplaceAll(normKey, "-", "")
-			normKey = strings.ReplaceAll(normKey, "_", "")
-
-			switch normKey {
+			switch normaliseKey(k) {
 			case "parents":
 				meta.Parents = append(meta.Parents, toStringSlice(v)...)
 			case "folders":
@@ -232,6 +259,17 @@ func ExtractMeta(data []byte, spaceFromCli string, titleFromH1 bool, titleFromFi
 					)
 				}
 				meta.Synchronized = &value
+			case "spliton":
+				meta.SplitOn = strings.ToLower(toString(v))
+				if _, err := SplitLevel(meta.SplitOn); err != nil {
+					return nil, nil, err
+				}
+			case "order":
+				order, ok := toInt(v)
+				if !ok {
+					return nil, nil, fmt.Errorf("order must be a whole number, got %v", v)
+				}
+				meta.Order = &order
 			case "properties":
 				for key, value := range toStringMap(v) {
 					if meta.Properties == nil {
@@ -242,6 +280,10 @@ func ExtractMeta(data []byte, spaceFromCli string, titleFromH1 bool, titleFromFi
 			}
 		}
 
+		if err := mapping.apply(parsed, meta); err != nil {
+			return nil, nil, err
+		}
+
 		// Presence of a non-empty sidebar forces the article layout, regardless of map key iteration order.
 		if meta.Sidebar != "" {
 			meta.Layout = "article"
@@ -283,6 +325,16 @@ func ExtractMeta(data []byte, spaceFromCli string, titleFromH1 bool, titleFromFi
 				line := string(lineSeg.Value(data))
 
 				key, value, ok := parseHeaderComment(line)
+
+				// An Embed, a Snippet or a Table directive is content,
+				// wherever it is written: one straight after the headers is
+				// where what it brings in goes, not one more header.
+				if ok && slices.ContainsFunc([]string{HeaderEmbed, HeaderSnippet, HeaderTable}, func(directive string) bool {
+					return strings.EqualFold(strings.TrimSpace(key), directive)
+				}) {
+					ok = false
+				}
+
 				if !ok {
 					if firstStart == -1 {
 						// Nothing has been read as a header yet, so this block
@@ -343,6 +395,12 @@ func ExtractMeta(data []byte, spaceFromCli string, titleFromH1 bool, titleFromFi
 					}
 					meta.Order = &order
 
+				case HeaderSplitOn:
+					meta.SplitOn = strings.ToLower(strings.TrimSpace(value))
+					if _, err := SplitLevel(meta.SplitOn); err != nil {
+						return nil, nil, fmt.Errorf("%s header: %w", HeaderSplitOn, err)
+					}
+
 				case HeaderAttachment:
 					meta.Attachments = append(meta.Attachments, value)
 
@@ -466,11 +524,17 @@ func ExtractMeta(data []byte, spaceFromCli string, titleFromH1 bool, titleFromFi
 }
 
 func setTitleFromFilename(meta *Meta, filename string) {
+	meta.Title = TitleFromFilename(filename)
+}
+
+// TitleFromFilename is the title --title-from-filename gives a file: its name
+// without the extension, with dashes and underscores as spaces, title-cased.
+func TitleFromFilename(filename string) string {
 	base := filepath.Base(filename)
 	title := strings.TrimSuffix(base, filepath.Ext(base))
 	title = strings.ReplaceAll(title, "_", " ")
 	title = strings.ReplaceAll(title, "-", " ")
-	meta.Title = cases.Title(language.English).String(title)
+	return cases.Title(language.English).String(title)
 }
 
 // ExtractDocumentLeadingH1 will extract leading H1 heading
@@ -501,3 +501,26 @@ func TestParseHeaderCommentStillParsesValidHeaders(t *testing.T) {
 	assert.Equal(t, "a", key)
 	assert.Empty(t, value)
 }
+
+func TestExtractMetaSplitOn(t *testing.T) {
+	meta, _, err := ExtractMeta(
+		[]byte("<!-- Space: DOCS -->\n<!-- Title: Runbook -->\n<!-- Split-On: H2 -->\n\nbody\n"),
+		"", false, false, "", nil, false, "", false,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "h2", meta.SplitOn)
+
+	meta, _, err = ExtractMeta(
+		[]byte("---\ntitle: Runbook\nsplit_on: none\n---\n\nbody\n"),
+		"DOCS", false, false, "", nil, false, "", true,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "none", meta.SplitOn)
+
+	_, _, err = ExtractMeta(
+		[]byte("<!-- Space: DOCS -->\n<!-- Split-On: sections -->\n\nbody\n"),
+		"", false, false, "", nil, false, "", false,
+	)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "h1 to h6")
+}
@@ -0,0 +1,227 @@
+// Package nav reads the navigation of an MkDocs site, so that a site organised
+// for MkDocs can be published with the titles, nesting and order its mkdocs.yml
+// already gives it.
+//
+// MkDocs keeps all of that in one place: the nav section lists every document,
+// titles each one, nests them into sections and orders them. A document in such
+// a site carries none of it itself, and asking for headers repeating what the
+// nav says would be asking for two copies to drift apart.
+//
+// A section becomes a parent page titled after the section. A section whose
+// first entry is an index.md or README.md is that document -- as the
+// navigation.indexes feature of Material for MkDocs has it -- and any other
+// section is an empty page, as a Parent header naming a page that does not
+// exist would give.
+package nav
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Entry is where the nav places one document.
+type Entry struct {
+	// Title is what the nav calls the document, or "" where it lists the file
+	// without a title and leaves it to the document.
+	Title string
+
+	// Parents are the titles of the sections the document is in, outermost
+	// first.
+	Parents []string
+
+	// Order is the document's position among its siblings, from one. Sections
+	// count as siblings too, so a page keeps its place beside them.
+	Order int
+}
+
+// Nav is the navigation of one MkDocs site.
+type Nav struct {
+	// DocsDir is the directory the nav's paths are relative to.
+	DocsDir string
+
+	entries map[string]Entry
+	order   []string
+}
+
+// indexNames are the documents that stand for the section they lead.
+var indexNames = []string{"index.md", "README.md"}
+
+// config is the part of mkdocs.yml read here.
+//
+// The nav is kept as a node rather than decoded: an entry is a path, a title
+// mapped to a path, or a title mapped to a section, and only walking it can
+// tell them apart. Everything else in the file is left undecoded, which matters
+// because mkdocs.yml is routinely full of Python-specific tags no YAML library
+// outside MkDocs understands.
+type config struct {
+	DocsDir string    `yaml:"docs_dir"`
+	Nav     yaml.Node `yaml:"nav"`
+}
+
+// Load reads the nav from an mkdocs.yml.
+func Load(path string) (*Nav, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	var cfg config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	if cfg.Nav.Kind == 0 {
+		return nil, fmt.Errorf("%s has no nav section", path)
+	}
+	if cfg.Nav.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("%s: line %d: nav is not a list", path, cfg.Nav.Line)
+	}
+
+	if cfg.DocsDir == "" {
+		cfg.DocsDir = "docs"
+	}
+	docsDir := cfg.DocsDir
+	if !filepath.IsAbs(docsDir) {
+		docsDir = filepath.Join(filepath.Dir(path), docsDir)
+	}
+	docsDir, err = filepath.Abs(docsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Nav{DocsDir: docsDir, entries: map[string]Entry{}}
+	if err := n.walk(&cfg.Nav, nil); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return n, nil
+}
+
+// walk records the entries of one section, whose parents are given.
+func (n *Nav) walk(section *yaml.Node, parents []string) error {
+	order := 0
+	for i, item := range section.Content {
+		title, target, err := split(item)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case target.Kind == yaml.ScalarNode:
+			if isExternal(target.Value) || !strings.HasSuffix(target.Value, ".md") {
+				// A link out of the site, or something that is not a document.
+				// Nothing is published for it, so it holds no position.
+				continue
+			}
+			order++
+			if err := n.add(target, Entry{Title: title, Parents: parents, Order: order}); err != nil {
+				return err
+			}
+
+		case target.Kind == yaml.SequenceNode:
+			if title == "" {
+				return fmt.Errorf("line %d: a section has no title", item.Line)
+			}
+			order++
+
+			children := target
+			if lead := leadingIndex(target); lead != nil {
+				if err := n.add(lead, Entry{Title: title, Parents: parents, Order: order}); err != nil {
+					return err
+				}
+				children = &yaml.Node{Kind: yaml.SequenceNode, Content: target.Content[1:]}
+			}
+
+			if err := n.walk(children, slices.Concat(parents, []string{title})); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("line %d: nav entry %d is neither a page nor a section", item.Line, i+1)
+		}
+	}
+
+	return nil
+}
+
+// split takes a nav item apart into its title, if it has one, and what it
+// points at.
+func split(item *yaml.Node) (string, *yaml.Node, error) {
+	switch item.Kind {
+	case yaml.ScalarNode:
+		return "", item, nil
+	case yaml.MappingNode:
+		if len(item.Content) != 2 {
+			return "", nil, fmt.Errorf("line %d: a nav entry maps one title to one page or section", item.Line)
+		}
+		return item.Content[0].Value, item.Content[1], nil
+	default:
+		return "", nil, fmt.Errorf("line %d: unexpected nav entry", item.Line)
+	}
+}
+
+// leadingIndex returns the entry of a section's index document, if the section
+// opens with one.
+func leadingIndex(section *yaml.Node) *yaml.Node {
+	if len(section.Content) == 0 {
+		return nil
+	}
+
+	title, target, err := split(section.Content[0])
+	if err != nil || title != "" || target.Kind != yaml.ScalarNode {
+		return nil
+	}
+	if !slices.Contains(indexNames, filepath.Base(target.Value)) {
+		return nil
+	}
+
+	return target
+}
+
+// isExternal reports whether a nav target is a link rather than a document.
+func isExternal(target string) bool {
+	return strings.Contains(target, "://") || strings.HasPrefix(target, "mailto:")
+}
+
+// add records where the nav places one document.
+func (n *Nav) add(target *yaml.Node, entry Entry) error {
+	path := filepath.Join(n.DocsDir, filepath.FromSlash(target.Value))
+	if _, ok := n.entries[path]; ok {
+		return fmt.Errorf("line %d: %s is listed more than once", target.Line, target.Value)
+	}
+
+	n.entries[path] = entry
+	n.order = append(n.order, path)
+
+	return nil
+}
+
+// Lookup returns where the nav places a document, and whether it lists it at
+// all.
+func (n *Nav) Lookup(file string) (Entry, bool) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return Entry{}, false
+	}
+
+	entry, ok := n.entries[path]
+	return entry, ok
+}
+
+// Missing returns the documents the nav lists that do not exist, in the order
+// it lists them.
+func (n *Nav) Missing() []string {
+	var missing []string
+	for _, path := range n.order {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, path)
+		}
+	}
+
+	return missing
+}
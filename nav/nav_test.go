@@ -0,0 +1,76 @@
+package nav_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kovetskiy/mark/v16/nav"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSite(t *testing.T, mkdocs string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mkdocs.yml")
+	require.NoError(t, os.WriteFile(path, []byte(mkdocs), 0o600))
+	return path
+}
+
+func TestLoadPlacesEveryListedDocument(t *testing.T) {
+	path := writeSite(t, `site_name: Docs
+markdown_extensions:
+  - pymdownx.emoji:
+      emoji_index: !!python/name:material.extensions.emoji.twemoji
+nav:
+  - Home: index.md
+  - Guides:
+      - guides/index.md
+      - Install: guides/install.md
+      - guides/usage.md
+  - Source: https://example.com/repo
+  - Reference:
+      - API: reference/api.md
+`)
+	site, err := nav.Load(path)
+	require.NoError(t, err)
+
+	docs := filepath.Join(filepath.Dir(path), "docs")
+	assert.Equal(t, docs, site.DocsDir)
+
+	for file, want := range map[string]nav.Entry{
+		"index.md":          {Title: "Home", Order: 1},
+		"guides/index.md":   {Title: "Guides", Order: 2},
+		"guides/install.md": {Title: "Install", Parents: []string{"Guides"}, Order: 1},
+		"guides/usage.md":   {Parents: []string{"Guides"}, Order: 2},
+		"reference/api.md":  {Title: "API", Parents: []string{"Reference"}, Order: 1},
+	} {
+		entry, ok := site.Lookup(filepath.Join(docs, file))
+		require.True(t, ok, file)
+		assert.Equal(t, want, entry, file)
+	}
+
+	_, ok := site.Lookup(filepath.Join(docs, "unlisted.md"))
+	assert.False(t, ok)
+
+	assert.Len(t, site.Missing(), 5, "nothing listed exists on disk")
+}
+
+func TestLoadHonoursDocsDir(t *testing.T) {
+	path := writeSite(t, "docs_dir: site\nnav:\n  - a.md\n")
+	site, err := nav.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(filepath.Dir(path), "site"), site.DocsDir)
+}
+
+func TestLoadRefusesWhatItCannotFollow(t *testing.T) {
+	for name, mkdocs := range map[string]string{
+		"no nav":       "site_name: Docs\n",
+		"listed twice": "nav:\n  - a.md\n  - Again: a.md\n",
+		"untitled":     "nav:\n  - - a.md\n",
+	} {
+		_, err := nav.Load(writeSite(t, mkdocs))
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,67 @@
+package mark
+
+import (
+	"path/filepath"
+	"slices"
+
+	"github.com/kovetskiy/mark/v16/metadata"
+	"github.com/kovetskiy/mark/v16/nav"
+	"github.com/rs/zerolog/log"
+)
+
+// navigation returns the MkDocs nav documents are placed by, or nil when there
+// is none. A run reads it once; anything else reading a document reads it
+// again, which costs a small file and keeps every caller of readDocument
+// placing documents the same way.
+func (c Config) navigation() (*nav.Nav, error) {
+	switch {
+	case c.Nav == "":
+		return nil, nil
+	case c.loadedNav != nil:
+		return c.loadedNav, nil
+	default:
+		return nav.Load(c.Nav)
+	}
+}
+
+// applyNav places a document where the nav lists it. The nav is the source of
+// truth for what it says: its title replaces the document's, its sections
+// replace any Parent headers, and its position is the document's Order.
+// --parents is put in front, as it always is.
+func applyNav(config Config, meta *metadata.Meta, entry nav.Entry) {
+	if entry.Title != "" {
+		meta.Title = entry.Title
+	}
+
+	meta.Parents = slices.Concat(cliParents(config), entry.Parents)
+
+	order := entry.Order
+	meta.Order = &order
+}
+
+// loadNav reads the nav for a run and says what it and the run's files
+// disagree about: a file the nav does not list is published by its own headers
+// alone, and an entry naming a file that does not exist publishes nothing.
+// MkDocs builds a site either way, and so does this.
+func loadNav(config Config, files []string) (*nav.Nav, error) {
+	navigation, err := nav.Load(config.Nav)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if _, ok := navigation.Lookup(file); !ok {
+			log.Warn().Msgf("%s is not in the nav of %s; it is placed by its own headers", file, config.Nav)
+		}
+	}
+
+	for _, path := range navigation.Missing() {
+		rel, err := filepath.Rel(navigation.DocsDir, path)
+		if err != nil {
+			rel = path
+		}
+		log.Warn().Msgf("%s lists %s, which does not exist", config.Nav, filepath.ToSlash(rel))
+	}
+
+	return navigation, nil
+}
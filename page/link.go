@@ -43,6 +43,23 @@ type LinkResolver struct {
 	// links keep their meaning.
 	SearchDirs []string
 
+	// LinkTo, when set, is what a link to another document becomes, given the
+	// file the link was found to name and the metadata read from it. It stands
+	// in for asking Confluence where that document's page is, for a caller
+	// with no Confluence to ask: the preview links its pages to each other
+	// through it. "" leaves the link as written.
+	LinkTo func(file string, meta *metadata.Meta) string
+
+	// ReadMeta, when set, reads the metadata of a document a link names, in
+	// place of reading its headers with the settings above. A caller that
+	// places documents by more than their headers -- a nav, their directories,
+	// another tool's front matter -- has to be asked, or a link would go to
+	// the title the document's headers alone would give it.
+	//
+	// The anchor the link is to comes with the file, for a document published
+	// as more than one page: it decides which of them the link arrives at.
+	ReadMeta func(file, anchor string) (*metadata.Meta, error)
+
 	// Checker decides how much is verified. Nil checks nothing.
 	Checker *LinkChecker
 
@@ -123,7 +140,7 @@ func NewLinkResolver(
 // after the colon uses as the page title -- the [Some Page](ac:) form. It is
 // wanted for that alone; nothing else looks at it.
 func (r *LinkResolver) Resolve(target, text string) (string, error) {
-	if r == nil || r.API == nil || target == "" {
+	if r == nil || (r.API == nil && r.LinkTo == nil) || target == "" {
 		return "", nil
 	}
 
@@ -154,10 +171,10 @@ func (r *LinkResolver) Resolve(target, text string) (string, error) {
 	filename, hash, _ := strings.Cut(target, "#")
 
 	resolved, why, err := resolveLink(
-		r.API, append([]string{r.Base}, r.SearchDirs...),
+		r.API, r.LinkTo, append([]string{r.Base}, r.SearchDirs...),
 		markdownLink{full: target, filename: filename, hash: hash},
 		r.SpaceForLinks, r.TitleFromH1, r.TitleFromFilename,
-		r.Parents, r.TitleAppendGeneratedHash, r.FrontMatterEnabled,
+		r.Parents, r.TitleAppendGeneratedHash, r.FrontMatterEnabled, r.ReadMeta,
 	)
 	if err != nil {
 		return "", fmt.Errorf("resolve link %q: %w", target, err)
@@ -241,6 +258,7 @@ type unresolved struct {
 // always done.
 func resolveLink(
 	api *confluence.API,
+	linkTo func(file string, meta *metadata.Meta) string,
 	bases []string,
 	link markdownLink,
 	spaceForLinks string,
@@ -249,6 +267,7 @@ func resolveLink(
 	parents []string,
 	titleAppendGeneratedHash bool,
 	frontMatterEnabled bool,
+	readMeta func(file, anchor string) (*metadata.Meta, error),
 ) (string, *unresolved, error) {
 	var result string
 
@@ -278,7 +297,16 @@ func resolveLink(
 
 		// This helps to determine if found link points to file that's
 		// not markdown or have mark required metadata
-		linkMeta, _, err := metadata.ExtractMeta(linkContents, spaceForLinks, titleFromH1, titleFromFilename, filepath, parents, titleAppendGeneratedHash, "", frontMatterEnabled)
+		var linkMeta *metadata.Meta
+		if readMeta != nil {
+			// The document linking here lends its space to one that has none,
+			// as it does below.
+			if linkMeta, err = readMeta(filepath, link.hash); err == nil && linkMeta != nil && linkMeta.Space == "" {
+				linkMeta.Space = spaceForLinks
+			}
+		} else {
+			linkMeta, _, err = metadata.ExtractMeta(linkContents, spaceForLinks, titleFromH1, titleFromFilename, filepath, parents, titleAppendGeneratedHash, "", frontMatterEnabled)
+		}
 		if err != nil {
 			log.Error().
 				Err(err).
@@ -308,12 +336,14 @@ func resolveLink(
 			return "", &unresolved{reason: "it has no title, so it is never published"}, nil
 		}
 
-		result, err = getConfluenceLink(api, linkMeta.Space, linkMeta.Title)
-		if err != nil {
+		if linkTo != nil {
+			result = linkTo(filepath, linkMeta)
+			if result == "" {
+				return "", &unresolved{reason: "it is not among the documents being previewed"}, nil
+			}
+		} else if result, err = getConfluenceLink(api, linkMeta.Space, linkMeta.Title); err != nil {
 			return "", nil, fmt.Errorf("find confluence page (file=%s, space=%s, title=%s): %w", filepath, linkMeta.Space, linkMeta.Title, err)
-		}
-
-		if result == "" {
+		} else if result == "" {
 			return "", &unresolved{
 				reason: fmt.Sprintf(
 					"%q is not in space %q yet", linkMeta.Title, linkMeta.Space,
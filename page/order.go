@@ -17,8 +17,18 @@ type Ordered struct {
 	Order    int
 }
 
+// Move is one repositioning OrderChildren makes: a page placed immediately
+// before or after a sibling.
+type Move struct {
+	PageID      string `json:"pageId"`
+	Title       string `json:"title"`
+	Where       string `json:"where"`
+	NeighbourID string `json:"neighbourId"`
+	Neighbour   string `json:"neighbour"`
+}
+
 // OrderChildren arranges pages under each parent into the order their documents
-// asked for.
+// asked for, and returns the moves it made -- or on a dry run, would have made.
 //
 // Only pages named here are touched, and only relative to each other. A run
 // covering part of a repository has no idea what else lives under those
@@ -30,7 +40,7 @@ type Ordered struct {
 // that reissued every move each time would fill page histories with churn and
 // make the feature unusable in CI. A run that changes nothing performs no
 // writes at all.
-func OrderChildren(api *confluence.API, dryRun bool, pages []Ordered) error {
+func OrderChildren(api *confluence.API, dryRun bool, pages []Ordered) ([]Move, error) {
 	byParent := map[string][]Ordered{}
 	for _, p := range pages {
 		if p.ParentID == "" {
@@ -47,20 +57,48 @@ func OrderChildren(api *confluence.API, dryRun bool, pages []Ordered) error {
 	}
 	sort.Strings(parents)
 
+	var moves []Move
 	for _, parent := range parents {
-		if err := orderUnder(api, dryRun, parent, byParent[parent]); err != nil {
-			return err
+		planned, err := orderUnder(api, parent, byParent[parent])
+		if err != nil {
+			return moves, err
+		}
+
+		// Left to right, so that by the time a page is placed after its
+		// predecessor, that predecessor is already where it finally belongs.
+		for _, move := range planned {
+			if dryRun {
+				log.Info().Msgf("page %q would be moved %s %q", move.Title, move.Where, move.Neighbour)
+				moves = append(moves, move)
+				continue
+			}
+
+			log.Info().Msgf("moving page %q %s %q", move.Title, move.Where, move.Neighbour)
+
+			var err error
+			if move.Where == "before" {
+				err = api.MoveContentBefore(move.PageID, move.NeighbourID)
+			} else {
+				err = api.MoveContentAfter(move.PageID, move.NeighbourID)
+			}
+			if err != nil {
+				return moves, fmt.Errorf("unable to order page %q: %w", move.Title, err)
+			}
+
+			moves = append(moves, move)
 		}
 	}
 
-	return nil
+	return moves, nil
 }
 
-func orderUnder(api *confluence.API, dryRun bool, parentID string, wanted []Ordered) error {
+// orderUnder works out the moves that put the wanted pages under one parent in
+// order.
+func orderUnder(api *confluence.API, parentID string, wanted []Ordered) ([]Move, error) {
 	if len(wanted) < 2 {
 		// A single page has nothing to be ordered against, and moving it would
 		// only disturb whatever it currently sits beside.
-		return nil
+		return nil, nil
 	}
 
 	// Title breaks ties so that two documents claiming the same position come
@@ -74,7 +112,7 @@ func orderUnder(api *confluence.API, dryRun bool, parentID string, wanted []Orde
 
 	children, err := api.GetChildPages(parentID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Where each page sits now, among this parent's children as Confluence
@@ -92,7 +130,7 @@ func orderUnder(api *confluence.API, dryRun bool, parentID string, wanted []Orde
 			// under, or created moments ago and not yet visible. Either way
 			// there is nothing to compare it against.
 			log.Debug().Msgf("page %q is not listed under %s; leaving its position alone", p.Title, parentID)
-			return nil
+			return nil, nil
 		}
 		current = append(current, at)
 	}
@@ -106,12 +144,7 @@ func orderUnder(api *confluence.API, dryRun bool, parentID string, wanted []Orde
 		settled[i] = true
 	}
 
-	if len(keep) == len(wanted) {
-		return nil
-	}
-
-	// Left to right, so that by the time a page is placed after its
-	// predecessor, that predecessor is already where it finally belongs.
+	var moves []Move
 	for i := range wanted {
 		if settled[i] {
 			continue
@@ -120,38 +153,21 @@ func orderUnder(api *confluence.API, dryRun bool, parentID string, wanted []Orde
 		// The first page has nothing to sit after, so it is placed ahead of the
 		// one that follows it instead. Without this a page asked to lead never
 		// moved at all.
-		before := i == 0
+		move := Move{PageID: wanted[i].PageID, Title: wanted[i].Title, Where: "after"}
 		var neighbour Ordered
-		if before {
+		if i == 0 {
+			move.Where = "before"
 			neighbour = wanted[1]
 		} else {
 			neighbour = wanted[i-1]
 		}
+		move.NeighbourID = neighbour.PageID
+		move.Neighbour = neighbour.Title
 
-		where := "after"
-		if before {
-			where = "before"
-		}
-
-		if dryRun {
-			log.Info().Msgf("page %q would be moved %s %q", wanted[i].Title, where, neighbour.Title)
-			continue
-		}
-
-		log.Info().Msgf("moving page %q %s %q", wanted[i].Title, where, neighbour.Title)
-
-		var err error
-		if before {
-			err = api.MoveContentBefore(wanted[i].PageID, neighbour.PageID)
-		} else {
-			err = api.MoveContentAfter(wanted[i].PageID, neighbour.PageID)
-		}
-		if err != nil {
-			return fmt.Errorf("unable to order page %q: %w", wanted[i].Title, err)
-		}
+		moves = append(moves, move)
 	}
 
-	return nil
+	return moves, nil
 }
 
 // longestIncreasingSubsequence returns the indices of a longest run of values
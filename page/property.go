@@ -64,9 +64,47 @@ func ApplyProperties(api *confluence.API, pageID string, properties map[string]a
 		return nil
 	}
 
+	current, err := currentProperties(api, pageID)
+	if err != nil {
+		return err
+	}
+
+	keys, values, err := changedProperties(current, properties)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		log.Info().Msgf("setting property %q of page %s", key, pageID)
+		if err := api.SetContentProperty(pageID, key, values[key], current[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PropertyChanges reports which of the given properties ApplyProperties would
+// write, without writing them.
+func PropertyChanges(api *confluence.API, pageID string, properties map[string]any) ([]string, error) {
+	if len(properties) == 0 {
+		return nil, nil
+	}
+
+	current, err := currentProperties(api, pageID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, _, err := changedProperties(current, properties)
+
+	return keys, err
+}
+
+func currentProperties(api *confluence.API, pageID string) (map[string]*confluence.Property, error) {
 	existing, err := api.ListContentProperties(pageID)
 	if err != nil {
-		return fmt.Errorf("unable to read properties of page %s: %w", pageID, err)
+		return nil, fmt.Errorf("unable to read properties of page %s: %w", pageID, err)
 	}
 
 	current := make(map[string]*confluence.Property, len(existing))
@@ -74,18 +112,30 @@ func ApplyProperties(api *confluence.API, pageID string, properties map[string]a
 		current[existing[i].Key] = &existing[i]
 	}
 
-	// Sorted so that a run writing several properties does so in the same order
-	// every time, which makes a page history readable.
+	return current, nil
+}
+
+// changedProperties returns the keys whose values differ from what the page
+// holds, with the encoded values to write.
+//
+// Sorted so that a run writing several properties does so in the same order
+// every time, which makes a page history readable.
+func changedProperties(
+	current map[string]*confluence.Property,
+	properties map[string]any,
+) ([]string, map[string][]byte, error) {
 	keys := make([]string, 0, len(properties))
 	for key := range properties {
 		keys = append(keys, key)
 	}
 	sort.Strings(keys)
 
+	var changed []string
+	values := make(map[string][]byte, len(properties))
 	for _, key := range keys {
 		value, err := json.Marshal(properties[key])
 		if err != nil {
-			return fmt.Errorf("unable to encode property %q: %w", key, err)
+			return nil, nil, fmt.Errorf("unable to encode property %q: %w", key, err)
 		}
 
 		if held, ok := current[key]; ok && json.Valid(held.Value) &&
@@ -93,13 +143,11 @@ func ApplyProperties(api *confluence.API, pageID string, properties map[string]a
 			continue
 		}
 
-		log.Info().Msgf("setting property %q of page %s", key, pageID)
-		if err := api.SetContentProperty(pageID, key, value, current[key]); err != nil {
-			return err
-		}
+		changed = append(changed, key)
+		values[key] = value
 	}
 
-	return nil
+	return changed, values, nil
 }
 
 // equalJSON compares two encodings by what they mean rather than how they were
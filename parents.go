@@ -0,0 +1,149 @@
+package mark
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kovetskiy/mark/v16/metadata"
+	"github.com/rs/zerolog/log"
+)
+
+// indexNames are the files that stand for the directory holding them, in the
+// order they are looked for.
+var indexNames = []string{"index.md", "README.md"}
+
+// isIndexFile reports whether a document is the one that stands for its
+// directory under --parents-from-path.
+func isIndexFile(file string) bool {
+	return slices.Contains(indexNames, filepath.Base(file))
+}
+
+// indexFile returns the document standing for a directory, or "" if it has
+// none.
+func indexFile(dir string) string {
+	for _, name := range indexNames {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			return filepath.Join(dir, name)
+		}
+	}
+
+	return ""
+}
+
+// titleSource is the path a document's title is derived from when it is taken
+// from the filename. An index stands for its directory, and is titled after it:
+// a tree of index.md files titled "Index" would give every section the same
+// name, and titles are unique in a space.
+func titleSource(file string, config Config) string {
+	if config.ParentsFromPath == "" || config.PathAsFolders || !isIndexFile(file) {
+		return file
+	}
+
+	if abs, err := filepath.Abs(file); err == nil {
+		return filepath.Dir(abs)
+	}
+
+	return file
+}
+
+// applyPathParents places a document by where it sits under the
+// --parents-from-path root: each directory between the two becomes a parent
+// page, or a folder with --path-as-folders.
+//
+// A document that declares its own Parent or Folder headers keeps them; they
+// say where it goes more precisely than its location does. --parents is put in
+// front either way, as it always is.
+func applyPathParents(file string, config Config, meta *metadata.Meta) {
+	if len(meta.Parents) > len(cliParents(config)) || len(meta.Folders) > 0 {
+		return
+	}
+
+	derived := pathParents(file, config)
+	if len(derived) == 0 {
+		return
+	}
+
+	if config.PathAsFolders {
+		meta.Folders = derived
+	} else {
+		meta.Parents = slices.Concat(meta.Parents, derived)
+	}
+}
+
+// cliParents returns the parents given with --parents, which every document
+// has in front of its own.
+func cliParents(config Config) []string {
+	if len(config.Parents) == 0 || config.Parents[0] == "" {
+		return nil
+	}
+
+	return config.Parents
+}
+
+// pathParents returns the titles of the directories between the
+// --parents-from-path root and a document, outermost first.
+//
+// An index is its directory's page, so it goes where the directory goes: among
+// its siblings, under the directory above. That is not so for folders, which
+// have no body of their own, and an index there is a page like any other.
+func pathParents(file string, config Config) []string {
+	root, err := filepath.Abs(config.ParentsFromPath)
+	if err != nil {
+		return nil
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil
+	}
+
+	dir := filepath.Dir(abs)
+	if !config.PathAsFolders && isIndexFile(abs) {
+		if dir == root {
+			return nil
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		log.Warn().Msgf(
+			"%s is not under %s; it is placed by its headers alone",
+			file, config.ParentsFromPath,
+		)
+		return nil
+	}
+	if rel == "." {
+		return nil
+	}
+
+	var titles []string
+	current := root
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, name)
+		titles = append(titles, directoryTitle(current, config))
+	}
+
+	return titles
+}
+
+// directoryTitle is the title of the page or folder a directory becomes: the
+// title of its index when it has one, so that the index is published as that
+// page rather than beside it, and its name otherwise, cased as
+// --title-from-filename would case it.
+func directoryTitle(dir string, config Config) string {
+	if !config.PathAsFolders {
+		if index := indexFile(dir); index != "" {
+			_, _, meta, err := readHeaders(index, titleSource(index, config), config)
+			switch {
+			case err != nil:
+				log.Warn().Err(err).Msgf("unable to read %s; titling its directory after its name", index)
+			case meta != nil && meta.Title != "":
+				return meta.Title
+			}
+		}
+	}
+
+	return metadata.TitleFromFilename(dir)
+}
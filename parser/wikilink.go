@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// wikiLinkParser reads Obsidian's links: [[Note]], [[Note|shown as]],
+// [[Note#Heading]] and the embedding forms that start with an exclamation
+// mark.
+//
+// It produces the nodes a Markdown link or image would have, so that nothing
+// after it needs to know a document was written in Obsidian: a link to a note
+// is resolved to its page like any relative link, and an embedded image is
+// uploaded and drawn like any other.
+//
+// An embedded note that is a paragraph of its own has already been replaced by
+// the note when the document gets here, by includes.ProcessObsidianEmbeds. One
+// in the middle of a sentence has nowhere to put a section and is a link to the
+// note instead.
+type wikiLinkParser struct{}
+
+// NewWikiLinkParser creates the parser for Obsidian's [[links]].
+func NewWikiLinkParser() parser.InlineParser {
+	return &wikiLinkParser{}
+}
+
+func (s *wikiLinkParser) Trigger() []byte {
+	return []byte{'[', '!'}
+}
+
+// imageExtensions are the files Obsidian embeds as images.
+var imageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".bmp", ".svg", ".webp", ".avif"}
+
+// attachmentExtensions are the files a link names as they are. A name with any
+// other ending is a note, which Obsidian links to without its .md -- and note
+// names have dots in them often enough ("Release 1.2") that taking whatever
+// follows the last one as an extension would get them wrong.
+var attachmentExtensions = append([]string{
+	".md", ".pdf", ".mp3", ".wav", ".ogg", ".m4a", ".mp4", ".webm", ".mov", ".canvas",
+}, imageExtensions...)
+
+// imageSize is the |300 or |300x200 an embedded image is sized with.
+var imageSize = regexp.MustCompile(`^(\d+)(?:x(\d+))?$`)
+
+func (s *wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+
+	embed := bytes.HasPrefix(line, []byte("![["))
+	if !embed && !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	open := 2
+	if embed {
+		open = 3
+	}
+
+	end := bytes.Index(line[open:], []byte("]]"))
+	if end <= 0 {
+		return nil
+	}
+	inner := line[open : open+end]
+	if bytes.ContainsAny(inner, "[\n") {
+		return nil
+	}
+
+	target, alias, hasAlias := strings.Cut(string(inner), "|")
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil
+	}
+
+	// Where the words shown for the link are in the source, so that they are
+	// a text node over the source like any other link's.
+	textStart := segment.Start + open
+	textStop := textStart + len(target)
+	if hasAlias {
+		textStart = segment.Start + open + strings.Index(string(inner), "|") + 1
+		textStop = segment.Start + open + end
+	}
+
+	block.Advance(open + end + 2)
+
+	file, _, _ := strings.Cut(target, "#")
+	if embed && slices.Contains(imageExtensions, strings.ToLower(path.Ext(file))) {
+		link := ast.NewLink()
+		link.Destination = []byte(file)
+
+		image := ast.NewImage(link)
+		if size := imageSize.FindStringSubmatch(strings.TrimSpace(alias)); size != nil {
+			image.SetAttributeString("width", []byte(size[1]))
+			if size[2] != "" {
+				image.SetAttributeString("height", []byte(size[2]))
+			}
+			textStart, textStop = segment.Start+open, segment.Start+open+len(file)
+		}
+		image.AppendChild(image, ast.NewTextSegment(text.NewSegment(textStart, textStop)))
+
+		return image
+	}
+
+	link := ast.NewLink()
+	link.Destination = []byte(WikiLinkDestination(target))
+	link.AppendChild(link, ast.NewTextSegment(text.NewSegment(textStart, textStop)))
+
+	return link
+}
+
+// WikiLinkDestination is the relative link an Obsidian link target stands for:
+// Note#Some Heading is Note.md#Some-Heading.
+//
+// The heading is written the way mark writes the heading's id. A link to a
+// block (Note#^id) goes to the note: Confluence has nothing a block id could
+// name.
+func WikiLinkDestination(target string) string {
+	file, heading, _ := strings.Cut(target, "#")
+	file = strings.TrimSpace(file)
+	heading = strings.TrimSpace(heading)
+
+	if file != "" && !slices.Contains(attachmentExtensions, strings.ToLower(path.Ext(file))) {
+		file += ".md"
+	}
+
+	if heading == "" || strings.HasPrefix(heading, "^") {
+		if file == "" {
+			return "#"
+		}
+		return file
+	}
+
+	return file + "#" + string(NewConfluenceIDs().Generate([]byte(heading), ast.KindHeading))
+}
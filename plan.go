@@ -0,0 +1,389 @@
+package mark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/page"
+	"github.com/rs/zerolog/log"
+)
+
+// planFormat is the version of the plan file this mark writes and reads. A
+// plan is made and applied by the same pipeline, minutes apart; one written by
+// another version is refused rather than guessed at.
+const planFormat = 1
+
+// What a plan would do with a document.
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+)
+
+// Plan is everything a run would do, worked out beforehand so that it can be
+// reviewed and then carried out exactly.
+//
+// Apply does not trust the plan to still be true. It checks that no page has
+// been edited since, then works the plan out again and refuses unless the two
+// agree -- so what is published is what was reviewed, or nothing is. The run
+// that follows checks each document and page once more as it publishes it,
+// for whatever changed after that.
+type Plan struct {
+	Format  int       `json:"format"`
+	Created time.Time `json:"created"`
+	BaseURL string    `json:"baseUrl"`
+
+	// Config is what the plan was made with, credentials aside. Apply runs
+	// with it rather than with whatever flags it is given, because a plan made
+	// with one set of flags says nothing about a run with another.
+	Config Config `json:"config"`
+
+	Pages   []PlannedPage   `json:"pages"`
+	Moves   []page.Move     `json:"moves,omitempty"`
+	Orphans []PlannedOrphan `json:"orphans,omitempty"`
+
+	mu sync.Mutex
+}
+
+// PlannedPage is what publishing one document would do to its page.
+type PlannedPage struct {
+	File   string `json:"file"`
+	Action string `json:"action"`
+	Space  string `json:"space,omitempty"`
+	Title  string `json:"title"`
+	PageID string `json:"pageId,omitempty"`
+
+	// Version is the page's version when the plan was made. A page at any
+	// other version has been edited since, and the plan no longer describes
+	// what publishing it would do.
+	Version int64 `json:"version,omitempty"`
+
+	// Source fingerprints the document as it was planned.
+	Source string `json:"source"`
+
+	// BodyHash fingerprints the normalised storage body that would be written.
+	BodyHash string `json:"bodyHash"`
+
+	RetitleFrom   string   `json:"retitleFrom,omitempty"`
+	ParentFrom    string   `json:"parentFrom,omitempty"`
+	ParentTo      string   `json:"parentTo,omitempty"`
+	LabelsAdded   []string `json:"labelsAdded,omitempty"`
+	LabelsRemoved []string `json:"labelsRemoved,omitempty"`
+	Properties    []string `json:"properties,omitempty"`
+	Attachments   []string `json:"attachments,omitempty"`
+
+	// Diff is the change to the body, for the person reviewing the plan.
+	Diff string `json:"diff,omitempty"`
+}
+
+// PlannedOrphan is a tracked page the plan would archive or delete because its
+// document is gone.
+type PlannedOrphan struct {
+	File   string `json:"file"`
+	PageID string `json:"pageId"`
+	Title  string `json:"title"`
+	Action string `json:"action"`
+}
+
+// metadataChanged reports whether anything besides the body would change.
+func (p PlannedPage) metadataChanged() bool {
+	return p.RetitleFrom != "" || p.ParentTo != "" ||
+		len(p.LabelsAdded) > 0 || len(p.LabelsRemoved) > 0 ||
+		len(p.Properties) > 0 || len(p.Attachments) > 0
+}
+
+func (p *Plan) addPage(planned PlannedPage) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// As with the run report, a document looked at twice is one document.
+	for i := range p.Pages {
+		if p.Pages[i].File == planned.File {
+			p.Pages[i] = planned
+			return
+		}
+	}
+
+	p.Pages = append(p.Pages, planned)
+}
+
+func (p *Plan) addMoves(moves []page.Move) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Moves = append(p.Moves, moves...)
+}
+
+func (p *Plan) addOrphan(orphan PlannedOrphan) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Orphans = append(p.Orphans, orphan)
+}
+
+// MakePlan works out everything a run with this configuration would do,
+// writing nothing. The same changes a diff shows are written to the output as
+// they are found.
+func MakePlan(config Config) (*Plan, error) {
+	if config.DryRun || config.CompileOnly {
+		return nil, errors.New("--dry-run and --compile-only cannot be used with plan: a plan publishes nothing already")
+	}
+
+	plan := &Plan{
+		Format:  planFormat,
+		Created: time.Now().UTC(),
+		BaseURL: strings.TrimRight(config.BaseURL, "/"),
+		Config:  config,
+	}
+
+	config.Diff = true
+	config.plan = plan
+
+	if err := Run(config); err != nil && !errors.Is(err, ErrChanged) {
+		return nil, err
+	}
+
+	// Pages are added as each document is compared, which with --concurrency
+	// is in no particular order.
+	slices.SortFunc(plan.Pages, func(a, b PlannedPage) int {
+		return strings.Compare(a.File, b.File)
+	})
+
+	return plan, nil
+}
+
+// Save writes the plan to a file.
+func (p *Plan) Save(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode plan: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("unable to write plan %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// LoadPlan reads a plan written by Save.
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read plan %s: %w", path, err)
+	}
+
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("unable to parse plan %s: %w", path, err)
+	}
+
+	if plan.Format != planFormat {
+		return nil, fmt.Errorf(
+			"plan %s is in format %d, and this version of mark applies format %d: make the plan again",
+			path, plan.Format, planFormat,
+		)
+	}
+
+	return &plan, nil
+}
+
+// Apply carries out a plan, or refuses.
+//
+// The config is the plan's own, with the credentials to publish with filled
+// in. Every page the plan would touch is checked first: one edited since the
+// plan was made is refused outright, and the plan is then worked out again
+// and compared, which catches everything else that moved underneath it -- a
+// document edited, a label added by hand, a parent renamed. Only when the two
+// agree is anything written.
+func Apply(config Config, plan *Plan) error {
+	if strings.TrimRight(config.BaseURL, "/") != plan.BaseURL {
+		return fmt.Errorf(
+			"the plan was made against %s, not %s", plan.BaseURL, config.BaseURL,
+		)
+	}
+
+	api := confluence.NewAPI(config.BaseURL, config.Username, config.Password, config.InsecureSkipTLSVerify)
+
+	var stale []string
+	for _, planned := range plan.Pages {
+		reason, err := planned.staleness(api)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			stale = append(stale, reason)
+		}
+	}
+
+	if len(stale) > 0 {
+		return fmt.Errorf("the plan is out of date, make it again:\n  %s", strings.Join(stale, "\n  "))
+	}
+
+	log.Info().Msg("checking the plan still holds")
+
+	check := config
+	check.Output = nil
+	fresh, err := MakePlan(check)
+	if err != nil {
+		return err
+	}
+
+	if differences := plan.differences(fresh); len(differences) > 0 {
+		return fmt.Errorf(
+			"the plan no longer matches what publishing would do, make it again:\n  %s",
+			strings.Join(differences, "\n  "),
+		)
+	}
+
+	// Between the comparison and each page being published, a document can
+	// still be edited and a page changed by hand. The run is given the plan,
+	// and refuses any document that no longer matches it; see checkPlanned.
+	config.applying = plan
+
+	return Run(config)
+}
+
+// staleness says how the page of a planned update has changed since the plan
+// was made: deleted, or edited to another version. It is empty for a page that
+// is as planned, and for a planned create.
+func (p PlannedPage) staleness(api *confluence.API) (string, error) {
+	if p.PageID == "" {
+		return "", nil
+	}
+
+	current, err := api.GetPageByID(p.PageID)
+	if err != nil {
+		if errors.Is(err, confluence.ErrNotFound) {
+			return fmt.Sprintf("page %q (%s) has been deleted", p.Title, p.PageID), nil
+		}
+		return "", fmt.Errorf("unable to retrieve page %s: %w", p.PageID, err)
+	}
+
+	if current.Version.Number != p.Version {
+		return fmt.Sprintf(
+			"page %q (%s) is at version %d; the plan was made against version %d",
+			p.Title, p.PageID, current.Version.Number, p.Version,
+		), nil
+	}
+
+	return "", nil
+}
+
+// checkPlanned refuses to publish a document the plan being applied does not
+// describe as it is now: one not in the plan, one edited since, or one whose
+// page has been. It is asked right before the document is published, after
+// the plan was checked as a whole, and returns what the plan says of it.
+func checkPlanned(api *confluence.API, plan *Plan, key, sourceHash string) (PlannedPage, error) {
+	plan.mu.Lock()
+	index := slices.IndexFunc(plan.Pages, func(p PlannedPage) bool { return p.File == key })
+	var planned PlannedPage
+	if index >= 0 {
+		planned = plan.Pages[index]
+	}
+	plan.mu.Unlock()
+
+	if index < 0 {
+		return PlannedPage{}, fmt.Errorf("%s is not in the plan; make the plan again", key)
+	}
+
+	if planned.Source != sourceHash {
+		return PlannedPage{}, fmt.Errorf("%s has been edited since the plan was made; make the plan again", key)
+	}
+
+	reason, err := planned.staleness(api)
+	if err != nil {
+		return PlannedPage{}, err
+	}
+	if reason != "" {
+		return PlannedPage{}, fmt.Errorf("%s since the plan was checked; make the plan again", reason)
+	}
+
+	return planned, nil
+}
+
+// differences lists how a plan made again differs from this one. The diff
+// text is left out of the comparison: it follows from the body hash and says
+// nothing more.
+func (p *Plan) differences(other *Plan) []string {
+	var result []string
+
+	planned := map[string]PlannedPage{}
+	for _, pg := range p.Pages {
+		planned[pg.File] = pg
+	}
+
+	seen := map[string]bool{}
+	for _, now := range other.Pages {
+		seen[now.File] = true
+
+		before, ok := planned[now.File]
+		if !ok {
+			result = append(result, fmt.Sprintf("%s is not in the plan", now.File))
+			continue
+		}
+
+		before.Diff, now.Diff = "", ""
+		switch {
+		case before.Source != now.Source:
+			result = append(result, fmt.Sprintf("%s has been edited", now.File))
+		case !sameJSON(before, now):
+			result = append(result, fmt.Sprintf("%s would no longer be published as planned", now.File))
+		}
+	}
+
+	for _, pg := range p.Pages {
+		if !seen[pg.File] {
+			result = append(result, fmt.Sprintf("%s is planned but would not be published", pg.File))
+		}
+	}
+
+	if !sameJSON(p.Moves, other.Moves) {
+		result = append(result, "pages would be ordered differently")
+	}
+
+	if !sameJSON(p.Orphans, other.Orphans) {
+		result = append(result, "different orphaned pages would be removed")
+	}
+
+	return result
+}
+
+// sameJSON compares two values as they would be written to the plan file, which
+// is the form one of them was read back from -- an empty list and no list at
+// all are the same thing there, and nowhere else needs to care.
+func sameJSON(a, b any) bool {
+	left, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+
+	right, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+
+	return string(left) == string(right)
+}
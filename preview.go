@@ -0,0 +1,480 @@
+package mark
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/kovetskiy/mark/v16/attachment"
+	markmd "github.com/kovetskiy/mark/v16/markdown"
+	"github.com/kovetskiy/mark/v16/metadata"
+	"github.com/kovetskiy/mark/v16/page"
+	"github.com/kovetskiy/mark/v16/stdlib"
+	"github.com/kovetskiy/mark/v16/storage"
+	"github.com/kovetskiy/mark/v16/vfs"
+	"github.com/rs/zerolog/log"
+)
+
+// Preview serves the files as web pages on addr until ctx is done, showing
+// each as it would look once published without publishing anything.
+//
+// Nothing is asked of Confluence, so no credentials are needed: documents are
+// compiled as a publish would compile them, and the storage format that comes
+// out is drawn in HTML by storage.ToHTML. Links between documents lead from one
+// preview page to the other, and images and attachments are served from the
+// files beside each document.
+//
+// Pages are compiled when they are asked for, so a reload always shows the
+// document as it is on disk; an open page reloads itself when the document,
+// or anything it includes or shows, changes.
+func Preview(ctx context.Context, config Config, addr string) error {
+	handler, err := NewPreviewHandler(config)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", addr, err)
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	log.Info().Msgf("previewing %s at http://%s/", config.Files, listener.Addr())
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// previewer serves the preview of the files matching a glob.
+type previewer struct {
+	config Config
+	std    *stdlib.Lib
+
+	// attachments are what each document's last compile attached, by file
+	// name, for the images on its page to be served from.
+	mu          sync.Mutex
+	attachments map[string]map[string][]byte
+}
+
+// previewDocument is a document the preview offers.
+type previewDocument struct {
+	file  string
+	space string
+	title string
+}
+
+// NewPreviewHandler builds the handler Preview serves, for a caller that
+// wants to serve it itself.
+func NewPreviewHandler(config Config) (http.Handler, error) {
+	if err := config.checkDiagrams(); err != nil {
+		return nil, err
+	}
+
+	// No API: templates that would look a user up fall back to the name.
+	std, err := stdlib.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve standard library: %w", err)
+	}
+
+	p := &previewer{config: config, std: std, attachments: map[string]map[string][]byte{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", p.serveIndex)
+	mux.HandleFunc("GET /page", p.servePage)
+	mux.HandleFunc("GET /attachment", p.serveAttachment)
+	mux.HandleFunc("GET /version", p.serveVersion)
+
+	return mux, nil
+}
+
+// documents lists the files the preview offers, with what their headers say.
+// A document that cannot be read is listed by its file name; opening it says
+// what is wrong.
+func (p *previewer) documents() ([]previewDocument, error) {
+	files, err := doublestar.FilepathGlob(p.config.Files)
+	if err != nil {
+		return nil, fmt.Errorf("unable to match %s: %w", p.config.Files, err)
+	}
+
+	documents := make([]previewDocument, 0, len(files))
+	for _, file := range files {
+		document := previewDocument{file: file, title: filepath.Base(file)}
+
+		if _, _, meta, err := readDocument(file, p.config); err == nil && meta != nil {
+			document.space = meta.Space
+			if meta.Title != "" {
+				document.title = meta.Title
+			}
+		}
+
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
+func previewPageURL(file string) string {
+	return "/page?file=" + url.QueryEscape(file)
+}
+
+func previewAttachmentURL(file, name string) string {
+	return "/attachment?file=" + url.QueryEscape(file) + "&name=" + url.QueryEscape(name)
+}
+
+// find returns the offered document at file, however the path is written.
+func find(documents []previewDocument, file string) (previewDocument, bool) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return previewDocument{}, false
+	}
+
+	for _, document := range documents {
+		if other, err := filepath.Abs(document.file); err == nil && other == abs {
+			return document, true
+		}
+	}
+
+	return previewDocument{}, false
+}
+
+func (p *previewer) serveIndex(w http.ResponseWriter, r *http.Request) {
+	documents, err := p.documents()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var body strings.Builder
+	body.WriteString("<table><tr><th>Title</th><th>Space</th><th>File</th></tr>")
+	for _, document := range documents {
+		fmt.Fprintf(&body, `<tr><td><a href="%s">%s</a></td><td>%s</td><td><code>%s</code></td></tr>`,
+			template.HTMLEscapeString(previewPageURL(document.file)),
+			template.HTMLEscapeString(document.title),
+			template.HTMLEscapeString(document.space),
+			template.HTMLEscapeString(document.file),
+		)
+	}
+	body.WriteString("</table>")
+
+	p.write(w, http.StatusOK, previewShell{
+		Title:   "Preview of " + p.config.Files,
+		Body:    template.HTML(body.String()), //nolint:gosec // built from escaped parts above
+		Version: p.indexVersion(documents),
+		Poll:    "/version",
+	})
+}
+
+func (p *previewer) servePage(w http.ResponseWriter, r *http.Request) {
+	documents, err := p.documents()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	document, ok := find(documents, r.URL.Query().Get("file"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Taken before compiling, so that a save made while the page compiles is
+	// noticed by the next poll rather than lost.
+	version := p.pageVersion(document.file)
+
+	shell := previewShell{
+		Title:   document.title,
+		Version: version,
+		Poll:    "/version?file=" + url.QueryEscape(document.file),
+	}
+
+	status := http.StatusOK
+	body, err := p.render(document.file, documents)
+	if err != nil {
+		log.Error().Err(err).Msgf("unable to preview %s", document.file)
+		status = http.StatusInternalServerError
+		body = `<div class="panel panel-warning"><p class="panel-title">Unable to compile ` +
+			template.HTMLEscapeString(document.file) + `</p><pre>` +
+			template.HTMLEscapeString(err.Error()) + `</pre></div>`
+	}
+	shell.Body = template.HTML(body) //nolint:gosec // rendered by storage.ToHTML, which escapes
+
+	p.write(w, status, shell)
+}
+
+// render compiles a document as publishing would and draws the result.
+func (p *previewer) render(file string, documents []previewDocument) (string, error) {
+	markdown, _, meta, err := readDocument(file, p.config)
+	if err != nil {
+		return "", err
+	}
+
+	// A copy for every compile, so that one compile's includes are not what
+	// the next compile of the same page finds; see Watch.
+	lib, err := p.std.Clone()
+	if err != nil {
+		return "", err
+	}
+
+	resolver := page.NewLinkResolver(
+		nil,
+		meta,
+		filepath.Dir(file),
+		p.config.Space,
+		p.config.TitleFromH1,
+		p.config.TitleFromFilename,
+		p.config.Parents,
+		p.config.TitleAppendGeneratedHash,
+		slices.Contains(p.config.Features, "frontmatter"),
+		nil,
+		includeSearchDirs(filepath.Dir(file), p.config.IncludePath, markdown),
+	)
+	resolver.ReadMeta = readMeta(p.config)
+	resolver.LinkTo = func(target string, _ *metadata.Meta) string {
+		if document, ok := find(documents, target); ok {
+			return previewPageURL(document.file)
+		}
+		return ""
+	}
+
+	var declared []string
+	if meta != nil {
+		declared = meta.Attachments
+	}
+
+	attachments, err := attachment.ResolveLocalAttachments(vfs.LocalOS, filepath.Dir(file), declared)
+	if err != nil {
+		return "", fmt.Errorf("unable to locate attachments: %w", err)
+	}
+	for i := range attachments {
+		attachments[i].Link = previewAttachmentURL(file, attachments[i].Filename)
+	}
+
+	imageAlign, err := getImageAlign(p.config.ImageAlign, meta)
+	if err != nil {
+		return "", fmt.Errorf("unable to determine image-align: %w", err)
+	}
+
+	cfg := p.config.markConfig(imageAlign, resolver.Resolve, attachment.NewResolver(attachments).Resolve)
+	html, inline, err := markmd.CompileMarkdown(markdown, lib, file, cfg)
+	if err != nil {
+		return "", fmt.Errorf("unable to compile markdown: %w", err)
+	}
+
+	if meta != nil {
+		var buffer bytes.Buffer
+		err := lib.Templates.ExecuteTemplate(&buffer, "ac:layout", struct {
+			Layout  string
+			Sidebar string
+			Body    string
+		}{meta.Layout, meta.Sidebar, html})
+		if err != nil {
+			return "", fmt.Errorf("unable to execute layout template: %w", err)
+		}
+		html = buffer.String()
+	}
+
+	files := map[string][]byte{}
+	for _, attached := range append(attachments, inline...) {
+		files[attached.Filename] = attached.FileBytes
+	}
+
+	p.mu.Lock()
+	p.attachments[file] = files
+	p.mu.Unlock()
+
+	space := ""
+	if meta != nil {
+		space = meta.Space
+	}
+
+	return storage.ToHTML(html, storage.HTMLLinks{
+		Attachment: func(name string) string {
+			return previewAttachmentURL(file, name)
+		},
+		Page: func(linkSpace, title string) string {
+			if linkSpace == "" {
+				linkSpace = space
+			}
+			for _, document := range documents {
+				if document.title == title && document.space == linkSpace {
+					return previewPageURL(document.file)
+				}
+			}
+			return ""
+		},
+	})
+}
+
+// serveAttachment serves a file a document's page shows or links to, as it
+// was when the page was last compiled.
+func (p *previewer) serveAttachment(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	data, ok := p.attachments[r.URL.Query().Get("file")][r.URL.Query().Get("name")]
+	p.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeContent(w, r, r.URL.Query().Get("name"), time.Time{}, bytes.NewReader(data))
+}
+
+// serveVersion answers the question an open page keeps asking: has anything
+// it is built from changed since it was loaded?
+func (p *previewer) serveVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	file := r.URL.Query().Get("file")
+	if file == "" {
+		documents, err := p.documents()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = fmt.Fprint(w, p.indexVersion(documents))
+		return
+	}
+
+	_, _ = fmt.Fprint(w, p.pageVersion(file))
+}
+
+// pageVersion fingerprints everything a document is built from, as far as a
+// watch would notice it changing.
+func (p *previewer) pageVersion(file string) string {
+	return stampsVersion(takeStamps(dependencies(file, p.config, p.std)))
+}
+
+// indexVersion fingerprints the list of documents: one appearing, going, or
+// being retitled changes it.
+func (p *previewer) indexVersion(documents []previewDocument) string {
+	paths := make([]string, 0, len(documents))
+	for _, document := range documents {
+		paths = append(paths, document.file)
+	}
+
+	return stampsVersion(takeStamps(paths))
+}
+
+func stampsVersion(stamps map[string]stamp) string {
+	paths := make([]string, 0, len(stamps))
+	for path := range stamps {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s %d %d\n", path, stamps[path].modified.UnixNano(), stamps[path].size)
+	}
+
+	return sha1Hash(b.String())
+}
+
+// previewShell is what every preview page is drawn into.
+type previewShell struct {
+	Title   string
+	Body    template.HTML
+	Version string
+	Poll    string
+}
+
+func (p *previewer) write(w http.ResponseWriter, status int, shell previewShell) {
+	var buffer bytes.Buffer
+	if err := previewTemplate.Execute(&buffer, shell); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(buffer.Bytes())
+}
+
+// previewTemplate draws a page. The styles are no more than it takes for the
+// stand-ins storage.ToHTML writes to read like Confluence's own: coloured
+// boxes, status lozenges, side-by-side layout cells.
+//
+// The script is the live reload: it asks every second whether the page is
+// still what it was built from, and reloads it when not.
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; color: #172b4d; max-width: 960px; margin: 0 auto; padding: 0 24px 48px; line-height: 1.5; }
+header { border-bottom: 1px solid #dfe1e6; margin-bottom: 24px; padding: 12px 0; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #c1c7d0; padding: 6px 10px; text-align: left; vertical-align: top; }
+th { background: #f4f5f7; }
+pre.code { background: #f4f5f7; border: 1px solid #dfe1e6; border-radius: 3px; padding: 8px 12px; overflow: auto; }
+.code-title { background: #ebecf0; margin: 0; padding: 4px 12px; font-weight: bold; }
+.panel { border-radius: 3px; padding: 8px 16px; margin: 12px 0; border: 1px solid #dfe1e6; }
+.panel-title { font-weight: bold; margin-top: 0; }
+.panel-info { background: #deebff; border-color: #b3d4ff; }
+.panel-tip { background: #e3fcef; border-color: #abf5d1; }
+.panel-note { background: #eae6ff; border-color: #c0b6f2; }
+.panel-warning { background: #ffebe6; border-color: #ffbdad; }
+.expand summary { cursor: pointer; color: #0052cc; }
+.status { display: inline-block; border-radius: 3px; padding: 0 4px; font-size: 11px; font-weight: bold; background: #dfe1e6; }
+.status-green { background: #e3fcef; color: #006644; }
+.status-yellow { background: #fff0b3; color: #172b4d; }
+.status-red { background: #ffebe6; color: #bf2600; }
+.status-blue { background: #deebff; color: #0747a6; }
+.status-purple { background: #eae6ff; color: #403294; }
+.toc ul { list-style: none; padding-left: 0; }
+.toc-level-1 { padding-left: 16px; } .toc-level-2 { padding-left: 32px; } .toc-level-3 { padding-left: 48px; } .toc-level-4 { padding-left: 64px; } .toc-level-5 { padding-left: 80px; }
+.layout-section { display: flex; gap: 24px; }
+.layout-cell { flex: 1; min-width: 0; }
+.layout-two_right_sidebar .layout-cell:last-child, .layout-two_left_sidebar .layout-cell:first-child { flex: 0 0 30%; }
+.macro { border: 1px dashed #c1c7d0; border-radius: 3px; padding: 4px 12px; color: #6b778c; }
+.macro-name { font-size: 12px; text-transform: uppercase; margin: 0; }
+.mention { background: #dfe1e6; border-radius: 10px; padding: 0 6px; }
+.tasks { list-style: none; padding-left: 0; }
+img { max-width: 100%; }
+img.align-center { display: block; margin: 0 auto; }
+img.align-right { float: right; }
+</style>
+</head>
+<body>
+<header><a href="/">All documents</a></header>
+<h1>{{ .Title }}</h1>
+{{ .Body }}
+<script>
+(function () {
+  var version = "{{ .Version }}";
+  setInterval(function () {
+    fetch("{{ .Poll }}").then(function (response) {
+      return response.text();
+    }).then(function (current) {
+      if (current !== version) {
+        location.reload();
+      }
+    }, function () {});
+  }, 1000);
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,231 @@
+package mark
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/metadata"
+	"github.com/kovetskiy/mark/v16/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// PullConfig holds the configuration for pulling pages out of Confluence.
+type PullConfig struct {
+	// Connection settings
+	BaseURL               string
+	Username              string
+	Password              string
+	InsecureSkipTLSVerify bool
+
+	// PageID is the page to pull.
+	PageID string
+
+	// Recursive pulls the page's descendants too, each child into a directory
+	// of its own under its parent's.
+	Recursive bool
+
+	// OutputDir is where files are written. Empty means the working directory.
+	OutputDir string
+
+	// Overwrite allows an existing file to be replaced. Without it a pull that
+	// would clobber a file fails before writing anything for that page.
+	Overwrite bool
+}
+
+// Pull converts a Confluence page, and with Recursive its descendants, into
+// Markdown files carrying mark's header comments, and downloads the page's
+// attachments next to each file.
+//
+// Every page is written into a directory of its own, named after it, which
+// holds its file, its attachments and its children's directories. Attachments
+// keep their names, which is what the body and any macro refer to them by, and
+// two pages with an attachment of the same name do not write over each other.
+func Pull(config PullConfig) error {
+	if config.PageID == "" {
+		return errors.New("no page to pull: pass a page id or a --target-url with a pageId")
+	}
+
+	api := confluence.NewAPI(config.BaseURL, config.Username, config.Password, config.InsecureSkipTLSVerify)
+
+	dir := config.OutputDir
+	if dir == "" {
+		dir = "."
+	}
+
+	return pullPage(api, config, config.PageID, dir, map[string]string{})
+}
+
+// pullPage pulls a page into a directory of its own in dir. homepages keeps
+// the homepage of each space met, so that it is asked for once.
+func pullPage(api *confluence.API, config PullConfig, pageID, dir string, homepages map[string]string) error {
+	info, err := api.GetPageByIDExpanded(pageID, "ancestors,version,body.storage,space")
+	if err != nil {
+		return fmt.Errorf("unable to retrieve page %s: %w", pageID, err)
+	}
+
+	doc, err := storage.ToMarkdown(info.Body.Storage.Value, info.Space.Key)
+	if err != nil {
+		return fmt.Errorf("unable to convert page %q: %w", info.Title, err)
+	}
+
+	labels, err := api.GetPageLabels(info, "global")
+	if err != nil {
+		return fmt.Errorf("unable to retrieve labels of page %q: %w", info.Title, err)
+	}
+
+	remote, err := api.GetAttachments(info.ID)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve attachments of page %q: %w", info.Title, err)
+	}
+
+	homepage, ok := homepages[info.Space.Key]
+	if !ok {
+		found, err := api.FindHomePage(info.Space.Key)
+		if err != nil {
+			return fmt.Errorf("unable to find the homepage of space %s: %w", info.Space.Key, err)
+		}
+		homepage = found.ID
+		homepages[info.Space.Key] = homepage
+	}
+
+	pageDir := filepath.Join(dir, slugify(info.Title, info.ID))
+	path := filepath.Join(pageDir, slugify(info.Title, info.ID)+".md")
+
+	// Every attachment is downloaded and declared, not only the ones the body
+	// refers to: a file linked from a macro kept raw, or attached and only
+	// listed by the attachments macro, is still part of the page, and an
+	// undeclared attachment would not be uploaded again on the next publish.
+	var attachments []confluence.AttachmentInfo
+	for _, attachment := range remote {
+		name := attachment.Filename
+		if name == "" || filepath.Base(name) != name || name == "." || name == ".." {
+			log.Warn().Msgf("skipping attachment %q of page %q: not a plain file name", name, info.Title)
+			continue
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	// Everything the page is written as is checked before any of it is, so
+	// that a pull refused for one file has not replaced the others.
+	if !config.Overwrite {
+		paths := []string{path}
+		for _, attachment := range attachments {
+			paths = append(paths, filepath.Join(pageDir, attachment.Filename))
+		}
+
+		for _, path := range paths {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists; pass --overwrite to replace it", path)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(pageDir, 0o755); err != nil {
+		return fmt.Errorf("unable to create directory %s: %w", pageDir, err)
+	}
+
+	var names []string
+	for _, attachment := range attachments {
+		data, err := api.DownloadAttachment(attachment)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(filepath.Join(pageDir, attachment.Filename), data, 0o644); err != nil {
+			return fmt.Errorf("unable to write attachment %s: %w", attachment.Filename, err)
+		}
+
+		names = append(names, attachment.Filename)
+	}
+
+	for _, name := range doc.Attachments {
+		if !slices.Contains(names, name) {
+			log.Warn().Msgf("page %q refers to attachment %q, which it does not have", info.Title, name)
+		}
+	}
+
+	var label []string
+	for _, l := range labels.Labels {
+		label = append(label, l.Name)
+	}
+
+	content := pullHeaders(info, homepage, label, names) + "\n" + doc.Markdown
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+
+	log.Info().Msgf("pulled page %q into %s", info.Title, path)
+
+	if !config.Recursive {
+		return nil
+	}
+
+	children, err := api.GetChildPages(info.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		if err := pullPage(api, config, child.ID, pageDir, homepages); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pullHeaders writes the header comments that publish the page back to where
+// it came from. An ancestry starting at the space's homepage leaves it out,
+// as that is where a page with no Parent header goes anyway; any other first
+// ancestor, in a space whose pages sit beside the homepage rather than under
+// it, is a parent like the rest.
+func pullHeaders(info *confluence.PageInfo, homepage string, labels, attachments []string) string {
+	var b strings.Builder
+
+	header := func(key, value string) {
+		fmt.Fprintf(&b, "<!-- %s: %s -->\n", key, value)
+	}
+
+	header(metadata.HeaderSpace, info.Space.Key)
+	ancestors := info.Ancestors
+	if len(ancestors) > 0 && ancestors[0].ID == homepage {
+		ancestors = ancestors[1:]
+	}
+	for _, ancestor := range ancestors {
+		header(metadata.HeaderParent, ancestor.Title)
+	}
+	header(metadata.HeaderTitle, info.Title)
+	if info.Type != "" && info.Type != "page" {
+		header(metadata.HeaderType, info.Type)
+	}
+	for _, label := range labels {
+		header(metadata.HeaderLabel, label)
+	}
+	for _, attachment := range attachments {
+		header(metadata.HeaderAttachment, attachment)
+	}
+
+	return b.String()
+}
+
+var reSlug = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// slugify turns a page title into a file name. A title with nothing usable in
+// it, such as one made only of punctuation, falls back to the page id.
+func slugify(title, fallback string) string {
+	slug := strings.Trim(reSlug.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if slug == "" {
+		return fallback
+	}
+	return slug
+}
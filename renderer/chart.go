@@ -0,0 +1,166 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// chartParameters are the parameters of Confluence's chart macro the ac:chart
+// template takes: by the name a template's data gives them, and by the
+// macro's own.
+//
+// https://confluence.atlassian.com/doc/chart-macro-136478.html
+var chartParameters = []struct {
+	field, parameter string
+}{
+	{"Type", "type"},
+	{"Title", "title"},
+	{"SubTitle", "subTitle"},
+	{"XLabel", "xLabel"},
+	{"YLabel", "yLabel"},
+	{"Width", "width"},
+	{"Height", "height"},
+	{"Orientation", "orientation"},
+	{"DataOrientation", "dataOrientation"},
+	{"Stacked", "stacked"},
+	{"ThreeD", "3D"},
+	{"ShowShapes", "showShapes"},
+	{"Opacity", "opacity"},
+	{"Legend", "legend"},
+	{"Colors", "colors"},
+	{"TimeSeries", "timeSeries"},
+	{"DateFormat", "dateFormat"},
+	{"TimePeriod", "timePeriod"},
+	{"RangeAxisLowerBound", "rangeAxisLowerBound"},
+	{"RangeAxisUpperBound", "rangeAxisUpperBound"},
+}
+
+// chartOption is one key=value option of a chart block, the value quoted when
+// it has spaces in it.
+var chartOption = regexp.MustCompile(`^(\w+)=("(?:[^"\\]|\\.)*"|\S+)\s*`)
+
+// ParseChartOptions reads the options of a chart block -- what follows chart in
+// its info string, type=bar title="Sales by quarter" -- as the ac:chart
+// template's data. An option is named by the template's name for it or the
+// macro's, in any case.
+func ParseChartOptions(info string) (map[string]any, error) {
+	options := map[string]any{}
+
+	rest := strings.TrimSpace(info)
+	for rest != "" {
+		match := chartOption.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, fmt.Errorf("chart options are key=value pairs, not %q", rest)
+		}
+		rest = rest[len(match[0]):]
+
+		value := match[2]
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("chart option %s: %w", match[1], err)
+			}
+			value = unquoted
+		}
+
+		field := ""
+		for _, parameter := range chartParameters {
+			if strings.EqualFold(match[1], parameter.field) || strings.EqualFold(match[1], parameter.parameter) {
+				field = parameter.field
+				break
+			}
+		}
+		if field == "" {
+			return nil, fmt.Errorf("the chart macro has no parameter %q", match[1])
+		}
+
+		options[field] = value
+	}
+
+	return options, nil
+}
+
+// markdownTableRule is the line under a Markdown table's header.
+var markdownTableRule = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+// ChartTable returns the data of a chart block -- a Markdown table, or CSV
+// whose first line is the header -- as the storage format table the chart
+// macro draws from.
+func ChartTable(data []byte) (string, error) {
+	data = bytes.TrimSpace(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")))
+	lines := strings.Split(string(data), "\n")
+
+	var rows [][]string
+	if len(lines) > 1 && markdownTableRule.MatchString(lines[1]) {
+		for i, line := range lines {
+			if i != 1 {
+				rows = append(rows, markdownTableCells(line))
+			}
+		}
+	} else {
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.TrimLeadingSpace = true
+
+		var err error
+		rows, err = reader.ReadAll()
+		if err != nil {
+			return "", fmt.Errorf("a chart's data is a Markdown table or CSV: %w", err)
+		}
+	}
+
+	if len(rows) < 2 {
+		return "", fmt.Errorf("a chart needs a header and at least one row of data")
+	}
+
+	var b strings.Builder
+	b.WriteString("<table><tbody>")
+	for i, row := range rows {
+		cell := "td"
+		if i == 0 {
+			cell = "th"
+		}
+
+		b.WriteString("<tr>")
+		for _, value := range row {
+			fmt.Fprintf(&b, "<%s>%s</%s>", cell, html.EscapeString(value), cell)
+		}
+		b.WriteString("</tr>")
+	}
+	b.WriteString("</tbody></table>")
+
+	return b.String(), nil
+}
+
+// markdownTableCells splits a row of a Markdown table into its cells, a pipe
+// escaped with a backslash being part of one.
+func markdownTableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var (
+		cells []string
+		cell  strings.Builder
+	)
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+
+	return append(cells, strings.TrimSpace(cell.String()))
+}
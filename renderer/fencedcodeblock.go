@@ -2,12 +2,15 @@ package renderer
 
 import (
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
 
 	"github.com/kovetskiy/mark/v16/attachment"
 	"github.com/kovetskiy/mark/v16/d2"
+	"github.com/kovetskiy/mark/v16/diagram"
+	"github.com/kovetskiy/mark/v16/includes"
 	"github.com/kovetskiy/mark/v16/mermaid"
 	"github.com/kovetskiy/mark/v16/stdlib"
 	"github.com/kovetskiy/mark/v16/types"
@@ -21,6 +24,7 @@ import (
 type ConfluenceFencedCodeBlockRenderer struct {
 	html.Config
 	Stdlib      *stdlib.Lib
+	Path        string
 	MarkConfig  types.MarkConfig
 	Attachments attachment.Attacher
 }
@@ -39,10 +43,11 @@ var reBlockDetails = regexp.MustCompile(
 )
 
 // NewConfluenceRenderer creates a new instance of the ConfluenceRenderer
-func NewConfluenceFencedCodeBlockRenderer(stdlib *stdlib.Lib, attachments attachment.Attacher, cfg types.MarkConfig, opts ...html.Option) renderer.NodeRenderer {
+func NewConfluenceFencedCodeBlockRenderer(stdlib *stdlib.Lib, attachments attachment.Attacher, path string, cfg types.MarkConfig, opts ...html.Option) renderer.NodeRenderer {
 	return &ConfluenceFencedCodeBlockRenderer{
 		Config:      html.NewConfig(),
 		Stdlib:      stdlib,
+		Path:        path,
 		MarkConfig:  cfg,
 		Attachments: attachments,
 	}
@@ -103,6 +108,9 @@ func (r *ConfluenceFencedCodeBlockRenderer) renderFencedCodeBlock(writer util.Bu
 	lang := ""
 	var options []string
 	title := ""
+	format := r.MarkConfig.DiagramFormat
+	mermaidMode := r.MarkConfig.MermaidMode
+	var d2Options []string
 	if len(groups) > 0 {
 		lang, options, title = groups[1], strings.Fields(groups[2]), groups[3]
 		for _, option := range options {
@@ -114,6 +122,22 @@ func (r *ConfluenceFencedCodeBlockRenderer) renderFencedCodeBlock(writer util.Bu
 				collapse = false
 				continue
 			}
+			// Only a diagram has a format: any other code block keeps the
+			// option, as it did before there were diagram formats.
+			_, rendered := r.MarkConfig.DiagramRenderers[lang]
+			isDiagram := lang == "d2" || lang == "mermaid" || rendered
+			if value, ok := strings.CutPrefix(option, "format="); ok && isDiagram {
+				format = value
+				continue
+			}
+			if value, ok := strings.CutPrefix(option, "mode="); ok && lang == "mermaid" {
+				mermaidMode = value
+				continue
+			}
+			if lang == "d2" && d2.IsOption(option) {
+				d2Options = append(d2Options, option)
+				continue
+			}
 			if option == "linenumbers" {
 				linenumbers = true
 				continue
@@ -138,100 +162,77 @@ func (r *ConfluenceFencedCodeBlockRenderer) renderFencedCodeBlock(writer util.Bu
 		lval = append(lval, line.Value(source)...)
 	}
 
-	if lang == "d2" && slices.Contains(r.MarkConfig.Features, "d2") {
-		attachment, err := d2.ProcessD2(title, lval, r.MarkConfig.D2Scale)
+	// The mode is an error only where it is used: a diagram left to a
+	// renderer is drawn however --mermaid-mode is set, so the renderer is
+	// looked for first.
+	mermaidMode, modeErr := mermaid.ParseMode(mermaidMode)
+
+	if renderer, ok := r.MarkConfig.DiagramRenderers[lang]; ok {
+		attachment, err := diagram.Process(renderer, title, lval, format, r.MarkConfig.DiagramCache)
 		if err != nil {
 			line, col := GetLineCol(source, node.Pos())
-			return ast.WalkStop, fmt.Errorf("line %d, col %d: d2 rendering failed: %w", line, col, err)
+			return ast.WalkStop, fmt.Errorf("line %d, col %d: %s rendering failed: %w", line, col, lang, err)
 		}
-		r.Attachments.Attach(attachment)
 
-		effectiveAlign := calculateAlign(r.MarkConfig.ImageAlign, attachment.Width)
-		effectiveLayout := calculateLayout(effectiveAlign, attachment.Width)
-		displayWidth := calculateDisplayWidth(attachment.Width, effectiveLayout)
+		if err := r.renderDiagram(writer, attachment, title); err != nil {
+			return ast.WalkStop, err
+		}
 
-		err = r.Stdlib.Templates.ExecuteTemplate(
-			writer,
-			"ac:image",
-			struct {
-				Align          string
-				Layout         string
-				OriginalWidth  string
-				OriginalHeight string
-				Width          string
-				Height         string
-				Title          string
-				Alt            string
-				Attachment     string
-				Url            string
-			}{
-				effectiveAlign,
-				effectiveLayout,
-				attachment.Width,
-				attachment.Height,
-				displayWidth,
-				"",
-				// The display title, not the attachment name: when the author gave
-				// no "title" in the info string, ProcessD2/ProcessMermaid fall back
-				// to the content checksum for the filename, and passing that here
-				// made Confluence render a 64-character hash as a caption under the
-				// diagram. The attachment keeps its checksum-derived name.
-				title,
-				"",
-				attachment.Filename,
-				"",
-			},
-		)
+	} else if lang == "mermaid" && slices.Contains(r.MarkConfig.Features, "mermaid") && (modeErr != nil || mermaidMode == mermaid.ModeMacro) {
+		if modeErr != nil {
+			line, col := GetLineCol(source, node.Pos())
+			return ast.WalkStop, fmt.Errorf("line %d, col %d: %w", line, col, modeErr)
+		}
+
+		if err := r.renderMermaidMacro(writer, title, lval); err != nil {
+			line, col := GetLineCol(source, node.Pos())
+			return ast.WalkStop, fmt.Errorf("line %d, col %d: %w", line, col, err)
+		}
+
+	} else if lang == "d2" && slices.Contains(r.MarkConfig.Features, "d2") {
+		options, err := d2.NewOptions(r.MarkConfig.D2Theme, r.MarkConfig.D2Layout, r.MarkConfig.D2Sketch)
+		if err == nil {
+			options, err = options.Apply(d2Options)
+		}
+		if err != nil {
+			line, col := GetLineCol(source, node.Pos())
+			return ast.WalkStop, fmt.Errorf("line %d, col %d: %w", line, col, err)
+		}
 
+		attachment, err := d2.ProcessD2(title, lval, r.MarkConfig.D2Scale, format, options, r.MarkConfig.DiagramCache)
 		if err != nil {
+			line, col := GetLineCol(source, node.Pos())
+			return ast.WalkStop, fmt.Errorf("line %d, col %d: d2 rendering failed: %w", line, col, err)
+		}
+
+		if err := r.renderDiagram(writer, attachment, title); err != nil {
 			return ast.WalkStop, err
 		}
 
 	} else if lang == "mermaid" && slices.Contains(r.MarkConfig.Features, "mermaid") {
-		attachment, err := mermaid.ProcessMermaidLocally(title, lval, r.MarkConfig.MermaidScale)
+		attachment, err := mermaid.ProcessMermaidLocally(title, lval, r.MarkConfig.MermaidScale, format, r.MarkConfig.DiagramCache)
 		if err != nil {
 			line, col := GetLineCol(source, node.Pos())
 			return ast.WalkStop, fmt.Errorf("line %d, col %d: mermaid rendering failed: %w", line, col, err)
 		}
-		r.Attachments.Attach(attachment)
 
-		effectiveAlign := calculateAlign(r.MarkConfig.ImageAlign, attachment.Width)
-		effectiveLayout := calculateLayout(effectiveAlign, attachment.Width)
-		displayWidth := calculateDisplayWidth(attachment.Width, effectiveLayout)
+		if err := r.renderDiagram(writer, attachment, title); err != nil {
+			return ast.WalkStop, err
+		}
 
-		err = r.Stdlib.Templates.ExecuteTemplate(
-			writer,
-			"ac:image",
-			struct {
-				Align          string
-				Layout         string
-				OriginalWidth  string
-				OriginalHeight string
-				Width          string
-				Height         string
-				Title          string
-				Alt            string
-				Attachment     string
-				Url            string
-			}{
-				effectiveAlign,
-				effectiveLayout,
-				attachment.Width,
-				attachment.Height,
-				displayWidth,
-				"",
-				// The display title, not the attachment name: when the author gave
-				// no "title" in the info string, ProcessD2/ProcessMermaid fall back
-				// to the content checksum for the filename, and passing that here
-				// made Confluence render a 64-character hash as a caption under the
-				// diagram. The attachment keeps its checksum-derived name.
-				title,
-				"",
-				attachment.Filename,
-				"",
-			},
-		)
+	} else if lang == "chart" && slices.Contains(r.MarkConfig.Features, "chart") {
+		// The options are read from the info string as written: they are
+		// key=value pairs, which the language's options are not.
+		data, err := ParseChartOptions(strings.TrimPrefix(strings.TrimSpace(string(info)), "chart"))
+		if err == nil {
+			data["Body"], err = ChartTable(lval)
+		}
+		if err != nil {
+			line, col := GetLineCol(source, node.Pos())
+			return ast.WalkStop, fmt.Errorf("line %d, col %d: %w", line, col, err)
+		}
 
+		err = r.Stdlib.Templates.ExecuteTemplate(writer, "ac:chart", data)
 		if err != nil {
 			return ast.WalkStop, err
 		}
@@ -281,3 +282,69 @@ func (r *ConfluenceFencedCodeBlockRenderer) renderFencedCodeBlock(writer util.Bu
 
 	return ast.WalkContinue, nil
 }
+
+// renderDiagram attaches a rendered diagram to the page and shows it there.
+func (r *ConfluenceFencedCodeBlockRenderer) renderDiagram(writer util.BufWriter, attachment attachment.Attachment, title string) error {
+	r.Attachments.Attach(attachment)
+
+	effectiveAlign := calculateAlign(r.MarkConfig.ImageAlign, attachment.Width)
+	effectiveLayout := calculateLayout(effectiveAlign, attachment.Width)
+	displayWidth := calculateDisplayWidth(attachment.Width, effectiveLayout)
+
+	return r.Stdlib.Templates.ExecuteTemplate(
+		writer,
+		"ac:image",
+		struct {
+			Align          string
+			Layout         string
+			OriginalWidth  string
+			OriginalHeight string
+			Width          string
+			Height         string
+			Title          string
+			Alt            string
+			Attachment     string
+			Url            string
+		}{
+			effectiveAlign,
+			effectiveLayout,
+			attachment.Width,
+			attachment.Height,
+			displayWidth,
+			"",
+			// The display title, not the attachment name: when the author gave
+			// no "title" in the info string, the diagram renderers fall back to
+			// the content checksum for the filename, and passing that here made
+			// Confluence render a 64-character hash as a caption under the
+			// diagram. The attachment keeps its checksum-derived name.
+			title,
+			"",
+			attachment.Filename,
+			"",
+		},
+	)
+}
+
+// renderMermaidMacro writes a Mermaid diagram as the macro of a Mermaid app
+// installed in Confluence, by the template --mermaid-macro-template names: one
+// of the standard library's, or a file found as the document's Includes are:
+// next to the document, then on --include-path.
+func (r *ConfluenceFencedCodeBlockRenderer) renderMermaidMacro(writer util.BufWriter, title string, text []byte) error {
+	name := r.MarkConfig.MermaidMacroTemplate
+	if name == "" {
+		name = "ac:mermaid"
+	}
+
+	templates, err := includes.LoadTemplate(filepath.Dir(r.Path), r.MarkConfig.IncludePath, name, "", "", r.Stdlib.Templates)
+	if err != nil {
+		return err
+	}
+
+	return templates.Execute(writer, struct {
+		Title string
+		Text  string
+	}{
+		title,
+		strings.TrimSuffix(string(text), "\n"),
+	})
+}
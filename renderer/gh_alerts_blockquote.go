@@ -42,6 +42,14 @@ func (r *ConfluenceGHAlertsBlockQuoteRenderer) getConfluenceMacroName(alertType
 		return "note"
 	case "caution":
 		return "warning"
+	// Obsidian's callouts, and their aliases, by the colour Obsidian gives
+	// them. The ones it shows blue are left to the default.
+	case "hint", "success", "check", "done":
+		return "tip"
+	case "question", "help", "faq", "attention":
+		return "note"
+	case "failure", "fail", "missing", "danger", "error", "bug":
+		return "warning"
 	default:
 		return "info"
 	}
@@ -66,10 +74,17 @@ func (r *ConfluenceGHAlertsBlockQuoteRenderer) renderBlockQuote(writer util.BufW
 func (r *ConfluenceGHAlertsBlockQuoteRenderer) renderGHAlert(writer util.BufWriter, source []byte, node ast.Node, entering bool, alertType string) (ast.WalkStatus, error) {
 	quoteLevel := r.LevelMap.Level(node)
 
+	// An Obsidian callout that starts out folded is in an expand macro, which
+	// is the nearest Confluence has.
+	foldTitle, folded := node.AttributeString("gh-alert-fold")
+
 	if quoteLevel == 0 && entering {
 		r.BlockQuoteNode = node
 		macroName := r.getConfluenceMacroName(alertType)
 		prefix := fmt.Sprintf("<ac:structured-macro ac:name=\"%s\"><ac:parameter ac:name=\"icon\">true</ac:parameter><ac:rich-text-body>\n", macroName)
+		if title, ok := foldTitle.([]byte); folded && ok {
+			prefix = fmt.Sprintf("<ac:structured-macro ac:name=\"expand\"><ac:parameter ac:name=\"title\">%s</ac:parameter><ac:rich-text-body>\n", util.EscapeHTML(title)) + prefix
+		}
 		if _, err := writer.Write([]byte(prefix)); err != nil {
 			return ast.WalkStop, err
 		}
@@ -78,6 +93,9 @@ func (r *ConfluenceGHAlertsBlockQuoteRenderer) renderGHAlert(writer util.BufWrit
 
 	if quoteLevel == 0 && !entering && node == r.BlockQuoteNode {
 		suffix := "</ac:rich-text-body></ac:structured-macro>\n"
+		if folded {
+			suffix += suffix
+		}
 		if _, err := writer.Write([]byte(suffix)); err != nil {
 			return ast.WalkStop, err
 		}
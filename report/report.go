@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 	"sync"
 )
@@ -51,6 +52,15 @@ const (
 	StatusUnchanged = "unchanged"
 	StatusSkipped   = "skipped"
 	StatusFailed    = "failed"
+
+	// StatusChanged is only reported by a diff: the page differs from its
+	// document, and publishing would change it.
+	StatusChanged = "changed"
+
+	// StatusValid and StatusInvalid are only reported by validate, which
+	// publishes nothing. What makes a document invalid is in Problems.
+	StatusValid   = "valid"
+	StatusInvalid = "invalid"
 )
 
 // Page is one document's outcome.
@@ -75,13 +85,22 @@ type Orphan struct {
 	Action string `json:"action"`
 }
 
+// Problem is something wrong at a line of a document, found without
+// publishing it.
+type Problem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
 // Report is everything a run has to say.
 type Report struct {
 	mu sync.Mutex
 
-	Pages   []Page   `json:"pages"`
-	Orphans []Orphan `json:"orphans,omitempty"`
-	Errors  []string `json:"errors,omitempty"`
+	Pages    []Page    `json:"pages"`
+	Orphans  []Orphan  `json:"orphans,omitempty"`
+	Problems []Problem `json:"problems,omitempty"`
+	Errors   []string  `json:"errors,omitempty"`
 }
 
 // New returns an empty report.
@@ -124,6 +143,18 @@ func (r *Report) AddOrphan(orphan Orphan) {
 	r.Orphans = append(r.Orphans, orphan)
 }
 
+// AddProblem records something wrong at a line of a document.
+func (r *Report) AddProblem(problem Problem) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Problems = append(r.Problems, problem)
+}
+
 // AddError records something that went wrong and was not about one document.
 func (r *Report) AddError(message string) {
 	if r == nil {
@@ -136,11 +167,58 @@ func (r *Report) AddError(message string) {
 	r.Errors = append(r.Errors, message)
 }
 
+// Merge records everything another report did, in the order it did. Documents
+// published in parallel each report on their own, and are merged in the order
+// of the run so that the report reads the same however they were scheduled.
+func (r *Report) Merge(other *Report) {
+	if r == nil || other == nil {
+		return
+	}
+
+	other.mu.Lock()
+	pages := slices.Clone(other.Pages)
+	orphans := slices.Clone(other.Orphans)
+	problems := slices.Clone(other.Problems)
+	messages := slices.Clone(other.Errors)
+	other.mu.Unlock()
+
+	for _, page := range pages {
+		r.AddPage(page)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Orphans = append(r.Orphans, orphans...)
+	r.Problems = append(r.Problems, problems...)
+	r.Errors = append(r.Errors, messages...)
+}
+
+// Count returns how many documents ended with the given status.
+func (r *Report) Count(status string) int {
+	if r == nil {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, page := range r.Pages {
+		if page.Status == status {
+			count++
+		}
+	}
+
+	return count
+}
+
 // Write says what happened, in the requested shape.
 //
 // The url form writes as each page publishes rather than at the end, so it is
 // not written again here: repeating it would double every line of the output
-// mark has always produced.
+// mark has always produced. Problems have no URL, and are written in it the
+// way compilers write them, as file:line: message.
 func (r *Report) Write(w io.Writer, format string) error {
 	if r == nil {
 		return nil
@@ -160,6 +238,12 @@ func (r *Report) Write(w io.Writer, format string) error {
 		return r.writeGitHub(w)
 
 	default:
+		for _, problem := range r.Problems {
+			if _, err := fmt.Fprintf(w, "%s:%d: %s\n", problem.File, problem.Line, problem.Message); err != nil {
+				return err
+			}
+		}
+
 		return nil
 	}
 }
@@ -182,6 +266,15 @@ func (r *Report) writeGitHub(w io.Writer) error {
 				fmt.Sprintf("published %q to %s", page.Title, page.URL)); err != nil {
 				return err
 			}
+
+		case StatusChanged:
+			message := fmt.Sprintf("page %q would be created", page.Title)
+			if page.URL != "" {
+				message = fmt.Sprintf("page %q at %s would change", page.Title, page.URL)
+			}
+			if err := command(w, "notice", page.File, message); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -196,6 +289,12 @@ func (r *Report) writeGitHub(w io.Writer) error {
 		}
 	}
 
+	for _, problem := range r.Problems {
+		if err := lineCommand(w, "error", problem.File, problem.Line, problem.Message); err != nil {
+			return err
+		}
+	}
+
 	for _, message := range r.Errors {
 		if err := command(w, "error", "", message); err != nil {
 			return err
@@ -210,9 +309,18 @@ func (r *Report) writeGitHub(w io.Writer) error {
 // The file is given as a property so that the annotation appears against that
 // file in a pull request, which is the whole reason for this format.
 func command(w io.Writer, level, file, message string) error {
+	return lineCommand(w, level, file, 0, message)
+}
+
+// lineCommand is command for a message about one line of the file, which the
+// annotation is then shown against.
+func lineCommand(w io.Writer, level, file string, line int, message string) error {
 	var properties string
 	if file != "" {
 		properties = " file=" + escapeProperty(file)
+		if line > 0 {
+			properties += fmt.Sprintf(",line=%d", line)
+		}
 	}
 
 	_, err := fmt.Fprintf(w, "::%s%s::%s\n", level, properties, escapeMessage(message))
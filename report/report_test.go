@@ -101,3 +101,22 @@ func TestAPageIsReportedOnce(t *testing.T) {
 	require.Len(t, r.Pages, 1)
 	assert.Equal(t, "second", r.Pages[0].URL, "the later word is the true one")
 }
+
+func TestProblemsNameTheLine(t *testing.T) {
+	r := New()
+	r.AddPage(Page{File: "docs/a.md", Status: StatusInvalid})
+	r.AddProblem(Problem{File: "docs/a.md", Line: 7, Message: `include template "missing.md" not found`})
+
+	var url strings.Builder
+	require.NoError(t, r.Write(&url, FormatURL))
+	assert.Equal(t, "docs/a.md:7: include template \"missing.md\" not found\n", url.String())
+
+	var github strings.Builder
+	require.NoError(t, r.Write(&github, FormatGitHub))
+	assert.Equal(t, "::error file=docs/a.md,line=7::include template \"missing.md\" not found\n", github.String())
+
+	var json strings.Builder
+	require.NoError(t, r.Write(&json, FormatJSON))
+	assert.Contains(t, json.String(), `"line": 7`)
+	assert.Contains(t, json.String(), `"status": "invalid"`)
+}
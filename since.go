@@ -0,0 +1,117 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/kovetskiy/mark/v16/stdlib"
+)
+
+// changedDocuments picks out the documents --since asks for: those of files
+// that git says changed since the ref, or that are built from a file that did.
+//
+// What a document is built from is what a watch follows -- see dependencies --
+// so a change to a shared fragment, a macro template or an attachment brings
+// in every document using it, however deeply it is nested. Changed means
+// changed in the working tree, committed or not, so a run before committing
+// publishes what is about to be committed; a new file git does not know yet
+// counts as changed too.
+//
+// The result is never nil, so that a run with nothing changed publishes
+// nothing rather than everything.
+func changedDocuments(files []string, config Config, std *stdlib.Lib) ([]string, error) {
+	base, _ := doublestar.SplitPattern(filepath.ToSlash(config.Files))
+	if base == "" {
+		base = "."
+	}
+
+	changed, err := changedSince(filepath.FromSlash(base), config.Since)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := []string{}
+	for _, file := range files {
+		for _, dependency := range dependencies(file, config, std) {
+			if changed[realPath(dependency)] {
+				affected = append(affected, file)
+				break
+			}
+		}
+	}
+
+	return affected, nil
+}
+
+// realPath is the absolute path of a file with symbolic links resolved, which
+// is how git names it. A file that is not there -- an include that was
+// deleted -- is resolved by its directory.
+func realPath(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	} else if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		path = filepath.Join(dir, filepath.Base(path))
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+
+	return path
+}
+
+// changedSince lists, as absolute paths, the files of the repository dir is
+// in that differ from ref in the working tree, and the untracked files git
+// does not ignore.
+func changedSince(dir, ref string) (map[string]bool, error) {
+	if _, err := git(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+		return nil, fmt.Errorf("unable to use --since %q: it names no commit in the repository at %s", ref, dir)
+	}
+
+	top, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the git repository for --since: %w", err)
+	}
+	top = strings.TrimSpace(top)
+
+	diff, err := git(dir, "diff", "--name-only", "-z", ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list files changed since %s: %w", ref, err)
+	}
+
+	untracked, err := git(dir, "ls-files", "--others", "--exclude-standard", "--full-name", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list untracked files: %w", err)
+	}
+
+	changed := map[string]bool{}
+	for _, name := range strings.Split(diff+untracked, "\x00") {
+		if name != "" {
+			changed[filepath.Join(top, filepath.FromSlash(name))] = true
+		}
+	}
+
+	return changed, nil
+}
+
+// git runs a git command in dir and returns what it printed.
+func git(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return stdout.String(), nil
+}
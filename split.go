@@ -0,0 +1,345 @@
+package mark
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kovetskiy/mark/v16/includes"
+	"github.com/kovetskiy/mark/v16/metadata"
+	cparser "github.com/kovetskiy/mark/v16/parser"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// document is what one page is published from: a whole source file, or one
+// section of a file split with Split-On.
+type document struct {
+	// file is the source file, which includes, attachments and relative links
+	// are found from.
+	file string
+
+	// key is what the manifest and the run's report know the page by: the
+	// file for the page the file itself publishes to, and the file and the
+	// section's anchor, runbook.md#Install, for a section's page. A section
+	// is owned by its file that way -- a section that goes away is a tracked
+	// page whose source is gone, like a deleted file's.
+	key string
+
+	markdown   []byte
+	sourceHash string
+	meta       *metadata.Meta
+
+	// anchors are the headings on this document's page, by
+	// includes.HeadingKey, for telling which page an anchor link is to.
+	anchors []string
+}
+
+// owns reports whether a link to anchor arrives at a heading on this page.
+func (d document) owns(anchor string) bool {
+	return slices.Contains(d.anchors, includes.HeadingKey(anchor))
+}
+
+// htmlFile is the name a compile writes the document's HTML under: the file's
+// own, or for a section the file's with the section's anchor added, so that
+// runbook.md#Install is written beside runbook.html as runbook.Install.html.
+func (d document) htmlFile() string {
+	_, anchor, ok := strings.Cut(strings.TrimPrefix(d.key, d.file), "#")
+	if !ok {
+		return d.file
+	}
+
+	ext := filepath.Ext(d.file)
+
+	return strings.TrimSuffix(d.file, ext) + "." + anchor + ext
+}
+
+// splitDocument returns the pages a document is published as: itself, or,
+// when it is split with Split-On or --split-on, itself and then a child page
+// for each section at that heading level, in the order they are written.
+//
+// A section runs from its heading to the next heading at the same level or
+// above. Its page is titled by the heading, which is left off the body since
+// the title already says it, and ordered among its siblings as it was in the
+// document. Whatever is not in a section -- the introduction, and anything
+// under a heading above the level split at -- stays on the parent page, which
+// is the page the document publishes to when it is not split.
+//
+// It is the document as written that is split, not as it is compiled: a
+// heading brought in by an include or a macro is part of whichever section it
+// lands in.
+func splitDocument(file string, markdown []byte, sourceHash string, meta *metadata.Meta, config Config) ([]document, error) {
+	whole := document{file: file, key: file, markdown: markdown, sourceHash: sourceHash, meta: meta}
+	if meta == nil {
+		return []document{whole}, nil
+	}
+
+	value := meta.SplitOn
+	if value == "" {
+		value = config.SplitOn
+	}
+
+	level, err := metadata.SplitLevel(value)
+	if err != nil {
+		return nil, err
+	}
+	if level == 0 {
+		return []document{whole}, nil
+	}
+
+	// A heading the document is titled by is its title, not a section of it,
+	// as the H1 --title-from-h1 reads is when splitting at h1.
+	sections := slices.DeleteFunc(findSections(markdown, level), func(s section) bool {
+		return s.title == meta.Title
+	})
+	if len(sections) == 0 {
+		return []document{whole}, nil
+	}
+
+	if meta.Type == "blogpost" {
+		return nil, fmt.Errorf("a blog post cannot have child pages, so it cannot be split; remove %s", metadata.HeaderSplitOn)
+	}
+
+	var rest bytes.Buffer
+	last := 0
+	for _, section := range sections {
+		rest.Write(markdown[last:section.start])
+		last = section.stop
+	}
+	rest.Write(markdown[last:])
+
+	parentMeta := *meta
+	parent := document{
+		file: file, key: file,
+		markdown:   rest.Bytes(),
+		sourceHash: sourceHash,
+		meta:       &parentMeta,
+		anchors:    headingKeys(rest.Bytes()),
+	}
+
+	documents := []document{parent}
+	ids := cparser.NewConfluenceIDs()
+	titles := map[string]bool{meta.Title: true}
+	claimed := map[string]bool{}
+	for i, section := range sections {
+		if titles[section.title] {
+			return nil, fmt.Errorf(
+				"%s splits into two pages titled %q; titles are unique in a space, so its headings have to be too",
+				file, section.title,
+			)
+		}
+		titles[section.title] = true
+
+		body := markdown[section.body:section.stop]
+
+		child := *meta
+		child.Title = section.title
+		child.Parents = append(slices.Clone(meta.Parents), meta.Title)
+		child.Labels = slices.Clone(meta.Labels)
+		child.Properties = maps.Clone(meta.Properties)
+		child.Attachments = mentioned(meta.Attachments, body)
+		child.SplitOn = ""
+
+		order := i + 1
+		child.Order = &order
+
+		for _, name := range child.Attachments {
+			claimed[name] = true
+		}
+
+		documents = append(documents, document{
+			file: file,
+			key:  file + "#" + string(ids.Generate([]byte(section.title), ast.KindHeading)),
+			// The body alone, without the heading: retitling a section is
+			// then followed like renaming a file, rather than read as one
+			// section going and another arriving.
+			markdown:   body,
+			sourceHash: sha1Hash(string(body)),
+			meta:       &child,
+			anchors:    append([]string{includes.HeadingKey(section.title)}, headingKeys(body)...),
+		})
+	}
+
+	// An attachment no section mentions is the parent's, along with those
+	// its own text does: one declared only to be attached has to be attached
+	// somewhere.
+	parentMeta.Attachments = nil
+	for _, name := range meta.Attachments {
+		if !claimed[name] || bytes.Contains(parent.markdown, []byte(name)) {
+			parentMeta.Attachments = append(parentMeta.Attachments, name)
+		}
+	}
+
+	return documents, nil
+}
+
+// section is where one section is in a document: the heading starts at start,
+// what follows it at body, and the section ends at stop.
+type section struct {
+	title             string
+	start, body, stop int
+}
+
+// findSections finds the sections of a document at a heading level.
+func findSections(markdown []byte, level int) []section {
+	doc := goldmark.New().Parser().Parse(text.NewReader(markdown))
+
+	var sections []section
+	closeSection := func(stop int) {
+		if n := len(sections); n > 0 && sections[n-1].stop < 0 {
+			sections[n-1].stop = stop
+		}
+	}
+
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		heading, ok := child.(*ast.Heading)
+		if !ok || heading.Level > level || heading.Lines().Len() == 0 {
+			continue
+		}
+
+		start := lineStart(markdown, heading.Lines().At(0).Start)
+		closeSection(start)
+
+		if heading.Level < level {
+			continue
+		}
+
+		//nolint:staticcheck // The heading's words without their markup.
+		title := strings.TrimSpace(string(heading.Text(markdown)))
+		if title == "" {
+			continue
+		}
+
+		sections = append(sections, section{
+			title: title,
+			start: start,
+			body:  headingEnd(markdown, heading),
+			stop:  -1,
+		})
+	}
+	closeSection(len(markdown))
+
+	return sections
+}
+
+// headingEnd returns where the line after a heading starts, past the underline
+// of one written in the setext style.
+func headingEnd(markdown []byte, heading *ast.Heading) int {
+	lines := heading.Lines()
+	// From the last character of the text rather than just past it: a setext
+	// heading's lines are a paragraph's, and carry their newline.
+	last := lines.At(lines.Len() - 1)
+	end := nextLine(markdown, max(last.Stop-1, last.Start))
+
+	atx := strings.HasPrefix(strings.TrimLeft(string(markdown[lineStart(markdown, lines.At(0).Start):]), " "), "#")
+	if !atx {
+		end = nextLine(markdown, end)
+	}
+
+	return end
+}
+
+// lineStart returns the offset of the start of the line offset is on.
+func lineStart(source []byte, offset int) int {
+	return bytes.LastIndexByte(source[:offset], '\n') + 1
+}
+
+// nextLine returns the offset of the start of the line after the one offset
+// is on, or the end of the source.
+func nextLine(source []byte, offset int) int {
+	if offset >= len(source) {
+		return len(source)
+	}
+
+	if i := bytes.IndexByte(source[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+
+	return len(source)
+}
+
+// headingKeys returns the headings of a document by includes.HeadingKey.
+func headingKeys(markdown []byte) []string {
+	doc := goldmark.New().Parser().Parse(text.NewReader(markdown))
+
+	var keys []string
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := node.(*ast.Heading); ok && entering {
+			//nolint:staticcheck // The heading's words without their markup.
+			keys = append(keys, includes.HeadingKey(string(heading.Text(markdown))))
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return keys
+}
+
+// mentioned returns the attachments a piece of a document refers to.
+func mentioned(attachments []string, markdown []byte) []string {
+	var names []string
+	for _, name := range attachments {
+		if bytes.Contains(markdown, []byte(name)) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// sectionLinks resolves links for one page of a split document. A link to an
+// anchor that is not on the page but on another page of the document was a
+// link within one page when it was written, and is now a link to another: it
+// is resolved as the link to the document's file and the anchor it is, which
+// the resolver follows to the section's page.
+func sectionLinks(doc document, documents []document, resolve func(target, text string) (string, error)) func(target, text string) (string, error) {
+	if len(documents) < 2 {
+		return resolve
+	}
+
+	return func(target, text string) (string, error) {
+		anchor, ok := strings.CutPrefix(target, "#")
+		if !ok || anchor == "" || doc.owns(anchor) {
+			return resolve(target, text)
+		}
+
+		for _, other := range documents {
+			if other.owns(anchor) {
+				return resolve(filepath.Base(doc.file)+target, text)
+			}
+		}
+
+		return resolve(target, text)
+	}
+}
+
+// documentKeys returns what the manifest knows a run's documents by: each file,
+// and each section of a file split into pages.
+//
+// The manifest has to be told before anything is published. A recorded key
+// absent from the run is how a renamed file is recognised, and a section of a
+// file still in the run must not be mistaken for one.
+func documentKeys(files []string, config Config) []string {
+	keys := slices.Clone(files)
+	for _, file := range files {
+		markdown, sourceHash, meta, err := readDocument(file, config)
+		if err != nil || config.PageID != "" {
+			continue
+		}
+
+		documents, err := splitDocument(file, markdown, sourceHash, meta, config)
+		if err != nil {
+			continue
+		}
+
+		for _, doc := range documents[1:] {
+			keys = append(keys, doc.key)
+		}
+	}
+
+	return keys
+}
@@ -7,6 +7,7 @@ import (
 	"text/template"
 
 	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/datafile"
 	"github.com/rs/zerolog/log"
 )
 
@@ -28,6 +29,18 @@ func New(api *confluence.API) (*Lib, error) {
 	return &lib, nil
 }
 
+// Clone returns a copy of the library that can be added to without touching
+// this one. Compiling a document adds the templates it includes to the library
+// it is compiled with, so documents compiled at the same time need one each.
+func (lib *Lib) Clone() (*Lib, error) {
+	templates, err := lib.Templates.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("unable to copy the standard library: %w", err)
+	}
+
+	return &Lib{Templates: templates}, nil
+}
+
 func templates(api *confluence.API) (*template.Template, error) {
 	text := func(line ...string) string {
 		return strings.Join(line, ``)
@@ -73,6 +86,10 @@ func templates(api *confluence.API) (*template.Template, error) {
 				return html.EscapeString(s)
 			},
 		},
+	).Funcs(
+		// Relative to the working directory until a document is compiled,
+		// which reads them from its own.
+		datafile.Funcs(""),
 	)
 
 	var err error
@@ -468,6 +485,46 @@ func templates(api *confluence.API) (*template.Template, error) {
 			`</ac:structured-macro>`,
 		),
 
+		// The macro a Mermaid diagram is published as with --mermaid-mode
+		// macro. Mermaid apps for Confluence name their macros differently,
+		// and --mermaid-macro-template names a template written for another.
+		`ac:mermaid`: text(
+			`<ac:structured-macro ac:name="mermaid">`,
+			/**/ `{{ with .Title }}<ac:parameter ac:name="title">{{ . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `<ac:plain-text-body><![CDATA[{{ .Text | cdata }}]]></ac:plain-text-body>`,
+			`</ac:structured-macro>`,
+		),
+
+		/* https://confluence.atlassian.com/doc/chart-macro-136478.html */
+		// Body is the table the chart is drawn from: a Markdown table when
+		// included, which is compiled with the page, or one already in the
+		// storage format.
+		`ac:chart`: text(
+			`<ac:structured-macro ac:name="chart">`,
+			/**/ `{{ with .Type }}<ac:parameter ac:name="type">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .Title }}<ac:parameter ac:name="title">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .SubTitle }}<ac:parameter ac:name="subTitle">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .XLabel }}<ac:parameter ac:name="xLabel">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .YLabel }}<ac:parameter ac:name="yLabel">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .Width }}<ac:parameter ac:name="width">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .Height }}<ac:parameter ac:name="height">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .Orientation }}<ac:parameter ac:name="orientation">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .DataOrientation }}<ac:parameter ac:name="dataOrientation">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .Stacked }}<ac:parameter ac:name="stacked">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .ThreeD }}<ac:parameter ac:name="3D">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .ShowShapes }}<ac:parameter ac:name="showShapes">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .Opacity }}<ac:parameter ac:name="opacity">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .Legend }}<ac:parameter ac:name="legend">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .Colors }}<ac:parameter ac:name="colors">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .TimeSeries }}<ac:parameter ac:name="timeSeries">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .DateFormat }}<ac:parameter ac:name="dateFormat">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .TimePeriod }}<ac:parameter ac:name="timePeriod">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .RangeAxisLowerBound }}<ac:parameter ac:name="rangeAxisLowerBound">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			/**/ `{{ with .RangeAxisUpperBound }}<ac:parameter ac:name="rangeAxisUpperBound">{{ print . | xmlesc }}</ac:parameter>{{ end }}`,
+			"<ac:rich-text-body>\n\n{{ .Body }}\n\n</ac:rich-text-body>",
+			`</ac:structured-macro>`,
+		),
+
 		// TODO(seletskiy): more templates here
 	} {
 		templates, err = templates.New(name).Parse(body)
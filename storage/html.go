@@ -0,0 +1,508 @@
+package storage
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// HTMLLinks says where the things a page refers to by name are to be found
+// when it is shown outside Confluence.
+type HTMLLinks struct {
+	// Attachment is the URL of the page's attachment with the given file name.
+	Attachment func(filename string) string
+
+	// Page is the URL of the page with the given title, in the given space or,
+	// when space is empty, in the page's own. "" leaves the link going nowhere.
+	Page func(space, title string) string
+}
+
+// ToHTML renders a storage body as HTML a browser can show, the way Confluence
+// would show the page.
+//
+// It is a stand-in, not a reimplementation: the macros mark's templates and
+// renderers produce are drawn as something that looks and reads like them --
+// panels as boxes, an expand as a <details>, a table of contents built from
+// the headings -- and any other macro as a labelled box with its body, if it
+// has one, so that nothing written in the page goes missing from the preview.
+// Ordinary HTML elements are kept as they are.
+func ToHTML(body string, links HTMLLinks) (string, error) {
+	root, err := Parse(body)
+	if err != nil {
+		return "", err
+	}
+
+	h := &htmlWriter{links: links, ids: map[string]bool{}}
+	h.collectHeadings(root)
+
+	var b strings.Builder
+	h.nodes(&b, root.Children)
+
+	return b.String(), nil
+}
+
+// heading is an entry of a table of contents.
+type heading struct {
+	level int
+	id    string
+	text  string
+}
+
+type htmlWriter struct {
+	links    HTMLLinks
+	headings []heading
+	ids      map[string]bool
+
+	// next is the heading about to be written, so that it is given the id the
+	// table of contents already links it by.
+	next int
+}
+
+// collectHeadings gives every heading an id up front: a table of contents can
+// come before the headings it lists.
+func (h *htmlWriter) collectHeadings(node *Node) {
+	for _, child := range node.Children {
+		if level := headingLevel(child.Name); level > 0 {
+			text := strings.TrimSpace(child.TextContent())
+
+			id := child.Attr("id")
+			if id == "" {
+				id = h.uniqueID(anchorID(text))
+			}
+			h.ids[id] = true
+
+			h.headings = append(h.headings, heading{level: level, id: id, text: text})
+			continue
+		}
+
+		h.collectHeadings(child)
+	}
+}
+
+func (h *htmlWriter) uniqueID(id string) string {
+	if id == "" {
+		id = "section"
+	}
+
+	unique := id
+	for i := 1; h.ids[unique]; i++ {
+		unique = id + "-" + strconv.Itoa(i)
+	}
+
+	return unique
+}
+
+// anchorID is the id a heading gets when it has none: its words joined by
+// dashes.
+func anchorID(text string) string {
+	return strings.Join(strings.Fields(text), "-")
+}
+
+func headingLevel(name string) int {
+	if len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6' {
+		return int(name[1] - '0')
+	}
+
+	return 0
+}
+
+// htmlVoid are the elements HTML writes with no closing tag.
+var htmlVoid = map[string]bool{"br": true, "hr": true, "img": true, "col": true}
+
+func (h *htmlWriter) nodes(b *strings.Builder, nodes []*Node) {
+	for _, node := range nodes {
+		h.node(b, node)
+	}
+}
+
+func (h *htmlWriter) node(b *strings.Builder, node *Node) {
+	switch node.Name {
+	case "":
+		b.WriteString(html.EscapeString(node.Text))
+
+	case "ac:structured-macro", "ac:macro":
+		h.macro(b, node)
+
+	case "ac:image":
+		h.image(b, node)
+
+	case "ac:link":
+		h.link(b, node)
+
+	case "ac:emoticon":
+		h.emoticon(b, node)
+
+	case "ac:task-list":
+		h.taskList(b, node)
+
+	case "ac:layout":
+		h.wrap(b, `<div class="layout">`, node.Children, `</div>`)
+
+	case "ac:layout-section":
+		h.wrap(b, `<div class="layout-section layout-`+html.EscapeString(node.Attr("ac:type"))+`">`, node.Children, `</div>`)
+
+	case "ac:layout-cell":
+		h.wrap(b, `<div class="layout-cell">`, node.Children, `</div>`)
+
+	case "ac:plain-text-body":
+		b.WriteString(html.EscapeString(node.TextContent()))
+
+	case "ac:parameter", "ac:placeholder":
+		// Settings of the macro around them, read by the macro; nothing of
+		// them is shown on the page.
+
+	default:
+		switch {
+		case strings.HasPrefix(node.Name, "ri:"):
+			// A reference, read by the element that holds it.
+
+		case strings.HasPrefix(node.Name, "ac:"):
+			// An element of the storage format with no look of its own, such
+			// as a rich text body.
+			h.nodes(b, node.Children)
+
+		default:
+			h.element(b, node)
+		}
+	}
+}
+
+func (h *htmlWriter) wrap(b *strings.Builder, open string, children []*Node, closing string) {
+	b.WriteString(open)
+	h.nodes(b, children)
+	b.WriteString(closing)
+}
+
+// element writes an ordinary HTML element. A heading gets the id the table of
+// contents was built with.
+func (h *htmlWriter) element(b *strings.Builder, node *Node) {
+	b.WriteString("<" + node.Name)
+
+	if headingLevel(node.Name) > 0 && h.next < len(h.headings) {
+		if node.Attr("id") == "" {
+			b.WriteString(` id="` + html.EscapeString(h.headings[h.next].id) + `"`)
+		}
+		h.next++
+	}
+
+	for _, attr := range node.Attrs {
+		b.WriteString(" " + qualified(attr.Name) + `="` + html.EscapeString(attr.Value) + `"`)
+	}
+	b.WriteString(">")
+
+	if htmlVoid[node.Name] {
+		return
+	}
+
+	h.nodes(b, node.Children)
+	b.WriteString("</" + node.Name + ">")
+}
+
+// boxes are the macros drawn as a box in a colour of their own. The name is
+// the class the box is drawn with.
+var boxes = map[string]bool{"info": true, "tip": true, "note": true, "warning": true, "panel": true}
+
+func (h *htmlWriter) macro(b *strings.Builder, node *Node) {
+	name := node.Attr("ac:name")
+	params := parameters(node)
+	body := node.Child("ac:rich-text-body")
+
+	switch {
+	case boxes[name]:
+		b.WriteString(`<div class="panel panel-` + name + `">`)
+		if params["title"] != "" {
+			b.WriteString(`<p class="panel-title">` + html.EscapeString(params["title"]) + `</p>`)
+		}
+		if body != nil {
+			h.nodes(b, body.Children)
+		}
+		b.WriteString(`</div>`)
+
+	case name == "code" || name == "noformat" || name == "plantuml":
+		h.code(b, node, params)
+
+	case name == "expand":
+		title := params["title"]
+		if title == "" {
+			title = "Click here to expand..."
+		}
+		b.WriteString(`<details class="expand"><summary>` + html.EscapeString(title) + `</summary>`)
+		if body != nil {
+			h.nodes(b, body.Children)
+		}
+		b.WriteString(`</details>`)
+
+	case name == "status":
+		title := params["title"]
+		if title == "" {
+			title = params["colour"]
+		}
+		class := "status status-" + strings.ToLower(params["colour"])
+		if params["subtle"] == "true" {
+			class += " status-subtle"
+		}
+		b.WriteString(`<span class="` + html.EscapeString(class) + `">` + html.EscapeString(strings.ToUpper(title)) + `</span>`)
+
+	case name == "toc":
+		h.toc(b, params)
+
+	case name == "anchor":
+		b.WriteString(`<a id="` + html.EscapeString(params[""]) + `"></a>`)
+
+	case name == "column":
+		style := ""
+		if params["width"] != "" {
+			style = ` style="width: ` + html.EscapeString(params["width"]) + `"`
+		}
+		b.WriteString(`<div class="column"` + style + `>`)
+		if body != nil {
+			h.nodes(b, body.Children)
+		}
+		b.WriteString(`</div>`)
+
+	case (name == "details" || name == "excerpt") && body != nil:
+		h.nodes(b, body.Children)
+
+	case name == "multimedia" || name == "view-file":
+		if file := attachmentParameter(node); file != "" {
+			b.WriteString(`<p class="macro"><a href="` + html.EscapeString(h.attachment(file)) + `">` + html.EscapeString(file) + `</a></p>`)
+			return
+		}
+		h.placeholder(b, name, body)
+
+	case name == "jira":
+		label := "Jira"
+		if params["key"] != "" {
+			label += " " + params["key"]
+		}
+		b.WriteString(`<span class="macro">` + html.EscapeString(label) + `</span>`)
+
+	default:
+		h.placeholder(b, name, body)
+	}
+}
+
+// placeholder stands in for a macro only Confluence can show: the children of
+// a page, a Jira query, a blog post list. Its body, if it has one, is shown.
+func (h *htmlWriter) placeholder(b *strings.Builder, name string, body *Node) {
+	b.WriteString(`<div class="macro"><p class="macro-name">` + html.EscapeString(name) + ` macro</p>`)
+	if body != nil {
+		h.nodes(b, body.Children)
+	}
+	b.WriteString(`</div>`)
+}
+
+func (h *htmlWriter) code(b *strings.Builder, node *Node, params map[string]string) {
+	text := ""
+	if body := node.Child("ac:plain-text-body"); body != nil {
+		text = body.TextContent()
+	}
+
+	language := params["language"]
+	if node.Attr("ac:name") == "plantuml" {
+		language = "plantuml"
+	}
+
+	collapse := params["collapse"] == "true"
+	if collapse {
+		summary := params["title"]
+		if summary == "" {
+			summary = "Expand source"
+		}
+		b.WriteString(`<details class="code-collapse"><summary>` + html.EscapeString(summary) + `</summary>`)
+	} else if params["title"] != "" {
+		b.WriteString(`<p class="code-title">` + html.EscapeString(params["title"]) + `</p>`)
+	}
+
+	class := ""
+	if language != "" {
+		class = ` class="language-` + html.EscapeString(language) + `"`
+	}
+	b.WriteString(`<pre class="code"><code` + class + `>` + html.EscapeString(text) + `</code></pre>`)
+
+	if collapse {
+		b.WriteString(`</details>`)
+	}
+}
+
+// toc lists the page's headings between minLevel and maxLevel, indented by
+// level.
+func (h *htmlWriter) toc(b *strings.Builder, params map[string]string) {
+	minLevel, err := strconv.Atoi(params["minLevel"])
+	if err != nil {
+		minLevel = 1
+	}
+	maxLevel, err := strconv.Atoi(params["maxLevel"])
+	if err != nil {
+		maxLevel = 7
+	}
+
+	b.WriteString(`<nav class="toc"><ul>`)
+	for _, entry := range h.headings {
+		if entry.level < minLevel || entry.level > maxLevel {
+			continue
+		}
+		fmt.Fprintf(b, `<li class="toc-level-%d"><a href="#%s">%s</a></li>`,
+			entry.level-minLevel, html.EscapeString(entry.id), html.EscapeString(entry.text))
+	}
+	b.WriteString(`</ul></nav>`)
+}
+
+func (h *htmlWriter) image(b *strings.Builder, node *Node) {
+	src := ""
+	if file := node.Child("ri:attachment"); file != nil {
+		src = h.attachment(file.Attr("ri:filename"))
+	} else if url := node.Child("ri:url"); url != nil {
+		src = url.Attr("ri:value")
+	}
+
+	b.WriteString(`<img src="` + html.EscapeString(src) + `"`)
+	if alt := node.Attr("ac:alt"); alt != "" {
+		b.WriteString(` alt="` + html.EscapeString(alt) + `"`)
+	}
+	if title := node.Attr("ac:title"); title != "" {
+		b.WriteString(` title="` + html.EscapeString(title) + `"`)
+	}
+	if width := node.Attr("ac:width"); width != "" {
+		b.WriteString(` width="` + html.EscapeString(width) + `"`)
+	}
+	if height := node.Attr("ac:height"); height != "" {
+		b.WriteString(` height="` + html.EscapeString(height) + `"`)
+	}
+	if align := node.Attr("ac:align"); align != "" {
+		b.WriteString(` class="align-` + html.EscapeString(align) + `"`)
+	}
+	b.WriteString(`>`)
+}
+
+func (h *htmlWriter) link(b *strings.Builder, node *Node) {
+	if user := node.Child("ri:user"); user != nil {
+		name := user.Attr("ri:username")
+		if name == "" {
+			name = "user"
+		}
+		b.WriteString(`<span class="mention">@` + html.EscapeString(name) + `</span>`)
+		return
+	}
+
+	href := ""
+	text := ""
+
+	switch {
+	case node.Child("ri:page") != nil:
+		target := node.Child("ri:page")
+		text = target.Attr("ri:content-title")
+		if h.links.Page != nil {
+			href = h.links.Page(target.Attr("ri:space-key"), text)
+		}
+
+	case node.Child("ri:attachment") != nil:
+		text = node.Child("ri:attachment").Attr("ri:filename")
+		href = h.attachment(text)
+	}
+
+	if anchor := node.Attr("ac:anchor"); anchor != "" {
+		href += "#" + anchor
+		if text == "" {
+			text = anchor
+		}
+	}
+
+	b.WriteString(`<a href="` + html.EscapeString(href) + `">`)
+	switch {
+	case node.Child("ac:link-body") != nil:
+		h.nodes(b, node.Child("ac:link-body").Children)
+	case node.Child("ac:plain-text-link-body") != nil:
+		b.WriteString(html.EscapeString(node.Child("ac:plain-text-link-body").TextContent()))
+	default:
+		b.WriteString(html.EscapeString(text))
+	}
+	b.WriteString(`</a>`)
+}
+
+func (h *htmlWriter) attachment(filename string) string {
+	if h.links.Attachment == nil {
+		return filename
+	}
+
+	return h.links.Attachment(filename)
+}
+
+// attachmentParameter is the file a macro such as view-file shows.
+func attachmentParameter(node *Node) string {
+	for _, child := range node.Children {
+		if child.Name != "ac:parameter" {
+			continue
+		}
+		if file := child.Child("ri:attachment"); file != nil {
+			return file.Attr("ri:filename")
+		}
+	}
+
+	return ""
+}
+
+// emoticons are the emoticons Confluence knows by name, drawn as the emoji
+// closest to each.
+var emoticons = map[string]string{
+	"smile":        "🙂",
+	"sad":          "🙁",
+	"cheeky":       "😛",
+	"laugh":        "😀",
+	"wink":         "😉",
+	"thumbs-up":    "👍",
+	"thumbs-down":  "👎",
+	"information":  "ℹ️",
+	"tick":         "✅",
+	"cross":        "❌",
+	"warning":      "⚠️",
+	"plus":         "➕",
+	"minus":        "➖",
+	"question":     "❓",
+	"light-on":     "💡",
+	"light-off":    "🌑",
+	"yellow-star":  "⭐",
+	"red-star":     "⭐",
+	"green-star":   "⭐",
+	"blue-star":    "⭐",
+	"heart":        "❤️",
+	"broken-heart": "💔",
+}
+
+func (h *htmlWriter) emoticon(b *strings.Builder, node *Node) {
+	if fallback := node.Attr("ac:emoji-fallback"); fallback != "" {
+		b.WriteString(html.EscapeString(fallback))
+		return
+	}
+
+	name := node.Attr("ac:name")
+	if emoji, ok := emoticons[name]; ok {
+		b.WriteString(emoji)
+		return
+	}
+
+	b.WriteString(html.EscapeString(":" + name + ":"))
+}
+
+func (h *htmlWriter) taskList(b *strings.Builder, node *Node) {
+	b.WriteString(`<ul class="tasks">`)
+	for _, task := range node.Children {
+		if task.Name != "ac:task" {
+			continue
+		}
+
+		checked := ""
+		if status := task.Child("ac:task-status"); status != nil &&
+			strings.TrimSpace(status.TextContent()) == "complete" {
+			checked = " checked"
+		}
+
+		b.WriteString(`<li><input type="checkbox" disabled` + checked + `> `)
+		if body := task.Child("ac:task-body"); body != nil {
+			h.nodes(b, body.Children)
+		}
+		b.WriteString(`</li>`)
+	}
+	b.WriteString(`</ul>`)
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToHTMLDrawsMacros(t *testing.T) {
+	body := `<ac:structured-macro ac:name="toc"><ac:parameter ac:name="minLevel">2</ac:parameter></ac:structured-macro>` +
+		`<h2>Getting started</h2>` +
+		`<ac:structured-macro ac:name="info"><ac:parameter ac:name="icon">false</ac:parameter>` +
+		`<ac:rich-text-body><p>Read <strong>this</strong>.</p></ac:rich-text-body></ac:structured-macro>` +
+		`<ac:structured-macro ac:name="code"><ac:parameter ac:name="language">go</ac:parameter>` +
+		`<ac:parameter ac:name="title">main.go</ac:parameter>` +
+		`<ac:plain-text-body><![CDATA[if a < b {}]]></ac:plain-text-body></ac:structured-macro>` +
+		`<ac:structured-macro ac:name="expand"><ac:parameter ac:name="title">More</ac:parameter>` +
+		`<ac:rich-text-body><p>Hidden.</p></ac:rich-text-body></ac:structured-macro>` +
+		`<p><ac:structured-macro ac:name="status"><ac:parameter ac:name="colour">Green</ac:parameter>` +
+		`<ac:parameter ac:name="title">done</ac:parameter></ac:structured-macro></p>` +
+		`<h2>Getting started</h2>` +
+		`<ac:structured-macro ac:name="children"></ac:structured-macro>`
+
+	html, err := ToHTML(body, HTMLLinks{})
+	require.NoError(t, err)
+
+	assert.Contains(t, html, `<nav class="toc"><ul>`+
+		`<li class="toc-level-0"><a href="#Getting-started">Getting started</a></li>`+
+		`<li class="toc-level-0"><a href="#Getting-started-1">Getting started</a></li></ul></nav>`)
+	assert.Contains(t, html, `<h2 id="Getting-started">Getting started</h2>`)
+	assert.Contains(t, html, `<h2 id="Getting-started-1">Getting started</h2>`)
+	assert.Contains(t, html, `<div class="panel panel-info"><p>Read <strong>this</strong>.</p></div>`)
+	assert.Contains(t, html, `<p class="code-title">main.go</p><pre class="code"><code class="language-go">if a &lt; b {}</code></pre>`)
+	assert.Contains(t, html, `<details class="expand"><summary>More</summary><p>Hidden.</p></details>`)
+	assert.Contains(t, html, `<span class="status status-green">DONE</span>`)
+	assert.Contains(t, html, `<div class="macro"><p class="macro-name">children macro</p></div>`)
+	assert.NotContains(t, html, "ac:")
+}
+
+func TestToHTMLResolvesImagesAndLinks(t *testing.T) {
+	body := `<ac:layout><ac:layout-section ac:type="two_equal">` +
+		`<ac:layout-cell><ac:image ac:alt="Diagram" ac:width="300"><ri:attachment ri:filename="img_diagram.png"/></ac:image></ac:layout-cell>` +
+		`<ac:layout-cell><p><ac:link><ri:page ri:content-title="Other Page"/><ac:plain-text-link-body><![CDATA[the other page]]></ac:plain-text-link-body></ac:link>` +
+		` and <ac:link ac:anchor="Setup"><ri:page ri:content-title="Unknown"/></ac:link></p></ac:layout-cell>` +
+		`</ac:layout-section></ac:layout>` +
+		`<ac:task-list><ac:task><ac:task-status>complete</ac:task-status><ac:task-body>Ship it</ac:task-body></ac:task></ac:task-list>`
+
+	html, err := ToHTML(body, HTMLLinks{
+		Attachment: func(filename string) string { return "/files/" + filename },
+		Page: func(space, title string) string {
+			if title == "Other Page" {
+				return "/other"
+			}
+			return ""
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, html, `<div class="layout"><div class="layout-section layout-two_equal"><div class="layout-cell">`+
+		`<img src="/files/img_diagram.png" alt="Diagram" width="300"></div>`)
+	assert.Contains(t, html, `<a href="/other">the other page</a>`)
+	assert.Contains(t, html, `<a href="#Setup">Unknown</a>`)
+	assert.Contains(t, html, `<ul class="tasks"><li><input type="checkbox" disabled checked> Ship it</li></ul>`)
+}
@@ -0,0 +1,767 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Document is a page body converted to Markdown.
+type Document struct {
+	Markdown string
+
+	// Attachments are the filenames the body refers to through ri:attachment,
+	// in the order they first appear, so that they can be declared in headers
+	// and downloaded next to the file.
+	Attachments []string
+}
+
+// ToMarkdown converts a storage body into Markdown mark can publish.
+//
+// space is the key of the space the page lives in. A link to a page in another
+// space has no Markdown form, because [text](ac:Title) always resolves in the
+// page's own space, and is kept as raw storage instead.
+func ToMarkdown(body, space string) (*Document, error) {
+	root, err := Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &converter{space: space, seen: map[string]bool{}}
+	markdown := strings.Join(c.blocks(root.Children), "\n\n")
+
+	doc := &Document{Attachments: c.attachments}
+	if markdown != "" {
+		doc.Markdown = markdown + "\n"
+	}
+
+	return doc, nil
+}
+
+type converter struct {
+	space       string
+	attachments []string
+	seen        map[string]bool
+
+	// inTable is set while a GFM table cell is rendered, where a line break
+	// cannot be written as one and a pipe has to be escaped.
+	inTable bool
+}
+
+func (c *converter) attach(filename string) {
+	if filename == "" || c.seen[filename] {
+		return
+	}
+	c.seen[filename] = true
+	c.attachments = append(c.attachments, filename)
+}
+
+// blocks converts a list of sibling nodes into Markdown blocks, gathering runs
+// of inline content into paragraphs. Confluence is loose about this: text sits
+// directly in a table cell, a list item or a macro body as often as it sits in
+// a <p>.
+func (c *converter) blocks(nodes []*Node) []string {
+	var (
+		out    []string
+		inline []*Node
+	)
+
+	flush := func() {
+		if text := strings.TrimSpace(c.inlines(inline)); text != "" {
+			out = append(out, escapeLeading(text))
+		}
+		inline = nil
+	}
+
+	for _, node := range nodes {
+		block, ok := c.block(node)
+		if !ok {
+			inline = append(inline, node)
+			continue
+		}
+		flush()
+		if block != "" {
+			out = append(out, block)
+		}
+	}
+	flush()
+
+	return out
+}
+
+// block converts a node that stands as a block of its own. ok is false for
+// inline content, which the caller folds into the surrounding paragraph.
+func (c *converter) block(node *Node) (markdown string, ok bool) {
+	switch node.Name {
+	case "p":
+		return strings.Join(c.blocks(node.Children), "\n\n"), true
+
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(node.Name[1] - '0')
+		text := strings.TrimSpace(c.inlines(node.Children))
+		if text == "" {
+			return "", true
+		}
+		return strings.Repeat("#", level) + " " + strings.ReplaceAll(text, "\\\n", " "), true
+
+	case "ul", "ol":
+		return c.list(node), true
+
+	case "ac:task-list":
+		return c.taskList(node), true
+
+	case "blockquote":
+		return quote(strings.Join(c.blocks(node.Children), "\n\n")), true
+
+	case "pre":
+		return fence("", node.TextContent()), true
+
+	case "hr":
+		return "---", true
+
+	case "table":
+		return c.table(node), true
+
+	case "div", "section", "ac:rich-text-body", "ac:layout-cell":
+		return strings.Join(c.blocks(node.Children), "\n\n"), true
+
+	case "ac:layout":
+		return c.layout(node), true
+
+	case "ac:structured-macro":
+		return c.macro(node)
+
+	case "details", "dl", "ac:layout-section", "ac:placeholder":
+		return c.raw(node), true
+	}
+
+	return "", false
+}
+
+// inlines converts a run of inline nodes into the text of one paragraph.
+func (c *converter) inlines(nodes []*Node) string {
+	var b strings.Builder
+	for _, node := range nodes {
+		b.WriteString(c.inline(node))
+	}
+
+	// A line break written at the end of a run is not a line break.
+	return strings.TrimSuffix(strings.TrimRight(b.String(), " "), "\\\n")
+}
+
+var reSpace = regexp.MustCompile(`\s+`)
+
+func (c *converter) inline(node *Node) string {
+	switch node.Name {
+	case "":
+		return c.escape(reSpace.ReplaceAllString(node.Text, " "))
+
+	case "strong", "b":
+		return wrap("**", c.inlines(node.Children))
+
+	case "em", "i":
+		return wrap("*", c.inlines(node.Children))
+
+	case "del", "s":
+		return wrap("~~", c.inlines(node.Children))
+
+	case "code":
+		return codeSpan(node.TextContent())
+
+	case "br":
+		if c.inTable {
+			return "<br/>"
+		}
+		return "\\\n"
+
+	case "a":
+		href := node.Attr("href")
+		text := strings.TrimSpace(c.inlines(node.Children))
+		if href == "" {
+			return text
+		}
+		if text == "" {
+			text = c.escape(href)
+		}
+		return "[" + text + "](" + destination(href) + ")"
+
+	case "img":
+		return "![" + c.escape(node.Attr("alt")) + "](" + destination(node.Attr("src")) + ")"
+
+	case "u", "sup", "sub":
+		inner := c.inlines(node.Children)
+		if inner == "" {
+			return ""
+		}
+		return "<" + node.Name + ">" + inner + "</" + node.Name + ">"
+
+	case "span", "font", "ac:inline-comment-marker":
+		return c.inlines(node.Children)
+
+	case "ac:link":
+		return c.link(node)
+
+	case "ac:image":
+		return c.image(node)
+
+	case "ac:structured-macro":
+		markdown, _ := c.macro(node)
+		return markdown
+	}
+
+	// Anything else, including a block element met inside a paragraph, which
+	// Markdown cannot express without splitting the paragraph.
+	return c.raw(node)
+}
+
+// link reverses <ac:link>. A link to a page in the same space becomes the
+// ac:Title form the link renderer reads; a link to an attachment becomes a
+// relative link to the downloaded file.
+func (c *converter) link(node *Node) string {
+	text := ""
+	if body := node.Child("ac:plain-text-link-body"); body != nil {
+		text = c.escape(body.TextContent())
+	} else if body := node.Child("ac:link-body"); body != nil {
+		text = strings.TrimSpace(c.inlines(body.Children))
+	}
+
+	if node.Attr("ac:anchor") != "" {
+		return c.raw(node)
+	}
+
+	if page := node.Child("ri:page"); page != nil {
+		if space := page.Attr("ri:space-key"); space != "" && space != c.space {
+			return c.raw(node)
+		}
+		title := page.Attr("ri:content-title")
+		if title == "" {
+			return c.raw(node)
+		}
+		if text == "" {
+			text = c.escape(title)
+		}
+		return "[" + text + "](" + destination("ac:"+title) + ")"
+	}
+
+	if file := node.Child("ri:attachment"); file != nil && file.Child("ri:page") == nil {
+		filename := file.Attr("ri:filename")
+		c.attach(filename)
+		if text == "" {
+			text = c.escape(filename)
+		}
+		return "[" + text + "](" + destination(filename) + ")"
+	}
+
+	return c.raw(node)
+}
+
+// image reverses <ac:image>, the output of the ac:image template.
+func (c *converter) image(node *Node) string {
+	alt := c.escape(node.Attr("ac:alt"))
+
+	title := ""
+	if value := node.Attr("ac:title"); value != "" {
+		title = ` "` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+
+	if file := node.Child("ri:attachment"); file != nil && file.Child("ri:page") == nil {
+		filename := file.Attr("ri:filename")
+		c.attach(filename)
+		return "![" + alt + "](" + destination(filename) + title + ")"
+	}
+
+	if url := node.Child("ri:url"); url != nil {
+		return "![" + alt + "](" + destination(url.Attr("ri:value")) + title + ")"
+	}
+
+	return c.raw(node)
+}
+
+// alerts maps the box macros to the GitHub alert that renders as each. The
+// mapping is not one to one -- [!IMPORTANT] renders as info too -- so the
+// alert chosen is the one that comes back as the same macro.
+var alerts = map[string]string{
+	"info":    "NOTE",
+	"tip":     "TIP",
+	"note":    "WARNING",
+	"warning": "CAUTION",
+}
+
+// macro reverses an <ac:structured-macro>. block reports whether the result
+// stands on its own rather than inside a paragraph.
+func (c *converter) macro(node *Node) (markdown string, block bool) {
+	name := node.Attr("ac:name")
+	params := parameters(node)
+
+	switch name {
+	case "code", "noformat":
+		body := ""
+		if text := node.Child("ac:plain-text-body"); text != nil {
+			body = text.TextContent()
+		}
+		return fence(codeInfo(params), body), true
+
+	case "info", "tip", "note", "warning":
+		body := node.Child("ac:rich-text-body")
+		if params["title"] != "" || body == nil {
+			break
+		}
+		inner := strings.Join(c.blocks(body.Children), "\n\n")
+		return quote("[!" + alerts[name] + "]\n" + inner), true
+
+	case "status":
+		if params["title"] == "" && params["colour"] == "" {
+			break
+		}
+		directive := "<!-- Include: ac:status\\nTitle: " + yamlQuote(params["title"]) +
+			"\\nColor: " + yamlQuote(params["colour"])
+		if params["subtle"] == "true" {
+			directive += "\\nSubtle: true"
+		}
+		return directive + " -->", false
+	}
+
+	// Anything else is kept as written. If it has a rich text body, only the
+	// wrapper stays raw and the body is converted, so that the content inside
+	// an expand or a panel remains editable as Markdown. This is the same shape
+	// the ac:expand and ac:box templates expand to.
+	if body := node.Child("ac:rich-text-body"); body != nil && len(node.Children) > 0 {
+		var open bytes.Buffer
+		open.WriteString("<" + node.Name)
+		for _, attr := range node.Attrs {
+			open.WriteString(" " + qualified(attr.Name) + `="`)
+			escapeText(&open, attr.Value)
+			open.WriteString(`"`)
+		}
+		open.WriteString(">")
+		for _, child := range node.Children {
+			if child == body {
+				break
+			}
+			open.WriteString(c.raw(child))
+		}
+		open.WriteString("<ac:rich-text-body>")
+
+		inner := strings.Join(c.blocks(body.Children), "\n\n")
+		closing := "</ac:rich-text-body></ac:structured-macro>"
+		if inner == "" {
+			return open.String() + closing, true
+		}
+		return open.String() + "\n\n" + inner + "\n\n" + closing, true
+	}
+
+	return c.raw(node), false
+}
+
+// parameters collects a macro's ac:parameter values. Parameters whose value
+// is markup rather than text -- a page link, a user -- are left out.
+func parameters(node *Node) map[string]string {
+	params := map[string]string{}
+	for _, child := range node.Children {
+		if child.Name != "ac:parameter" {
+			continue
+		}
+		simple := true
+		for _, grandchild := range child.Children {
+			if grandchild.Name != "" {
+				simple = false
+			}
+		}
+		if simple {
+			params[child.Attr("ac:name")] = child.TextContent()
+		}
+	}
+	return params
+}
+
+// codeInfo builds the info string of a fenced code block from the parameters
+// of a code macro, in the form the fenced code block renderer parses.
+func codeInfo(params map[string]string) string {
+	var options []string
+	if params["firstline"] != "" && params["firstline"] != "1" {
+		options = append(options, params["firstline"])
+	} else if params["linenumbers"] == "true" {
+		options = append(options, "linenumbers")
+	}
+	if params["collapse"] == "true" {
+		options = append(options, "collapse")
+	}
+	if params["theme"] != "" {
+		options = append(options, params["theme"])
+	}
+	if params["title"] != "" {
+		options = append(options, "title", params["title"])
+	}
+
+	lang := params["language"]
+	if lang == "" && len(options) > 0 {
+		lang = "-"
+	}
+
+	return strings.TrimSpace(lang + " " + strings.Join(options, " "))
+}
+
+func (c *converter) list(node *Node) string {
+	ordered := node.Name == "ol"
+	number := 1
+	if start, err := strconv.Atoi(node.Attr("start")); err == nil {
+		number = start
+	}
+
+	var items []string
+	for _, item := range node.Children {
+		if item.Name != "li" {
+			continue
+		}
+
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+
+		items = append(items, indent(marker, c.item(item.Children)))
+	}
+
+	return strings.Join(items, "\n")
+}
+
+// item converts the content of a list item. An item holding more than one
+// paragraph is loose and keeps blank lines between its blocks; otherwise the
+// list stays tight, which is how the editor writes it.
+func (c *converter) item(nodes []*Node) string {
+	paragraphs := 0
+	for _, node := range nodes {
+		if node.Name == "p" {
+			paragraphs++
+		}
+	}
+
+	separator := "\n"
+	if paragraphs > 1 {
+		separator = "\n\n"
+	}
+
+	return strings.Join(c.blocks(nodes), separator)
+}
+
+func (c *converter) taskList(node *Node) string {
+	var items []string
+	for _, task := range node.Children {
+		if task.Name != "ac:task" {
+			continue
+		}
+
+		marker := "- [ ] "
+		if status := task.Child("ac:task-status"); status != nil &&
+			strings.TrimSpace(status.TextContent()) == "complete" {
+			marker = "- [x] "
+		}
+
+		body := ""
+		if content := task.Child("ac:task-body"); content != nil {
+			body = c.item(content.Children)
+		}
+
+		items = append(items, indent(marker, body))
+	}
+
+	return strings.Join(items, "\n")
+}
+
+// layoutTypes are the section types the layout transformer understands.
+var layoutTypes = map[string]bool{
+	"single":              true,
+	"two_equal":           true,
+	"two_left_sidebar":    true,
+	"two_right_sidebar":   true,
+	"three":               true,
+	"three_with_sidebars": true,
+}
+
+// layout reverses <ac:layout> into the comment markers the layout transformer
+// reads. A section of a type the transformer does not know is kept raw whole.
+func (c *converter) layout(node *Node) string {
+	for _, section := range node.Children {
+		if section.Name == "ac:layout-section" && !layoutTypes[section.Attr("ac:type")] {
+			return c.raw(node)
+		}
+	}
+
+	parts := []string{"<!-- ac:layout -->"}
+	for _, section := range node.Children {
+		if section.Name != "ac:layout-section" {
+			continue
+		}
+		parts = append(parts, "<!-- ac:layout-section type:"+section.Attr("ac:type")+" -->")
+		for _, cell := range section.Children {
+			if cell.Name != "ac:layout-cell" {
+				continue
+			}
+			parts = append(parts, "<!-- ac:layout-cell -->")
+			if body := strings.Join(c.blocks(cell.Children), "\n\n"); body != "" {
+				parts = append(parts, "\n"+body+"\n")
+			}
+			parts = append(parts, "<!-- ac:layout-cell end -->")
+		}
+		parts = append(parts, "<!-- ac:layout-section end -->")
+	}
+	parts = append(parts, "<!-- ac:layout end -->")
+
+	return strings.Join(parts, "\n")
+}
+
+// table converts a table to a GFM table when it can be one: no merged cells
+// and nothing in a cell but a line of inline content. Anything else is kept as
+// raw storage, which loses no structure.
+func (c *converter) table(node *Node) string {
+	var rows [][]*Node
+	var collect func(*Node)
+	collect = func(n *Node) {
+		for _, child := range n.Children {
+			switch child.Name {
+			case "thead", "tbody", "tfoot":
+				collect(child)
+			case "tr":
+				var cells []*Node
+				for _, cell := range child.Children {
+					if cell.Name == "th" || cell.Name == "td" {
+						cells = append(cells, cell)
+					}
+				}
+				rows = append(rows, cells)
+			}
+		}
+	}
+	collect(node)
+
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return c.raw(node)
+	}
+
+	width := len(rows[0])
+	for _, row := range rows {
+		if len(row) != width {
+			return c.raw(node)
+		}
+		for _, cell := range row {
+			if !simpleCell(cell) {
+				return c.raw(node)
+			}
+		}
+	}
+
+	c.inTable = true
+	defer func() { c.inTable = false }()
+
+	var lines []string
+	for i, row := range rows {
+		var cells []string
+		for _, cell := range row {
+			content := cell.Children
+			if p := cell.Child("p"); p != nil {
+				content = p.Children
+			}
+			text := strings.TrimSpace(c.inlines(content))
+			cells = append(cells, text)
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", width))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// simpleCell reports whether a cell fits on one line of a GFM table.
+func simpleCell(cell *Node) bool {
+	if cell.Attr("colspan") != "" && cell.Attr("colspan") != "1" {
+		return false
+	}
+	if cell.Attr("rowspan") != "" && cell.Attr("rowspan") != "1" {
+		return false
+	}
+
+	paragraphs := 0
+	for _, child := range cell.Children {
+		switch child.Name {
+		case "p":
+			paragraphs++
+			for _, grandchild := range child.Children {
+				if isBlock(grandchild) {
+					return false
+				}
+			}
+		case "":
+			if paragraphs > 0 && strings.TrimSpace(child.Text) != "" {
+				return false
+			}
+		default:
+			if isBlock(child) {
+				return false
+			}
+		}
+	}
+
+	return paragraphs <= 1
+}
+
+func isBlock(node *Node) bool {
+	switch node.Name {
+	case "p", "h1", "h2", "h3", "h4", "h5", "h6", "ul", "ol", "pre",
+		"blockquote", "table", "hr", "div", "section",
+		"ac:task-list", "ac:layout", "ac:structured-macro":
+		return true
+	}
+	return false
+}
+
+// raw writes a node as storage XML on a single line, in a form that survives
+// being read as Markdown: the Confluence tag parser keeps ac: and ri: tags
+// raw, and the text between them is escaped so that nothing in it can be taken
+// for emphasis, a link or a blank line ending the paragraph.
+func (c *converter) raw(node *Node) string {
+	var b bytes.Buffer
+	render(&b, node, func(b *bytes.Buffer, text string) {
+		for _, r := range text {
+			if strings.ContainsRune("\\`*_[]!#|~", r) {
+				fmt.Fprintf(b, "&#%d;", r)
+				continue
+			}
+			escapeText(b, string(r))
+		}
+	})
+	return b.String()
+}
+
+// escape makes text safe to write as Markdown.
+func (c *converter) escape(text string) string {
+	var b strings.Builder
+	runes := []rune(text)
+	for i, r := range runes {
+		switch r {
+		case '\\', '`', '*', '[', ']', '<', '>':
+			b.WriteRune('\\')
+		case '|':
+			if c.inTable {
+				b.WriteRune('\\')
+			}
+		case '_':
+			// An underscore inside a word never starts emphasis, and escaping
+			// every one makes snake_case identifiers unreadable.
+			inWord := i > 0 && i < len(runes)-1 &&
+				isWordRune(runes[i-1]) && isWordRune(runes[i+1])
+			if !inWord {
+				b.WriteRune('\\')
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+var reBlockStart = regexp.MustCompile(`^(#{1,6}(\s|$)|[-+=]|\d+[.)](\s|$))`)
+
+// escapeLeading escapes what would make a paragraph start a heading or a list.
+func escapeLeading(text string) string {
+	if match := reBlockStart.FindString(text); match != "" {
+		if match[0] >= '0' && match[0] <= '9' {
+			digits := strings.TrimRight(match, ".) \t")
+			return digits + "\\" + text[len(digits):]
+		}
+		return "\\" + text
+	}
+	return text
+}
+
+// wrap puts emphasis markers around text. Surrounding spaces are moved outside
+// the markers, because "** bold **" is not emphasis.
+func wrap(marker, text string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	leading := text[:strings.Index(text, trimmed)]
+	trailing := text[len(leading)+len(trimmed):]
+	return leading + marker + trimmed + marker + trailing
+}
+
+func codeSpan(text string) string {
+	text = reSpace.ReplaceAllString(text, " ")
+	ticks := strings.Repeat("`", longestRun(text, '`')+1)
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		return ticks + " " + text + " " + ticks
+	}
+	return ticks + text + ticks
+}
+
+func fence(info, body string) string {
+	body = strings.TrimSuffix(body, "\n")
+	ticks := strings.Repeat("`", max(3, longestRun(body, '`')+1))
+	return ticks + info + "\n" + body + "\n" + ticks
+}
+
+func longestRun(text string, r rune) int {
+	longest, current := 0, 0
+	for _, c := range text {
+		if c == r {
+			current++
+			longest = max(longest, current)
+		} else {
+			current = 0
+		}
+	}
+	return longest
+}
+
+// destination writes a link destination, bracketing it when it contains
+// characters that would otherwise end it.
+func destination(dest string) string {
+	if strings.ContainsAny(dest, " ()<>") {
+		return "<" + strings.NewReplacer("<", `\<`, ">", `\>`).Replace(dest) + ">"
+	}
+	return dest
+}
+
+// indent prefixes the first line of text with marker and aligns the lines
+// that follow under it.
+func indent(marker, text string) string {
+	pad := strings.Repeat(" ", len(marker))
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = strings.TrimRight(marker+line, " ")
+		case line != "":
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func quote(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = ">"
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// yamlQuote writes a string as a single-quoted YAML scalar, which needs no
+// escaping but for the quote itself. Double quotes would need backslashes, and
+// an Include directive turns every \n it contains into a line break.
+func yamlQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
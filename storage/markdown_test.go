@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"testing"
+
+	markmd "github.com/kovetskiy/mark/v16/markdown"
+	"github.com/kovetskiy/mark/v16/stdlib"
+	"github.com/kovetskiy/mark/v16/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "headings and inline formatting",
+			body: `<h2>Intro</h2><p>Some <strong>bold</strong>, <em>italic</em> and <code>code</code> with a <a href="https://example.com">link</a>.</p>`,
+			want: "## Intro\n\nSome **bold**, *italic* and `code` with a [link](https://example.com).\n",
+		},
+		{
+			name: "markdown syntax in text is escaped",
+			body: `<p>1. not a list, *not emphasis*, snake_case stays</p>`,
+			want: "1\\. not a list, \\*not emphasis\\*, snake_case stays\n",
+		},
+		{
+			name: "nested lists",
+			body: `<ul><li>one</li><li>two<ol><li>a</li><li>b</li></ol></li></ul>`,
+			want: "- one\n- two\n  1. a\n  2. b\n",
+		},
+		{
+			name: "code macro",
+			body: `<ac:structured-macro ac:name="code">` +
+				`<ac:parameter ac:name="language">bash</ac:parameter>` +
+				`<ac:parameter ac:name="collapse">true</ac:parameter>` +
+				`<ac:parameter ac:name="title">Setup</ac:parameter>` +
+				`<ac:plain-text-body><![CDATA[echo "]]]]><![CDATA[>"]]></ac:plain-text-body>` +
+				`</ac:structured-macro>`,
+			want: "```bash collapse title Setup\necho \"]]>\"\n```\n",
+		},
+		{
+			name: "info macro becomes an alert",
+			body: `<ac:structured-macro ac:name="warning"><ac:parameter ac:name="icon">true</ac:parameter>` +
+				`<ac:rich-text-body><p>Mind the gap.</p></ac:rich-text-body></ac:structured-macro>`,
+			want: "> [!CAUTION]\n> Mind the gap.\n",
+		},
+		{
+			name: "status macro becomes an include",
+			body: `<p>State: <ac:structured-macro ac:name="status"><ac:parameter ac:name="colour">Green</ac:parameter>` +
+				`<ac:parameter ac:name="title">DONE</ac:parameter></ac:structured-macro></p>`,
+			want: "State: <!-- Include: ac:status\\nTitle: 'DONE'\\nColor: 'Green' -->\n",
+		},
+		{
+			name: "task list",
+			body: `<ac:task-list><ac:task><ac:task-id>1</ac:task-id><ac:task-status>complete</ac:task-status>` +
+				`<ac:task-body>ship it</ac:task-body></ac:task><ac:task><ac:task-id>2</ac:task-id>` +
+				`<ac:task-status>incomplete</ac:task-status><ac:task-body>celebrate</ac:task-body></ac:task></ac:task-list>`,
+			want: "- [x] ship it\n- [ ] celebrate\n",
+		},
+		{
+			name: "page link in the same space",
+			body: `<p><ac:link><ri:page ri:content-title="Release Notes" ri:space-key="DOCS"/>` +
+				`<ac:plain-text-link-body><![CDATA[notes]]></ac:plain-text-link-body></ac:link></p>`,
+			want: "[notes](<ac:Release Notes>)\n",
+		},
+		{
+			name: "page link in another space stays raw",
+			body: `<p><ac:link><ri:page ri:content-title="Elsewhere" ri:space-key="OPS"/></ac:link></p>`,
+			want: "<ac:link><ri:page ri:content-title=\"Elsewhere\" ri:space-key=\"OPS\"/></ac:link>\n",
+		},
+		{
+			name: "simple table",
+			body: `<table><tbody><tr><th>Key</th><th>Value</th></tr><tr><td>a|b</td><td><p>1</p></td></tr></tbody></table>`,
+			want: "| Key | Value |\n| --- | --- |\n| a\\|b | 1 |\n",
+		},
+		{
+			name: "merged cells keep the table raw",
+			body: `<table><tbody><tr><td colspan="2">wide</td></tr></tbody></table>`,
+			want: "<table><tbody><tr><td colspan=\"2\">wide</td></tr></tbody></table>\n",
+		},
+		{
+			name: "layout",
+			body: `<ac:layout><ac:layout-section ac:type="single"><ac:layout-cell><p>only</p></ac:layout-cell></ac:layout-section></ac:layout>`,
+			want: "<!-- ac:layout -->\n<!-- ac:layout-section type:single -->\n<!-- ac:layout-cell -->\n\nonly\n\n" +
+				"<!-- ac:layout-cell end -->\n<!-- ac:layout-section end -->\n<!-- ac:layout end -->\n",
+		},
+		{
+			name: "unknown macro is kept on one line",
+			body: "<ac:structured-macro ac:name=\"jira\"><ac:parameter ac:name=\"jqlQuery\">project = A_B\n\nORDER BY *</ac:parameter></ac:structured-macro>",
+			want: "<ac:structured-macro ac:name=\"jira\"><ac:parameter ac:name=\"jqlQuery\">project = A&#95;B&#xA;&#xA;ORDER BY &#42;</ac:parameter></ac:structured-macro>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ToMarkdown(tt.body, "DOCS")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, doc.Markdown)
+		})
+	}
+}
+
+func TestToMarkdownCollectsAttachments(t *testing.T) {
+	body := `<p><ac:image ac:alt="diagram"><ri:attachment ri:filename="arch.png"/></ac:image></p>` +
+		`<p><ac:link><ri:attachment ri:filename="spec.pdf"/><ac:plain-text-link-body><![CDATA[the spec]]></ac:plain-text-link-body></ac:link></p>` +
+		`<p><ac:image><ri:attachment ri:filename="arch.png"/></ac:image></p>`
+
+	doc, err := ToMarkdown(body, "DOCS")
+	require.NoError(t, err)
+
+	assert.Equal(t, "![diagram](arch.png)\n\n[the spec](spec.pdf)\n\n![](arch.png)\n", doc.Markdown)
+	assert.Equal(t, []string{"arch.png", "spec.pdf"}, doc.Attachments)
+}
+
+// TestToMarkdownRoundTrip publishes the converted Markdown again and checks
+// that the macros came back. This is the property pull exists for: a page
+// taken into the repository must not lose what cannot be written as Markdown.
+func TestToMarkdownRoundTrip(t *testing.T) {
+	body := `<ac:structured-macro ac:name="expand"><ac:parameter ac:name="title">Details</ac:parameter>` +
+		`<ac:rich-text-body><p>Hidden <strong>text</strong>.</p></ac:rich-text-body></ac:structured-macro>` +
+		`<p>Build: <ac:structured-macro ac:name="status"><ac:parameter ac:name="colour">Red</ac:parameter>` +
+		`<ac:parameter ac:name="title">FAILED</ac:parameter></ac:structured-macro></p>` +
+		"<ac:structured-macro ac:name=\"jira\"><ac:parameter ac:name=\"key\">OPS_1</ac:parameter>" +
+		"<ac:parameter ac:name=\"note\">first\n\nsecond *x*</ac:parameter></ac:structured-macro>"
+
+	doc, err := ToMarkdown(body, "DOCS")
+	require.NoError(t, err)
+
+	std, err := stdlib.New(nil)
+	require.NoError(t, err)
+
+	html, _, err := markmd.CompileMarkdown([]byte(doc.Markdown), std, "page.md", types.MarkConfig{})
+	require.NoError(t, err)
+
+	assert.Contains(t, html, `<ac:structured-macro ac:name="expand"><ac:parameter ac:name="title">Details</ac:parameter><ac:rich-text-body>`)
+	assert.Contains(t, html, `<p>Hidden <strong>text</strong>.</p>`)
+	assert.Contains(t, html, `<ac:parameter ac:name="colour">Red</ac:parameter><ac:parameter ac:name="title">FAILED</ac:parameter>`)
+	assert.Contains(t, html, `<ac:parameter ac:name="key">OPS_1</ac:parameter>`)
+	assert.Contains(t, html, "first\n\nsecond *x*")
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"slices"
+	"strings"
+)
+
+// blockElements start a line of their own in normalised output.
+var blockElements = map[string]bool{
+	"p": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "li": true, "blockquote": true, "pre": true, "hr": true, "div": true,
+	"table": true, "colgroup": true, "col": true, "thead": true, "tbody": true, "tr": true, "th": true, "td": true,
+
+	"ac:structured-macro": true, "ac:parameter": true,
+	"ac:rich-text-body": true, "ac:plain-text-body": true,
+	"ac:layout": true, "ac:layout-section": true, "ac:layout-cell": true,
+	"ac:task-list": true, "ac:task": true, "ac:task-status": true, "ac:task-body": true,
+	"ac:adf-extension": true, "ac:adf-node": true, "ac:adf-content": true,
+}
+
+// volatileAttributes are written by Confluence on save and mean nothing about
+// the content. A page mark published comes back with a fresh macro-id on every
+// macro, and leaving them in would make every such page look changed.
+var volatileAttributes = map[string]bool{
+	"ac:macro-id":        true,
+	"ac:local-id":        true,
+	"local-id":           true,
+	"ri:version-at-save": true,
+}
+
+// volatileElements likewise: Confluence numbers tasks itself.
+var volatileElements = map[string]bool{
+	"ac:task-id":   true,
+	"ac:task-uuid": true,
+}
+
+// Normalize rewrites a storage body into a canonical form for comparing two
+// bodies line by line.
+//
+// The body Confluence hands back is not the one mark sent: it is reformatted,
+// attributes are added, CDATA is re-escaped, and inline comments are wrapped
+// around the text they are on. None of that is a change anybody made, so it is
+// taken out -- attributes are sorted and the volatile ones dropped, comment
+// markers are unwrapped, whitespace between blocks is discarded -- and every
+// block element is put on a line of its own, indented by depth, so that a
+// diff of two normalised bodies points at the paragraph that changed rather
+// than at one enormous line.
+func Normalize(body string) (string, error) {
+	root, err := Parse(body)
+	if err != nil {
+		return "", err
+	}
+
+	clean(root)
+
+	var b bytes.Buffer
+	writeBlocks(&b, root.Children, 0)
+
+	return b.String(), nil
+}
+
+func clean(node *Node) {
+	var children []*Node
+	for _, child := range node.Children {
+		if volatileElements[child.Name] {
+			continue
+		}
+
+		clean(child)
+
+		if child.Name == "ac:inline-comment-marker" {
+			children = append(children, child.Children...)
+			continue
+		}
+
+		// A marker unwrapped above can leave two runs of text side by side.
+		if last := len(children) - 1; child.Name == "" && last >= 0 && children[last].Name == "" {
+			children[last] = &Node{Text: children[last].Text + child.Text}
+			continue
+		}
+
+		children = append(children, child)
+	}
+	node.Children = children
+
+	node.Attrs = slices.DeleteFunc(node.Attrs, func(attr xml.Attr) bool {
+		return volatileAttributes[qualified(attr.Name)]
+	})
+	slices.SortFunc(node.Attrs, func(a, b xml.Attr) int {
+		return strings.Compare(qualified(a.Name), qualified(b.Name))
+	})
+}
+
+// writeBlocks writes a run of siblings, each block element on a line of its
+// own and each run of inline content between them on one line.
+func writeBlocks(b *bytes.Buffer, nodes []*Node, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	var inline bytes.Buffer
+	flush := func() {
+		if text := strings.TrimSpace(inline.String()); text != "" {
+			b.WriteString(indent + text + "\n")
+		}
+		inline.Reset()
+	}
+
+	for _, node := range nodes {
+		if !blockElements[node.Name] {
+			render(&inline, node, escapeKeepingLines)
+			continue
+		}
+
+		flush()
+
+		if !hasBlocks(node) {
+			b.WriteString(indent)
+			render(b, node, escapeKeepingLines)
+			b.WriteString("\n")
+			continue
+		}
+
+		b.WriteString(indent)
+		startTag(b, node)
+		b.WriteString(">\n")
+		writeBlocks(b, node.Children, depth+1)
+		b.WriteString(indent + "</" + node.Name + ">\n")
+	}
+
+	flush()
+}
+
+// escapeKeepingLines escapes text without encoding line breaks, so that a code
+// block changed on one line is shown as one line changed.
+func escapeKeepingLines(b *bytes.Buffer, text string) {
+	b.WriteString(textEscaper.Replace(text))
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+func hasBlocks(node *Node) bool {
+	for _, child := range node.Children {
+		if blockElements[child.Name] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	// What mark sends, and what Confluence hands back for it: reformatted,
+	// with a macro id, an inline comment and the CDATA split differently.
+	sent := `<h1>Title</h1><p>Some text.</p>` +
+		`<ac:structured-macro ac:name="code" ac:schema-version="1"><ac:parameter ac:name="language">go</ac:parameter>` +
+		`<ac:plain-text-body><![CDATA[x := 1
+y := 2]]></ac:plain-text-body></ac:structured-macro>` +
+		`<ul><li>one</li><li>two</li></ul>`
+
+	stored := "<h1>Title</h1>\n<p>Some <ac:inline-comment-marker ac:ref=\"c1\">text</ac:inline-comment-marker>.</p>\n" +
+		`<ac:structured-macro ac:schema-version="1" ac:macro-id="0b6c2a" ac:name="code"><ac:parameter ac:name="language">go</ac:parameter>` +
+		"<ac:plain-text-body><![CDATA[x := 1\ny := 2]]></ac:plain-text-body></ac:structured-macro>\n" +
+		`<ul>  <li>one</li> <li>two</li></ul>`
+
+	left, err := Normalize(sent)
+	require.NoError(t, err)
+	right, err := Normalize(stored)
+	require.NoError(t, err)
+
+	assert.Equal(t, left, right)
+	assert.Equal(t, `<h1>Title</h1>
+<p>Some text.</p>
+<ac:structured-macro ac:name="code" ac:schema-version="1">
+  <ac:parameter ac:name="language">go</ac:parameter>
+  <ac:plain-text-body>x := 1
+y := 2</ac:plain-text-body>
+</ac:structured-macro>
+<ul>
+  <li>one</li>
+  <li>two</li>
+</ul>
+`, left)
+}
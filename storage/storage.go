@@ -0,0 +1,184 @@
+// Package storage reads Confluence storage format, the XHTML dialect a page
+// body is kept in, back into the Markdown mark publishes from.
+//
+// The conversion is the inverse of what the renderers and stdlib templates
+// produce, not a general HTML-to-Markdown converter: a page mark published
+// should come back as something close to the file it came from, and a page
+// written by hand in the editor should come back as something mark can publish
+// again without losing content. Whatever has no Markdown form -- a macro with
+// no counterpart, a table with merged cells -- is written out as raw storage
+// XML, which the Confluence tag parser passes through on the next publish.
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Node is an element or a run of text in a parsed storage body. Text nodes
+// have an empty Name.
+type Node struct {
+	Name     string
+	Attrs    []xml.Attr
+	Text     string
+	Children []*Node
+}
+
+// Attr returns the value of the attribute with the given qualified name, such
+// as "ac:name" or "ri:filename".
+func (n *Node) Attr(name string) string {
+	for _, attr := range n.Attrs {
+		if qualified(attr.Name) == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Child returns the first child element with the given name, or nil.
+func (n *Node) Child(name string) *Node {
+	for _, child := range n.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// TextContent is the concatenated text of the node and everything under it.
+func (n *Node) TextContent() string {
+	if n.Name == "" {
+		return n.Text
+	}
+	var b strings.Builder
+	for _, child := range n.Children {
+		b.WriteString(child.TextContent())
+	}
+	return b.String()
+}
+
+func qualified(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// autoClose lists the elements the editor may leave unclosed. It is not
+// xml.HTMLAutoClose: that compares local names only, and includes "link", so
+// every <ac:link> would be closed the moment it opened.
+var autoClose = []string{"br", "hr", "img", "col"}
+
+// Parse reads a storage body into a tree rooted at a nameless element.
+//
+// Storage format is not quite XML: the body is a fragment with several roots,
+// the ac: and ri: prefixes are never declared, and the editor writes HTML
+// entities such as &nbsp; that XML does not define. The decoder is therefore
+// run in its non-strict mode with the HTML entity table, over the body wrapped
+// in a single root. An undeclared prefix is left in Name.Space as written,
+// which is what keeps "ac:structured-macro" recognisable.
+func Parse(body string) (*Node, error) {
+	decoder := xml.NewDecoder(strings.NewReader("<mark-root>" + body + "</mark-root>"))
+	decoder.Strict = false
+	decoder.AutoClose = autoClose
+	decoder.Entity = xml.HTMLEntity
+
+	root := &Node{}
+	stack := []*Node{root}
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse storage format: %w", err)
+		}
+
+		top := stack[len(stack)-1]
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Local == "mark-root" && len(stack) == 1 {
+				continue
+			}
+			node := &Node{Name: qualified(token.Name), Attrs: token.Attr}
+			top.Children = append(top.Children, node)
+			stack = append(stack, node)
+
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case xml.CharData:
+			// Adjacent runs -- a CDATA section split to escape "]]>" -- are
+			// merged so that a code block comes back as one string.
+			if last := len(top.Children) - 1; last >= 0 && top.Children[last].Name == "" {
+				top.Children[last].Text += string(token)
+				continue
+			}
+			top.Children = append(top.Children, &Node{Text: string(token)})
+		}
+	}
+
+	return root, nil
+}
+
+// voidElements are written self-closed when rendered back to XML.
+var voidElements = map[string]bool{
+	"br": true, "hr": true, "img": true, "col": true,
+}
+
+// Render writes a node back out as storage XML.
+//
+// CDATA sections are not reproduced: their text is escaped instead, which
+// Confluence reads the same way.
+func Render(node *Node) string {
+	var b bytes.Buffer
+	render(&b, node, escapeText)
+	return b.String()
+}
+
+func escapeText(b *bytes.Buffer, text string) {
+	_ = xml.EscapeText(b, []byte(text))
+}
+
+func render(b *bytes.Buffer, node *Node, escape func(*bytes.Buffer, string)) {
+	if node.Name == "" {
+		// The root returned by Parse has children and no text.
+		escape(b, node.Text)
+		for _, child := range node.Children {
+			render(b, child, escape)
+		}
+		return
+	}
+
+	startTag(b, node)
+
+	if len(node.Children) == 0 && (voidElements[node.Name] || strings.Contains(node.Name, ":")) {
+		b.WriteString("/>")
+		return
+	}
+
+	b.WriteString(">")
+	for _, child := range node.Children {
+		render(b, child, escape)
+	}
+	b.WriteString("</" + node.Name + ">")
+}
+
+// startTag writes the opening tag of an element up to, and not including, the
+// closing bracket, which depends on whether the element has children.
+func startTag(b *bytes.Buffer, node *Node) {
+	b.WriteString("<" + node.Name)
+	for _, attr := range node.Attrs {
+		b.WriteString(" " + qualified(attr.Name) + `="`)
+		_ = xml.EscapeText(b, []byte(attr.Value))
+		b.WriteString(`"`)
+	}
+}
@@ -1,16 +1,23 @@
 package transformer
 
 import (
+	"regexp"
 	"strings"
 
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 )
 
 // GHAlertsTransformer transforms GitHub Alert syntax ([!NOTE], [!TIP], etc.)
 // into a custom AST node that can be rendered as Confluence macros
-type GHAlertsTransformer struct{}
+type GHAlertsTransformer struct {
+	// Callouts also takes Obsidian's callouts, which are GitHub's alerts with
+	// more types, a title of their own and a fold: "> [!faq]- Why?" is a
+	// question titled "Why?" that starts out folded.
+	Callouts bool
+}
 
 // NewGHAlertsTransformer creates a new GitHub Alerts transformer
 func NewGHAlertsTransformer() *GHAlertsTransformer {
@@ -33,6 +40,9 @@ func (t *GHAlertsTransformer) Transform(doc *ast.Document, reader text.Reader, p
 		// Check if this blockquote contains GitHub Alert syntax
 		alertType := t.extractAlertType(blockquote, reader)
 		if alertType == "" {
+			if t.Callouts {
+				t.transformCallout(blockquote, reader)
+			}
 			return ast.WalkContinue, nil
 		}
 
@@ -118,15 +128,8 @@ func (t *GHAlertsTransformer) splitAlertParagraph(blockquote *ast.Blockquote, pa
 	// Generate user-friendly title
 	title := strings.ToUpper(alertType[:1]) + alertType[1:]
 
-	// Create a new paragraph for the title
-	titleParagraph := ast.NewParagraph()
-	titleText := ast.NewText()
-	titleText.Segment = text.NewSegment(0, 0) // Dummy segment, we'll use attribute for content
-	titleText.SetAttribute([]byte("replacement-content"), []byte(title))
-	titleParagraph.AppendChild(titleParagraph, titleText)
-
 	// Insert the title paragraph before the current one
-	blockquote.InsertBefore(blockquote, paragraph, titleParagraph)
+	blockquote.InsertBefore(blockquote, paragraph, newTitleParagraph(title))
 
 	// Remove the first three nodes ([ !TYPE ]) from the original paragraph
 	currentNode := paragraph.FirstChild()
@@ -141,3 +144,68 @@ func (t *GHAlertsTransformer) splitAlertParagraph(blockquote *ast.Blockquote, pa
 		blockquote.RemoveChild(blockquote, paragraph)
 	}
 }
+
+// newTitleParagraph creates the paragraph an alert's title is shown in.
+func newTitleParagraph(title string) *ast.Paragraph {
+	titleParagraph := ast.NewParagraph()
+	titleText := ast.NewText()
+	titleText.Segment = text.NewSegment(0, 0) // Dummy segment, we'll use attribute for content
+	titleText.SetAttribute([]byte("replacement-content"), util.EscapeHTML([]byte(title)))
+	titleParagraph.AppendChild(titleParagraph, titleText)
+
+	return titleParagraph
+}
+
+// calloutLine is the first line of an Obsidian callout: its type, its fold and
+// its title, each but the type optional.
+var calloutLine = regexp.MustCompile(`^\[!([A-Za-z][\w-]*)\]([+-]?)[ \t]*(.*)$`)
+
+// transformCallout marks a blockquote that is an Obsidian callout the way an
+// alert is marked, and takes its first line off.
+//
+// Obsidian takes any type, and shows one it does not know as a note, so every
+// type is accepted here too. A callout that starts out folded is marked with
+// its title as well, to be rendered inside an expand macro titled with it.
+// Confluence has no expand macro that starts out open, so a callout that folds
+// but starts open ("+") is shown as an ordinary one: that is how it is first
+// seen in Obsidian.
+func (t *GHAlertsTransformer) transformCallout(blockquote *ast.Blockquote, reader text.Reader) {
+	paragraph, ok := blockquote.FirstChild().(*ast.Paragraph)
+	if !ok || paragraph.Lines().Len() == 0 {
+		return
+	}
+
+	first := paragraph.Lines().At(0)
+	match := calloutLine.FindStringSubmatch(strings.TrimRight(string(first.Value(reader.Source())), "\r\n"))
+	if match == nil {
+		return
+	}
+
+	calloutType := strings.ToLower(match[1])
+	title := strings.TrimSpace(match[3])
+	if title == "" {
+		title = strings.ToUpper(calloutType[:1]) + calloutType[1:]
+	}
+
+	blockquote.SetAttribute([]byte("gh-alert-type"), []byte(calloutType))
+
+	for node := paragraph.FirstChild(); node != nil && node.Pos() < first.Stop; {
+		next := node.NextSibling()
+		paragraph.RemoveChild(paragraph, node)
+		node = next
+	}
+	if paragraph.FirstChild() == nil {
+		blockquote.RemoveChild(blockquote, paragraph)
+	}
+
+	if match[2] == "-" {
+		blockquote.SetAttribute([]byte("gh-alert-fold"), []byte(title))
+		return
+	}
+
+	if first := blockquote.FirstChild(); first != nil {
+		blockquote.InsertBefore(blockquote, first, newTitleParagraph(title))
+	} else {
+		blockquote.AppendChild(blockquote, newTitleParagraph(title))
+	}
+}
@@ -1,14 +1,42 @@
 package types
 
+import "github.com/kovetskiy/mark/v16/diagram"
+
 type MarkConfig struct {
-	MermaidScale  float64
-	D2Scale       float64
+	MermaidScale float64
+	D2Scale      float64
+
+	// D2Theme, D2Layout and D2Sketch are how D2 diagrams are drawn, unless a
+	// block's own options say otherwise. They are kept as given, for the d2
+	// package to read; left empty they draw diagrams as they always were.
+	D2Theme  string
+	D2Layout string
+	D2Sketch bool
+
 	DropFirstH1   bool
 	StripNewlines bool
 	Features      []string
 	ImageAlign    string
 	IncludePath   string
 
+	// DiagramRenderers render the code blocks of the languages they are
+	// configured for as images, ahead of the built-in Mermaid and D2.
+	DiagramRenderers map[string]diagram.Renderer
+
+	// MermaidMode is how Mermaid diagrams are published, image or macro,
+	// unless a block's mode option says otherwise. MermaidMacroTemplate is
+	// the template a macro is written by, ac:mermaid when empty.
+	MermaidMode          string
+	MermaidMacroTemplate string
+
+	// DiagramFormat is the format diagrams are drawn in, png or svg, unless a
+	// block's format option says otherwise.
+	DiagramFormat string
+
+	// DiagramCache keeps rendered diagrams, so that one rendered before is not
+	// rendered again. Nil renders every diagram.
+	DiagramCache *diagram.Cache
+
 	// ResolveLink turns a link target written in the document -- a relative
 	// path, optionally with a #fragment -- into the Confluence link it should
 	// become, or "" to leave it as written. The text is the words between the
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	mark "github.com/kovetskiy/mark/v16"
 	"github.com/rs/zerolog"
@@ -14,70 +16,133 @@ import (
 )
 
 func RunMark(ctx context.Context, cmd *cli.Command) error {
-	if err := SetLogLevel(cmd); err != nil {
+	if err := setupLogging(cmd); err != nil {
 		return err
 	}
 
-	zerolog.TimeFieldFormat = "2006-01-02 15:04:05.000"
+	config, err := markConfig(cmd, cmd.Bool("compile-only"))
+	if err != nil {
+		return err
+	}
 
-	output := zerolog.ConsoleWriter{
-		Out:        os.Stderr,
-		TimeFormat: "2006-01-02 15:04:05.000",
-		FormatLevel: func(i any) string {
-			var l string
-			if ll, ok := i.(string); ok {
-				switch ll {
-				case "trace":
-					l = "TRACE"
-				case "debug":
-					l = "DEBUG"
-				case "info":
-					l = "INFO"
-				case "warn":
-					l = "WARNING"
-				case "error":
-					l = "ERROR"
-				case "fatal":
-					l = "FATAL"
-				case "panic":
-					l = "PANIC"
-				default:
-					l = strings.ToUpper(ll)
-				}
-			} else {
-				l = strings.ToUpper(fmt.Sprintf("%s", i))
-			}
-			return l
-		},
-		FormatFieldName: func(i any) string {
-			return ""
-		},
-		FormatFieldValue: func(i any) string {
-			return fmt.Sprintf("%s", i)
-		},
-		FormatErrFieldName: func(i any) string {
-			return ""
-		},
-		FormatErrFieldValue: func(i any) string {
-			return fmt.Sprintf("%s", i)
-		},
+	defer mark.Cleanup()
+
+	if cmd.Bool("watch") {
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return mark.Watch(ctx, config)
 	}
-	if cmd.String("color") == "never" {
-		output.NoColor = true
+
+	return mark.Run(config)
+}
+
+// RunDiff is the action of the diff command: a publish of the same files that
+// writes nothing and prints what it would have changed.
+func RunDiff(ctx context.Context, cmd *cli.Command) error {
+	if err := setupLogging(cmd); err != nil {
+		return err
+	}
+
+	config, err := markConfig(cmd, cmd.Bool("compile-only"))
+	if err != nil {
+		return err
+	}
+	config.Diff = true
+
+	defer mark.Cleanup()
+	return mark.Run(config)
+}
+
+// RunPlan is the action of the plan command: it works out what publishing the
+// files would do and saves it for apply.
+func RunPlan(ctx context.Context, cmd *cli.Command) error {
+	if err := setupLogging(cmd); err != nil {
+		return err
+	}
+
+	config, err := markConfig(cmd, cmd.Bool("compile-only"))
+	if err != nil {
+		return err
+	}
+
+	defer mark.Cleanup()
+
+	plan, err := mark.MakePlan(config)
+	if err != nil {
+		return err
+	}
+
+	path := cmd.String("out")
+	if err := plan.Save(path); err != nil {
+		return err
+	}
+
+	counts := map[string]int{}
+	for _, page := range plan.Pages {
+		counts[page.Action]++
+	}
+
+	log.Info().Msgf(
+		"plan saved to %s: %d to create, %d to update, %d unchanged",
+		path, counts[mark.ActionCreate], counts[mark.ActionUpdate], counts[mark.ActionUnchanged],
+	)
+
+	return nil
+}
+
+// RunApply is the action of the apply command. Only the flags saying how to
+// reach Confluence are read; everything else comes from the plan.
+func RunApply(ctx context.Context, cmd *cli.Command) error {
+	if err := setupLogging(cmd); err != nil {
+		return err
+	}
+
+	path := cmd.Args().First()
+	if path == "" {
+		return fmt.Errorf("no plan to apply: pass the file written by mark plan")
+	}
+
+	plan, err := mark.LoadPlan(path)
+	if err != nil {
+		return err
 	}
-	log.Logger = zerolog.New(output).With().Timestamp().Logger()
 
 	creds, err := GetCredentials(
 		cmd.String("username"),
 		cmd.String("password"),
 		cmd.String("target-url"),
 		cmd.String("base-url"),
-		cmd.Bool("compile-only"),
+		false,
 	)
 	if err != nil {
 		return err
 	}
 
+	config := plan.Config
+	config.BaseURL = creds.BaseURL
+	config.Username = creds.Username
+	config.Password = creds.Password
+	config.Output = os.Stdout
+
+	defer mark.Cleanup()
+	return mark.Apply(config, plan)
+}
+
+// markConfig reads the global flags into the configuration for a run. An
+// offline run asks nothing of Confluence, so it does without credentials.
+func markConfig(cmd *cli.Command, offline bool) (mark.Config, error) {
+	creds, err := GetCredentials(
+		cmd.String("username"),
+		cmd.String("password"),
+		cmd.String("target-url"),
+		cmd.String("base-url"),
+		offline,
+	)
+	if err != nil {
+		return mark.Config{}, err
+	}
+
 	log.Debug().Msg("config:")
 	for _, f := range cmd.Flags {
 		flag := f.Names()
@@ -103,19 +168,27 @@ func RunMark(ctx context.Context, cmd *cli.Command) error {
 		DryRun:          cmd.Bool("dry-run"),
 		ContinueOnError: cmd.Bool("continue-on-error"),
 		CI:              cmd.Bool("ci"),
+		Concurrency:     cmd.Int("concurrency"),
+		Since:           cmd.String("since"),
 
 		Space:                    cmd.String("space"),
 		Parents:                  parents,
+		ParentsFromPath:          cmd.String("parents-from-path"),
+		PathAsFolders:            cmd.Bool("path-as-folders"),
+		Nav:                      cmd.String("nav"),
 		TitleFromH1:              cmd.Bool("title-from-h1"),
 		TitleFromFilename:        cmd.Bool("title-from-filename"),
 		TitleAppendGeneratedHash: cmd.Bool("title-append-generated-hash"),
 		ContentAppearance:        cmd.String("content-appearance"),
+		SplitOn:                  cmd.String("split-on"),
 
 		MinorEdit:          cmd.Bool("minor-edit"),
 		VersionMessage:     cmd.String("version-message"),
 		EditLock:           cmd.Bool("edit-lock"),
 		ChangesOnly:        cmd.Bool("changes-only"),
 		TrackPages:         cmd.Bool("track-pages"),
+		ManifestFile:       cmd.String("manifest-file"),
+		ManifestLock:       cmd.Duration("manifest-lock"),
 		NoOverwrite:        cmd.Bool("no-overwrite"),
 		CheckLinks:         cmd.StringSlice("check-links"),
 		CheckLinksWarnOnly: cmd.Bool("check-links-warn-only"),
@@ -126,19 +199,241 @@ func RunMark(ctx context.Context, cmd *cli.Command) error {
 		OrphanUnder:        cmd.String("orphan-under"),
 		PreserveComments:   cmd.Bool("preserve-comments"),
 
-		DropH1:          cmd.Bool("drop-h1"),
-		StripLinebreaks: cmd.Bool("strip-linebreaks"),
-		MermaidScale:    cmd.Float("mermaid-scale"),
-		D2Scale:         cmd.Float("d2-scale"),
-		Features:        cmd.StringSlice("features"),
-		ImageAlign:      cmd.String("image-align"),
-		IncludePath:     cmd.String("include-path"),
+		DropH1:               cmd.Bool("drop-h1"),
+		StripLinebreaks:      cmd.Bool("strip-linebreaks"),
+		MermaidScale:         cmd.Float("mermaid-scale"),
+		D2Scale:              cmd.Float("d2-scale"),
+		D2Theme:              cmd.String("d2-theme"),
+		D2Layout:             cmd.String("d2-layout"),
+		D2Sketch:             cmd.Bool("d2-sketch"),
+		Features:             cmd.StringSlice("features"),
+		DiagramRenderers:     cmd.StringSlice("diagram-renderer"),
+		KrokiURL:             cmd.String("kroki-url"),
+		DiagramFormat:        cmd.String("diagram-format"),
+		MermaidMode:          cmd.String("mermaid-mode"),
+		MermaidMacroTemplate: cmd.String("mermaid-macro-template"),
+		CacheDir:             cmd.String("cache-dir"),
+		CacheMaxSize:         int64(cmd.Int("cache-max-size")) << 20,
+		FrontMatterMapping:   cmd.String("front-matter-mapping"),
+		ImageAlign:           cmd.String("image-align"),
+		IncludePath:          cmd.String("include-path"),
+		HTMLDir:              cmd.String("html-dir"),
 
 		Output: os.Stdout,
 	}
 
+	return config, nil
+}
+
+// RunPreview is the action of the preview command: it serves the files as web
+// pages until interrupted, without a connection to Confluence.
+func RunPreview(ctx context.Context, cmd *cli.Command) error {
+	if err := setupLogging(cmd); err != nil {
+		return err
+	}
+
+	config, err := markConfig(cmd, true)
+	if err != nil {
+		return err
+	}
+
 	defer mark.Cleanup()
-	return mark.Run(config)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return mark.Preview(ctx, config, cmd.String("listen"))
+}
+
+// RunValidate is the action of the validate command: it checks the files
+// offline, needing no credentials.
+func RunValidate(ctx context.Context, cmd *cli.Command) error {
+	if err := setupLogging(cmd); err != nil {
+		return err
+	}
+
+	config, err := markConfig(cmd, true)
+	if err != nil {
+		return err
+	}
+
+	defer mark.Cleanup()
+	return mark.Validate(config)
+}
+
+// manifestAction builds the action of a manifest subcommand, which is run with
+// exactly the arguments its usage names: those in brackets are optional, and
+// one ending in "..." may be repeated.
+//
+// Credentials are needed only to reach Confluence: a command that reads and
+// writes nothing but a manifest file can do without, and one that checks the
+// mapping against the pages cannot.
+func manifestAction(needsConfluence bool, run func(mark.Config, []string) error) cli.ActionFunc {
+	return func(ctx context.Context, cmd *cli.Command) error {
+		if err := setupLogging(cmd); err != nil {
+			return err
+		}
+
+		args := cmd.Args().Slice()
+		want := 0
+		for _, field := range strings.Fields(cmd.ArgsUsage) {
+			if !strings.HasPrefix(field, "[") {
+				want++
+			}
+		}
+		variadic := strings.HasSuffix(strings.TrimSuffix(cmd.ArgsUsage, "]"), "...")
+		if len(args) < want || (!variadic && len(args) > want) {
+			return fmt.Errorf("expected %s", cmd.ArgsUsage)
+		}
+
+		offline := !needsConfluence && cmd.String("manifest-file") != ""
+
+		config, err := markConfig(cmd, offline)
+		if err != nil {
+			return err
+		}
+
+		return run(config, args)
+	}
+}
+
+// The actions of the manifest subcommands.
+var (
+	RunManifestList = manifestAction(false, func(config mark.Config, args []string) error {
+		return mark.ListManifest(config, args[0])
+	})
+	RunManifestShow = manifestAction(false, func(config mark.Config, args []string) error {
+		return mark.ShowManifest(config, args[0], args[1])
+	})
+	RunManifestForget = manifestAction(false, func(config mark.Config, args []string) error {
+		return mark.ForgetManifest(config, args[0], args[1])
+	})
+	RunManifestSet = manifestAction(true, func(config mark.Config, args []string) error {
+		return mark.SetManifest(config, args[0], args[1], args[2])
+	})
+	RunManifestFsck = manifestAction(true, func(config mark.Config, args []string) error {
+		return mark.FsckManifest(config, args[0])
+	})
+	RunManifestAdopt = manifestAction(true, func(config mark.Config, args []string) error {
+		return mark.AdoptManifest(config, args)
+	})
+	RunManifestExport = manifestAction(true, func(config mark.Config, args []string) error {
+		return mark.ExportManifest(config, args)
+	})
+	RunManifestImport = manifestAction(true, func(config mark.Config, args []string) error {
+		return mark.ImportManifest(config, args)
+	})
+)
+
+// RunCachePrune is the action of the cache prune command: it trims the diagram
+// cache without publishing anything.
+func RunCachePrune(ctx context.Context, cmd *cli.Command) error {
+	if err := setupLogging(cmd); err != nil {
+		return err
+	}
+
+	config, err := markConfig(cmd, true)
+	if err != nil {
+		return err
+	}
+
+	return mark.PruneCache(config, cmd.Duration("max-age"))
+}
+
+// RunPull is the action of the pull command.
+func RunPull(ctx context.Context, cmd *cli.Command) error {
+	if err := setupLogging(cmd); err != nil {
+		return err
+	}
+
+	creds, err := GetCredentials(
+		cmd.String("username"),
+		cmd.String("password"),
+		cmd.String("target-url"),
+		cmd.String("base-url"),
+		false,
+	)
+	if err != nil {
+		return err
+	}
+
+	// The page can be named as an argument or, as for publishing, through the
+	// pageId of --target-url.
+	pageID := cmd.Args().First()
+	if pageID == "" {
+		pageID = creds.PageID
+	}
+
+	return mark.Pull(mark.PullConfig{
+		BaseURL:               creds.BaseURL,
+		Username:              creds.Username,
+		Password:              creds.Password,
+		InsecureSkipTLSVerify: cmd.Bool("insecure-skip-tls-verify"),
+
+		PageID:    pageID,
+		Recursive: cmd.Bool("recursive"),
+		OutputDir: cmd.String("output-dir"),
+		Overwrite: cmd.Bool("overwrite"),
+	})
+}
+
+// setupLogging applies --log-level and --color to the global logger. Every
+// command calls it first, so that all of them log the same way.
+func setupLogging(cmd *cli.Command) error {
+	if err := SetLogLevel(cmd); err != nil {
+		return err
+	}
+
+	zerolog.TimeFieldFormat = "2006-01-02 15:04:05.000"
+
+	output := zerolog.ConsoleWriter{
+		Out:        os.Stderr,
+		TimeFormat: "2006-01-02 15:04:05.000",
+		FormatLevel: func(i any) string {
+			var l string
+			if ll, ok := i.(string); ok {
+				switch ll {
+				case "trace":
+					l = "TRACE"
+				case "debug":
+					l = "DEBUG"
+				case "info":
+					l = "INFO"
+				case "warn":
+					l = "WARNING"
+				case "error":
+					l = "ERROR"
+				case "fatal":
+					l = "FATAL"
+				case "panic":
+					l = "PANIC"
+				default:
+					l = strings.ToUpper(ll)
+				}
+			} else {
+				l = strings.ToUpper(fmt.Sprintf("%s", i))
+			}
+			return l
+		},
+		FormatFieldName: func(i any) string {
+			return ""
+		},
+		FormatFieldValue: func(i any) string {
+			return fmt.Sprintf("%s", i)
+		},
+		FormatErrFieldName: func(i any) string {
+			return ""
+		},
+		FormatErrFieldValue: func(i any) string {
+			return fmt.Sprintf("%s", i)
+		},
+	}
+	if cmd.String("color") == "never" {
+		output.NoColor = true
+	}
+	log.Logger = zerolog.New(output).With().Timestamp().Logger()
+
+	return nil
 }
 
 func ConfigFilePath() string {
@@ -32,6 +32,18 @@ var Flags = []cli.Flag{
 		Usage:   "don't exit if an error occurs while processing a file, continue processing remaining files.",
 		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_CONTINUE_ON_ERROR"), altsrctoml.TOML("continue-on-error", altsrc.NewStringPtrSourcer(&filename))),
 	},
+	&cli.IntFlag{
+		Name:    "concurrency",
+		Value:   1,
+		Usage:   "publish up to this many files at once. A file whose parent is another file in the run still waits for it.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_CONCURRENCY"), altsrctoml.TOML("concurrency", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.StringFlag{
+		Name:    "since",
+		Value:   "",
+		Usage:   "publish only the files changed since this git ref, and those that include, take a macro from or attach a file that changed.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_SINCE"), altsrctoml.TOML("since", altsrc.NewStringPtrSourcer(&filename))),
+	},
 	&cli.BoolFlag{
 		Name:    "compile-only",
 		Value:   false,
@@ -44,6 +56,19 @@ var Flags = []cli.Flag{
 		Usage:   "resolve page and ancestry, show resulting HTML and exit.",
 		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_DRY_RUN"), altsrctoml.TOML("dry-run", altsrc.NewStringPtrSourcer(&filename))),
 	},
+	&cli.BoolFlag{
+		Name:    "watch",
+		Value:   false,
+		Usage:   "keep running, and publish each file again when it or anything it includes, uses or attaches changes.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_WATCH"), altsrctoml.TOML("watch", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.StringFlag{
+		Name:      "html-dir",
+		Value:     "",
+		Usage:     "with --compile-only or --dry-run, write each file's HTML into this directory instead of printing it.",
+		TakesFile: true,
+		Sources:   cli.NewValueSourceChain(cli.EnvVar("MARK_HTML_DIR"), altsrctoml.TOML("html-dir", altsrc.NewStringPtrSourcer(&filename))),
+	},
 	&cli.BoolFlag{
 		Name:    "edit-lock",
 		Value:   false,
@@ -164,6 +189,26 @@ var Flags = []cli.Flag{
 		Usage:   "A list containing the parents of the document separated by parents-delimiter (default: '/'). These will be prepended to the ones defined in the document itself.",
 		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_PARENTS"), altsrctoml.TOML("parents", altsrc.NewStringPtrSourcer(&filename))),
 	},
+	&cli.StringFlag{
+		Name:      "parents-from-path",
+		Value:     "",
+		Usage:     "use the directories between this root and each document as its parent pages. An index.md or README.md in a directory is published as that directory's page. Documents with their own Parent or Folder headers keep them.",
+		TakesFile: true,
+		Sources:   cli.NewValueSourceChain(cli.EnvVar("MARK_PARENTS_FROM_PATH"), altsrctoml.TOML("parents-from-path", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.BoolFlag{
+		Name:    "path-as-folders",
+		Value:   false,
+		Usage:   "with --parents-from-path, make each directory a Confluence Cloud folder rather than a parent page.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_PATH_AS_FOLDERS"), altsrctoml.TOML("path-as-folders", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.StringFlag{
+		Name:      "nav",
+		Value:     "",
+		Usage:     "place the documents listed in the nav section of this mkdocs.yml by it: their titles, parent pages and order.",
+		TakesFile: true,
+		Sources:   cli.NewValueSourceChain(cli.EnvVar("MARK_NAV"), altsrctoml.TOML("nav", altsrc.NewStringPtrSourcer(&filename))),
+	},
 	&cli.StringFlag{
 		Name:    "parents-delimiter",
 		Value:   "/",
@@ -179,6 +224,12 @@ var Flags = []cli.Flag{
 			altsrctoml.TOML("content-appearance", altsrc.NewStringPtrSourcer(&filename)),
 		),
 	},
+	&cli.StringFlag{
+		Name:    "split-on",
+		Value:   "",
+		Usage:   "publish each section at this heading level (h1 to h6) as a child page of its document's page, unless the document says otherwise with a Split-On header.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_SPLIT_ON"), altsrctoml.TOML("split-on", altsrc.NewStringPtrSourcer(&filename))),
+	},
 	&cli.FloatFlag{
 		Name:    "mermaid-scale",
 		Value:   1.0,
@@ -253,9 +304,21 @@ var Flags = []cli.Flag{
 	&cli.BoolFlag{
 		Name:    "track-pages",
 		Value:   false,
-		Usage:   "Remember which page each file publishes to, so renaming a file or changing its title updates the existing page instead of creating a second one. Stores the mapping in Confluence (a space property on Cloud, a homepage content property on Server/Data Center); nothing is written to the repository.",
+		Usage:   "Remember which page each file publishes to, so renaming a file or changing its title updates the existing page instead of creating a second one. Stores the mapping in Confluence (a space property on Cloud, a homepage content property on Server/Data Center) unless --manifest-file is given.",
 		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_TRACK_PAGES"), altsrctoml.TOML("track-pages", altsrc.NewStringPtrSourcer(&filename))),
 	},
+	&cli.StringFlag{
+		Name:    "manifest-file",
+		Value:   "",
+		Usage:   "keep the --track-pages mapping in this JSON file, to be committed with the documents, instead of in Confluence.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_MANIFEST_FILE"), altsrctoml.TOML("manifest-file", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.DurationFlag{
+		Name:    "manifest-lock",
+		Value:   0,
+		Usage:   "take a lock on the --track-pages mapping in Confluence for the whole run, waiting up to this long (e.g. 10m) for another run holding it to finish.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_MANIFEST_LOCK"), altsrctoml.TOML("manifest-lock", altsrc.NewStringPtrSourcer(&filename))),
+	},
 	&cli.BoolFlag{
 		Name:    "preserve-comments",
 		Value:   false,
@@ -268,13 +331,82 @@ var Flags = []cli.Flag{
 		Usage:   "defines the scaling factor for d2 renderings.",
 		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_D2_SCALE"), altsrctoml.TOML("d2-scale", altsrc.NewStringPtrSourcer(&filename))),
 	},
+	&cli.StringFlag{
+		Name:    "d2-theme",
+		Value:   "",
+		Usage:   "the theme d2 diagrams are drawn in, light or dark: an ID or a name from d2's theme catalog, e.g. 200 or dark-mauve. Grape Soda when not set. A diagram's theme= option wins over it.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_D2_THEME"), altsrctoml.TOML("d2-theme", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.StringFlag{
+		Name:    "d2-layout",
+		Value:   "dagre",
+		Usage:   "the layout engine d2 diagrams are laid out with: dagre or elk. A diagram's layout= option wins over it.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_D2_LAYOUT"), altsrctoml.TOML("d2-layout", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.BoolFlag{
+		Name:    "d2-sketch",
+		Value:   false,
+		Usage:   "draw d2 diagrams as if by hand. A diagram's sketch or nosketch option wins over it.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_D2_SKETCH"), altsrctoml.TOML("d2-sketch", altsrc.NewStringPtrSourcer(&filename))),
+	},
 
+	&cli.StringSliceFlag{
+		Name:  "diagram-renderer",
+		Usage: "render the code blocks of a language as images with a Kroki server or a command, ahead of the built-in mermaid and d2. Repeat or comma-separate any of: language=kroki, language=kroki:<type> (Kroki's name for the language, e.g. dot=kroki:graphviz) or language=command:<command> (reads the source on stdin and writes the image to stdout; {format} in it is the image format).",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_DIAGRAM_RENDERER"),
+			altsrctoml.TOML("diagram-renderer", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.StringFlag{
+		Name:    "kroki-url",
+		Value:   "",
+		Usage:   "the Kroki server that languages rendered with kroki by --diagram-renderer are sent to, e.g. https://kroki.io.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_KROKI_URL"), altsrctoml.TOML("kroki-url", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.StringFlag{
+		Name:    "mermaid-mode",
+		Value:   "image",
+		Usage:   "publish mermaid diagrams as an image rendered here, or as the macro of a Mermaid app installed in Confluence, which keeps them editable and needs no browser: image or macro. A diagram's mode=image or mode=macro option wins over it.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_MERMAID_MODE"), altsrctoml.TOML("mermaid-mode", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.StringFlag{
+		Name:      "mermaid-macro-template",
+		Value:     "ac:mermaid",
+		Usage:     "the template a mermaid macro is written by with --mermaid-mode macro: a standard library template or a file, found as an Include's is, taking .Text and .Title. Name one written for the Mermaid app installed in Confluence.",
+		TakesFile: true,
+		Sources:   cli.NewValueSourceChain(cli.EnvVar("MARK_MERMAID_MACRO_TEMPLATE"), altsrctoml.TOML("mermaid-macro-template", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.StringFlag{
+		Name:    "diagram-format",
+		Value:   "png",
+		Usage:   "draw mermaid, d2 and --diagram-renderer diagrams as png or svg. A diagram's format=svg or format=png option wins over it. SVG stays sharp at any size, and d2 needs no browser for it; some Confluence Server versions show SVG attachments poorly.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_DIAGRAM_FORMAT"), altsrctoml.TOML("diagram-format", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.StringFlag{
+		Name:      "cache-dir",
+		Value:     "",
+		Usage:     "keep rendered diagrams in this directory, so that a diagram rendered before is not rendered again -- and needs no browser -- as long as its source, scale, options and renderer stay the same.",
+		TakesFile: true,
+		Sources:   cli.NewValueSourceChain(cli.EnvVar("MARK_CACHE_DIR"), altsrctoml.TOML("cache-dir", altsrc.NewStringPtrSourcer(&filename))),
+	},
+	&cli.IntFlag{
+		Name:    "cache-max-size",
+		Value:   512,
+		Usage:   "megabytes the diagrams in --cache-dir may take up: the least recently used are removed beyond it. 0 is no limit.",
+		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_CACHE_MAX_SIZE"), altsrctoml.TOML("cache-max-size", altsrc.NewStringPtrSourcer(&filename))),
+	},
 	&cli.StringSliceFlag{
 		Name:    "features",
 		Value:   []string{"mermaid", "mention"},
-		Usage:   "Enables optional features. Current features: d2, date, details, frontmatter, html-img-tag, inline-link-card, math, mention, mermaid, mkdocsadmonitions, plantuml",
+		Usage:   "Enables optional features. Current features: chart, d2, date, details, frontmatter, html-img-tag, inline-link-card, math, mention, mermaid, mkdocsadmonitions, obsidian, plantuml",
 		Sources: cli.NewValueSourceChain(cli.EnvVar("MARK_FEATURES"), altsrctoml.TOML("features", altsrc.NewStringPtrSourcer(&filename))),
 	},
+	&cli.StringFlag{
+		Name:      "front-matter-mapping",
+		Value:     "",
+		Usage:     "read another tool's front matter keys as mark's: docusaurus, hugo, jekyll, or a YAML file mapping keys to title, order, labels, synchronized, draft or property:NAME. Requires the frontmatter feature.",
+		TakesFile: true,
+		Sources:   cli.NewValueSourceChain(cli.EnvVar("MARK_FRONT_MATTER_MAPPING"), altsrctoml.TOML("front-matter-mapping", altsrc.NewStringPtrSourcer(&filename))),
+	},
 	&cli.BoolFlag{
 		Name:    "insecure-skip-tls-verify",
 		Value:   false,
@@ -289,6 +421,57 @@ var Flags = []cli.Flag{
 	},
 }
 
+// PullFlags are the flags of the pull command, on top of the global ones that
+// say how to reach Confluence. They are not read from the configuration file:
+// they describe one pull, not a site.
+var PullFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:    "recursive",
+		Aliases: []string{"r"},
+		Usage:   "pull the page's descendants as well, each into a directory named after its parent.",
+	},
+	&cli.StringFlag{
+		Name:      "output-dir",
+		Aliases:   []string{"o"},
+		Value:     "",
+		Usage:     "write files and attachments into this directory rather than the current one.",
+		TakesFile: true,
+	},
+	&cli.BoolFlag{
+		Name:  "overwrite",
+		Usage: "replace a file that already exists instead of failing.",
+	},
+}
+
+// PlanFlags are the flags of the plan command.
+var PlanFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:      "out",
+		Aliases:   []string{"o"},
+		Value:     "mark.plan.json",
+		Usage:     "write the plan to this file.",
+		TakesFile: true,
+	},
+}
+
+// CachePruneFlags are the flags of the cache prune command.
+var CachePruneFlags = []cli.Flag{
+	&cli.DurationFlag{
+		Name:  "max-age",
+		Value: 0,
+		Usage: "also remove the diagrams not used for this long, e.g. 720h. 0 keeps them however old they are.",
+	},
+}
+
+// PreviewFlags are the flags of the preview command.
+var PreviewFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "listen",
+		Value: "127.0.0.1:8000",
+		Usage: "serve the preview on this address.",
+	},
+}
+
 // CheckFlags validates combinations and values of global flags.
 // CheckConfigFile reports a configuration file that cannot be used.
 //
@@ -0,0 +1,378 @@
+package mark
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/kovetskiy/mark/v16/attachment"
+	"github.com/kovetskiy/mark/v16/includes"
+	"github.com/kovetskiy/mark/v16/macro"
+	markmd "github.com/kovetskiy/mark/v16/markdown"
+	"github.com/kovetskiy/mark/v16/metadata"
+	"github.com/kovetskiy/mark/v16/page"
+	"github.com/kovetskiy/mark/v16/report"
+	"github.com/kovetskiy/mark/v16/stdlib"
+	"github.com/kovetskiy/mark/v16/vfs"
+)
+
+// ErrInvalid is returned by Validate when any document has a problem. The
+// problems themselves are in the report it writes.
+var ErrInvalid = errors.New("validation failed")
+
+// Validate checks every document the way a publish would read it, without
+// talking to Confluence: ignored regions, headers, includes, macros and the
+// full compile, the attachments a document declares and the files its relative
+// links lead to. It also catches two documents that would publish to the same
+// page, which a publish only finds out by one of them overwriting the other.
+//
+// It is meant for a pre-commit hook or a CI step that has no credentials, so
+// nothing is published and nothing stops at the first failure: every problem
+// is reported against the line of the file it is on, in the same formats as a
+// run's report, and ErrInvalid is returned if there were any.
+func Validate(config Config) error {
+	outputFormat, err := report.ParseFormat(config.OutputFormat)
+	if err != nil {
+		return err
+	}
+
+	if _, err := metadata.SplitLevel(config.SplitOn); err != nil {
+		return fmt.Errorf("--split-on: %w", err)
+	}
+
+	if err := config.checkDiagrams(); err != nil {
+		return err
+	}
+
+	files, err := doublestar.FilepathGlob(config.Files)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files matched")
+	}
+
+	if config.loadedFrontMatter, err = config.frontMatterMapping(); err != nil {
+		return err
+	}
+
+	std, err := stdlib.New(nil)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve standard library: %w", err)
+	}
+
+	results := report.New()
+
+	// Where each page is published from, to catch the second document that
+	// would land on it.
+	publishedFrom := map[[2]string]string{}
+
+	for _, file := range files {
+		v := &validation{file: file, config: config}
+		meta := v.check(std)
+
+		if meta != nil && meta.Space != "" && meta.Title != "" {
+			key := [2]string{meta.Space, meta.Title}
+			if first, ok := publishedFrom[key]; ok {
+				v.problem(v.lineOf(meta.Title), "page %q in space %s is also published from %s", meta.Title, meta.Space, first)
+			} else {
+				publishedFrom[key] = file
+			}
+		}
+
+		status := report.StatusValid
+		if len(v.problems) > 0 {
+			status = report.StatusInvalid
+		}
+
+		result := report.Page{File: file, Status: status}
+		if meta != nil {
+			result.Space, result.Title = meta.Space, meta.Title
+		}
+		results.AddPage(result)
+
+		for _, problem := range v.problems {
+			results.AddProblem(problem)
+		}
+	}
+
+	if err := results.Write(config.output(), outputFormat); err != nil {
+		return fmt.Errorf("unable to write report: %w", err)
+	}
+
+	if problems := len(results.Problems); problems > 0 {
+		return fmt.Errorf("%w: %d problem(s) in %d of %d file(s)",
+			ErrInvalid, problems, results.Count(report.StatusInvalid), len(files))
+	}
+
+	return nil
+}
+
+// validation is what is known about one document while it is being checked.
+type validation struct {
+	file   string
+	config Config
+
+	// source is the file as written, which is what line numbers count in.
+	source   []byte
+	problems []report.Problem
+}
+
+func (v *validation) problem(line int, format string, args ...any) {
+	v.problems = append(v.problems, report.Problem{
+		File: v.file, Line: line, Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// lineOf is the first line of the document containing text. Where a problem
+// can only be described, not pointed at, it is put on the first line.
+func (v *validation) lineOf(text string) int {
+	if text == "" {
+		return 1
+	}
+
+	index := bytes.Index(v.source, []byte(text))
+	if index < 0 {
+		return 1
+	}
+
+	return bytes.Count(v.source[:index], []byte("\n")) + 1
+}
+
+var (
+	lineNumber   = regexp.MustCompile(`\bline (\d+)\b`)
+	quotedString = regexp.MustCompile(`"((?:[^"\\]|\\.)+)"`)
+)
+
+// lineOfError finds the line an error is about: the one it names, or else the
+// first one containing something it quotes.
+func (v *validation) lineOfError(err error) int {
+	message := err.Error()
+
+	if match := lineNumber.FindStringSubmatch(message); match != nil {
+		if line, err := strconv.Atoi(match[1]); err == nil {
+			return line
+		}
+	}
+
+	for _, match := range quotedString.FindAllStringSubmatch(message, -1) {
+		quoted, err := strconv.Unquote(`"` + match[1] + `"`)
+		if err != nil {
+			quoted = match[1]
+		}
+		if quoted != v.file && bytes.Contains(v.source, []byte(quoted)) {
+			return v.lineOf(quoted)
+		}
+	}
+
+	return 1
+}
+
+// check runs everything a publish would, short of the publish, and returns the
+// document's metadata if it could be read.
+//
+// The cheap checks come first and are all made, so that one run lists
+// everything wrong that can be found without compiling. The compile comes
+// last, and only for a document nothing was found wrong with yet: it stops at
+// the first error, which would most often be one already reported.
+func (v *validation) check(std *stdlib.Lib) *metadata.Meta {
+	config := v.config
+
+	source, err := os.ReadFile(v.file)
+	if err != nil {
+		v.problem(1, "unable to read file: %s", err)
+		return nil
+	}
+	v.source = bytes.ReplaceAll(source, []byte("\r\n"), []byte("\n"))
+
+	markdown, err := metadata.StripIgnoredBlocks(v.source)
+	if err != nil {
+		line := v.lineOfError(err)
+		v.problem(line, "%s", strings.TrimPrefix(err.Error(), fmt.Sprintf("line %d: ", line)))
+		return nil
+	}
+
+	meta, markdown, err := metadata.ExtractMetaWithMapping(
+		markdown,
+		config.Space,
+		config.TitleFromH1,
+		config.TitleFromFilename,
+		v.file,
+		config.Parents,
+		config.TitleAppendGeneratedHash,
+		config.ContentAppearance,
+		slices.Contains(config.Features, "frontmatter"),
+		config.loadedFrontMatter,
+	)
+	if err != nil {
+		v.problem(v.lineOfError(err), "unable to extract metadata: %s", err)
+		return nil
+	}
+
+	markdown, err = includes.ProcessSnippets(v.file, markdown)
+	if err != nil {
+		v.problem(v.lineOfError(err), "%s", err)
+		return meta
+	}
+
+	markdown, err = includes.ProcessTables(v.file, markdown)
+	if err != nil {
+		v.problem(v.lineOfError(err), "%s", err)
+		return meta
+	}
+
+	markdown, embedded, err := includes.ProcessEmbeds(v.file, markdown)
+	if err != nil {
+		v.problem(v.lineOfError(err), "%s", err)
+		return meta
+	}
+	if meta != nil {
+		meta.Attachments = append(meta.Attachments, embedded...)
+	}
+
+	base := filepath.Dir(v.file)
+
+	switch {
+	case meta == nil && config.PageID == "":
+		v.problem(1, "no mark headers: the file would not be published")
+	case meta == nil:
+	case meta.Space == "":
+		v.problem(1, "space is not set ('Space' header is not set and '--space' option is not set)")
+	case meta.Title == "":
+		v.problem(1, "page title is not set: use the 'Title' header, "+
+			"or the --title-from-h1 / --title-from-filename flags")
+	}
+
+	if meta != nil && meta.Title != "" {
+		if _, err := splitDocument(v.file, markdown, "", meta, config); err != nil {
+			v.problem(1, "%s", err)
+		}
+	}
+
+	if meta != nil {
+		for _, name := range meta.Attachments {
+			if _, err := os.Stat(filepath.Join(base, name)); err != nil {
+				v.problem(v.lineOf(name), "attachment %q does not exist", name)
+			}
+		}
+	}
+
+	for _, name := range includes.DirectiveTargets(markdown) {
+		if std.Templates.Lookup(name) == nil {
+			if _, _, err := locateTemplate(base, config.IncludePath, name); err != nil {
+				v.problem(v.lineOf(name), "include %q does not exist", name)
+			}
+		}
+	}
+
+	for _, directive := range macro.Directives(markdown) {
+		if _, err := regexp.Compile(directive.Expr); err != nil {
+			v.problem(v.lineOf(directive.Expr), "macro pattern %q does not compile: %s", directive.Expr, err)
+		}
+
+		name := directive.Template
+		if strings.HasPrefix(name, "#") || std.Templates.Lookup(name) != nil {
+			continue
+		}
+		if _, _, err := locateTemplate(base, config.IncludePath, name); err != nil {
+			v.problem(v.lineOf(name), "macro template %q does not exist", name)
+		}
+	}
+
+	if len(v.problems) > 0 {
+		return meta
+	}
+
+	v.compile(std, meta, markdown)
+
+	return meta
+}
+
+// compile compiles the document as a publish would, with links checked against
+// the files they lead to rather than resolved to pages.
+func (v *validation) compile(std *stdlib.Lib, meta *metadata.Meta, markdown []byte) {
+	config := v.config
+	base := filepath.Dir(v.file)
+
+	lib, err := std.Clone()
+	if err != nil {
+		v.problem(1, "%s", err)
+		return
+	}
+
+	resolver := page.NewLinkResolver(
+		nil,
+		meta,
+		base,
+		config.Space,
+		config.TitleFromH1,
+		config.TitleFromFilename,
+		config.Parents,
+		config.TitleAppendGeneratedHash,
+		slices.Contains(config.Features, "frontmatter"),
+		page.NewLinkChecker(page.LinkChecks{Internal: true}),
+		includeSearchDirs(base, config.IncludePath, markdown),
+	)
+
+	resolver.ReadMeta = readMeta(config)
+
+	// Any page will do: what is being checked is that the link leads to a
+	// document that would be published, not where it is.
+	resolver.LinkTo = func(string, *metadata.Meta) string { return "#" }
+
+	resolveLink := func(target, text string) (string, error) {
+		before := len(resolver.Broken())
+		resolved, err := resolver.Resolve(target, text)
+		for _, message := range resolver.Broken()[before:] {
+			v.problem(v.lineOf(target), "%s", message)
+		}
+		return resolved, err
+	}
+
+	var declared []string
+	if meta != nil {
+		declared = meta.Attachments
+	}
+
+	attachments, err := attachment.ResolveLocalAttachments(vfs.LocalOS, base, declared)
+	if err != nil {
+		v.problem(1, "unable to locate attachments: %s", err)
+		return
+	}
+
+	imageAlign, err := getImageAlign(config.ImageAlign, meta)
+	if err != nil {
+		v.problem(v.lineOf("Image-Align"), "unable to determine image-align: %s", err)
+		return
+	}
+
+	cfg := config.markConfig(imageAlign, resolveLink, attachment.NewResolver(attachments).Resolve)
+	_, _, err = markmd.CompileMarkdown(markdown, lib, v.file, cfg)
+	if err != nil {
+		v.problem(v.lineOfError(err), "unable to compile markdown: %s", err)
+	}
+}
+
+// locateTemplate finds the file an include or a macro names: beside the
+// document, or failing that under the include path, which is where the
+// compile looks for it too.
+func locateTemplate(base, includePath, name string) (string, []byte, error) {
+	path := filepath.Join(base, name)
+
+	body, err := os.ReadFile(path)
+	if err != nil && includePath != "" {
+		fallback := filepath.Join(includePath, name)
+		if fallbackBody, fallbackErr := os.ReadFile(fallback); fallbackErr == nil {
+			return fallback, fallbackBody, nil
+		}
+	}
+
+	return path, body, err
+}
@@ -0,0 +1,285 @@
+package mark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/kovetskiy/mark/v16/confluence"
+	"github.com/kovetskiy/mark/v16/includes"
+	"github.com/kovetskiy/mark/v16/macro"
+	"github.com/kovetskiy/mark/v16/stdlib"
+	"github.com/rs/zerolog/log"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// watchInterval is how often a watch looks for changes. Files are polled
+// rather than subscribed to: a save is noticed within half a second either
+// way, and polling behaves the same on every filesystem mark runs on,
+// network mounts and containers included.
+var watchInterval = 500 * time.Millisecond
+
+// stamp is what a watch remembers about a file to notice it changing. A file
+// that does not exist has the zero stamp, so it appearing is a change too.
+type stamp struct {
+	modified time.Time
+	size     int64
+}
+
+// Watch publishes the files as Run does, then keeps publishing them again as
+// they change until ctx is done.
+//
+// Only the documents a change affects are published again: a document is
+// affected by a change to itself, to an attachment it declares or an image it
+// shows, and to any template it includes or takes a macro from. A document
+// that appears is published; one that disappears is left alone, since a
+// watch only ever sees part of what a full run would, and removing pages is
+// not something to do on a half-view.
+//
+// The standard library is built once, and the mermaid and d2 renderers are
+// started once and stay warm between publishes. A publish that fails is
+// logged and the watch goes on: the next save is usually the fix.
+func Watch(ctx context.Context, config Config) error {
+	if config.Diff {
+		return errors.New("--watch cannot be used with diff: a diff is a single look, not a session")
+	}
+
+	api := confluence.NewAPI(config.BaseURL, config.Username, config.Password, config.InsecureSkipTLSVerify)
+
+	std, err := stdlib.New(api)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve standard library: %w", err)
+	}
+
+	// Each publish compiles with a copy, because compiling adds what a
+	// document includes to the library it is given -- and a library that had
+	// kept the last publish's includes would keep publishing them unchanged.
+	publish := func(only []string) {
+		lib, err := std.Clone()
+		if err == nil {
+			err = run(config, lib, only)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("publishing failed; watching for the next change")
+		}
+	}
+
+	documents := map[string][]string{}
+	watched := func() []string {
+		var paths []string
+		for _, deps := range documents {
+			paths = append(paths, deps...)
+		}
+		slices.Sort(paths)
+		return slices.Compact(paths)
+	}
+
+	files, err := doublestar.FilepathGlob(config.Files)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		documents[file] = dependencies(file, config, std)
+	}
+	stamps := takeStamps(watched())
+
+	publish(nil)
+
+	log.Info().Msgf("watching %d document(s) for changes", len(documents))
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		files, err := doublestar.FilepathGlob(config.Files)
+		if err != nil {
+			log.Error().Err(err).Msgf("unable to match %s", config.Files)
+			continue
+		}
+
+		current := takeStamps(watched())
+
+		var affected []string
+		for _, file := range files {
+			deps, known := documents[file]
+			if !known || slices.ContainsFunc(deps, func(path string) bool {
+				return current[path] != stamps[path]
+			}) {
+				affected = append(affected, file)
+			}
+		}
+
+		for file := range documents {
+			if !slices.Contains(files, file) {
+				log.Info().Msgf("%s is gone; its page is left as it is", file)
+				delete(documents, file)
+			}
+		}
+
+		stamps = current
+		if len(affected) == 0 {
+			continue
+		}
+
+		// Looked at again before publishing: what a document pulls in is
+		// exactly what an edit to it is likely to have changed.
+		for _, file := range affected {
+			documents[file] = dependencies(file, config, std)
+		}
+		stamps = takeStamps(watched())
+
+		log.Info().Msgf("%d document(s) changed: %s", len(affected), strings.Join(affected, ", "))
+		publish(affected)
+	}
+}
+
+// takeStamps stamps each path.
+func takeStamps(paths []string) map[string]stamp {
+	stamps := make(map[string]stamp, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = stamp{modified: info.ModTime(), size: info.Size()}
+		} else {
+			stamps[path] = stamp{}
+		}
+	}
+	return stamps
+}
+
+// dependencies lists the files a document is built from: the document, the
+// files it embeds and takes snippets and tables from, the attachments it declares, the
+// local images it shows, and every template it
+// includes or takes a macro from, including those pulled in by the templates
+// themselves, and -- with the obsidian feature -- the notes and images it
+// embeds.
+//
+// Templates are found the way compiling finds them: one the standard library
+// has is no file at all, and others are looked for beside the document first
+// and then under the include path. One found in neither is listed where it
+// would be beside the document, so that creating it counts as a change. A
+// document that cannot be read depends on itself and the files it names
+// outright alone; publishing says what is wrong with it, and a save is what
+// will put it right.
+func dependencies(file string, config Config, std *stdlib.Lib) []string {
+	deps := []string{file}
+
+	// The document as read has its embeds, snippets and tables in it already;
+	// the files they came from are only to be found in the files as written.
+	// They are listed even when the document cannot be read, which is what one
+	// that is not there yet does to it.
+	if source, err := os.ReadFile(file); err == nil {
+		embedded := includes.EmbedFiles(file, source)
+		deps = append(deps, includes.SnippetFiles(file, source)...)
+		deps = append(deps, includes.TableFiles(file, source)...)
+		for _, name := range embedded {
+			deps = append(deps, name)
+			if source, err := os.ReadFile(name); err == nil {
+				deps = append(deps, includes.SnippetFiles(name, source)...)
+				deps = append(deps, includes.TableFiles(name, source)...)
+			}
+		}
+	}
+
+	markdown, _, meta, err := readDocument(file, config)
+	if err != nil {
+		return deps
+	}
+
+	base := filepath.Dir(file)
+
+	if meta != nil {
+		for _, name := range meta.Attachments {
+			deps = append(deps, filepath.Join(base, name))
+		}
+	}
+
+	for _, name := range localImages(markdown) {
+		deps = append(deps, filepath.Join(base, name))
+	}
+
+	if slices.Contains(config.Features, "obsidian") {
+		deps = embeddedFiles(deps, base, markdown)
+	}
+
+	pending := [][]byte{markdown}
+	for len(pending) > 0 {
+		contents := pending[0]
+		pending = pending[1:]
+
+		for _, name := range append(includes.DirectiveTargets(contents), macro.TemplateFiles(contents)...) {
+			if std.Templates.Lookup(name) != nil {
+				continue
+			}
+
+			path, body, err := locateTemplate(base, config.IncludePath, name)
+			if slices.Contains(deps, path) {
+				continue
+			}
+			deps = append(deps, path)
+
+			if err == nil {
+				pending = append(pending, body)
+			}
+		}
+	}
+
+	return deps
+}
+
+// embeddedFiles adds the files a document embeds with Obsidian's ![[...]] to
+// deps, and the files those notes embed in turn.
+func embeddedFiles(deps []string, dir string, markdown []byte) []string {
+	for _, name := range includes.ObsidianEmbedTargets(markdown) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if slices.Contains(deps, path) {
+			continue
+		}
+		deps = append(deps, path)
+
+		if !strings.HasSuffix(path, ".md") {
+			continue
+		}
+		if body, err := os.ReadFile(path); err == nil {
+			deps = embeddedFiles(deps, filepath.Dir(path), body)
+		}
+	}
+
+	return deps
+}
+
+// localImages lists the images a document shows from files beside it, as the
+// paths it writes them with.
+func localImages(markdown []byte) []string {
+	var images []string
+
+	document := goldmark.DefaultParser().Parse(text.NewReader(markdown))
+	_ = ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		image, ok := node.(*ast.Image)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+
+		destination := string(image.Destination)
+		if destination != "" && !strings.Contains(destination, "://") && !strings.HasPrefix(destination, "data:") {
+			images = append(images, destination)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return images
+}